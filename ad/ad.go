@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/url"
-	"sort"
 	"strings"
 	"time"
 
@@ -23,6 +22,7 @@ type Ad struct {
 	Price         float64    `json:"price" db:"price"`
 	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
 	DeletedAt     *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty" db:"updated_at"`
 	SubCategoryID int        `json:"subcategory_id" db:"subcategory_id"`
 	UserID        int        `json:"user_id" db:"user_id"`
 	ImageCount    int        `json:"image_count" db:"image_count"`
@@ -31,6 +31,18 @@ type Ad struct {
 	LastClickedAt *time.Time `json:"last_clicked_at,omitempty" db:"last_clicked_at"`
 	HasVector     bool       `json:"has_vector" db:"has_vector"`
 
+	// Structured part attributes
+	Condition  string  `json:"condition,omitempty" db:"condition"`
+	PartNumber string  `json:"part_number,omitempty" db:"part_number"`
+	Quantity   int     `json:"quantity" db:"quantity"`
+	Position   string  `json:"position,omitempty" db:"position"`
+	CoreCharge float64 `json:"core_charge,omitempty" db:"core_charge"`
+
+	// Set while a sale is pending, e.g. after the seller accepts an offer
+	PendingAt *time.Time `json:"pending_at,omitempty" db:"pending_at"`
+	// Set while moderators keep the ad out of public view
+	HiddenAt *time.Time `json:"hidden_at,omitempty" db:"hidden_at"`
+
 	// Computed/derived fields from joins
 	City        sql.NullString  `json:"city,omitempty" db:"city"`
 	AdminArea   sql.NullString  `json:"admin_area,omitempty" db:"admin_area"`
@@ -46,72 +58,38 @@ type Ad struct {
 	Models  []string `json:"models" db:"models"`
 	Engines []string `json:"engines" db:"engines"`
 
+	// All fitment groups; Make/Years/Models/Engines mirror the first one
+	Fitment []FitmentGroup `json:"fitment,omitempty" db:"-"`
+
+	// Image manifest in display order, loaded by GetAdsByIDs
+	Images []Image `json:"images,omitempty" db:"-"`
+
 	// User-specific computed fields
 	Bookmarked bool `json:"bookmarked" db:"is_bookmarked"`
 }
 
+// LastChanged returns when the ad last changed, which is when it was
+// created for ads that haven't changed since
+func (a Ad) LastChanged() time.Time {
+	if a.UpdatedAt != nil && a.UpdatedAt.After(a.CreatedAt) {
+		return *a.UpdatedAt
+	}
+	return a.CreatedAt
+}
+
 // IsArchived returns true if the ad has been archived
 func (a Ad) IsArchived() bool {
 	return a.DeletedAt != nil
 }
 
-// GetVehicleData retrieves vehicle information for an ad
-func GetVehicleData(adID int) (makeName string, years []string, models []string, engines []string) {
-	query := `
-		SELECT DISTINCT m.name, y.year, mo.name, e.name
-		FROM AdCar ac
-		JOIN Car c ON ac.car_id = c.id
-		JOIN Make m ON c.make_id = m.id
-		JOIN Year y ON c.year_id = y.id
-		JOIN Model mo ON c.model_id = mo.id
-		JOIN Engine e ON c.engine_id = e.id
-		WHERE ac.ad_id = ?
-		ORDER BY m.name, y.year, mo.name, e.name
-	`
-
-	rows, err := db.Query(query, adID)
-	if err != nil {
-		return "", nil, nil, nil
-	}
-	defer rows.Close()
-
-	makeSet := make(map[string]bool)
-	yearSet := make(map[string]bool)
-	modelSet := make(map[string]bool)
-	engineSet := make(map[string]bool)
-
-	for rows.Next() {
-		var makeName, modelName, engineName string
-		var year int
-		if err := rows.Scan(&makeName, &year, &modelName, &engineName); err != nil {
-			continue
-		}
-		makeSet[makeName] = true
-		yearSet[fmt.Sprintf("%d", year)] = true
-		modelSet[modelName] = true
-		engineSet[engineName] = true
-	}
-
-	// Convert sets to slices
-	makes := make([]string, 0, len(makeSet))
-	for m := range makeSet {
-		makes = append(makes, m)
-	}
-	sort.Strings(makes)
-	if len(makes) > 0 {
-		makeName = makes[0]
-	}
-	for y := range yearSet {
-		years = append(years, y)
-	}
-	for m := range modelSet {
-		models = append(models, m)
-	}
-	for e := range engineSet {
-		engines = append(engines, e)
-	}
+// IsHidden returns true if moderators have hidden the ad
+func (a Ad) IsHidden() bool {
+	return a.HiddenAt != nil
+}
 
-	return makeName, years, models, engines
+// IsPending returns true if a sale of the ad is pending
+func (a Ad) IsPending() bool {
+	return a.PendingAt != nil
 }
 
 // buildAdQuery builds the complete query for fetching ads with IDs and user context
@@ -124,6 +102,7 @@ func buildAdQuery(ids []int, currentUser *user.User) (string, []interface{}) {
 		query = `
 			SELECT a.id, a.title, a.description, a.price, a.created_at, a.subcategory_id,
 			       a.user_id, psc.name as subcategory, pc.name as category, a.click_count, a.last_clicked_at, a.location_id, a.image_count,
+			       a.condition, a.part_number, a.quantity, a.position, a.core_charge, a.pending_at, a.hidden_at, a.updated_at,
 			       l.city, l.admin_area, l.country, l.latitude, l.longitude,
 			       CASE WHEN ba.ad_id IS NOT NULL THEN 1 ELSE 0 END as is_bookmarked
 			FROM Ad a
@@ -131,21 +110,23 @@ func buildAdQuery(ids []int, currentUser *user.User) (string, []interface{}) {
 			LEFT JOIN PartCategory pc ON psc.category_id = pc.id
 			LEFT JOIN Location l ON a.location_id = l.id
 			LEFT JOIN BookmarkedAd ba ON a.id = ba.ad_id AND ba.user_id = ?
-			WHERE a.deleted_at IS NULL
+			WHERE a.deleted_at IS NULL AND (a.hidden_at IS NULL OR a.user_id = ? OR ?)
 		`
-		args = append(args, currentUser.ID)
+		// Hidden ads stay visible to their seller and to admins
+		args = append(args, currentUser.ID, currentUser.ID, currentUser.IsAdmin)
 	} else {
 		// Query without bookmark status (default to false)
 		query = `
 			SELECT a.id, a.title, a.description, a.price, a.created_at, a.subcategory_id,
 			       a.user_id, psc.name as subcategory, pc.name as category, a.click_count, a.last_clicked_at, a.location_id, a.image_count,
+			       a.condition, a.part_number, a.quantity, a.position, a.core_charge, a.pending_at, a.hidden_at, a.updated_at,
 			       l.city, l.admin_area, l.country, l.latitude, l.longitude,
 			       0 as is_bookmarked
 			FROM Ad a
 			LEFT JOIN PartSubCategory psc ON a.subcategory_id = psc.id
 			LEFT JOIN PartCategory pc ON psc.category_id = pc.id
 			LEFT JOIN Location l ON a.location_id = l.id
-			WHERE a.deleted_at IS NULL
+			WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL
 		`
 	}
 
@@ -178,118 +159,138 @@ func GetAdWithVehicle(id int, currentUser *user.User) (Ad, bool) {
 	}
 
 	// Get vehicle data
-	ad.Make, ad.Years, ad.Models, ad.Engines = GetVehicleData(id)
+	ad.SetFitment(GetVehicleData(id))
 
 	return ad, true
 }
 
-func AddAd(ad Ad) int {
+// AddAd inserts a new ad and resolves its fitment groups, returning the new
+// ad ID and how the fitment matched the vehicle catalog
+func AddAd(ad Ad) (int, FitmentReport, error) {
 	tx, err := db.Begin()
 	if err != nil {
-		return 0
+		return 0, FitmentReport{}, err
 	}
 	defer tx.Rollback()
 
-	createdAt := time.Now().UTC().Format(time.RFC3339)
-	res, err := tx.Exec("INSERT INTO Ad (title, description, price, created_at, subcategory_id, user_id, location_id, image_count) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		ad.Title, ad.Description, ad.Price, createdAt, ad.SubCategoryID, ad.UserID, ad.LocationID, ad.ImageCount)
+	createdAt := time.Now().UTC().Format(time.RFC3339Nano)
+	res, err := tx.Exec(`INSERT INTO Ad (title, description, price, created_at, updated_at, subcategory_id, user_id, location_id, image_count,
+		condition, part_number, quantity, position, core_charge) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ad.Title, ad.Description, ad.Price, createdAt, createdAt, ad.SubCategoryID, ad.UserID, ad.LocationID, ad.ImageCount,
+		ad.Condition, ad.PartNumber, ad.Quantity, ad.Position, ad.CoreCharge)
 	if err != nil {
-		return 0
+		return 0, FitmentReport{}, err
 	}
 	adID, _ := res.LastInsertId()
 
-	if err := addAdVehicleAssociations(tx, int(adID), ad.Make, ad.Years, ad.Models, ad.Engines); err != nil {
-		return 0
+	if err := recordPriceChange(tx, int(adID), ad.Price, createdAt); err != nil {
+		return 0, FitmentReport{}, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return 0
+	report, err := addAdVehicleAssociations(tx, int(adID), ad.FitmentGroups())
+	if err != nil {
+		return 0, report, err
 	}
 
-	return int(adID)
-}
-
-// addAdVehicleAssociations creates the normalized vehicle associations for an ad
-func addAdVehicleAssociations(tx *sql.Tx, adID int, makeName string, years []string, models []string, engines []string) error {
-	if makeName == "" && len(years) == 0 && len(models) == 0 && len(engines) == 0 {
-		return nil
-	}
-	for _, yearStr := range years {
-		for _, modelName := range models {
-			for _, engineName := range engines {
-				var carID int
-				err := tx.QueryRow(`
-					SELECT c.id FROM Car c
-					JOIN Make m ON c.make_id = m.id
-					JOIN Year y ON c.year_id = y.id
-					JOIN Model mo ON c.model_id = mo.id
-					JOIN Engine e ON c.engine_id = e.id
-					WHERE m.name = ? AND y.year = ? AND mo.name = ? AND e.name = ?
-				`, makeName, yearStr, modelName, engineName).Scan(&carID)
-				if err != nil {
-					if err == sql.ErrNoRows {
-						return fmt.Errorf("car not found for make=%s, year=%s, model=%s, engine=%s", makeName, yearStr, modelName, engineName)
-					}
-					return fmt.Errorf("error looking up car: %w", err)
-				}
-
-				_, err = tx.Exec("INSERT OR IGNORE INTO AdCar (ad_id, car_id) VALUES (?, ?)", adID, carID)
-				if err != nil {
-					return fmt.Errorf("error inserting AdCar association: %w", err)
-				}
-			}
-		}
+	if err := tx.Commit(); err != nil {
+		return 0, report, err
 	}
-	return nil
+
+	return int(adID), report, nil
 }
 
-// UpdateAd updates an existing ad
-func UpdateAd(ad Ad) error {
+// UpdateAd updates an existing ad, recording any price change in its history
+// and re-resolving its fitment groups
+func UpdateAd(ad Ad) (FitmentReport, error) {
 	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return FitmentReport{}, err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec("UPDATE Ad SET title = ?, description = ?, price = ?, subcategory_id = ?, location_id = ?, image_count = ? WHERE id = ?",
-		ad.Title, ad.Description, ad.Price, ad.SubCategoryID, ad.LocationID, ad.ImageCount, ad.ID)
+	if err := seedPriceHistory(tx, ad.ID); err != nil {
+		return FitmentReport{}, err
+	}
+
+	// image_count is left alone: it only grows as uploaded images finish
+	// processing
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	_, err = tx.Exec(`UPDATE Ad SET title = ?, description = ?, price = ?, subcategory_id = ?, location_id = ?,
+		condition = ?, part_number = ?, quantity = ?, position = ?, core_charge = ?, updated_at = ? WHERE id = ?`,
+		ad.Title, ad.Description, ad.Price, ad.SubCategoryID, ad.LocationID,
+		ad.Condition, ad.PartNumber, ad.Quantity, ad.Position, ad.CoreCharge, now, ad.ID)
 	if err != nil {
-		return err
+		return FitmentReport{}, err
+	}
+
+	if err := recordPriceChange(tx, ad.ID, ad.Price, now); err != nil {
+		return FitmentReport{}, err
 	}
 
 	// First, remove existing vehicle associations for this ad
 	_, err = tx.Exec("DELETE FROM AdCar WHERE ad_id = ?", ad.ID)
 	if err != nil {
-		return err
+		return FitmentReport{}, err
 	}
 
 	// Then, add the new ones
-	if ad.Make != "" || len(ad.Years) > 0 || len(ad.Models) > 0 || len(ad.Engines) > 0 {
-		if err := addAdVehicleAssociations(tx, ad.ID, ad.Make, ad.Years, ad.Models, ad.Engines); err != nil {
-			return err
-		}
+	report, err := addAdVehicleAssociations(tx, ad.ID, ad.FitmentGroups())
+	if err != nil {
+		return report, err
 	}
 
-	return tx.Commit()
+	return report, tx.Commit()
 }
 
 // ArchiveAd archives an ad using soft delete
 func ArchiveAd(id int) error {
-	_, err := db.Exec("UPDATE Ad SET deleted_at = ? WHERE id = ?",
-		time.Now().UTC().Format(time.RFC3339Nano), id)
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	_, err := db.Exec("UPDATE Ad SET deleted_at = ?, updated_at = ? WHERE id = ?", now, now, id)
 	return err
 }
 
-// RestoreAd restores an archived ad by clearing the deleted_at field
-func RestoreAd(adID int) error {
-	_, err := db.Exec("UPDATE Ad SET deleted_at = NULL WHERE id = ?", adID)
+// MarkAdPending marks an ad as having a pending sale
+func MarkAdPending(adID int) error {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	_, err := db.Exec("UPDATE Ad SET pending_at = ?, updated_at = ? WHERE id = ? AND pending_at IS NULL", now, now, adID)
 	return err
 }
 
+// ClearAdPending puts a pending ad back on the market
+func ClearAdPending(adID int) error {
+	_, err := db.Exec("UPDATE Ad SET pending_at = NULL, updated_at = ? WHERE id = ?",
+		time.Now().UTC().Format(time.RFC3339Nano), adID)
+	return err
+}
+
+// RestoreAd restores an archived ad by clearing the deleted_at field. An ad
+// past config.AdExpiry is renewed as well, or it would expire again at the
+// next sweep.
+func RestoreAd(adID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := seedPriceHistory(tx, adID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	ts := now.Format(time.RFC3339Nano)
+	if _, err := tx.Exec(`UPDATE Ad SET deleted_at = NULL, updated_at = ?,
+		created_at = CASE WHEN created_at <= ? THEN ? ELSE created_at END WHERE id = ?`,
+		ts, expiryCutoff(now), ts, adID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // ArchiveAdsByUserID archives all ads for a specific user
 func ArchiveAdsByUserID(userID int) error {
-	_, err := db.Exec("UPDATE Ad SET deleted_at = ? WHERE user_id = ? AND deleted_at IS NULL",
-		time.Now().UTC().Format(time.RFC3339Nano), userID)
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	_, err := db.Exec("UPDATE Ad SET deleted_at = ?, updated_at = ? WHERE user_id = ? AND deleted_at IS NULL",
+		now, now, userID)
 	return err
 }
 
@@ -306,6 +307,13 @@ func GetAdsByIDs(ids []int, currentUser *user.User) ([]Ad, error) {
 	if err != nil {
 		return nil, err
 	}
+	images, err := getImagesForAds(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ads {
+		ads[i].Images = images[ads[i].ID]
+	}
 
 	// For single ID, just return the first result directly
 	if len(ids) == 1 {
@@ -343,13 +351,14 @@ func GetMostPopularAds(n int) []Ad {
 		SELECT 
 			a.id, a.title, a.description, a.price, a.created_at, 
 			a.subcategory_id, a.user_id, psc.name as subcategory, pc.name as category, a.click_count, a.last_clicked_at, a.location_id, a.image_count,
+			a.condition, a.part_number, a.quantity, a.position, a.core_charge, a.pending_at,
 			l.city, l.admin_area, l.country, l.latitude, l.longitude,
 			0 as is_bookmarked
 		FROM Ad a
 		LEFT JOIN PartSubCategory psc ON a.subcategory_id = psc.id
 		LEFT JOIN PartCategory pc ON psc.category_id = pc.id
 		LEFT JOIN Location l ON a.location_id = l.id
-		WHERE a.deleted_at IS NULL
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL
 		ORDER BY (
 			a.click_count * 2 + 
 			COALESCE((SELECT COUNT(*) FROM BookmarkedAd ba WHERE ba.ad_id = a.id), 0) * 3 + 
@@ -367,7 +376,7 @@ func GetMostPopularAds(n int) []Ad {
 
 	// Get vehicle data for each ad
 	for i := range ads {
-		ads[i].Make, ads[i].Years, ads[i].Models, ads[i].Engines = GetVehicleData(ads[i].ID)
+		ads[i].SetFitment(GetVehicleData(ads[i].ID))
 	}
 
 	log.Printf("[GetMostPopularAds] Found %d ads from SQL query", len(ads))
@@ -400,7 +409,7 @@ func getAdIDsForTreeCriteria(adIDs []int, makeName, year, model, engine, categor
 		JOIN Year y ON c.year_id = y.id
 		JOIN Model mo ON c.model_id = mo.id
 		JOIN Engine e ON c.engine_id = e.id
-		WHERE a.deleted_at IS NULL
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL
 	`
 
 	// Add tree criteria filters
@@ -470,6 +479,21 @@ func GetAdsForAll(makeName, year, model, engine, category, subcategory string) (
 	return GetAdsByIDs(filteredIDs, nil) // user will be passed in actual usage
 }
 
+// GetAdsPageForAll returns one page of the ads for a make/year/model/engine/
+// category/subcategory, newest first, and how many ads there are in all.
+// Empty criteria match everything.
+func GetAdsPageForAll(makeName, year, model, engine, category, subcategory string, offset, limit int) ([]Ad, int, error) {
+	ids, err := getAdIDsForTreeCriteria(nil, makeName, year, model, engine, category, subcategory)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset >= len(ids) {
+		return nil, len(ids), nil
+	}
+	ads, err := GetAdsByIDs(ids[offset:min(offset+limit, len(ids))], nil)
+	return ads, len(ids), err
+}
+
 // GetAdsForAdIDs returns ads for a specific make/year/model/engine/category/subcategory, filtered by ad IDs
 func GetAdsForAdIDs(adIDs []int, makeName, year, model, engine, category, subcategory string) ([]Ad, error) {
 	if len(adIDs) == 0 {
@@ -7,6 +7,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/db/dbtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -150,6 +151,18 @@ func TestBookmarkAd(t *testing.T) {
 	mock.ExpectExec("INSERT OR IGNORE INTO BookmarkedAd \\(user_id, ad_id\\) VALUES \\(\\?, \\?\\)").
 		WithArgs(1, 1).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	// The seller's webhooks hear about the new bookmark
+	mock.ExpectQuery("SELECT a.user_id, \\(SELECT COUNT\\(\\*\\) FROM BookmarkedAd b WHERE b.ad_id = a.id\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "count"}).AddRow(2, 3))
+	mock.ExpectQuery("SELECT w.id, w.events FROM Webhook w").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "events"}).AddRow(5, "ad.bookmarked"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO WebhookDelivery").
+		WithArgs(5, "ad.bookmarked", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	err = BookmarkAd(1, 1)
 
@@ -157,6 +170,18 @@ func TestBookmarkAd(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestBookmarkAd_AlreadyBookmarked(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// Nothing is sent for a bookmark the user already had
+	mock.ExpectExec("INSERT OR IGNORE INTO BookmarkedAd").
+		WithArgs(1, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, BookmarkAd(1, 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUnbookmarkAd(t *testing.T) {
 	mockDB, mock, err := sqlmock.New()
 	require.NoError(t, err)
@@ -249,8 +274,8 @@ func TestArchiveAd(t *testing.T) {
 	adID := 123
 
 	// Mock UPDATE to set deleted_at (soft delete)
-	mock.ExpectExec("UPDATE Ad SET deleted_at = \\? WHERE id = \\?").
-		WithArgs(sqlmock.AnyArg(), adID).
+	mock.ExpectExec("UPDATE Ad SET deleted_at = \\?, updated_at = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), adID).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	// Call ArchiveAd
@@ -261,3 +286,18 @@ func TestArchiveAd(t *testing.T) {
 	err = mock.ExpectationsWereMet()
 	require.NoError(t, err)
 }
+
+func TestGetAdsPageForAll_PastTheEnd(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// Engine is left open, so it isn't filtered on
+	mock.ExpectQuery("SELECT DISTINCT a.id").
+		WithArgs("Ford", "2005", "F-150", "Electrical").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(2).AddRow(1))
+
+	ads, total, err := GetAdsPageForAll("Ford", "2005", "F-150", "", "Electrical", "", 24, 24)
+	require.NoError(t, err)
+	assert.Empty(t, ads)
+	assert.Equal(t, 3, total)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
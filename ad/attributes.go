@@ -0,0 +1,57 @@
+package ad
+
+import "strings"
+
+// Attribute names, as used in forms, vector payloads and subcategory attribute schemas
+const (
+	AttrCondition  = "condition"
+	AttrPartNumber = "part_number"
+	AttrQuantity   = "quantity"
+	AttrPosition   = "position"
+	AttrCoreCharge = "core_charge"
+)
+
+// Part condition values
+const (
+	ConditionNew            = "new"
+	ConditionUsed           = "used"
+	ConditionRemanufactured = "remanufactured"
+)
+
+// Conditions lists the accepted part conditions in display order
+var Conditions = []string{ConditionNew, ConditionUsed, ConditionRemanufactured}
+
+// Positions lists the side/position values a part can be fitted to
+var Positions = []string{
+	"Front", "Rear", "Left", "Right",
+	"Front Left", "Front Right", "Rear Left", "Rear Right",
+	"Upper", "Lower", "Inner", "Outer",
+}
+
+// IsValidCondition returns true if c is one of the accepted conditions
+func IsValidCondition(c string) bool {
+	for _, v := range Conditions {
+		if v == c {
+			return true
+		}
+	}
+	return false
+}
+
+// ConditionLabel returns the display text for a condition value
+func ConditionLabel(c string) string {
+	if c == "" {
+		return ""
+	}
+	return strings.ToUpper(c[:1]) + c[1:]
+}
+
+// ConditionLabel returns the display text for the ad's condition
+func (a Ad) ConditionLabel() string {
+	return ConditionLabel(a.Condition)
+}
+
+// HasPartAttributes returns true if any structured part attribute is set
+func (a Ad) HasPartAttributes() bool {
+	return a.Condition != "" || a.PartNumber != "" || a.Quantity > 1 || a.Position != "" || a.CoreCharge > 0
+}
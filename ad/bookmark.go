@@ -2,14 +2,46 @@ package ad
 
 import (
 	"database/sql"
+	"log"
 
 	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/webhook"
 )
 
-// BookmarkAd bookmarks an ad for a user
+// BookmarkAd bookmarks an ad for a user and tells the seller's webhooks
+// about new bookmarks
 func BookmarkAd(userID, adID int) error {
-	_, err := db.Exec(`INSERT OR IGNORE INTO BookmarkedAd (user_id, ad_id) VALUES (?, ?)`, userID, adID)
-	return err
+	res, err := db.Exec(`INSERT OR IGNORE INTO BookmarkedAd (user_id, ad_id) VALUES (?, ?)`, userID, adID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Already bookmarked
+		return nil
+	}
+
+	event := bookmarkEvent{AdID: adID}
+	var sellerID int
+	err = db.QueryRow(`SELECT a.user_id, (SELECT COUNT(*) FROM BookmarkedAd b WHERE b.ad_id = a.id)
+		FROM Ad a WHERE a.id = ?`, adID).Scan(&sellerID, &event.BookmarkCount)
+	if err != nil {
+		log.Printf("[webhook] Failed to load ad %d for %s: %v", adID, webhook.EventAdBookmarked, err)
+		return nil
+	}
+	if sellerID == userID {
+		return nil
+	}
+	if err := webhook.Emit(sellerID, webhook.EventAdBookmarked, event); err != nil {
+		log.Printf("[webhook] Failed to queue %s for user %d: %v", webhook.EventAdBookmarked, sellerID, err)
+	}
+	return nil
+}
+
+// bookmarkEvent is the data of ad.bookmarked webhooks. Who bookmarked the ad
+// isn't shared, as bookmarks are private.
+type bookmarkEvent struct {
+	AdID          int `json:"ad_id"`
+	BookmarkCount int `json:"bookmark_count"`
 }
 
 // UnbookmarkAd removes a bookmark for an ad by a user
@@ -40,3 +72,15 @@ func GetBookmarkedAdIDs(userID int) ([]int, error) {
 	err := db.Select(&adIDs, query, userID)
 	return adIDs, err
 }
+
+// GetPriceDropAlertUserIDs returns the users who bookmarked an ad and have not
+// opted out of price-drop alerts
+func GetPriceDropAlertUserIDs(adID int) ([]int, error) {
+	query := `SELECT ba.user_id FROM BookmarkedAd ba
+		JOIN User u ON ba.user_id = u.id
+		WHERE ba.ad_id = ? AND u.price_drop_alerts = 1 AND u.deleted_at IS NULL`
+
+	var userIDs []int
+	err := db.Select(&userIDs, query, adID)
+	return userIDs, err
+}
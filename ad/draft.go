@@ -0,0 +1,317 @@
+package ad
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+)
+
+// ErrDraftImagesFull is returned when a draft already holds as many images,
+// or as many bytes of them, as an ad form can send
+var ErrDraftImagesFull = errors.New("draft can't hold more images")
+
+// DraftFields holds the ad form values captured by autosave. Every field is
+// optional because a draft can be saved at any point while the form is filled in.
+type DraftFields struct {
+	Title         string   `json:"title,omitempty"`
+	Make          string   `json:"make,omitempty"`
+	Years         []string `json:"years,omitempty"`
+	Models        []string `json:"models,omitempty"`
+	Engines       []string `json:"engines,omitempty"`
+	YearFrom      int      `json:"year_from,omitempty"`
+	YearTo        int      `json:"year_to,omitempty"`
+	AllModels     bool     `json:"all_models,omitempty"`
+	AllEngines    bool     `json:"all_engines,omitempty"`
+	Category      string   `json:"category,omitempty"`
+	SubCategory   string   `json:"subcategory,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Price         string   `json:"price,omitempty"`
+	Location      string   `json:"location,omitempty"`
+	Condition     string   `json:"condition,omitempty"`
+	PartNumber    string   `json:"part_number,omitempty"`
+	Quantity      string   `json:"quantity,omitempty"`
+	Position      string   `json:"position,omitempty"`
+	CoreCharge    string   `json:"core_charge,omitempty"`
+	DeletedImages string   `json:"deleted_images,omitempty"`
+	ImageOrder    string   `json:"image_order,omitempty"`
+	PrimaryImage  string   `json:"primary_image,omitempty"`
+
+	// Fitment holds the groups added after the first make/years/models/engines
+	Fitment []FitmentGroup `json:"fitment,omitempty"`
+}
+
+// Draft is an unpublished ad, or an unsaved edit of an existing ad when AdID is set
+type Draft struct {
+	ID         int
+	UserID     int
+	AdID       int
+	Fields     DraftFields
+	ImageCount int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// DraftImage is an original image upload attached to a draft
+type DraftImage struct {
+	ID       int
+	DraftID  int
+	Position int
+	Filename string
+	Size     int64
+	Data     []byte
+}
+
+// IsEdit returns true if the draft holds changes to an already published ad
+func (d Draft) IsEdit() bool {
+	return d.AdID != 0
+}
+
+// ApplyTo overlays the draft's form values onto an ad so edit forms can be
+// pre-filled from it
+func (d Draft) ApplyTo(a *Ad) {
+	f := d.Fields
+	a.Title = f.Title
+	primary := FitmentGroup{
+		Make: f.Make, Years: f.Years, Models: f.Models, Engines: f.Engines,
+		YearFrom: f.YearFrom, YearTo: f.YearTo, AllModels: f.AllModels, AllEngines: f.AllEngines,
+	}
+	a.SetFitment(append([]FitmentGroup{primary}, f.Fitment...))
+	a.Category = sql.NullString{String: f.Category, Valid: f.Category != ""}
+	a.SubCategory = sql.NullString{String: f.SubCategory, Valid: f.SubCategory != ""}
+	a.Description = f.Description
+	if price, err := strconv.ParseFloat(f.Price, 64); err == nil {
+		a.Price = price
+	}
+	a.Condition = f.Condition
+	a.PartNumber = f.PartNumber
+	a.Position = f.Position
+	if quantity, err := strconv.Atoi(f.Quantity); err == nil {
+		a.Quantity = quantity
+	}
+	if coreCharge, err := strconv.ParseFloat(f.CoreCharge, 64); err == nil {
+		a.CoreCharge = coreCharge
+	}
+}
+
+// SaveDraft inserts a new draft or updates an existing one owned by the same
+// user, returning the draft ID
+func SaveDraft(d Draft) (int, error) {
+	data, err := json.Marshal(d.Fields)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+
+	var adID sql.NullInt64
+	if d.AdID != 0 {
+		adID = sql.NullInt64{Int64: int64(d.AdID), Valid: true}
+	}
+
+	if d.ID != 0 {
+		res, err := db.Exec("UPDATE AdDraft SET form_data = ?, updated_at = ? WHERE id = ? AND user_id = ?",
+			string(data), now, d.ID, d.UserID)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return 0, sql.ErrNoRows
+		}
+		return d.ID, nil
+	}
+
+	res, err := db.Exec("INSERT INTO AdDraft (user_id, ad_id, form_data, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		d.UserID, adID, string(data), now, now)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+	return int(id), nil
+}
+
+const draftSelect = `
+	SELECT d.id, d.user_id, d.ad_id, d.form_data, d.created_at, d.updated_at,
+		(SELECT COUNT(*) FROM AdDraftImage di WHERE di.draft_id = d.id) AS image_count
+	FROM AdDraft d`
+
+func scanDraft(scanner interface{ Scan(...interface{}) error }) (Draft, error) {
+	var d Draft
+	var adID sql.NullInt64
+	var formData, createdAt, updatedAt string
+	if err := scanner.Scan(&d.ID, &d.UserID, &adID, &formData, &createdAt, &updatedAt, &d.ImageCount); err != nil {
+		return Draft{}, err
+	}
+	if adID.Valid {
+		d.AdID = int(adID.Int64)
+	}
+	if err := json.Unmarshal([]byte(formData), &d.Fields); err != nil {
+		return Draft{}, err
+	}
+	d.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	d.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updatedAt)
+	return d, nil
+}
+
+// GetDraft returns a draft owned by the given user
+func GetDraft(id, userID int) (Draft, error) {
+	row := db.QueryRow(draftSelect+" WHERE d.id = ? AND d.user_id = ?", id, userID)
+	return scanDraft(row)
+}
+
+// GetDraftForAd returns the user's pending edit draft for a published ad, if any
+func GetDraftForAd(adID, userID int) (Draft, bool) {
+	row := db.QueryRow(draftSelect+" WHERE d.ad_id = ? AND d.user_id = ? ORDER BY d.updated_at DESC LIMIT 1", adID, userID)
+	d, err := scanDraft(row)
+	if err != nil {
+		return Draft{}, false
+	}
+	return d, true
+}
+
+// GetDraftsByUser returns all drafts for a user, most recently saved first
+func GetDraftsByUser(userID int) ([]Draft, error) {
+	rows, err := db.Query(draftSelect+" WHERE d.user_id = ? ORDER BY d.updated_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+	for rows.Next() {
+		d, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, rows.Err()
+}
+
+// DeleteDraft removes a draft and its images
+func DeleteDraft(id, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM AdDraft WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec("DELETE FROM AdDraftImage WHERE draft_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddDraftImage stores an uploaded image on a draft. An image with the same
+// filename and size is treated as already saved and skipped, since autosave
+// re-sends the pending file list on every save. Images past
+// config.ImageMaxUploads or config.DraftImageMaxBytes aren't stored.
+func AddDraftImage(draftID int, filename string, data []byte) error {
+	var exists int
+	err := db.QueryRow("SELECT 1 FROM AdDraftImage WHERE draft_id = ? AND filename = ? AND size = ?",
+		draftID, filename, len(data)).Scan(&exists)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	res, err := db.Exec(`INSERT INTO AdDraftImage (draft_id, position, filename, size, data)
+		SELECT ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM AdDraftImage WHERE draft_id = ?), ?, ?, ?
+		WHERE (SELECT COUNT(*) FROM AdDraftImage WHERE draft_id = ?) < ?
+			AND (SELECT COALESCE(SUM(size), 0) FROM AdDraftImage WHERE draft_id = ?) + ? <= ?`,
+		draftID, draftID, filename, len(data), data,
+		draftID, config.ImageMaxUploads, draftID, len(data), config.DraftImageMaxBytes)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDraftImagesFull
+	}
+	return nil
+}
+
+// GetDraftImages returns a draft's images in upload order
+func GetDraftImages(draftID int) ([]DraftImage, error) {
+	rows, err := db.Query("SELECT id, draft_id, position, filename, size, data FROM AdDraftImage WHERE draft_id = ? ORDER BY position", draftID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []DraftImage
+	for rows.Next() {
+		var img DraftImage
+		if err := rows.Scan(&img.ID, &img.DraftID, &img.Position, &img.Filename, &img.Size, &img.Data); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// DeleteDraftImage removes a single image from a draft
+func DeleteDraftImage(draftID, imageID int) error {
+	_, err := db.Exec("DELETE FROM AdDraftImage WHERE id = ? AND draft_id = ?", imageID, draftID)
+	return err
+}
+
+// GetDraftImage returns a single draft image
+func GetDraftImage(draftID, imageID int) (DraftImage, error) {
+	var img DraftImage
+	err := db.QueryRow("SELECT id, draft_id, position, filename, size, data FROM AdDraftImage WHERE id = ? AND draft_id = ?", imageID, draftID).
+		Scan(&img.ID, &img.DraftID, &img.Position, &img.Filename, &img.Size, &img.Data)
+	return img, err
+}
+
+// DeleteStaleDrafts deletes drafts nobody saved for config.DraftExpiry, along
+// with their images, returning how many were deleted
+func DeleteStaleDrafts() (int, error) {
+	cutoff := time.Now().UTC().Add(-config.DraftExpiry).Format(time.RFC3339Nano)
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM AdDraftImage WHERE draft_id IN (SELECT id FROM AdDraft WHERE updated_at <= ?)`, cutoff); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM AdDraft WHERE updated_at <= ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), tx.Commit()
+}
+
+// StartDraftExpiryProcessor periodically deletes abandoned drafts in the
+// background
+func StartDraftExpiryProcessor() {
+	go func() {
+		log.Printf("[draft] Draft expiry processor started")
+		ticker := time.NewTicker(config.DraftExpirySweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := DeleteStaleDrafts()
+			if err != nil {
+				log.Printf("[draft] Failed to delete stale drafts: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("[draft] Deleted %d stale drafts", n)
+			}
+		}
+	}()
+}
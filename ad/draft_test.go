@@ -0,0 +1,89 @@
+package ad
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveDraft_Insert(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectExec("INSERT INTO AdDraft \\(user_id, ad_id, form_data, created_at, updated_at\\) VALUES \\(\\?, \\?, \\?, \\?, \\?\\)").
+		WithArgs(1, nil, `{"title":"Alternator","make":"Ford","years":["2005"]}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	id, err := SaveDraft(Draft{
+		UserID: 1,
+		Fields: DraftFields{Title: "Alternator", Make: "Ford", Years: []string{"2005"}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 7, id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveDraft_UpdateNotOwned(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectExec("UPDATE AdDraft SET form_data = \\?, updated_at = \\? WHERE id = \\? AND user_id = \\?").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 7, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := SaveDraft(Draft{ID: 7, UserID: 2})
+
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddDraftImage_Full(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	data := []byte("image")
+	mock.ExpectQuery("SELECT 1 FROM AdDraftImage WHERE draft_id = \\? AND filename = \\? AND size = \\?").
+		WithArgs(7, "a.jpg", len(data)).
+		WillReturnError(sql.ErrNoRows)
+	// The draft already holds config.ImageMaxUploads images, so nothing is inserted
+	mock.ExpectExec("INSERT INTO AdDraftImage").
+		WithArgs(7, 7, "a.jpg", len(data), data, 7, config.ImageMaxUploads, 7, len(data), config.DraftImageMaxBytes).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := AddDraftImage(7, "a.jpg", data)
+
+	assert.ErrorIs(t, err, ErrDraftImagesFull)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteStaleDrafts(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM AdDraftImage WHERE draft_id IN \\(SELECT id FROM AdDraft WHERE updated_at <= \\?\\)").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("DELETE FROM AdDraft WHERE updated_at <= \\?").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	n, err := DeleteStaleDrafts()
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDraft_ApplyTo(t *testing.T) {
+	a := Ad{ID: 3, Title: "Old", Price: 10}
+	Draft{AdID: 3, Fields: DraftFields{Title: "New", Price: "25.50", Category: "Engine"}}.ApplyTo(&a)
+
+	assert.Equal(t, 3, a.ID)
+	assert.Equal(t, "New", a.Title)
+	assert.Equal(t, 25.5, a.Price)
+	assert.Equal(t, "Engine", a.Category.String)
+}
@@ -0,0 +1,78 @@
+package ad
+
+import (
+	"log"
+	"time"
+
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/webhook"
+)
+
+// expiredAd is the data of ad.expired webhooks
+type expiredAd struct {
+	AdID      int       `json:"ad_id"`
+	Title     string    `json:"title"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// expiryCutoff returns the listing date before which ads have expired
+func expiryCutoff(now time.Time) string {
+	return now.Add(-config.AdExpiry).Format(time.RFC3339Nano)
+}
+
+// ExpireAds archives active ads listed or last renewed more than
+// config.AdExpiry ago and tells their sellers' webhooks. Ads pending sale or
+// hidden by moderation are left alone. Expiry counts from since at the
+// earliest, so ads listed before it was turned on get a full config.AdExpiry
+// to be renewed. It returns the IDs of the ads that expired.
+func ExpireAds(since time.Time) ([]int, error) {
+	now := time.Now().UTC()
+	if now.Add(-config.AdExpiry).Before(since) {
+		return nil, nil
+	}
+	cutoff := expiryCutoff(now)
+	rows, err := db.Query(`SELECT id, user_id, COALESCE(title, '') FROM Ad
+		WHERE deleted_at IS NULL AND pending_at IS NULL AND hidden_at IS NULL AND created_at <= ?`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	type expiring struct {
+		sellerID int
+		event    expiredAd
+	}
+	var ads []expiring
+	for rows.Next() {
+		var e expiring
+		if err := rows.Scan(&e.event.AdID, &e.sellerID, &e.event.Title); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.event.ExpiredAt = now
+		ads = append(ads, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ts := now.Format(time.RFC3339Nano)
+	var expired []int
+	for _, e := range ads {
+		// Renewed, archived, marked pending or hidden in the meantime
+		res, err := db.Exec(`UPDATE Ad SET deleted_at = ?, updated_at = ?
+			WHERE id = ? AND deleted_at IS NULL AND pending_at IS NULL AND hidden_at IS NULL AND created_at <= ?`,
+			ts, ts, e.event.AdID, cutoff)
+		if err != nil {
+			return expired, err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			continue
+		}
+		expired = append(expired, e.event.AdID)
+		if err := webhook.Emit(e.sellerID, webhook.EventAdExpired, e.event); err != nil {
+			log.Printf("[webhook] Failed to queue %s for user %d: %v", webhook.EventAdExpired, e.sellerID, err)
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,92 @@
+package ad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpireAds(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectQuery("SELECT id, user_id, COALESCE\\(title, ''\\) FROM Ad\\s+WHERE deleted_at IS NULL AND pending_at IS NULL AND hidden_at IS NULL AND created_at <= \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).
+			AddRow(4, 2, "Alternator").
+			AddRow(5, 3, "Starter"))
+	mock.ExpectExec("UPDATE Ad SET deleted_at = \\?, updated_at = \\?\\s+WHERE id = \\? AND deleted_at IS NULL AND pending_at IS NULL AND hidden_at IS NULL AND created_at <= \\?").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 4, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT w.id, w.events FROM Webhook w").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "events"}).AddRow(8, "ad.expired"))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO WebhookDelivery").
+		WithArgs(8, "ad.expired", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	// Renewed by its seller since it was selected, so it's left alone
+	mock.ExpectExec("UPDATE Ad SET deleted_at = \\?").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ids, err := ExpireAds(time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []int{4}, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpireAds_LeavesPendingAndHiddenAds(t *testing.T) {
+	mock := dbtest.Mock(t)
+	// Pending and hidden ads aren't selected at all
+	mock.ExpectQuery("FROM Ad\\s+WHERE deleted_at IS NULL AND pending_at IS NULL AND hidden_at IS NULL AND created_at <= \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}).AddRow(4, 2, "Alternator"))
+	// Marked pending or hidden since it was selected, so the guarded update
+	// leaves it alone and its seller hears nothing
+	mock.ExpectExec("UPDATE Ad SET deleted_at = \\?, updated_at = \\?\\s+WHERE id = \\? AND deleted_at IS NULL AND pending_at IS NULL AND hidden_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 4, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ids, err := ExpireAds(time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpireAds_GracePeriod(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// Turned on less than config.AdExpiry ago: even ads listed long before
+	// still have time to be renewed, so nothing is looked at
+	ids, err := ExpireAds(time.Now().Add(-config.AdExpiry + time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Once config.AdExpiry has passed since then, expiry goes by listing date
+	mock.ExpectQuery("FROM Ad\\s+WHERE deleted_at IS NULL").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title"}))
+	ids, err = ExpireAds(time.Now().Add(-config.AdExpiry - time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestoreAd_RenewsExpiredListing(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO AdPriceHistory").
+		WithArgs(4, 4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE Ad SET deleted_at = NULL, updated_at = \\?,\\s+created_at = CASE WHEN created_at <= \\? THEN \\? ELSE created_at END WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, RestoreAd(4))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,304 @@
+package ad
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/parts-pile/site/db"
+)
+
+// FitmentGroup is one make together with the years, models and engines of
+// that make an ad fits. An ad can carry several groups, e.g. a part shared by
+// the Ford Ranger and the Mazda B-Series.
+//
+// A group is a rule rather than an exact list: a year range replaces Years,
+// and AllModels/AllEngines match every model or engine of the make in those
+// years. Groups are resolved against Car in bulk, so combinations that don't
+// exist are simply skipped.
+type FitmentGroup struct {
+	Make       string   `json:"make"`
+	Years      []string `json:"years"`
+	Models     []string `json:"models"`
+	Engines    []string `json:"engines"`
+	YearFrom   int      `json:"year_from,omitempty"`
+	YearTo     int      `json:"year_to,omitempty"`
+	AllModels  bool     `json:"all_models,omitempty"`
+	AllEngines bool     `json:"all_engines,omitempty"`
+}
+
+// ErrNoFitmentMatches is returned when none of an ad's fitment rules match a
+// vehicle in the catalog
+var ErrNoFitmentMatches = errors.New("none of the selected vehicles exist in the catalog")
+
+// IsEmpty returns true if nothing has been selected for the group
+func (f FitmentGroup) IsEmpty() bool {
+	return f.Make == "" && len(f.Years) == 0 && len(f.Models) == 0 && len(f.Engines) == 0 &&
+		!f.HasYearRange() && !f.AllModels && !f.AllEngines
+}
+
+// HasYearRange returns true if the group's years are given as a range
+func (f FitmentGroup) HasYearRange() bool {
+	return f.YearFrom != 0 && f.YearTo != 0
+}
+
+// FitmentReport summarizes how an ad's fitment groups resolved against the
+// vehicle catalog
+type FitmentReport struct {
+	// Vehicles is the number of catalog vehicles the ad was listed for
+	Vehicles int
+	// Skipped counts explicitly selected year/model/engine combinations that
+	// don't exist. Wildcard rules never count as skipped.
+	Skipped int
+}
+
+// Summary describes the report for the seller
+func (r FitmentReport) Summary() string {
+	summary := fmt.Sprintf("Listed for %d vehicle%s.", r.Vehicles, plural(r.Vehicles))
+	if r.Skipped > 0 {
+		summary += fmt.Sprintf(" Skipped %d year/model/engine combination%s that don't exist.", r.Skipped, plural(r.Skipped))
+	}
+	return summary
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// FitmentField returns the form field name for a fitment group. The first
+// group keeps the plain field names (make, years, ...) while additional
+// groups are suffixed with their index (make_1, years_1, ...).
+func FitmentField(name string, group int) string {
+	if group == 0 {
+		return name
+	}
+	return name + "_" + strconv.Itoa(group)
+}
+
+// FitmentGroups returns the ad's fitment groups, falling back to the
+// Make/Years/Models/Engines fields for ads built without Fitment
+func (a Ad) FitmentGroups() []FitmentGroup {
+	if len(a.Fitment) > 0 {
+		return a.Fitment
+	}
+	primary := FitmentGroup{Make: a.Make, Years: a.Years, Models: a.Models, Engines: a.Engines}
+	if primary.IsEmpty() {
+		return nil
+	}
+	return []FitmentGroup{primary}
+}
+
+// SetFitment stores the fitment groups on the ad and mirrors the first group
+// into Make/Years/Models/Engines
+func (a *Ad) SetFitment(groups []FitmentGroup) {
+	a.Fitment = groups
+	if len(groups) == 0 {
+		a.Make, a.Years, a.Models, a.Engines = "", nil, nil, nil
+		return
+	}
+	a.Make = groups[0].Make
+	a.Years = groups[0].Years
+	a.Models = groups[0].Models
+	a.Engines = groups[0].Engines
+}
+
+// FitmentSummary returns the distinct makes, years, models and engines across
+// all of the ad's fitment groups, each sorted
+func (a Ad) FitmentSummary() (makes, years, models, engines []string) {
+	makeSet := make(map[string]bool)
+	yearSet := make(map[string]bool)
+	modelSet := make(map[string]bool)
+	engineSet := make(map[string]bool)
+	for _, g := range a.FitmentGroups() {
+		if g.Make != "" {
+			makeSet[g.Make] = true
+		}
+		for _, y := range g.Years {
+			yearSet[y] = true
+		}
+		for _, m := range g.Models {
+			modelSet[m] = true
+		}
+		for _, e := range g.Engines {
+			engineSet[e] = true
+		}
+	}
+	return sortedKeys(makeSet), sortedKeys(yearSet), sortedKeys(modelSet), sortedKeys(engineSet)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetVehicleData retrieves the fitment groups of an ad in the order they were
+// entered. Within a group, years, models and engines are sorted.
+func GetVehicleData(adID int) []FitmentGroup {
+	query := `
+		SELECT DISTINCT ac.fitment_group, m.name, y.year, mo.name, e.name
+		FROM AdCar ac
+		JOIN Car c ON ac.car_id = c.id
+		JOIN Make m ON c.make_id = m.id
+		JOIN Year y ON c.year_id = y.id
+		JOIN Model mo ON c.model_id = mo.id
+		JOIN Engine e ON c.engine_id = e.id
+		WHERE ac.ad_id = ?
+		ORDER BY ac.fitment_group, m.name, y.year, mo.name, e.name
+	`
+
+	rows, err := db.Query(query, adID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	type groupSets struct {
+		makeName string
+		years    map[string]bool
+		models   map[string]bool
+		engines  map[string]bool
+	}
+	var order []int
+	sets := make(map[int]*groupSets)
+
+	for rows.Next() {
+		var group, year int
+		var makeName, modelName, engineName string
+		if err := rows.Scan(&group, &makeName, &year, &modelName, &engineName); err != nil {
+			continue
+		}
+		s, ok := sets[group]
+		if !ok {
+			s = &groupSets{
+				makeName: makeName,
+				years:    make(map[string]bool),
+				models:   make(map[string]bool),
+				engines:  make(map[string]bool),
+			}
+			sets[group] = s
+			order = append(order, group)
+		}
+		s.years[fmt.Sprintf("%d", year)] = true
+		s.models[modelName] = true
+		s.engines[engineName] = true
+	}
+
+	groups := make([]FitmentGroup, 0, len(order))
+	for _, group := range order {
+		s := sets[group]
+		groups = append(groups, FitmentGroup{
+			Make:    s.makeName,
+			Years:   sortedKeys(s.years),
+			Models:  sortedKeys(s.models),
+			Engines: sortedKeys(s.engines),
+		})
+	}
+	return groups
+}
+
+// fitmentWhere builds the Car filter for a fitment group. It returns false
+// if the group can't match anything, e.g. because no years were selected.
+func fitmentWhere(f FitmentGroup) (string, []interface{}, bool) {
+	conditions := []string{"m.name = ?"}
+	args := []interface{}{f.Make}
+
+	switch {
+	case f.HasYearRange():
+		conditions = append(conditions, "y.year BETWEEN ? AND ?")
+		args = append(args, min(f.YearFrom, f.YearTo), max(f.YearFrom, f.YearTo))
+	case len(f.Years) > 0:
+		conditions = append(conditions, "y.year IN ("+placeholders(len(f.Years))+")")
+		for _, y := range f.Years {
+			args = append(args, y)
+		}
+	default:
+		return "", nil, false
+	}
+
+	if !f.AllModels {
+		if len(f.Models) == 0 {
+			return "", nil, false
+		}
+		conditions = append(conditions, "mo.name IN ("+placeholders(len(f.Models))+")")
+		for _, m := range f.Models {
+			args = append(args, m)
+		}
+	}
+	if !f.AllEngines {
+		if len(f.Engines) == 0 {
+			return "", nil, false
+		}
+		conditions = append(conditions, "e.name IN ("+placeholders(len(f.Engines))+")")
+		for _, e := range f.Engines {
+			args = append(args, e)
+		}
+	}
+	return strings.Join(conditions, " AND "), args, true
+}
+
+// requestedCombinations returns how many year/model/engine combinations an
+// explicit fitment group asks for, or 0 if it uses a wildcard
+func requestedCombinations(f FitmentGroup) int {
+	if f.AllModels || f.AllEngines {
+		return 0
+	}
+	years := len(f.Years)
+	if f.HasYearRange() {
+		years = max(f.YearFrom, f.YearTo) - min(f.YearFrom, f.YearTo) + 1
+	}
+	return years * len(f.Models) * len(f.Engines)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+const fitmentCarJoins = `
+	FROM Car c
+	JOIN Make m ON c.make_id = m.id
+	JOIN Year y ON c.year_id = y.id
+	JOIN Model mo ON c.model_id = mo.id
+	JOIN Engine e ON c.engine_id = e.id`
+
+// addAdVehicleAssociations resolves each fitment group against Car with a
+// single INSERT ... SELECT, so combinations missing from the catalog are
+// skipped rather than failing the whole ad
+func addAdVehicleAssociations(tx *sql.Tx, adID int, groups []FitmentGroup) (FitmentReport, error) {
+	var report FitmentReport
+	for group, fitment := range groups {
+		where, args, ok := fitmentWhere(fitment)
+		if !ok {
+			continue
+		}
+
+		var matched int
+		if err := tx.QueryRow("SELECT COUNT(*)"+fitmentCarJoins+" WHERE "+where, args...).Scan(&matched); err != nil {
+			return FitmentReport{}, fmt.Errorf("error counting fitment matches: %w", err)
+		}
+		if requested := requestedCombinations(fitment); requested > matched {
+			report.Skipped += requested - matched
+		}
+
+		insertArgs := append([]interface{}{adID, group}, args...)
+		res, err := tx.Exec("INSERT OR IGNORE INTO AdCar (ad_id, car_id, fitment_group) SELECT ?, c.id, ?"+fitmentCarJoins+" WHERE "+where, insertArgs...)
+		if err != nil {
+			return FitmentReport{}, fmt.Errorf("error inserting AdCar associations: %w", err)
+		}
+		inserted, _ := res.RowsAffected()
+		report.Vehicles += int(inserted)
+	}
+	if report.Vehicles == 0 && len(groups) > 0 {
+		return report, ErrNoFitmentMatches
+	}
+	return report, nil
+}
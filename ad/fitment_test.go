@@ -0,0 +1,113 @@
+package ad
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVehicleDataGroups(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectQuery("SELECT DISTINCT ac.fitment_group, m.name, y.year, mo.name, e.name").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"fitment_group", "make", "year", "model", "engine"}).
+			AddRow(0, "Ford", 2005, "Ranger", "3.0L").
+			AddRow(0, "Ford", 2004, "Ranger", "3.0L").
+			AddRow(1, "Mazda", 2004, "B3000", "3.0L"))
+
+	groups := GetVehicleData(5)
+
+	require.Len(t, groups, 2)
+	assert.Equal(t, FitmentGroup{Make: "Ford", Years: []string{"2004", "2005"}, Models: []string{"Ranger"}, Engines: []string{"3.0L"}}, groups[0])
+	assert.Equal(t, FitmentGroup{Make: "Mazda", Years: []string{"2004"}, Models: []string{"B3000"}, Engines: []string{"3.0L"}}, groups[1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFitmentGroups(t *testing.T) {
+	// Ads built without Fitment fall back to the primary fields
+	a := Ad{Make: "Ford", Years: []string{"2005"}, Models: []string{"F-150"}, Engines: []string{"4.6L"}}
+	assert.Equal(t, []FitmentGroup{{Make: "Ford", Years: []string{"2005"}, Models: []string{"F-150"}, Engines: []string{"4.6L"}}}, a.FitmentGroups())
+	assert.Empty(t, Ad{}.FitmentGroups())
+
+	a.SetFitment([]FitmentGroup{
+		{Make: "Mazda", Years: []string{"2004"}, Models: []string{"B3000"}, Engines: []string{"3.0L"}},
+		{Make: "Ford", Years: []string{"2004", "2005"}, Models: []string{"Ranger"}, Engines: []string{"3.0L"}},
+	})
+	assert.Equal(t, "Mazda", a.Make)
+	assert.Equal(t, []string{"B3000"}, a.Models)
+	assert.Len(t, a.FitmentGroups(), 2)
+
+	makes, years, models, engines := a.FitmentSummary()
+	assert.Equal(t, []string{"Ford", "Mazda"}, makes)
+	assert.Equal(t, []string{"2004", "2005"}, years)
+	assert.Equal(t, []string{"B3000", "Ranger"}, models)
+	assert.Equal(t, []string{"3.0L"}, engines)
+}
+
+func TestFitmentField(t *testing.T) {
+	assert.Equal(t, "make", FitmentField("make", 0))
+	assert.Equal(t, "years_2", FitmentField("years", 2))
+}
+
+func TestAddAdVehicleAssociationsSkipsMissingCombinations(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	// 2 years x 2 models x 1 engine requested, only 3 exist
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)").
+		WithArgs("Ford", 1995, 1996, "Ranger", "Explorer", "4.0L").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectExec("INSERT OR IGNORE INTO AdCar \\(ad_id, car_id, fitment_group\\) SELECT").
+		WithArgs(9, 0, "Ford", 1995, 1996, "Ranger", "Explorer", "4.0L").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	// Wildcard groups never report skipped combinations
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)").
+		WithArgs("Mazda", "1995").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectExec("INSERT OR IGNORE INTO AdCar").
+		WithArgs(9, 1, "Mazda", "1995").
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	report, err := addAdVehicleAssociations(tx, 9, []FitmentGroup{
+		{Make: "Ford", YearFrom: 1996, YearTo: 1995, Models: []string{"Ranger", "Explorer"}, Engines: []string{"4.0L"}},
+		{Make: "Mazda", Years: []string{"1995"}, AllModels: true, AllEngines: true},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, FitmentReport{Vehicles: 8, Skipped: 1}, report)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddAdVehicleAssociationsNoMatches(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT OR IGNORE INTO AdCar").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	_, err = addAdVehicleAssociations(tx, 9, []FitmentGroup{
+		{Make: "Ford", Years: []string{"1901"}, Models: []string{"Ranger"}, Engines: []string{"4.0L"}},
+	})
+
+	assert.ErrorIs(t, err, ErrNoFitmentMatches)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFitmentReportSummary(t *testing.T) {
+	assert.Equal(t, "Listed for 1 vehicle.", FitmentReport{Vehicles: 1}.Summary())
+	assert.Equal(t, "Listed for 12 vehicles. Skipped 3 year/model/engine combinations that don't exist.",
+		FitmentReport{Vehicles: 12, Skipped: 3}.Summary())
+}
@@ -0,0 +1,241 @@
+package ad
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// Image is one photo in an ad's image manifest
+type Image struct {
+	ID       int // Stable for as long as the image exists
+	AdID     int
+	Idx      int // Number in the image's storage keys
+	Position int
+	Primary  bool
+	Variants []string // Stored sizes, e.g. "480w"
+}
+
+// HasVariant returns true if the image is stored in the given size
+func (img Image) HasVariant(size string) bool {
+	return slices.Contains(img.Variants, size)
+}
+
+// Cover returns the ad's cover photo: the primary image, or the first one
+// when none is marked
+func (a Ad) Cover() (Image, bool) {
+	for _, img := range a.Images {
+		if img.Primary {
+			return img, true
+		}
+	}
+	if len(a.Images) > 0 {
+		return a.Images[0], true
+	}
+	return Image{}, false
+}
+
+const imageSelect = "SELECT id, ad_id, idx, position, is_primary, variants FROM AdImage"
+
+func scanImages(rows *sql.Rows) ([]Image, error) {
+	defer rows.Close()
+	var images []Image
+	for rows.Next() {
+		var img Image
+		var variants string
+		if err := rows.Scan(&img.ID, &img.AdID, &img.Idx, &img.Position, &img.Primary, &variants); err != nil {
+			return nil, err
+		}
+		if variants != "" {
+			img.Variants = strings.Split(variants, ",")
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// GetImages returns an ad's images in display order
+func GetImages(adID int) ([]Image, error) {
+	rows, err := db.Query(imageSelect+" WHERE ad_id = ? ORDER BY position, id", adID)
+	if err != nil {
+		return nil, err
+	}
+	return scanImages(rows)
+}
+
+// GetImage returns one of an ad's images
+func GetImage(adID, imageID int) (Image, error) {
+	rows, err := db.Query(imageSelect+" WHERE ad_id = ? AND id = ?", adID, imageID)
+	if err != nil {
+		return Image{}, err
+	}
+	images, err := scanImages(rows)
+	if err != nil {
+		return Image{}, err
+	}
+	if len(images) == 0 {
+		return Image{}, sql.ErrNoRows
+	}
+	return images[0], nil
+}
+
+// getImagesForAds returns the images of several ads in display order, keyed
+// by ad ID
+func getImagesForAds(ids []int) (map[int][]Image, error) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := db.Query(imageSelect+" WHERE ad_id IN ("+strings.Join(placeholders, ",")+") ORDER BY ad_id, position, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	images, err := scanImages(rows)
+	if err != nil {
+		return nil, err
+	}
+	byAd := make(map[int][]Image)
+	for _, img := range images {
+		byAd[img.AdID] = append(byAd[img.AdID], img)
+	}
+	return byAd, nil
+}
+
+// NextImageIdx reserves the storage number for the ad's next image. Numbers
+// come from a per-ad counter and are never handed out twice, so a new image
+// can't take over the signed, cached URLs of a deleted one.
+func NextImageIdx(adID int) (int, error) {
+	var idx int
+	err := db.QueryRow(`UPDATE Ad SET last_image_idx = MAX(last_image_idx,
+			(SELECT COALESCE(MAX(idx), 0) FROM AdImage WHERE ad_id = ?)) + 1
+		WHERE id = ? RETURNING last_image_idx`, adID, adID).Scan(&idx)
+	return idx, err
+}
+
+// BackfillImages adds manifest entries for ads whose images were stored
+// before the manifest existed, numbered 1 to image_count with the first as
+// the cover. It returns the number of images added.
+func BackfillImages(variants []string) (int, error) {
+	res, err := db.Exec(`WITH RECURSIVE seq(i) AS (
+			SELECT 1 UNION ALL SELECT i + 1 FROM seq WHERE i < (SELECT MAX(image_count) FROM Ad)
+		)
+		INSERT INTO AdImage (ad_id, idx, position, is_primary, variants, created_at)
+		SELECT a.id, seq.i, seq.i, seq.i = 1, ?, ?
+		FROM Ad a JOIN seq ON seq.i <= a.image_count
+		WHERE a.image_count > 0 AND NOT EXISTS (SELECT 1 FROM AdImage WHERE ad_id = a.id)`,
+		strings.Join(variants, ","), time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// AddImage appends a processed image to the ad's manifest within the caller's
+// transaction and returns its ID. An ad's first image becomes its cover.
+func AddImage(tx *sql.Tx, adID, idx int, variants []string) (int, error) {
+	res, err := tx.Exec(`INSERT INTO AdImage (ad_id, idx, position, is_primary, variants, created_at)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM AdImage WHERE ad_id = ?),
+			NOT EXISTS (SELECT 1 FROM AdImage WHERE ad_id = ?), ?, ?)`,
+		adID, idx, adID, adID, strings.Join(variants, ","), time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+	return int(id), updateImageCount(tx, adID)
+}
+
+// DeleteImages removes images from the ad's manifest and returns the removed
+// ones so their files can be deleted. If the cover goes, the first remaining
+// image takes its place.
+func DeleteImages(adID int, imageIDs []int) ([]Image, error) {
+	if len(imageIDs) == 0 {
+		return nil, nil
+	}
+	images, err := GetImages(adID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var deleted []Image
+	for _, img := range images {
+		if !slices.Contains(imageIDs, img.ID) {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM AdImage WHERE id = ? AND ad_id = ?", img.ID, adID); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, img)
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+	_, err = tx.Exec(`UPDATE AdImage SET is_primary = 1 WHERE id = (
+			SELECT id FROM AdImage WHERE ad_id = ? ORDER BY position, id LIMIT 1)
+		AND NOT EXISTS (SELECT 1 FROM AdImage WHERE ad_id = ? AND is_primary = 1)`, adID, adID)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateImageCount(tx, adID); err != nil {
+		return nil, err
+	}
+	return deleted, tx.Commit()
+}
+
+// ReorderImages puts the listed images first, in the given order. Images
+// that aren't listed keep their order after them.
+func ReorderImages(adID int, imageIDs []int) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE AdImage SET position = position + ? WHERE ad_id = ?", len(imageIDs), adID); err != nil {
+		return err
+	}
+	for i, id := range imageIDs {
+		if _, err := tx.Exec("UPDATE AdImage SET position = ? WHERE id = ? AND ad_id = ?", i+1, id, adID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetPrimaryImage makes one of the ad's images its cover photo
+func SetPrimaryImage(adID, imageID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT 1 FROM AdImage WHERE id = ? AND ad_id = ?", imageID, adID).Scan(&exists); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE AdImage SET is_primary = (id = ?) WHERE ad_id = ?", imageID, adID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateImageCount keeps the ad's image count in step with its manifest
+func updateImageCount(tx *sql.Tx, adID int) error {
+	_, err := tx.Exec("UPDATE Ad SET image_count = (SELECT COUNT(*) FROM AdImage WHERE ad_id = ?) WHERE id = ?", adID, adID)
+	return err
+}
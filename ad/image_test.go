@@ -0,0 +1,72 @@
+package ad
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAd_Cover(t *testing.T) {
+	_, ok := Ad{}.Cover()
+	assert.False(t, ok)
+
+	a := Ad{Images: []Image{{ID: 4, Position: 1}, {ID: 5, Position: 2, Primary: true}}}
+	cover, ok := a.Cover()
+	assert.True(t, ok)
+	assert.Equal(t, 5, cover.ID)
+
+	// Without a primary image the first one is the cover
+	a.Images[1].Primary = false
+	cover, _ = a.Cover()
+	assert.Equal(t, 4, cover.ID)
+}
+
+func TestReorderImages(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE AdImage SET position = position \\+ \\? WHERE ad_id = \\?").
+		WithArgs(2, 3).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE AdImage SET position = \\? WHERE id = \\? AND ad_id = \\?").
+		WithArgs(1, 9, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE AdImage SET position = \\? WHERE id = \\? AND ad_id = \\?").
+		WithArgs(2, 7, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, ReorderImages(3, []int{9, 7}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetPrimaryImage_OtherAdsImage(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT 1 FROM AdImage WHERE id = \\? AND ad_id = \\?").
+		WithArgs(9, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}))
+	mock.ExpectRollback()
+
+	assert.Error(t, SetPrimaryImage(3, 9))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNextImageIdx(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// The counter is bumped rather than derived from the remaining images, so
+	// deleting the last image doesn't free its number
+	mock.ExpectQuery("UPDATE Ad SET last_image_idx = MAX\\(last_image_idx,.*RETURNING last_image_idx").
+		WithArgs(3, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"last_image_idx"}).AddRow(5))
+
+	idx, err := NextImageIdx(3)
+	require.NoError(t, err)
+	assert.Equal(t, 5, idx)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
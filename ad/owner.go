@@ -0,0 +1,86 @@
+package ad
+
+import (
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// ownerAdQuery selects a seller's ads whether or not they are archived
+const ownerAdQuery = `
+	SELECT a.id, a.title, a.description, a.price, a.created_at, a.deleted_at, a.subcategory_id,
+	       a.user_id, psc.name as subcategory, pc.name as category, a.click_count, a.last_clicked_at, a.location_id, a.image_count,
+	       a.condition, a.part_number, a.quantity, a.position, a.core_charge, a.pending_at, a.hidden_at, a.updated_at,
+	       l.city, l.admin_area, l.country, l.latitude, l.longitude,
+	       0 as is_bookmarked
+	FROM Ad a
+	LEFT JOIN PartSubCategory psc ON a.subcategory_id = psc.id
+	LEFT JOIN PartCategory pc ON psc.category_id = pc.id
+	LEFT JOIN Location l ON a.location_id = l.id
+	WHERE a.user_id = ?`
+
+// GetAdsByUser returns a seller's active ads, or their archived ads when
+// archived is true, newest first
+func GetAdsByUser(userID int, archived bool) ([]Ad, error) {
+	query := ownerAdQuery + " AND a.deleted_at IS NULL"
+	if archived {
+		query = ownerAdQuery + " AND a.deleted_at IS NOT NULL"
+	}
+	query += " ORDER BY a.created_at DESC, a.id DESC"
+
+	var ads []Ad
+	if err := db.Select(&ads, query, userID); err != nil {
+		return nil, err
+	}
+	return ads, nil
+}
+
+// GetUserAd returns one of a seller's ads, including archived ones
+func GetUserAd(id, userID int) (Ad, bool) {
+	var ads []Ad
+	if err := db.Select(&ads, ownerAdQuery+" AND a.id = ?", userID, id); err != nil || len(ads) == 0 {
+		return Ad{}, false
+	}
+	return ads[0], true
+}
+
+// RenewAd moves an active ad's listing date to now so it ranks and ages as a
+// fresh listing. The original price is kept in the price history.
+func RenewAd(adID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := seedPriceHistory(tx, adID); err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if _, err := tx.Exec("UPDATE Ad SET created_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL",
+		now, now, adID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateAdPrice changes an ad's price and records the change in its history
+func UpdateAdPrice(adID int, price float64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := seedPriceHistory(tx, adID); err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if _, err := tx.Exec("UPDATE Ad SET price = ?, updated_at = ? WHERE id = ?", price, now, adID); err != nil {
+		return err
+	}
+	if err := recordPriceChange(tx, adID, price, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package ad
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAdsByUser(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectQuery("WHERE a.user_id = \\? AND a.deleted_at IS NOT NULL ORDER BY a.created_at DESC").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "price", "user_id"}).
+			AddRow(9, "Alternator", 80.0, 4))
+
+	ads, err := GetAdsByUser(4, true)
+
+	assert.NoError(t, err)
+	require.Len(t, ads, 1)
+	assert.Equal(t, "Alternator", ads[0].Title)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateAdPrice(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO AdPriceHistory \\(ad_id, price, changed_at\\)\\s+SELECT id, price, created_at FROM Ad").
+		WithArgs(9, 9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE Ad SET price = \\?, updated_at = \\? WHERE id = \\?").
+		WithArgs(72.0, sqlmock.AnyArg(), 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO AdPriceHistory \\(ad_id, price, changed_at\\)\\s+SELECT \\?, \\?, \\?").
+		WithArgs(9, 72.0, sqlmock.AnyArg(), 9, 72.0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, UpdateAdPrice(9, 72.0))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRenewAd(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// The original listing price is kept before the listing date moves
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO AdPriceHistory").
+		WithArgs(9, 9).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE Ad SET created_at = \\?, updated_at = \\? WHERE id = \\? AND deleted_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, RenewAd(9))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,66 @@
+package ad
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// PricePoint is a recorded price of an ad
+type PricePoint struct {
+	Price     float64
+	ChangedAt time.Time
+}
+
+// recordPriceChange appends the ad's price to its history if it differs from
+// the last recorded price
+func recordPriceChange(tx *sql.Tx, adID int, price float64, changedAt string) error {
+	_, err := tx.Exec(`INSERT INTO AdPriceHistory (ad_id, price, changed_at)
+		SELECT ?, ?, ?
+		WHERE COALESCE((SELECT price FROM AdPriceHistory WHERE ad_id = ? ORDER BY changed_at DESC, id DESC LIMIT 1), -1) != ?`,
+		adID, price, changedAt, adID, price)
+	return err
+}
+
+// seedPriceHistory records the ad's current price as of its creation for ads
+// listed before price history was kept
+func seedPriceHistory(tx *sql.Tx, adID int) error {
+	_, err := tx.Exec(`INSERT INTO AdPriceHistory (ad_id, price, changed_at)
+		SELECT id, price, created_at FROM Ad
+		WHERE id = ? AND price IS NOT NULL AND NOT EXISTS (SELECT 1 FROM AdPriceHistory WHERE ad_id = ?)`,
+		adID, adID)
+	return err
+}
+
+// GetPriceHistory returns the recorded prices of an ad, oldest first
+func GetPriceHistory(adID int) ([]PricePoint, error) {
+	rows, err := db.Query(`SELECT price, changed_at FROM AdPriceHistory WHERE ad_id = ? ORDER BY changed_at, id`, adID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []PricePoint
+	for rows.Next() {
+		var p PricePoint
+		var changedAt string
+		if err := rows.Scan(&p.Price, &changedAt); err != nil {
+			return nil, err
+		}
+		p.ChangedAt = parsePriceTime(changedAt)
+		history = append(history, p)
+	}
+	return history, rows.Err()
+}
+
+// parsePriceTime parses history timestamps, which are RFC3339 when written by
+// the app and SQLite's default format when seeded from Ad.created_at
+func parsePriceTime(s string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
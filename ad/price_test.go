@@ -0,0 +1,45 @@
+package ad
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPriceHistory(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectQuery("SELECT price, changed_at FROM AdPriceHistory WHERE ad_id = \\? ORDER BY changed_at, id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"price", "changed_at"}).
+			AddRow(50.0, "2025-01-02 03:04:05").
+			AddRow(40.0, "2025-02-01T10:00:00Z"))
+
+	history, err := GetPriceHistory(1)
+
+	assert.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 50.0, history[0].Price)
+	assert.Equal(t, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), history[0].ChangedAt)
+	assert.Equal(t, 40.0, history[1].Price)
+	assert.Equal(t, time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC), history[1].ChangedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPriceDropAlertUserIDs(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectQuery("SELECT ba.user_id FROM BookmarkedAd ba").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2).AddRow(3))
+
+	userIDs, err := GetPriceDropAlertUserIDs(7)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, userIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
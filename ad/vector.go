@@ -14,13 +14,14 @@ func GetAdsWithoutVectors() ([]Ad, error) {
 		SELECT 
 			a.id, a.title, a.description, a.price, a.created_at, 
 			a.subcategory_id, a.user_id, psc.name as subcategory, pc.name as category, a.click_count, a.last_clicked_at, a.location_id, a.image_count,
+			a.condition, a.part_number, a.quantity, a.position, a.core_charge, a.pending_at,
 			l.city, l.admin_area, l.country, l.latitude, l.longitude,
 			0 as is_bookmarked
 		FROM Ad a
 		LEFT JOIN PartSubCategory psc ON a.subcategory_id = psc.id
 		LEFT JOIN PartCategory pc ON psc.category_id = pc.id
 		LEFT JOIN Location l ON a.location_id = l.id
-		WHERE a.has_vector = 0 AND a.deleted_at IS NULL
+		WHERE a.has_vector = 0 AND a.deleted_at IS NULL AND a.hidden_at IS NULL
 	`
 
 	var ads []Ad
@@ -34,7 +35,7 @@ func GetAdsWithoutVectors() ([]Ad, error) {
 	for i := range ads {
 		ads[i].HasVector = false
 		// Get vehicle data
-		ads[i].Make, ads[i].Years, ads[i].Models, ads[i].Engines = GetVehicleData(ads[i].ID)
+		ads[i].SetFitment(GetVehicleData(ads[i].ID))
 	}
 
 	log.Printf("[GetAdsWithoutVectors] Found %d ads without vectors from SQL query", len(ads))
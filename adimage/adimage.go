@@ -0,0 +1,301 @@
+// Package adimage turns uploaded ad images into the stored sizes in the
+// background. Uploads are staged in the database as jobs, so they survive
+// restarts and failed attempts are retried.
+package adimage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/imagestore"
+)
+
+// Status is where an image is in processing
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing"
+	StatusReady      Status = "ready"
+	StatusFailed     Status = "failed"
+)
+
+// Upload is an original image file waiting to be processed
+type Upload struct {
+	Filename string
+	Data     []byte
+}
+
+// Job is the processing state of one uploaded image
+type Job struct {
+	ID        int
+	AdID      int
+	Filename  string
+	Status    Status
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+// Messages shown to sellers when an image can't be processed
+const (
+	errAdMissing = "The ad no longer exists."
+	errStorage   = "The image could not be stored."
+)
+
+// jobError is a processing failure. Permanent failures aren't retried.
+type jobError struct {
+	msg       string
+	permanent bool
+	err       error
+}
+
+func (e *jobError) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.err)
+}
+
+func (e *jobError) Unwrap() error {
+	return e.err
+}
+
+// Enqueue stages uploads for processing, in order
+func Enqueue(adID int, uploads []Upload) error {
+	if len(uploads) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, u := range uploads {
+		_, err := tx.Exec(`INSERT INTO AdImageJob (ad_id, filename, data, status, next_attempt_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, adID, u.Filename, u.Data, StatusPending, now, now, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetJobs returns the ad's images that aren't available yet: the ones still
+// processing and the ones that failed
+func GetJobs(adID int) ([]Job, error) {
+	rows, err := db.Query(`SELECT id, ad_id, filename, status, attempts, last_error, created_at
+		FROM AdImageJob WHERE ad_id = ? AND status != ? ORDER BY id`, adID, StatusReady)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		var createdAt string
+		if err := rows.Scan(&j.ID, &j.AdID, &j.Filename, &j.Status, &j.Attempts, &j.LastError, &createdAt); err != nil {
+			return nil, err
+		}
+		j.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// DismissFailed forgets the ad's failed images once the seller has seen them
+func DismissFailed(adID int) error {
+	_, err := db.Exec("DELETE FROM AdImageJob WHERE ad_id = ? AND status = ?", adID, StatusFailed)
+	return err
+}
+
+// Delete removes images from the ad's manifest and deletes every stored size
+// of them. Files that can't be deleted are logged and left behind.
+func Delete(adID int, imageIDs []int) error {
+	deleted, err := ad.DeleteImages(adID, imageIDs)
+	if err != nil {
+		return err
+	}
+	store := imagestore.Default()
+	if store == nil {
+		return errors.New("no image store configured")
+	}
+	for _, img := range deleted {
+		for _, size := range img.Variants {
+			key := imagestore.AdImageKey(adID, img.Idx, size)
+			if err := store.Delete(key); err != nil {
+				log.Printf("[images] Failed to delete %s: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ProcessNext processes the oldest job that is due. It returns false when
+// there was nothing to do.
+func ProcessNext() (bool, error) {
+	now := time.Now().UTC()
+	var (
+		id, adID, attempts int
+		filename           string
+		data               []byte
+	)
+	err := db.QueryRow(`SELECT id, ad_id, filename, data, attempts FROM AdImageJob
+		WHERE status = ? AND next_attempt_at <= ? ORDER BY id LIMIT 1`,
+		StatusPending, now.Format(time.RFC3339Nano)).Scan(&id, &adID, &filename, &data, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	res, err := db.Exec("UPDATE AdImageJob SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND status = ?",
+		StatusProcessing, now.Format(time.RFC3339Nano), id, StatusPending)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Claimed by someone else in the meantime
+		return true, nil
+	}
+	attempts++
+
+	idx, err := process(id, adID, data)
+	if err != nil {
+		return true, fail(id, adID, filename, attempts, err)
+	}
+	log.Printf("[images] Stored %q as image %d of ad %d", filename, idx, adID)
+	return true, nil
+}
+
+// process stores the image sizes under the ad's next image number and adds
+// the image to the ad's manifest, making it visible
+func process(id, adID int, data []byte) (int, error) {
+	variants, err := encodeVariants(data)
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		return 0, &jobError{msg: invalid.Error(), permanent: true, err: err}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var exists int
+	err = db.QueryRow("SELECT 1 FROM Ad WHERE id = ?", adID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, &jobError{msg: errAdMissing, permanent: true, err: err}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	store := imagestore.Default()
+	if store == nil {
+		return 0, &jobError{msg: errStorage, err: errors.New("no image store configured")}
+	}
+	idx, err := ad.NextImageIdx(adID)
+	if err != nil {
+		return 0, err
+	}
+	sizes := make([]string, len(Variants))
+	for i, v := range Variants {
+		if err := store.Put(imagestore.AdImageKey(adID, idx, v.Suffix), "image/webp", variants[i]); err != nil {
+			return 0, &jobError{msg: errStorage, err: err}
+		}
+		sizes[i] = v.Suffix
+	}
+	return idx, markReady(id, adID, idx, sizes)
+}
+
+// markReady adds the stored image to the ad's manifest and drops the staged
+// original
+func markReady(id, adID, idx int, sizes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	imageID, err := ad.AddImage(tx, adID, idx, sizes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE AdImageJob SET status = ?, data = NULL, image_id = ?, last_error = '', updated_at = ?
+		WHERE id = ?`, StatusReady, imageID, time.Now().UTC().Format(time.RFC3339Nano), id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// fail schedules a retry with exponential backoff, or gives up on the job
+// once it can't succeed or has used up its attempts
+func fail(id, adID int, filename string, attempts int, err error) error {
+	log.Printf("[images] Processing %q for ad %d failed (attempt %d): %v", filename, adID, attempts, err)
+
+	msg := errStorage
+	permanent := false
+	var jerr *jobError
+	if errors.As(err, &jerr) {
+		msg, permanent = jerr.msg, jerr.permanent
+	}
+	now := time.Now().UTC()
+
+	if permanent || attempts >= config.ImageJobMaxAttempts {
+		_, err := db.Exec("UPDATE AdImageJob SET status = ?, data = NULL, last_error = ?, updated_at = ? WHERE id = ?",
+			StatusFailed, msg, now.Format(time.RFC3339Nano), id)
+		return err
+	}
+	next := now.Add(config.ImageJobRetryDelay << (attempts - 1))
+	_, err = db.Exec("UPDATE AdImageJob SET status = ?, last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?",
+		StatusPending, msg, next.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano), id)
+	return err
+}
+
+// ProcessPending works through every job that is due and returns how many
+// it processed
+func ProcessPending() (int, error) {
+	n := 0
+	for {
+		ok, err := ProcessNext()
+		if err != nil || !ok {
+			return n, err
+		}
+		n++
+	}
+}
+
+// StartProcessor processes image jobs in the background. Jobs left
+// processing by a previous run are picked up again, and ads whose images
+// predate the manifest get manifest entries.
+func StartProcessor() {
+	if _, err := db.Exec("UPDATE AdImageJob SET status = ? WHERE status = ?", StatusPending, StatusProcessing); err != nil {
+		log.Printf("[images] Failed to resume interrupted jobs: %v", err)
+	}
+	suffixes := make([]string, len(Variants))
+	for i, v := range Variants {
+		suffixes[i] = v.Suffix
+	}
+	if n, err := ad.BackfillImages(suffixes); err != nil {
+		log.Printf("[images] Failed to backfill image manifests: %v", err)
+	} else if n > 0 {
+		log.Printf("[images] Backfilled %d images into ad manifests", n)
+	}
+	go func() {
+		log.Printf("[images] Image processor started")
+		ticker := time.NewTicker(config.ImageJobPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := ProcessPending(); err != nil {
+				log.Printf("[images] Failed to process image jobs: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,195 @@
+package adimage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/chai2010/webp"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/parts-pile/site/imagestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStore(t *testing.T) *imagestore.LocalStore {
+	s, err := imagestore.NewLocalStore(t.TempDir(), "secret")
+	require.NoError(t, err)
+	imagestore.Set(s)
+	t.Cleanup(func() { imagestore.Set(nil) })
+	return s
+}
+
+func testPNG(t *testing.T) []byte {
+	return testPNGSized(t, 400, 300)
+}
+
+func testPNGSized(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, x%h, color.RGBA{200, 0, 0, 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+var jobColumns = []string{"id", "ad_id", "filename", "data", "attempts"}
+
+func expectClaim(mock sqlmock.Sqlmock, id, adID int, data []byte, attempts int) {
+	mock.ExpectQuery("SELECT id, ad_id, filename, data, attempts FROM AdImageJob").
+		WithArgs(StatusPending, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(jobColumns).AddRow(id, adID, "photo.jpg", data, attempts))
+	mock.ExpectExec("UPDATE AdImageJob SET status = \\?, attempts = attempts \\+ 1").
+		WithArgs(StatusProcessing, sqlmock.AnyArg(), id, StatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestEnqueue(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO AdImageJob").
+		WithArgs(7, "a.jpg", []byte("a"), StatusPending, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO AdImageJob").
+		WithArgs(7, "b.jpg", []byte("b"), StatusPending, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, Enqueue(7, []Upload{{"a.jpg", []byte("a")}, {"b.jpg", []byte("b")}}))
+	// Nothing to stage
+	require.NoError(t, Enqueue(7, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectAdExists(mock sqlmock.Sqlmock, adID, nextIdx int) {
+	mock.ExpectQuery("SELECT 1 FROM Ad WHERE id = \\?").
+		WithArgs(adID).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery("UPDATE Ad SET last_image_idx = .* RETURNING last_image_idx").
+		WithArgs(adID, adID).
+		WillReturnRows(sqlmock.NewRows([]string{"last_image_idx"}).AddRow(nextIdx))
+}
+
+func TestProcessNext_StoresImageInManifest(t *testing.T) {
+	mock := dbtest.Mock(t)
+	store := setupStore(t)
+
+	expectClaim(mock, 3, 7, testPNG(t), 0)
+	expectAdExists(mock, 7, 4)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO AdImage").
+		WithArgs(7, 4, 7, 7, "160w,480w,1200w", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectExec("UPDATE Ad SET image_count = \\(SELECT COUNT\\(\\*\\) FROM AdImage WHERE ad_id = \\?\\) WHERE id = \\?").
+		WithArgs(7, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE AdImageJob SET status = \\?, data = NULL, image_id = \\?").
+		WithArgs(StatusReady, 12, sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ok, err := ProcessNext()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	keys, err := store.List("7/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7/4-1200w.webp", "7/4-160w.webp", "7/4-480w.webp"}, keys)
+}
+
+func TestProcessNext_UnsupportedImageFailsRightAway(t *testing.T) {
+	mock := dbtest.Mock(t)
+	setupStore(t)
+
+	expectClaim(mock, 3, 7, []byte("not an image"), 0)
+	mock.ExpectExec("UPDATE AdImageJob SET status = \\?, data = NULL, last_error = \\?").
+		WithArgs(StatusFailed, "This file "+reasonUnsupported, sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ok, err := ProcessNext()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type failingStore struct{ imagestore.Store }
+
+func (failingStore) Put(string, string, []byte) error {
+	return errors.New("bucket unavailable")
+}
+
+func TestProcessNext_StorageErrorsAreRetried(t *testing.T) {
+	mock := dbtest.Mock(t)
+	imagestore.Set(failingStore{})
+	t.Cleanup(func() { imagestore.Set(nil) })
+
+	expectClaim(mock, 3, 7, testPNG(t), 1)
+	expectAdExists(mock, 7, 1)
+	mock.ExpectExec("UPDATE AdImageJob SET status = \\?, last_error = \\?, next_attempt_at = \\?").
+		WithArgs(StatusPending, errStorage, sqlmock.AnyArg(), sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ok, err := ProcessNext()
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Nothing else is due
+	mock.ExpectQuery("SELECT id, ad_id, filename, data, attempts FROM AdImageJob").
+		WillReturnRows(sqlmock.NewRows(jobColumns))
+	ok, err = ProcessNext()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEncodeVariants(t *testing.T) {
+	variants, err := encodeVariants(testPNG(t))
+	require.NoError(t, err)
+	require.Len(t, variants, len(Variants))
+	for i, v := range Variants {
+		cfg, err := webp.DecodeConfig(bytes.NewReader(variants[i]))
+		require.NoError(t, err)
+		assert.Equal(t, v.Width, cfg.Width)
+		assert.Equal(t, v.Width*3/4, cfg.Height)
+	}
+}
+
+func TestDelete_RemovesEveryStoredSize(t *testing.T) {
+	mock := dbtest.Mock(t)
+	store := setupStore(t)
+	for _, key := range []string{"7/2-160w.webp", "7/2-480w.webp", "7/2-1200w.webp", "7/3-480w.webp"} {
+		require.NoError(t, store.Put(key, "image/webp", []byte("x")))
+	}
+
+	mock.ExpectQuery("SELECT id, ad_id, idx, position, is_primary, variants FROM AdImage WHERE ad_id = \\?").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ad_id", "idx", "position", "is_primary", "variants"}).
+			AddRow(20, 7, 2, 1, true, "160w,480w,1200w").
+			AddRow(21, 7, 3, 2, false, "480w"))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM AdImage WHERE id = \\? AND ad_id = \\?").
+		WithArgs(20, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The remaining image becomes the cover
+	mock.ExpectExec("UPDATE AdImage SET is_primary = 1").
+		WithArgs(7, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE Ad SET image_count").
+		WithArgs(7, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, Delete(7, []int{20, 99}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	keys, err := store.List("7/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7/3-480w.webp"}, keys)
+}
@@ -0,0 +1,98 @@
+package adimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/chai2010/webp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withOrientation inserts an EXIF segment with the given orientation after
+// the JPEG's start marker
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	header := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, header...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func testJPEG(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil))
+	return buf.Bytes()
+}
+
+func TestExifOrientation(t *testing.T) {
+	jpg := testJPEG(t, 300, 200)
+	assert.Equal(t, 1, exifOrientation(jpg))
+	assert.Equal(t, 6, exifOrientation(withOrientation(jpg, 6)))
+	assert.Equal(t, 1, exifOrientation(withOrientation(jpg, 42)))
+	assert.Equal(t, 1, exifOrientation(testPNG(t)))
+	assert.Equal(t, 1, exifOrientation([]byte{0xFF, 0xD8, 0xFF}))
+}
+
+func TestOrient_RotatesRight(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{255, 0, 0, 255}
+	img.Set(0, 0, red)
+
+	out := orient(img, 6)
+	assert.Equal(t, image.Rect(0, 0, 2, 3), out.Bounds())
+	// The top left corner ends up top right
+	assert.Equal(t, red, out.At(1, 0))
+	assert.Equal(t, img, orient(img, 1))
+}
+
+func TestDecode_AppliesOrientation(t *testing.T) {
+	img, err := decode(withOrientation(testJPEG(t, 300, 200), 6))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 200, 300), img.Bounds())
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(Upload{Filename: "ok.png", Data: testPNG(t)}))
+
+	err := Validate(Upload{Filename: "tiny.png", Data: testPNGSized(t, 40, 30)})
+	var invalid *ValidationError
+	require.True(t, errors.As(err, &invalid))
+	assert.Contains(t, err.Error(), "tiny.png is too small (40x30)")
+
+	err = Validate(Upload{Filename: "notes.txt", Data: []byte("hello")})
+	assert.EqualError(t, err, "notes.txt "+reasonUnsupported)
+}
+
+func TestSizeProblem_CapsPixels(t *testing.T) {
+	assert.Empty(t, sizeProblem(4000, 3000))
+	assert.Contains(t, sizeProblem(10000, 8000), "too large")
+}
+
+func TestEncodeVariants_StripsMetadata(t *testing.T) {
+	variants, err := encodeVariants(withOrientation(testJPEG(t, 400, 300), 6))
+	require.NoError(t, err)
+	for _, v := range variants {
+		assert.False(t, bytes.Contains(v, []byte("EXIF")))
+		assert.False(t, bytes.Contains(v, []byte("Exif")))
+		_, err := webp.DecodeConfig(bytes.NewReader(v))
+		assert.NoError(t, err)
+	}
+}
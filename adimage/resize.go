@@ -0,0 +1,108 @@
+package adimage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/chai2010/webp"
+	"github.com/parts-pile/site/config"
+	"golang.org/x/image/draw"
+)
+
+// Variant is one of the sizes every ad image is stored in
+type Variant struct {
+	Width   int
+	Suffix  string
+	Quality float32
+}
+
+// Variants lists the stored sizes, smallest first
+var Variants = []Variant{
+	{160, "160w", 60},
+	{480, "480w", 70},
+	{1200, "1200w", 80},
+}
+
+// ValidationError explains why an upload can't be used
+type ValidationError struct {
+	Filename string
+	Reason   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %s", e.Filename, e.Reason)
+}
+
+// Reasons uploads are rejected, completing "<filename> ..."
+const (
+	reasonUnsupported = "isn't a supported image. Please upload a JPEG, PNG or GIF."
+)
+
+// sizeProblem returns why an image of the given dimensions can't be used, or
+// an empty string when it's fine
+func sizeProblem(width, height int) string {
+	if min(width, height) < config.ImageMinDimension {
+		return fmt.Sprintf("is too small (%dx%d). Images need to be at least %d pixels on each side.",
+			width, height, config.ImageMinDimension)
+	}
+	if int64(width)*int64(height) > config.ImageMaxPixels {
+		return fmt.Sprintf("is too large (%dx%d). Images can have at most %d megapixels.",
+			width, height, config.ImageMaxPixels/1_000_000)
+	}
+	return ""
+}
+
+// Validate checks an upload can be processed before it is queued. Only the
+// image header is read, so this is cheap enough to run in the request.
+func Validate(u Upload) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(u.Data))
+	if err != nil {
+		return &ValidationError{Filename: u.Filename, Reason: reasonUnsupported}
+	}
+	if problem := sizeProblem(cfg.Width, cfg.Height); problem != "" {
+		return &ValidationError{Filename: u.Filename, Reason: problem}
+	}
+	return nil
+}
+
+// decode decodes an upload and turns it upright. The size is checked from the
+// header first so oversized images are never decoded. Decoding leaves all
+// metadata such as EXIF GPS positions behind.
+func decode(data []byte) (image.Image, error) {
+	if err := Validate(Upload{Filename: "This file", Data: data}); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ValidationError{Filename: "This file", Reason: reasonUnsupported}
+	}
+	return orient(img, exifOrientation(data)), nil
+}
+
+// encodeVariants decodes an uploaded image and encodes it as WebP in every
+// variant size, in the order of Variants. The WebP files carry no metadata.
+func encodeVariants(data []byte) ([][]byte, error) {
+	img, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+
+	encoded := make([][]byte, 0, len(Variants))
+	for _, v := range Variants {
+		h := max(bounds.Dy()*v.Width/bounds.Dx(), 1)
+		dst := image.NewRGBA(image.Rect(0, 0, v.Width, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+
+		var buf bytes.Buffer
+		if err := webp.Encode(&buf, dst, &webp.Options{Lossless: false, Quality: v.Quality}); err != nil {
+			return nil, fmt.Errorf("encode %s: %w", v.Suffix, err)
+		}
+		encoded = append(encoded, buf.Bytes())
+	}
+	return encoded, nil
+}
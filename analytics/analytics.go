@@ -0,0 +1,323 @@
+package analytics
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+)
+
+// EventType is something that happened to an ad
+type EventType string
+
+const (
+	// EventImpression is an ad shown in search results, the feed, a tree leaf
+	// or on the map
+	EventImpression EventType = "impression"
+	// EventView is an ad's details being opened
+	EventView EventType = "view"
+	// EventBookmark is an ad being bookmarked
+	EventBookmark EventType = "bookmark"
+	// EventConversation is a buyer starting a conversation about an ad
+	EventConversation EventType = "conversation"
+	// EventRock is a rock thrown at an ad
+	EventRock EventType = "rock"
+)
+
+// EventTypes lists the event types in the order the dashboard shows them
+var EventTypes = []EventType{EventImpression, EventView, EventBookmark, EventConversation, EventRock}
+
+// Label returns the event type as shown to sellers
+func (t EventType) Label() string {
+	switch t {
+	case EventImpression:
+		return "Impressions"
+	case EventView:
+		return "Views"
+	case EventBookmark:
+		return "Bookmarks"
+	case EventConversation:
+		return "Conversations"
+	case EventRock:
+		return "Rocks"
+	}
+	return string(t)
+}
+
+// Source is where the visitor found the ad
+type Source string
+
+const (
+	SourceSearch Source = "search"
+	SourceFeed   Source = "feed"
+	SourceTree   Source = "tree"
+	SourceMap    Source = "map"
+	// SourceDirect covers everything outside the search page: ad links,
+	// bookmarks and messages
+	SourceDirect Source = "direct"
+)
+
+// Sources lists the sources in the order the dashboard shows them
+var Sources = []Source{SourceSearch, SourceFeed, SourceTree, SourceMap, SourceDirect}
+
+// Label returns the source as shown to sellers
+func (s Source) Label() string {
+	switch s {
+	case SourceSearch:
+		return "Search query"
+	case SourceFeed:
+		return "Feed"
+	case SourceTree:
+		return "Tree"
+	case SourceMap:
+		return "Map"
+	case SourceDirect:
+		return "Direct"
+	}
+	return string(s)
+}
+
+// SourceFor returns the source for a results view and search query. The tree
+// and map views count as their own sources; list and grid results are a
+// search when there is a query and the personalized feed otherwise.
+func SourceFor(view, query string) Source {
+	switch view {
+	case "tree":
+		return SourceTree
+	case "map":
+		return SourceMap
+	}
+	if strings.TrimSpace(query) != "" {
+		return SourceSearch
+	}
+	return SourceFeed
+}
+
+// RecordEvent records a single event for an ad
+func RecordEvent(adID int, eventType EventType, source Source) error {
+	_, err := db.Exec(`INSERT INTO AdEvent (ad_id, event_type, source, created_at) VALUES (?, ?, ?, ?)`,
+		adID, eventType, source, time.Now().UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// RecordImpressions records an impression for each ad shown in a page of results
+func RecordImpressions(adIDs []int, source Source) error {
+	if len(adIDs) == 0 {
+		return nil
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	values := make([]string, 0, len(adIDs))
+	args := make([]interface{}, 0, len(adIDs)*4)
+	for _, adID := range adIDs {
+		values = append(values, "(?, ?, ?, ?)")
+		args = append(args, adID, EventImpression, source, now)
+	}
+	_, err := db.Exec(`INSERT INTO AdEvent (ad_id, event_type, source, created_at) VALUES `+strings.Join(values, ", "), args...)
+	return err
+}
+
+// RollupEvents folds the raw events into the daily counts and deletes them.
+// It returns the number of raw events rolled up.
+func RollupEvents() (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var maxID sql.NullInt64
+	if err := tx.QueryRow(`SELECT MAX(id) FROM AdEvent`).Scan(&maxID); err != nil {
+		return 0, err
+	}
+	if !maxID.Valid {
+		return 0, nil
+	}
+
+	if _, err := tx.Exec(`INSERT INTO AdEventDaily (ad_id, day, event_type, source, count)
+		SELECT ad_id, date(created_at), event_type, source, COUNT(*)
+		FROM AdEvent
+		WHERE id <= ?
+		GROUP BY ad_id, date(created_at), event_type, source
+		ON CONFLICT(ad_id, day, event_type, source) DO UPDATE SET count = count + excluded.count`,
+		maxID.Int64); err != nil {
+		return 0, fmt.Errorf("error rolling up events: %w", err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM AdEvent WHERE id <= ?`, maxID.Int64)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting rolled up events: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, tx.Commit()
+}
+
+// StartRollupProcessor periodically rolls up raw events in the background
+func StartRollupProcessor() {
+	go func() {
+		log.Printf("[analytics] Rollup processor started")
+		ticker := time.NewTicker(config.AnalyticsRollupInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := RollupEvents()
+			if err != nil {
+				log.Printf("[analytics] Failed to roll up events: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("[analytics] Rolled up %d events", n)
+			}
+		}
+	}()
+}
+
+// dailyEvents combines the rolled up counts with the raw events not yet
+// rolled up, so the dashboard is current between rollups
+const dailyEvents = `
+	WITH events AS (
+		SELECT ad_id, day, event_type, source, count FROM AdEventDaily
+		UNION ALL
+		SELECT ad_id, date(created_at), event_type, source, COUNT(*) FROM AdEvent
+		GROUP BY ad_id, date(created_at), event_type, source
+	)`
+
+// Series holds an ad's daily event counts, oldest day first
+type Series struct {
+	Days   []time.Time
+	Counts map[EventType][]int
+}
+
+// Total returns the number of events of a type across the series
+func (s Series) Total(eventType EventType) int {
+	total := 0
+	for _, n := range s.Counts[eventType] {
+		total += n
+	}
+	return total
+}
+
+// Since returns the first UTC day of a window of days ending today
+func Since(days int) time.Time {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	return today.AddDate(0, 0, -(days - 1))
+}
+
+// GetAdSeries returns an ad's daily event counts for each UTC day from since
+// through today. Days without events count zero.
+func GetAdSeries(adID int, since time.Time) (Series, error) {
+	since = since.UTC().Truncate(24 * time.Hour)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	s := Series{Counts: make(map[EventType][]int)}
+	index := make(map[string]int)
+	for day := since; !day.After(today); day = day.AddDate(0, 0, 1) {
+		index[day.Format(time.DateOnly)] = len(s.Days)
+		s.Days = append(s.Days, day)
+	}
+	for _, t := range EventTypes {
+		s.Counts[t] = make([]int, len(s.Days))
+	}
+
+	rows, err := db.Query(dailyEvents+`
+		SELECT day, event_type, SUM(count) FROM events
+		WHERE ad_id = ? AND day >= ?
+		GROUP BY day, event_type`, adID, since.Format(time.DateOnly))
+	if err != nil {
+		return Series{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day string
+		var eventType EventType
+		var count int
+		if err := rows.Scan(&day, &eventType, &count); err != nil {
+			return Series{}, err
+		}
+		i, ok := index[day]
+		if !ok {
+			continue
+		}
+		if counts, ok := s.Counts[eventType]; ok {
+			counts[i] += count
+		}
+	}
+	return s, rows.Err()
+}
+
+// GetAdSources returns an ad's event counts by source since the given day
+func GetAdSources(adID int, since time.Time) (map[Source]map[EventType]int, error) {
+	rows, err := db.Query(dailyEvents+`
+		SELECT source, event_type, SUM(count) FROM events
+		WHERE ad_id = ? AND day >= ?
+		GROUP BY source, event_type`, adID, since.UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := make(map[Source]map[EventType]int)
+	for rows.Next() {
+		var source Source
+		var eventType EventType
+		var count int
+		if err := rows.Scan(&source, &eventType, &count); err != nil {
+			return nil, err
+		}
+		if sources[source] == nil {
+			sources[source] = make(map[EventType]int)
+		}
+		sources[source][eventType] = count
+	}
+	return sources, rows.Err()
+}
+
+// AdSummary is one of a seller's ads with its event totals
+type AdSummary struct {
+	AdID     int
+	Title    string
+	Archived bool
+	Totals   map[EventType]int
+}
+
+// GetSellerSummaries returns the event totals since the given day for each
+// of a seller's ads, newest ad first
+func GetSellerSummaries(userID int, since time.Time) ([]AdSummary, error) {
+	rows, err := db.Query(dailyEvents+`
+		SELECT a.id, COALESCE(a.title, ''), a.deleted_at IS NOT NULL, COALESCE(e.event_type, ''), COALESCE(SUM(e.count), 0)
+		FROM Ad a
+		LEFT JOIN events e ON e.ad_id = a.id AND e.day >= ?
+		WHERE a.user_id = ?
+		GROUP BY a.id, e.event_type
+		ORDER BY a.created_at DESC, a.id DESC`, since.UTC().Format(time.DateOnly), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []AdSummary
+	for rows.Next() {
+		var adID, count int
+		var title string
+		var archived bool
+		var eventType EventType
+		if err := rows.Scan(&adID, &title, &archived, &eventType, &count); err != nil {
+			return nil, err
+		}
+		if len(summaries) == 0 || summaries[len(summaries)-1].AdID != adID {
+			summaries = append(summaries, AdSummary{
+				AdID:     adID,
+				Title:    title,
+				Archived: archived,
+				Totals:   make(map[EventType]int),
+			})
+		}
+		if eventType != "" {
+			summaries[len(summaries)-1].Totals[eventType] = count
+		}
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,111 @@
+package analytics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceFor(t *testing.T) {
+	assert.Equal(t, SourceTree, SourceFor("tree", "alternator"))
+	assert.Equal(t, SourceMap, SourceFor("map", ""))
+	assert.Equal(t, SourceSearch, SourceFor("list", "alternator"))
+	assert.Equal(t, SourceSearch, SourceFor("grid", "alternator"))
+	assert.Equal(t, SourceFeed, SourceFor("list", "  "))
+}
+
+func TestRecordImpressions(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectExec("INSERT INTO AdEvent \\(ad_id, event_type, source, created_at\\) VALUES \\(\\?, \\?, \\?, \\?\\), \\(\\?, \\?, \\?, \\?\\)").
+		WithArgs(3, EventImpression, SourceSearch, sqlmock.AnyArg(), 7, EventImpression, SourceSearch, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+
+	assert.NoError(t, RecordImpressions([]int{3, 7}, SourceSearch))
+	// Empty pages don't touch the database
+	assert.NoError(t, RecordImpressions(nil, SourceFeed))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollupEvents(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT MAX\\(id\\) FROM AdEvent").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(42))
+	mock.ExpectExec("INSERT INTO AdEventDaily .* WHERE id <= \\? .* ON CONFLICT").
+		WithArgs(int64(42)).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec("DELETE FROM AdEvent WHERE id <= \\?").
+		WithArgs(int64(42)).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+	mock.ExpectCommit()
+
+	n, err := RollupEvents()
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRollupEventsNothingToDo(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT MAX\\(id\\) FROM AdEvent").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectRollback()
+
+	n, err := RollupEvents()
+
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAdSeries(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	since := Since(3)
+	today := time.Now().UTC().Format(time.DateOnly)
+	mock.ExpectQuery("WITH events AS .* SELECT day, event_type, SUM\\(count\\) FROM events").
+		WithArgs(5, since.Format(time.DateOnly)).
+		WillReturnRows(sqlmock.NewRows([]string{"day", "event_type", "count"}).
+			AddRow(since.Format(time.DateOnly), "impression", 10).
+			AddRow(today, "impression", 4).
+			AddRow(today, "view", 2))
+
+	series, err := GetAdSeries(5, since)
+
+	require.NoError(t, err)
+	require.Len(t, series.Days, 3)
+	assert.Equal(t, []int{10, 0, 4}, series.Counts[EventImpression])
+	assert.Equal(t, []int{0, 0, 2}, series.Counts[EventView])
+	assert.Equal(t, 14, series.Total(EventImpression))
+	assert.Zero(t, series.Total(EventRock))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSellerSummaries(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectQuery("WITH events AS .* FROM Ad a\\s+LEFT JOIN events e").
+		WithArgs(sqlmock.AnyArg(), 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "archived", "event_type", "count"}).
+			AddRow(2, "Door", false, "", 0).
+			AddRow(1, "Alternator", true, "impression", 30).
+			AddRow(1, "Alternator", true, "view", 6))
+
+	summaries, err := GetSellerSummaries(7, Since(30))
+
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+	assert.Equal(t, AdSummary{AdID: 2, Title: "Door", Totals: map[EventType]int{}}, summaries[0])
+	assert.Equal(t, AdSummary{AdID: 1, Title: "Alternator", Archived: true,
+		Totals: map[EventType]int{EventImpression: 30, EventView: 6}}, summaries[1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,178 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// Scopes limit what a key can do through the API
+const (
+	// ScopeRead reads ads, the catalog and the owner's bookmarks
+	ScopeRead = "read"
+	// ScopeWrite creates, edits and archives the owner's ads and bookmarks
+	ScopeWrite = "write"
+	// ScopeMessages reads and sends the owner's messages
+	ScopeMessages = "messages"
+)
+
+// Scopes lists every scope in the order they're offered
+var Scopes = []string{ScopeRead, ScopeWrite, ScopeMessages}
+
+// tokenPrefix starts every key so leaked keys are easy to recognize
+const tokenPrefix = "pp_"
+
+// displayLength is how much of a key is kept to tell keys apart
+const displayLength = len(tokenPrefix) + 8
+
+var (
+	// ErrInvalidKey is returned for keys that don't exist or were revoked
+	ErrInvalidKey = errors.New("invalid or revoked API key")
+	// ErrNotFound is returned when revoking a key the user doesn't have
+	ErrNotFound = errors.New("API key not found")
+)
+
+// Key is a user's API key. The key itself is only shown once, when created;
+// afterwards it's known by its prefix.
+type Key struct {
+	ID         int        `db:"id"`
+	UserID     int        `db:"user_id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	Scopes     string     `db:"scopes"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+// ScopeList returns the key's scopes
+func (k Key) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// HasScope returns true if the key grants the scope
+func (k Key) HasScope(scope string) bool {
+	return slices.Contains(k.ScopeList(), scope)
+}
+
+// IsRevoked returns true if the key can no longer be used
+func (k Key) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// hash returns the stored form of a key
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeScopes drops unknown and repeated scopes, keeping them in the
+// usual order
+func normalizeScopes(scopes []string) []string {
+	var valid []string
+	for _, s := range Scopes {
+		if slices.Contains(scopes, s) {
+			valid = append(valid, s)
+		}
+	}
+	return valid
+}
+
+// Create makes a new key for the user and returns it along with the key
+// itself, which isn't stored and can't be shown again
+func Create(userID int, name string, scopes []string) (Key, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Key{}, "", fmt.Errorf("Please name the key")
+	}
+	scopes = normalizeScopes(scopes)
+	if len(scopes) == 0 {
+		return Key{}, "", fmt.Errorf("Please choose at least one scope")
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, "", err
+	}
+	token := tokenPrefix + hex.EncodeToString(secret)
+
+	k := Key{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:displayLength],
+		Scopes:    strings.Join(scopes, " "),
+		CreatedAt: time.Now().UTC(),
+	}
+	res, err := db.Exec(`INSERT INTO ApiKey (user_id, name, prefix, key_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		k.UserID, k.Name, k.Prefix, hash(token), k.Scopes, k.CreatedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return Key{}, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Key{}, "", err
+	}
+	k.ID = int(id)
+	return k, token, nil
+}
+
+// Authenticate returns the active key matching the given key and records
+// that it was used
+func Authenticate(token string) (Key, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return Key{}, ErrInvalidKey
+	}
+	var k Key
+	err := db.GetRow(&k, `SELECT id, user_id, name, prefix, scopes, created_at, last_used_at, revoked_at
+		FROM ApiKey WHERE key_hash = ? AND revoked_at IS NULL`, hash(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Key{}, ErrInvalidKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	now := time.Now().UTC()
+	if _, err := db.Exec("UPDATE ApiKey SET last_used_at = ? WHERE id = ?", now.Format(time.RFC3339Nano), k.ID); err != nil {
+		return Key{}, err
+	}
+	k.LastUsedAt = &now
+	return k, nil
+}
+
+// GetKeysForUser returns the user's keys, newest first, including revoked
+// ones so the user can see when they stopped working
+func GetKeysForUser(userID int) ([]Key, error) {
+	var keys []Key
+	err := db.Select(&keys, `SELECT id, user_id, name, prefix, scopes, created_at, last_used_at, revoked_at
+		FROM ApiKey WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+	return keys, err
+}
+
+// CountActiveKeys returns how many of the user's keys still work
+func CountActiveKeys(userID int) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM ApiKey WHERE user_id = ? AND revoked_at IS NULL", userID).Scan(&n)
+	return n, err
+}
+
+// Revoke stops one of the user's keys from working
+func Revoke(userID, id int) error {
+	res, err := db.Exec("UPDATE ApiKey SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339Nano), id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
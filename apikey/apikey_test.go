@@ -0,0 +1,86 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey_Scopes(t *testing.T) {
+	k := Key{Scopes: "read messages"}
+	assert.True(t, k.HasScope(ScopeRead))
+	assert.True(t, k.HasScope(ScopeMessages))
+	assert.False(t, k.HasScope(ScopeWrite))
+
+	assert.Equal(t, []string{ScopeRead, ScopeWrite}, normalizeScopes([]string{"write", "admin", "read", "write"}))
+}
+
+func TestCreate_StoresOnlyTheHash(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectExec("INSERT INTO ApiKey").
+		WithArgs(7, "Sync", sqlmock.AnyArg(), sqlmock.AnyArg(), "read write", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	k, token, err := Create(7, " Sync ", []string{"write", "read"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, k.ID)
+	assert.True(t, strings.HasPrefix(token, tokenPrefix))
+	assert.Equal(t, token[:displayLength], k.Prefix)
+	assert.NotEqual(t, token, hash(token))
+	assert.Len(t, hash(token), 64)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreate_Invalid(t *testing.T) {
+	dbtest.Mock(t)
+	_, _, err := Create(7, "", []string{ScopeRead})
+	assert.Error(t, err)
+	_, _, err = Create(7, "Sync", []string{"admin"})
+	assert.Error(t, err)
+}
+
+func TestAuthenticate(t *testing.T) {
+	mock := dbtest.Mock(t)
+	token := tokenPrefix + "abc123"
+	created := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT id, user_id, name, prefix, scopes, created_at, last_used_at, revoked_at FROM ApiKey WHERE key_hash = \\? AND revoked_at IS NULL").
+		WithArgs(hash(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "created_at", "last_used_at", "revoked_at"}).
+			AddRow(3, 7, "Sync", "pp_abc123", "read", created, nil, nil))
+	mock.ExpectExec("UPDATE ApiKey SET last_used_at = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	k, err := Authenticate(token)
+	require.NoError(t, err)
+	assert.Equal(t, 7, k.UserID)
+	assert.NotNil(t, k.LastUsedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthenticate_Unknown(t *testing.T) {
+	mock := dbtest.Mock(t)
+	_, err := Authenticate("not-a-key")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	mock.ExpectQuery("SELECT id, user_id").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	_, err = Authenticate(tokenPrefix + "revoked")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevoke_OtherUsersKey(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectExec("UPDATE ApiKey SET revoked_at = \\? WHERE id = \\? AND user_id = \\? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 3, 8).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.ErrorIs(t, Revoke(8, 3), ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
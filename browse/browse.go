@@ -0,0 +1,121 @@
+// Package browse builds and resolves the crawlable URLs of the
+// make/year/model/category/subcategory browse tree
+package browse
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/parts-pile/site/part"
+	"github.com/parts-pile/site/vehicle"
+)
+
+// Root is the path every browse page lives under
+const Root = "/parts"
+
+// Levels names the levels of the tree below the root, in URL order
+var Levels = []string{"Make", "Year", "Model", "Category", "Subcategory"}
+
+// Slug turns a catalog name into a URL segment, e.g. "F-150 Super Duty"
+// becomes "f-150-super-duty"
+func Slug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// Path returns the browse page of the given make, year, model, category and
+// subcategory, as far down the tree as names are given
+func Path(names ...string) string {
+	path := Root
+	for _, name := range names {
+		path += "/" + url.PathEscape(Slug(name))
+	}
+	return path
+}
+
+// Children returns the names one level below the given page that have ads,
+// using the same queries as the tree view with engines left open
+func Children(names []string) ([]string, error) {
+	switch len(names) {
+	case 0:
+		return vehicle.GetAdMakes()
+	case 1:
+		return vehicle.GetAdYears(names[0])
+	case 2:
+		return vehicle.GetAdModels(names[0], names[1])
+	case 3:
+		return part.GetAdCategories(names[0], names[1], names[2], "")
+	case 4:
+		return part.GetAdSubCategories(names[0], names[1], names[2], "", names[3])
+	}
+	return nil, nil
+}
+
+// Resolve turns the slugs of a browse URL back into catalog names. ok is
+// false when a slug matches nothing at its level.
+func Resolve(slugs []string) (names []string, ok bool, err error) {
+	if len(slugs) > len(Levels) {
+		return nil, false, nil
+	}
+	for _, slug := range slugs {
+		children, err := Children(names)
+		if err != nil {
+			return nil, false, err
+		}
+		match := ""
+		for _, child := range children {
+			if Slug(child) == Slug(slug) {
+				match = child
+				break
+			}
+		}
+		if match == "" {
+			return nil, false, nil
+		}
+		names = append(names, match)
+	}
+	return names, true, nil
+}
+
+// ResolveModel finds the make's model with the given slug in any year
+func ResolveModel(makeName, slug string) (string, bool, error) {
+	years, err := vehicle.GetAdYears(makeName)
+	if err != nil {
+		return "", false, err
+	}
+	for _, year := range years {
+		models, err := vehicle.GetAdModels(makeName, year)
+		if err != nil {
+			return "", false, err
+		}
+		for _, model := range models {
+			if Slug(model) == Slug(slug) {
+				return model, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// Title reads a page's names as a vehicle and part, e.g. "2005 Ford F-150
+// Electrical"
+func Title(names []string) string {
+	if len(names) >= 2 {
+		ordered := append([]string{names[1], names[0]}, names[2:]...)
+		return strings.Join(ordered, " ")
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,32 @@
+package browse
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "f-150", Slug("F-150"))
+	assert.Equal(t, "f-150-super-duty", Slug(" F-150  Super Duty "))
+	assert.Equal(t, "mercedes-benz", Slug("Mercedes-Benz"))
+	assert.Equal(t, "a-c-heating", Slug("A/C & Heating"))
+	assert.Equal(t, "citroën", Slug("Citroën"))
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/parts", Path())
+	assert.Equal(t, "/parts/ford/2005/f-150/electrical", Path("Ford", "2005", "F-150", "Electrical"))
+}
+
+func TestTitle(t *testing.T) {
+	assert.Equal(t, "", Title(nil))
+	assert.Equal(t, "Ford", Title([]string{"Ford"}))
+	assert.Equal(t, "2005 Ford F-150 Electrical Alternator", Title([]string{"Ford", "2005", "F-150", "Electrical", "Alternator"}))
+}
+
+func TestResolve_TooDeep(t *testing.T) {
+	_, ok, err := Resolve([]string{"a", "b", "c", "d", "e", "f"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -10,7 +10,6 @@ import (
 	"image/png"
 	"log"
 	"math/rand"
-	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -19,11 +18,11 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/parts-pile/site/config"
 	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/imagestore"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/gofont/gomono"
 	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/math/fixed"
-	"gopkg.in/kothar/go-backblaze.v0"
 )
 
 type TestAd struct {
@@ -72,9 +71,9 @@ func main() {
 
 	fmt.Printf("Generated %d images to upload\n", len(imagesToUpload))
 
-	// Batch upload to B2
-	if err := batchUploadToB2(imagesToUpload); err != nil {
-		log.Fatalf("Failed to upload images to B2: %v", err)
+	// Batch upload to the image store
+	if err := batchUpload(imagesToUpload); err != nil {
+		log.Fatalf("Failed to upload images: %v", err)
 	}
 
 	fmt.Println("Test image generation and upload complete!")
@@ -159,18 +158,15 @@ func generateImagesForAds(testAds []TestAd) []ImageToUpload {
 					continue
 				}
 
-				// Create B2 path
-				b2Path := filepath.Join(
-					fmt.Sprintf("%d", ad.ID),
-					fmt.Sprintf("%d-%s.webp", i+1, sz.Suffix),
-				)
+				// Create storage key
+				key := imagestore.AdImageKey(ad.ID, i+1, sz.Suffix)
 
 				imagesToUpload = append(imagesToUpload, ImageToUpload{
 					AdID:     ad.ID,
 					ImageNum: i + 1,
 					Size:     sz.Suffix,
 					Data:     webpBuf.Bytes(),
-					Path:     b2Path,
+					Path:     key,
 				})
 			}
 		}
@@ -293,28 +289,12 @@ func addText(img *image.RGBA, text string, textColor color.Color, imgWidth, imgH
 	d.DrawString(text)
 }
 
-// batchUploadToB2 uploads all images to B2 in batches
-func batchUploadToB2(imagesToUpload []ImageToUpload) error {
-	accountID := config.B2MasterKeyID
-	keyID := config.B2KeyID
-	appKey := config.B2AppKey
-	if accountID == "" || appKey == "" || keyID == "" {
-		return fmt.Errorf("B2 credentials not set in env vars")
-	}
-
-	b2, err := backblaze.NewB2(backblaze.Credentials{
-		AccountID:      accountID,
-		ApplicationKey: appKey,
-		KeyID:          keyID,
-	})
-	if err != nil {
-		return fmt.Errorf("B2 auth error: %v", err)
-	}
-
-	bucket, err := b2.Bucket(config.B2BucketName)
-	if err != nil {
-		return fmt.Errorf("B2 bucket error: %v", err)
+// batchUpload uploads all images to the configured image store in batches
+func batchUpload(imagesToUpload []ImageToUpload) error {
+	if err := imagestore.Init(); err != nil {
+		return err
 	}
+	store := imagestore.Default()
 
 	// Upload in batches with concurrency control
 	batchSize := 10 // Upload 10 images concurrently
@@ -337,12 +317,7 @@ func batchUploadToB2(imagesToUpload []ImageToUpload) error {
 			maxRetries := 3
 			var err error
 			for attempt := 0; attempt < maxRetries; attempt++ {
-				_, err = bucket.UploadTypedFile(
-					imageToUpload.Path,
-					"image/webp",
-					nil,
-					bytes.NewReader(imageToUpload.Data),
-				)
+				err = store.Put(imageToUpload.Path, "image/webp", imageToUpload.Data)
 
 				if err == nil {
 					// Success
@@ -357,7 +332,7 @@ func batchUploadToB2(imagesToUpload []ImageToUpload) error {
 
 				// Log retry attempt
 				if attempt < maxRetries-1 {
-					log.Printf("B2 upload attempt %d failed for %s: %v, retrying...", attempt+1, imageToUpload.Path, err)
+					log.Printf("Upload attempt %d failed for %s: %v, retrying...", attempt+1, imageToUpload.Path, err)
 					// Wait a bit before retry (exponential backoff)
 					time.Sleep(time.Duration(attempt+1) * time.Second)
 				}
@@ -365,7 +340,7 @@ func batchUploadToB2(imagesToUpload []ImageToUpload) error {
 
 			// All retries failed
 			mu.Lock()
-			log.Printf("B2 upload failed after %d attempts for %s: %v", maxRetries, imageToUpload.Path, err)
+			log.Printf("Upload failed after %d attempts for %s: %v", maxRetries, imageToUpload.Path, err)
 			errorCount++
 			mu.Unlock()
 		}(i, img)
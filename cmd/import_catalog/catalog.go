@@ -0,0 +1,693 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/vehicle"
+)
+
+// Catalog is the vehicle and part catalog described by the JSON files, in
+// the formats cmd/rebuild_db reads. A nil field means its file wasn't there,
+// so that part of the catalog is left alone.
+type Catalog struct {
+	Cars            map[string]map[string]map[string][]string // make-year-model.json: make -> year -> model -> engines
+	MakeParents     map[string]string                         // make-parent.json: make -> parent company
+	ParentCompanies map[string]string                         // parent.json: name -> country
+	Categories      map[string][]string                       // part.json: category -> subcategories
+	Attributes      map[string]json.RawMessage                // part-attribute.json: subcategory -> attribute schema
+}
+
+// readJSON decodes a catalog file, reporting whether it exists
+func readJSON(dir, name string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// LoadCatalog reads whichever catalog files are in dir
+func LoadCatalog(dir string) (Catalog, error) {
+	var c Catalog
+	if _, err := readJSON(dir, "make-year-model.json", &c.Cars); err != nil {
+		return c, err
+	}
+
+	var makeParents []struct {
+		Make          string `json:"make"`
+		ParentCompany string `json:"parent_company"`
+	}
+	if found, err := readJSON(dir, "make-parent.json", &makeParents); err != nil {
+		return c, err
+	} else if found {
+		c.MakeParents = make(map[string]string, len(makeParents))
+		for _, mp := range makeParents {
+			c.MakeParents[mp.Make] = mp.ParentCompany
+		}
+	}
+
+	var parents []struct {
+		Name    string `json:"name"`
+		Country string `json:"country"`
+	}
+	if found, err := readJSON(dir, "parent.json", &parents); err != nil {
+		return c, err
+	} else if found {
+		c.ParentCompanies = make(map[string]string, len(parents))
+		for _, pc := range parents {
+			c.ParentCompanies[pc.Name] = pc.Country
+		}
+	}
+
+	if _, err := readJSON(dir, "part.json", &c.Categories); err != nil {
+		return c, err
+	}
+	if _, err := readJSON(dir, "part-attribute.json", &c.Attributes); err != nil {
+		return c, err
+	}
+
+	for _, years := range c.Cars {
+		for year := range years {
+			if _, err := strconv.Atoi(year); err != nil {
+				return c, fmt.Errorf("make-year-model.json: invalid year %q", year)
+			}
+		}
+	}
+	return c, nil
+}
+
+type carKey struct {
+	Make   string
+	Year   int
+	Model  string
+	Engine string
+}
+
+func (k carKey) String() string {
+	return fmt.Sprintf("%s %d %s %s", k.Make, k.Year, k.Model, k.Engine)
+}
+
+type subcategoryKey struct {
+	Category    string
+	Subcategory string
+}
+
+func (k subcategoryKey) String() string {
+	return k.Category + " / " + k.Subcategory
+}
+
+type makeRow struct {
+	ID            int
+	ParentCompany string
+}
+
+type subcategoryRow struct {
+	ID     int
+	Schema string
+}
+
+// snapshot is the catalog as it is in the database, keyed by name
+type snapshot struct {
+	ParentCompanies map[string]int
+	Countries       map[string]string
+	Makes           map[string]makeRow
+	Years           map[int]int
+	Models          map[string]int
+	Engines         map[string]int
+	Cars            map[carKey]bool
+	Categories      map[string]int
+	Subcategories   map[subcategoryKey]subcategoryRow
+	// Retired holds the IDs of the makes, models and engines admins retired
+	Retired map[vehicle.Kind]map[int]bool
+	// Replaced maps the names admins renamed or merged away to the name of
+	// the entry they now belong to
+	Replaced map[vehicle.Kind]map[string]string
+}
+
+// entryID returns the ID of the make, model or engine with this name
+func (s *snapshot) entryID(kind vehicle.Kind, name string) (int, bool) {
+	switch kind {
+	case vehicle.KindMake:
+		m, ok := s.Makes[name]
+		return m.ID, ok
+	case vehicle.KindModel:
+		id, ok := s.Models[name]
+		return id, ok
+	case vehicle.KindEngine:
+		id, ok := s.Engines[name]
+		return id, ok
+	}
+	return 0, false
+}
+
+// resolve returns the name the database uses for a make, model or engine
+// named in the files, following admin renames and merges, and whether that
+// entry is retired. A note is added to ignored for each name that isn't
+// taken as it is.
+func (s *snapshot) resolve(kind vehicle.Kind, name string, ignored map[string]bool) (string, bool) {
+	if _, ok := s.entryID(kind, name); !ok {
+		if current, replaced := s.Replaced[kind][name]; replaced {
+			ignored[fmt.Sprintf("%s: renamed or merged into %s by an admin", name, current)] = true
+			name = current
+		}
+	}
+	id, ok := s.entryID(kind, name)
+	if ok && s.Retired[kind][id] {
+		ignored[name+": retired by an admin"] = true
+		return name, true
+	}
+	return name, false
+}
+
+// loadNames maps each name in a table to its ID. Models and engines may
+// repeat a name; the oldest row wins, as it does everywhere else.
+func loadNames(query string) (map[string]int, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		if _, seen := ids[name]; !seen {
+			ids[name] = id
+		}
+	}
+	return ids, rows.Err()
+}
+
+func loadSnapshot() (*snapshot, error) {
+	s := &snapshot{
+		Countries:     make(map[string]string),
+		Makes:         make(map[string]makeRow),
+		Years:         make(map[int]int),
+		Cars:          make(map[carKey]bool),
+		Subcategories: make(map[subcategoryKey]subcategoryRow),
+		Retired:       make(map[vehicle.Kind]map[int]bool),
+		Replaced:      make(map[vehicle.Kind]map[string]string),
+	}
+	var err error
+	if s.ParentCompanies, err = loadNames("SELECT id, name FROM ParentCompany ORDER BY id"); err != nil {
+		return nil, err
+	}
+	if s.Models, err = loadNames("SELECT id, name FROM Model ORDER BY id"); err != nil {
+		return nil, err
+	}
+	if s.Engines, err = loadNames("SELECT id, name FROM Engine ORDER BY id"); err != nil {
+		return nil, err
+	}
+	if s.Categories, err = loadNames("SELECT id, name FROM PartCategory ORDER BY id"); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT name, COALESCE(country, '') FROM ParentCompany")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, country string
+		if err := rows.Scan(&name, &country); err != nil {
+			return nil, err
+		}
+		s.Countries[name] = country
+	}
+
+	rows, err = db.Query(`SELECT m.id, m.name, COALESCE(pc.name, '') FROM Make m
+		LEFT JOIN ParentCompany pc ON pc.id = m.parent_company_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var m makeRow
+		if err := rows.Scan(&m.ID, &name, &m.ParentCompany); err != nil {
+			return nil, err
+		}
+		s.Makes[name] = m
+	}
+
+	rows, err = db.Query("SELECT id, year FROM Year")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, year int
+		if err := rows.Scan(&id, &year); err != nil {
+			return nil, err
+		}
+		s.Years[year] = id
+	}
+
+	rows, err = db.Query(`SELECT m.name, y.year, mo.name, e.name FROM Car c
+		JOIN Make m ON m.id = c.make_id
+		JOIN Year y ON y.id = c.year_id
+		JOIN Model mo ON mo.id = c.model_id
+		JOIN Engine e ON e.id = c.engine_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k carKey
+		if err := rows.Scan(&k.Make, &k.Year, &k.Model, &k.Engine); err != nil {
+			return nil, err
+		}
+		s.Cars[k] = true
+	}
+
+	for _, kind := range vehicle.Kinds {
+		s.Retired[kind] = make(map[int]bool)
+		s.Replaced[kind] = make(map[string]string)
+	}
+	rows, err = db.Query(`SELECT 'make', id FROM Make WHERE retired_at IS NOT NULL
+		UNION ALL SELECT 'model', id FROM Model WHERE retired_at IS NOT NULL
+		UNION ALL SELECT 'engine', id FROM Engine WHERE retired_at IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind vehicle.Kind
+		var id int
+		if err := rows.Scan(&kind, &id); err != nil {
+			return nil, err
+		}
+		s.Retired[kind][id] = true
+	}
+
+	// Later renames win, and names the entry was renamed back to are its own
+	rows, err = db.Query(`SELECT r.kind, r.name, COALESCE(m.name, mo.name, e.name) FROM CatalogReplacedName r
+		LEFT JOIN Make m ON r.kind = 'make' AND m.id = r.entry_id
+		LEFT JOIN Model mo ON r.kind = 'model' AND mo.id = r.entry_id
+		LEFT JOIN Engine e ON r.kind = 'engine' AND e.id = r.entry_id
+		WHERE COALESCE(m.name, mo.name, e.name) IS NOT NULL
+		ORDER BY r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind vehicle.Kind
+		var name, current string
+		if err := rows.Scan(&kind, &name, &current); err != nil {
+			return nil, err
+		}
+		if _, ok := s.Replaced[kind]; ok && name != current {
+			s.Replaced[kind][name] = current
+		}
+	}
+
+	rows, err = db.Query(`SELECT psc.id, pc.name, psc.name, COALESCE(psc.attribute_schema, '') FROM PartSubCategory psc
+		JOIN PartCategory pc ON pc.id = psc.category_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k subcategoryKey
+		var sub subcategoryRow
+		if err := rows.Scan(&sub.ID, &k.Category, &k.Subcategory, &sub.Schema); err != nil {
+			return nil, err
+		}
+		s.Subcategories[k] = sub
+	}
+	return s, rows.Err()
+}
+
+// Section reports how one part of the catalog differs from the files
+type Section struct {
+	Name     string
+	New      []string
+	Changed  []string
+	Orphaned []string
+	// Ignored entries are in the files but were retired, renamed or merged
+	// by an admin, so they aren't added back
+	Ignored []string
+}
+
+// Report is the difference between the files and the database. Orphaned
+// entries are in the database but not the files; they're only reported,
+// since ads may still use them.
+type Report struct {
+	Sections []Section
+	Warnings []string
+
+	parentCompanies []string
+	countries       []string
+	makes           []string
+	makeParents     map[string]string // make -> parent company
+	years           []int
+	models          []string
+	engines         []string
+	cars            []carKey
+	categories      []string
+	subcategories   []subcategoryKey
+	schemas         []subcategoryKey
+}
+
+// HasChanges reports whether applying the report would write anything
+func (r *Report) HasChanges() bool {
+	for _, s := range r.Sections {
+		if len(s.New) > 0 || len(s.Changed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func sorted(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func orphans[K comparable](inDB map[K]int, inFile map[K]bool, name func(K) string) []string {
+	var out []string
+	for k := range inDB {
+		if !inFile[k] {
+			out = append(out, name(k))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sameSchema compares attribute schemas ignoring whitespace
+func sameSchema(inDB string, inFile json.RawMessage) bool {
+	var a, b bytes.Buffer
+	if json.Compact(&a, []byte(inDB)) != nil || json.Compact(&b, inFile) != nil {
+		return inDB == string(inFile)
+	}
+	return a.String() == b.String()
+}
+
+// Diff compares the catalog files with the database
+func Diff(c Catalog, s *snapshot) *Report {
+	r := &Report{}
+
+	if c.ParentCompanies != nil {
+		sec := Section{Name: "parent companies"}
+		inFile := make(map[string]bool)
+		for _, name := range sortedKeys(c.ParentCompanies) {
+			inFile[name] = true
+			country := c.ParentCompanies[name]
+			if _, ok := s.ParentCompanies[name]; !ok {
+				sec.New = append(sec.New, name)
+				r.parentCompanies = append(r.parentCompanies, name)
+			} else if s.Countries[name] != country {
+				sec.Changed = append(sec.Changed, fmt.Sprintf("%s: country %q -> %q", name, s.Countries[name], country))
+				r.countries = append(r.countries, name)
+			}
+		}
+		sec.Orphaned = orphans(s.ParentCompanies, inFile, func(k string) string { return k })
+		r.Sections = append(r.Sections, sec)
+	}
+
+	if c.Cars != nil {
+		makes := Section{Name: "makes"}
+		years := Section{Name: "years"}
+		models := Section{Name: "models"}
+		engines := Section{Name: "engines"}
+		cars := Section{Name: "cars"}
+		fileMakes, fileYears, fileModels, fileEngines := map[string]bool{}, map[int]bool{}, map[string]bool{}, map[string]bool{}
+		fileCars := map[carKey]bool{}
+		ignoredMakes, ignoredModels, ignoredEngines, ignoredCars := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+		r.makeParents = make(map[string]string)
+
+		for _, fileMake := range sortedKeys(c.Cars) {
+			makeName, makeRetired := s.resolve(vehicle.KindMake, fileMake, ignoredMakes)
+			fileMakes[makeName] = true
+			parent, hasParent := c.MakeParents[fileMake]
+			if _, known := c.ParentCompanies[parent]; hasParent && !known {
+				if _, known = s.ParentCompanies[parent]; !known {
+					r.Warnings = append(r.Warnings, fmt.Sprintf("make %s: unknown parent company %q", fileMake, parent))
+					hasParent = false
+				}
+			}
+			if existing, ok := s.Makes[makeName]; !ok {
+				makes.New = append(makes.New, makeName)
+				r.makes = append(r.makes, makeName)
+			} else if _, seen := r.makeParents[makeName]; hasParent && !seen && !makeRetired && existing.ParentCompany != parent {
+				makes.Changed = append(makes.Changed, fmt.Sprintf("%s: parent company %q -> %q", makeName, existing.ParentCompany, parent))
+				r.makeParents[makeName] = parent
+			}
+			for yearText, modelMap := range c.Cars[fileMake] {
+				year, _ := strconv.Atoi(yearText)
+				fileYears[year] = true
+				for fileModel, engineList := range modelMap {
+					model, modelRetired := s.resolve(vehicle.KindModel, fileModel, ignoredModels)
+					fileModels[model] = true
+					for _, fileEngine := range engineList {
+						engine, engineRetired := s.resolve(vehicle.KindEngine, fileEngine, ignoredEngines)
+						fileEngines[engine] = true
+						k := carKey{makeName, year, model, engine}
+						if fileCars[k] {
+							// Also listed under a name an admin replaced
+							continue
+						}
+						fileCars[k] = true
+						switch {
+						case s.Cars[k]:
+						case makeRetired || modelRetired || engineRetired:
+							ignoredCars[k.String()+": uses a retired make, model or engine"] = true
+						default:
+							r.cars = append(r.cars, k)
+						}
+					}
+				}
+			}
+		}
+
+		for _, year := range sortedInts(fileYears) {
+			if _, ok := s.Years[year]; !ok {
+				years.New = append(years.New, strconv.Itoa(year))
+				r.years = append(r.years, year)
+			}
+		}
+		for _, model := range sorted(fileModels) {
+			if _, ok := s.Models[model]; !ok {
+				models.New = append(models.New, model)
+				r.models = append(r.models, model)
+			}
+		}
+		for _, engine := range sorted(fileEngines) {
+			if _, ok := s.Engines[engine]; !ok {
+				engines.New = append(engines.New, engine)
+				r.engines = append(r.engines, engine)
+			}
+		}
+		sort.Slice(r.cars, func(i, j int) bool { return r.cars[i].String() < r.cars[j].String() })
+		for _, k := range r.cars {
+			cars.New = append(cars.New, k.String())
+		}
+
+		makeIDs := make(map[string]int, len(s.Makes))
+		for name, m := range s.Makes {
+			makeIDs[name] = m.ID
+		}
+		makes.Orphaned = orphans(makeIDs, fileMakes, func(k string) string { return k })
+		years.Orphaned = orphans(s.Years, fileYears, strconv.Itoa)
+		models.Orphaned = orphans(s.Models, fileModels, func(k string) string { return k })
+		engines.Orphaned = orphans(s.Engines, fileEngines, func(k string) string { return k })
+		for k := range s.Cars {
+			if !fileCars[k] {
+				cars.Orphaned = append(cars.Orphaned, k.String())
+			}
+		}
+		sort.Strings(cars.Orphaned)
+		makes.Ignored = sorted(ignoredMakes)
+		models.Ignored = sorted(ignoredModels)
+		engines.Ignored = sorted(ignoredEngines)
+		cars.Ignored = sorted(ignoredCars)
+		r.Sections = append(r.Sections, makes, years, models, engines, cars)
+	}
+
+	if c.Categories != nil {
+		categories := Section{Name: "part categories"}
+		subcategories := Section{Name: "part subcategories"}
+		fileCategories := map[string]bool{}
+		fileSubcategories := map[subcategoryKey]bool{}
+		for _, category := range sortedKeys(c.Categories) {
+			fileCategories[category] = true
+			if _, ok := s.Categories[category]; !ok {
+				categories.New = append(categories.New, category)
+				r.categories = append(r.categories, category)
+			}
+			for _, name := range c.Categories[category] {
+				k := subcategoryKey{category, name}
+				fileSubcategories[k] = true
+				schema, hasSchema := c.Attributes[name]
+				if existing, ok := s.Subcategories[k]; !ok {
+					subcategories.New = append(subcategories.New, k.String())
+					r.subcategories = append(r.subcategories, k)
+				} else if hasSchema && !sameSchema(existing.Schema, schema) {
+					subcategories.Changed = append(subcategories.Changed, k.String()+": attribute schema")
+					r.schemas = append(r.schemas, k)
+				}
+			}
+		}
+		categories.Orphaned = orphans(s.Categories, fileCategories, func(k string) string { return k })
+		for k := range s.Subcategories {
+			if !fileSubcategories[k] {
+				subcategories.Orphaned = append(subcategories.Orphaned, k.String())
+			}
+		}
+		sort.Strings(subcategories.Orphaned)
+		r.Sections = append(r.Sections, categories, subcategories)
+	}
+	return r
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedInts(set map[int]bool) []int {
+	out := make([]int, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Ints(out)
+	return out
+}
+
+func insert(tx *sql.Tx, query string, args ...interface{}) (int, error) {
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// parentCompanyID looks up a make's parent company, which may be missing
+// from both parent.json and the database
+func parentCompanyID(s *snapshot, name string) interface{} {
+	if id, ok := s.ParentCompanies[name]; ok {
+		return id
+	}
+	return nil
+}
+
+// Apply writes the new and changed entries in one transaction. The snapshot
+// is updated with the IDs of inserted rows.
+func Apply(c Catalog, s *snapshot, r *Report) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range r.parentCompanies {
+		id, err := insert(tx, "INSERT INTO ParentCompany (name, country) VALUES (?, ?)", name, c.ParentCompanies[name])
+		if err != nil {
+			return fmt.Errorf("failed to add parent company %s: %w", name, err)
+		}
+		s.ParentCompanies[name] = id
+	}
+	for _, name := range r.countries {
+		if _, err := tx.Exec("UPDATE ParentCompany SET country = ? WHERE id = ?", c.ParentCompanies[name], s.ParentCompanies[name]); err != nil {
+			return fmt.Errorf("failed to update parent company %s: %w", name, err)
+		}
+	}
+
+	for _, name := range r.makes {
+		id, err := insert(tx, "INSERT INTO Make (name, parent_company_id) VALUES (?, ?)", name, parentCompanyID(s, c.MakeParents[name]))
+		if err != nil {
+			return fmt.Errorf("failed to add make %s: %w", name, err)
+		}
+		s.Makes[name] = makeRow{ID: id, ParentCompany: c.MakeParents[name]}
+	}
+	for _, name := range sortedKeys(r.makeParents) {
+		parent := r.makeParents[name]
+		if _, err := tx.Exec("UPDATE Make SET parent_company_id = ? WHERE id = ?", parentCompanyID(s, parent), s.Makes[name].ID); err != nil {
+			return fmt.Errorf("failed to update make %s: %w", name, err)
+		}
+		s.Makes[name] = makeRow{ID: s.Makes[name].ID, ParentCompany: parent}
+	}
+	for _, year := range r.years {
+		if s.Years[year], err = insert(tx, "INSERT INTO Year (year) VALUES (?)", year); err != nil {
+			return fmt.Errorf("failed to add year %d: %w", year, err)
+		}
+	}
+	for _, name := range r.models {
+		if s.Models[name], err = insert(tx, "INSERT INTO Model (name) VALUES (?)", name); err != nil {
+			return fmt.Errorf("failed to add model %s: %w", name, err)
+		}
+	}
+	for _, name := range r.engines {
+		if s.Engines[name], err = insert(tx, "INSERT INTO Engine (name) VALUES (?)", name); err != nil {
+			return fmt.Errorf("failed to add engine %s: %w", name, err)
+		}
+	}
+	if len(r.cars) > 0 {
+		stmt, err := tx.Prepare("INSERT OR IGNORE INTO Car (make_id, year_id, model_id, engine_id) VALUES (?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, k := range r.cars {
+			if _, err := stmt.Exec(s.Makes[k.Make].ID, s.Years[k.Year], s.Models[k.Model], s.Engines[k.Engine]); err != nil {
+				return fmt.Errorf("failed to add car %s: %w", k, err)
+			}
+			s.Cars[k] = true
+		}
+	}
+
+	for _, name := range r.categories {
+		if s.Categories[name], err = insert(tx, "INSERT INTO PartCategory (name) VALUES (?)", name); err != nil {
+			return fmt.Errorf("failed to add part category %s: %w", name, err)
+		}
+	}
+	for _, k := range r.subcategories {
+		var schema interface{}
+		if raw, ok := c.Attributes[k.Subcategory]; ok {
+			schema = string(raw)
+		}
+		id, err := insert(tx, "INSERT INTO PartSubCategory (category_id, name, attribute_schema) VALUES (?, ?, ?)",
+			s.Categories[k.Category], k.Subcategory, schema)
+		if err != nil {
+			return fmt.Errorf("failed to add part subcategory %s: %w", k, err)
+		}
+		s.Subcategories[k] = subcategoryRow{ID: id}
+	}
+	for _, k := range r.schemas {
+		if _, err := tx.Exec("UPDATE PartSubCategory SET attribute_schema = ? WHERE id = ?",
+			string(c.Attributes[k.Subcategory]), s.Subcategories[k].ID); err != nil {
+			return fmt.Errorf("failed to update part subcategory %s: %w", k, err)
+		}
+	}
+	return tx.Commit()
+}
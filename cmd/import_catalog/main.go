@@ -0,0 +1,82 @@
+// Command import_catalog brings a live database's vehicle and part catalog up
+// to date with the JSON files cmd/rebuild_db seeds from, without touching
+// users, ads or messages. It only adds and updates: entries missing from the
+// files are reported as orphaned and left for an admin to merge or retire.
+// Names an admin renamed or merged away are read as the entry they now
+// belong to, and cars using retired makes, models or engines are reported
+// rather than added. Running it twice in a row makes no changes the second
+// time.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+)
+
+func main() {
+	var (
+		dir    = flag.String("dir", "cmd/rebuild_db", "Directory holding make-year-model.json, make-parent.json, parent.json, part.json and part-attribute.json")
+		dbURL  = flag.String("db", config.DatabaseURL, "Database to import into")
+		dryRun = flag.Bool("dry-run", false, "Report what would change without writing anything")
+		limit  = flag.Int("limit", 20, "Entries listed per kind of change (0 lists all)")
+	)
+	flag.Parse()
+
+	catalog, err := LoadCatalog(*dir)
+	if err != nil {
+		log.Fatalf("Failed to load catalog: %v", err)
+	}
+	if err := db.Init(*dbURL); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	snap, err := loadSnapshot()
+	if err != nil {
+		log.Fatalf("Failed to read catalog from database: %v", err)
+	}
+	report := Diff(catalog, snap)
+	printReport(os.Stdout, report, *limit)
+
+	switch {
+	case !report.HasChanges():
+		fmt.Println("Catalog is up to date.")
+	case *dryRun:
+		fmt.Println("Dry run: nothing was written.")
+	default:
+		if err := Apply(catalog, snap, report); err != nil {
+			log.Fatalf("Import failed, nothing was written: %v", err)
+		}
+		fmt.Println("Catalog imported. The site's vehicle cache expires within an hour; clear it under /admin/vehicle-cache to see the changes now.")
+	}
+}
+
+func printList(w io.Writer, mark string, entries []string, limit int) {
+	for i, e := range entries {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(w, "    ... and %d more\n", len(entries)-limit)
+			return
+		}
+		fmt.Fprintf(w, "  %s %s\n", mark, e)
+	}
+}
+
+func printReport(w io.Writer, r *Report, limit int) {
+	for _, s := range r.Sections {
+		fmt.Fprintf(w, "%s: %d new, %d changed, %d orphaned, %d ignored\n", s.Name, len(s.New), len(s.Changed), len(s.Orphaned), len(s.Ignored))
+		printList(w, "+", s.New, limit)
+		printList(w, "~", s.Changed, limit)
+		printList(w, "-", s.Orphaned, limit)
+		printList(w, "!", s.Ignored, limit)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+}
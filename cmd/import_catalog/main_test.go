@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/vehicle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestLoadCatalog(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "make-year-model.json", `{"HONDA": {"2020": {"CIVIC": ["1.5L"]}}}`)
+	writeFile(t, dir, "make-parent.json", `[{"make": "HONDA", "parent_company": "Honda Motor Company"}]`)
+
+	c, err := LoadCatalog(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.5L"}, c.Cars["HONDA"]["2020"]["CIVIC"])
+	assert.Equal(t, "Honda Motor Company", c.MakeParents["HONDA"])
+	assert.Nil(t, c.ParentCompanies, "missing files leave their part of the catalog alone")
+	assert.Nil(t, c.Categories)
+}
+
+func TestLoadCatalog_InvalidYear(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "make-year-model.json", `{"HONDA": {"twenty": {"CIVIC": ["1.5L"]}}}`)
+
+	_, err := LoadCatalog(dir)
+	assert.ErrorContains(t, err, "invalid year")
+}
+
+func emptySnapshot() *snapshot {
+	return &snapshot{
+		ParentCompanies: map[string]int{},
+		Countries:       map[string]string{},
+		Makes:           map[string]makeRow{},
+		Years:           map[int]int{},
+		Models:          map[string]int{},
+		Engines:         map[string]int{},
+		Cars:            map[carKey]bool{},
+		Categories:      map[string]int{},
+		Subcategories:   map[subcategoryKey]subcategoryRow{},
+	}
+}
+
+func section(t *testing.T, r *Report, name string) Section {
+	for _, s := range r.Sections {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no %s section", name)
+	return Section{}
+}
+
+func TestDiff(t *testing.T) {
+	c := Catalog{
+		Cars: map[string]map[string]map[string][]string{
+			"HONDA": {"2020": {"CIVIC": {"1.5L", "2.0L"}}},
+		},
+		MakeParents:     map[string]string{"HONDA": "Honda Motor Company"},
+		ParentCompanies: map[string]string{"Honda Motor Company": "JP"},
+		Categories:      map[string][]string{"Electrical": {"Battery"}},
+		Attributes:      map[string]json.RawMessage{"Battery": json.RawMessage(`{"core_charge": true}`)},
+	}
+	s := emptySnapshot()
+	s.ParentCompanies["Honda Motor Company"] = 1
+	s.Countries["Honda Motor Company"] = "US"
+	s.ParentCompanies["Old Motors"] = 2
+	s.Makes["HONDA"] = makeRow{ID: 1}
+	s.Makes["EDSEL"] = makeRow{ID: 2}
+	s.Years[2020] = 1
+	s.Models["CIVIC"] = 1
+	s.Engines["1.5L"] = 1
+	s.Cars[carKey{"HONDA", 2020, "CIVIC", "1.5L"}] = true
+	s.Categories["Electrical"] = 1
+	s.Subcategories[subcategoryKey{"Electrical", "Battery"}] = subcategoryRow{ID: 1, Schema: "{\n  \"core_charge\": true\n}"}
+
+	r := Diff(c, s)
+	assert.True(t, r.HasChanges())
+
+	pc := section(t, r, "parent companies")
+	assert.Empty(t, pc.New)
+	assert.Equal(t, []string{`Honda Motor Company: country "US" -> "JP"`}, pc.Changed)
+	assert.Equal(t, []string{"Old Motors"}, pc.Orphaned)
+
+	makes := section(t, r, "makes")
+	assert.Empty(t, makes.New)
+	assert.Equal(t, []string{`HONDA: parent company "" -> "Honda Motor Company"`}, makes.Changed)
+	assert.Equal(t, []string{"EDSEL"}, makes.Orphaned)
+
+	assert.Equal(t, []string{"2.0L"}, section(t, r, "engines").New)
+	assert.Equal(t, []string{"HONDA 2020 CIVIC 2.0L"}, section(t, r, "cars").New)
+	assert.Empty(t, section(t, r, "models").New)
+
+	sub := section(t, r, "part subcategories")
+	assert.Empty(t, sub.Changed, "schemas differing only in whitespace are the same")
+}
+
+func TestDiff_UpToDate(t *testing.T) {
+	c := Catalog{
+		Cars:        map[string]map[string]map[string][]string{"HONDA": {"2020": {"CIVIC": {"1.5L"}}}},
+		MakeParents: map[string]string{"HONDA": "Nobody Ltd"},
+	}
+	s := emptySnapshot()
+	s.Makes["HONDA"] = makeRow{ID: 1}
+	s.Years[2020] = 1
+	s.Models["CIVIC"] = 1
+	s.Engines["1.5L"] = 1
+	s.Cars[carKey{"HONDA", 2020, "CIVIC", "1.5L"}] = true
+
+	r := Diff(c, s)
+	assert.False(t, r.HasChanges())
+	assert.Equal(t, []string{`make HONDA: unknown parent company "Nobody Ltd"`}, r.Warnings)
+	assert.Len(t, r.Sections, 5, "only the files that were loaded are compared")
+}
+
+func TestDiff_AdminEdits(t *testing.T) {
+	c := Catalog{
+		Cars: map[string]map[string]map[string][]string{
+			"CHEVY": {"2021": {"MALIBU": {"1.5L"}}},
+			"EDSEL": {"2021": {"CORSAIR": {"5.9L"}}},
+		},
+	}
+	s := emptySnapshot()
+	s.Retired = map[vehicle.Kind]map[int]bool{vehicle.KindMake: {2: true}}
+	s.Replaced = map[vehicle.Kind]map[string]string{vehicle.KindMake: {"CHEVY": "CHEVROLET"}}
+	s.Makes["CHEVROLET"] = makeRow{ID: 1}
+	s.Makes["EDSEL"] = makeRow{ID: 2}
+	s.Years[2021] = 1
+	s.Models["MALIBU"] = 1
+	s.Engines["1.5L"] = 1
+
+	r := Diff(c, s)
+
+	makes := section(t, r, "makes")
+	assert.Empty(t, makes.New, "a renamed make isn't added back under its old name")
+	assert.Empty(t, makes.Orphaned, "the renamed make is still in the files under its old name")
+	assert.Equal(t, []string{"CHEVY: renamed or merged into CHEVROLET by an admin", "EDSEL: retired by an admin"}, makes.Ignored)
+
+	cars := section(t, r, "cars")
+	assert.Equal(t, []string{"CHEVROLET 2021 MALIBU 1.5L"}, cars.New)
+	assert.Equal(t, []string{"EDSEL 2021 CORSAIR 5.9L: uses a retired make, model or engine"}, cars.Ignored)
+}
+
+// useDatabase points the db package at a new SQLite database built from
+// schema.sql
+func useDatabase(t *testing.T) {
+	schema, err := os.ReadFile("../../schema.sql")
+	require.NoError(t, err)
+	sqlDB, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "catalog.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	_, err = sqlDB.Exec(string(schema))
+	require.NoError(t, err)
+	db.SetForTesting(sqlDB)
+}
+
+// importCatalog diffs the catalog against the database and applies it
+func importCatalog(t *testing.T, c Catalog) *Report {
+	s, err := loadSnapshot()
+	require.NoError(t, err)
+	r := Diff(c, s)
+	require.NoError(t, Apply(c, s, r))
+	return r
+}
+
+func TestApply_RunTwice(t *testing.T) {
+	useDatabase(t)
+	c := Catalog{
+		Cars: map[string]map[string]map[string][]string{
+			"HONDA":  {"2020": {"CIVIC": {"1.5L", "2.0L"}}, "2021": {"ACCORD": {"1.5L"}}},
+			"TOYOTA": {"2021": {"CAMRY": {"2.5L"}}},
+		},
+		MakeParents:     map[string]string{"HONDA": "Honda Motor Company"},
+		ParentCompanies: map[string]string{"Honda Motor Company": "JP"},
+		Categories:      map[string][]string{"Electrical": {"Battery", "Alternator"}},
+		Attributes:      map[string]json.RawMessage{"Battery": json.RawMessage(`{"core_charge": true}`)},
+	}
+
+	first := importCatalog(t, c)
+	assert.True(t, first.HasChanges())
+	assert.Len(t, section(t, first, "cars").New, 4)
+
+	second := importCatalog(t, c)
+	assert.False(t, second.HasChanges(), "running the import again changes nothing")
+
+	// An admin renames a make, merges an engine and retires a model
+	hondaID, err := vehicle.FindEntry(vehicle.KindMake, "HONDA")
+	require.NoError(t, err)
+	_, err = vehicle.RenameEntry(vehicle.KindMake, hondaID, "Honda")
+	require.NoError(t, err)
+	fromID, err := vehicle.FindEntry(vehicle.KindEngine, "2.0L")
+	require.NoError(t, err)
+	intoID, err := vehicle.FindEntry(vehicle.KindEngine, "1.5L")
+	require.NoError(t, err)
+	_, err = vehicle.MergeEntry(vehicle.KindEngine, fromID, intoID)
+	require.NoError(t, err)
+	camryID, err := vehicle.FindEntry(vehicle.KindModel, "CAMRY")
+	require.NoError(t, err)
+	require.NoError(t, vehicle.RetireEntry(vehicle.KindModel, camryID, true))
+
+	// The files gain a car on the retired model and one on the old make name
+	c.Cars["TOYOTA"]["2022"] = map[string][]string{"CAMRY": {"2.5L"}}
+	c.Cars["HONDA"]["2022"] = map[string][]string{"CIVIC": {"2.0L"}}
+
+	third := importCatalog(t, c)
+	assert.Empty(t, section(t, third, "makes").New, "the renamed make isn't recreated")
+	assert.Equal(t, []string{"HONDA: renamed or merged into Honda by an admin"}, section(t, third, "makes").Ignored)
+	assert.Empty(t, section(t, third, "engines").New, "the merged engine isn't recreated")
+	assert.Equal(t, []string{"2.0L: renamed or merged into 1.5L by an admin"}, section(t, third, "engines").Ignored)
+	assert.Equal(t, []string{"Honda 2022 CIVIC 1.5L"}, section(t, third, "cars").New)
+	assert.Equal(t, []string{"TOYOTA 2022 CAMRY 2.5L: uses a retired make, model or engine"}, section(t, third, "cars").Ignored)
+
+	fourth := importCatalog(t, c)
+	assert.False(t, fourth.HasChanges(), "admin edits don't make the import change anything on the next run")
+}
+
+func TestPrintReport_Limit(t *testing.T) {
+	r := &Report{Sections: []Section{{Name: "models", New: []string{"A", "B", "C"}, Orphaned: []string{"Z"}, Ignored: []string{"Y: retired by an admin"}}}}
+	var out bytes.Buffer
+	printReport(&out, r, 2)
+	assert.Equal(t, "models: 3 new, 0 changed, 1 orphaned, 1 ignored\n  + A\n  + B\n    ... and 1 more\n  - Z\n  ! Y: retired by an admin\n", out.String())
+}
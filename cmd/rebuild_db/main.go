@@ -26,6 +26,7 @@ func main() {
 
 	jsonFile := "cmd/rebuild_db/make-year-model.json"
 	partFile := "cmd/rebuild_db/part.json"
+	partAttributeFile := "cmd/rebuild_db/part-attribute.json"
 	parentFile := "cmd/rebuild_db/parent.json"
 	makeParentFile := "cmd/rebuild_db/make-parent.json"
 	adFile := "cmd/rebuild_db/ad.json"
@@ -329,6 +330,22 @@ func main() {
 		}
 	}
 
+	// Import part-attribute.json (optional per-subcategory attribute schemas)
+	partAttributeData, err := ioutil.ReadFile(partAttributeFile)
+	if err != nil {
+		log.Fatalf("Failed to read part-attribute.json: %v", err)
+	}
+	var partAttributes map[string]json.RawMessage
+	if err := json.Unmarshal(partAttributeData, &partAttributes); err != nil {
+		log.Fatalf("Failed to parse part-attribute.json: %v", err)
+	}
+	for subcat, schema := range partAttributes {
+		_, err := database.Exec(`UPDATE PartSubCategory SET attribute_schema = ? WHERE name = ?`, string(schema), subcat)
+		if err != nil {
+			log.Printf("Failed to set attribute schema for %s: %v", subcat, err)
+		}
+	}
+
 	// Import user.json
 	userFile := "cmd/rebuild_db/user.json"
 	userData, err := ioutil.ReadFile(userFile)
@@ -502,6 +519,14 @@ func main() {
 		}
 		adID, _ := res.LastInsertId()
 
+		// List the images in the manifest; gen_test_images stores their files
+		for i := 1; i <= numImages; i++ {
+			if _, err := database.Exec(`INSERT INTO AdImage (ad_id, idx, position, is_primary, variants) VALUES (?, ?, ?, ?, '160w,480w,1200w')`,
+				adID, i, i, i == 1); err != nil {
+				log.Printf("Failed to insert AdImage: %v", err)
+			}
+		}
+
 		// Create AdCar relationships for all combinations
 		for _, year := range ad.Years {
 			for _, model := range ad.Models {
@@ -21,6 +21,25 @@ const (
 	B2BucketName           = "parts-pile"
 	B2FileServerURL        = "https://f004.backblazeb2.com/file/parts-pile"
 
+	// Local disk image storage, used when B2 isn't configured
+	LocalImagePath      = "/media/" // URL path images are served from
+	LocalImageURLExpiry = 1 * time.Hour
+
+	// Background image processing
+	ImageJobPollInterval = 2 * time.Second
+	ImageJobRetryDelay   = 30 * time.Second // Doubles with each failed attempt
+	ImageJobMaxAttempts  = 5
+
+	// Upload limits
+	ImageMinDimension = 200        // Shortest side of an upload, in pixels
+	ImageMaxPixels    = 40_000_000 // Decoded size cap, guards against decompression bombs
+	ImageMaxUploads   = 10         // Images sent with one ad form, counting those saved on its draft
+
+	// Ad drafts configuration
+	DraftImageMaxBytes       = ServerUploadLimit   // Images saved on one draft, so it never holds more than a form can send
+	DraftExpiry              = 30 * 24 * time.Hour // Drafts untouched this long are deleted with their images
+	DraftExpirySweepInterval = 1 * time.Hour
+
 	// Qdrant vector database configuration
 	QdrantPort       = 6334
 	QdrantMaxRetries = 10
@@ -42,6 +61,53 @@ const (
 	// Gemini API configuration
 	GeminiEmbeddingModel = "embedding-001"
 
+	// Offer negotiation configuration
+	OfferExpiry              = 48 * time.Hour
+	OfferExpirySweepInterval = 5 * time.Minute
+
+	// Ad expiry configuration
+	AdExpiry              = 90 * 24 * time.Hour // Ads are archived this long after they were listed or renewed
+	AdExpirySweepInterval = 1 * time.Hour
+
+	// Ad analytics configuration
+	AnalyticsRollupInterval = 15 * time.Minute
+	AnalyticsDashboardDays  = 30
+
+	// Browse pages configuration
+	BrowsePageSize = 24 // Ads listed per page
+
+	// Feed configuration
+	FeedSize   = 50               // Newest ads listed in a feed
+	FeedMaxAge = 15 * time.Minute // How long feed readers and proxies may cache a feed
+
+	// Sitemap configuration
+	SitemapMaxURLs       = 50_000          // Per child sitemap, the protocol's limit
+	SitemapCheckInterval = 1 * time.Minute // How often cached sitemaps are checked for ad changes
+
+	// Public API configuration
+	APIRateLimitMax = 120             // Requests per key per window
+	APIRateLimitExp = 1 * time.Minute // Rate limit window
+	APIKeysPerUser  = 10              // Active keys a user may have at once
+
+	// Outbound webhook configuration
+	WebhooksPerUser         = 5
+	WebhookTimeout          = 10 * time.Second
+	WebhookWorkers          = 4 // Deliveries sent at once, so a slow endpoint doesn't hold up the rest
+	WebhookPollInterval     = 5 * time.Second
+	WebhookRetryDelay       = 1 * time.Minute // Doubles with each failed attempt
+	WebhookMaxAttempts      = 8               // After which a delivery is dead-lettered
+	WebhookDeliveriesListed = 25              // Recent deliveries shown in settings
+
+	// Vehicle catalog admin configuration
+	CatalogEntriesListed = 100 // Makes, models or engines shown at once, filtered by name
+
+	// Part number interchange admin configuration
+	PartNumbersListed     = 100 // Part numbers shown at once, filtered by number
+	PartNumberImportShown = 20  // Import warnings shown to the admin
+
+	// Moderation configuration
+	ModerationRockThreshold = 3 // Unresolved rocks that hide an ad until reviewed
+
 	// Password/Argon2 configuration
 	Argon2Memory = 64 * 1024
 
@@ -66,15 +132,30 @@ var (
 	B2AppKey      = getEnvWithDefault("BACKBLAZE_APP_KEY", "")
 	B2BucketID    = getEnvWithDefault("B2_BUCKET_ID", "")
 
+	// Image storage: "b2" or "local". Defaults to B2 when its credentials
+	// are set and local disk otherwise.
+	ImageStoreBackend = getEnvWithDefault("IMAGE_STORE", "")
+	ImageStoreDir     = getEnvWithDefault("IMAGE_STORE_DIR", "data/images")
+	ImageURLSecret    = getEnvWithDefault("IMAGE_URL_SECRET", "")
+
 	// Qdrant vector database configuration
 	QdrantHost       = getEnvWithDefault("QDRANT_HOST", "")
 	QdrantAPIKey     = getEnvWithDefault("QDRANT_API_KEY", "")
 	QdrantCollection = getEnvWithDefault("QDRANT_COLLECTION", "")
 
+	// Ad expiry: the date (YYYY-MM-DD) ads start expiring from. Ads listed
+	// earlier get a full AdExpiry from that date to be renewed. Unset leaves
+	// ad expiry off.
+	AdExpirySince = getEnvWithDefault("AD_EXPIRY_SINCE", "")
+
 	// AI/ML API configuration
 	GeminiAPIKey = getEnvWithDefault("GEMINI_API_KEY", "")
 	GrokAPIKey   = getEnvWithDefault("GROK_API_KEY", "")
 
+	// Content moderation: comma-separated kinds of content (ad, message,
+	// username) screened by Grok after the local rules
+	ModerationGrokKinds = getEnvWithDefault("MODERATION_GROK_KINDS", "username")
+
 	// SMS/Twilio configuration
 	TwilioAccountSID = getEnvWithDefault("TWILIO_ACCOUNT_SID", "")
 	TwilioAuthToken  = getEnvWithDefault("TWILIO_AUTH_TOKEN", "")
@@ -0,0 +1,22 @@
+// Package dbtest points the db package at a mock database for tests
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/parts-pile/site/db"
+)
+
+// Mock replaces the database with a sqlmock one for the rest of the test
+func Mock(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock database: %v", err)
+	}
+	t.Cleanup(func() { mockDB.Close() })
+	db.SetForTesting(sqlx.NewDb(mockDB, "sqlmock"))
+	return mock
+}
@@ -132,6 +132,90 @@ func (s *EmailService) SendNotificationEmail(to, senderName, adTitle, messageCon
 	return s.SendEmail(to, subject, htmlBody)
 }
 
+// SendPriceDropEmail notifies a user that an ad they bookmarked dropped in price
+func (s *EmailService) SendPriceDropEmail(to, adTitle string, oldPrice, newPrice float64, adID int) error {
+	subject := fmt.Sprintf("Price drop: '%s' is now $%.2f", adTitle, newPrice)
+
+	htmlBody := fmt.Sprintf(`
+<html>
+<head>
+    <title>Price Drop</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: #f8f9fa; padding: 20px; border-radius: 8px; margin-bottom: 20px; }
+        .price-box { background-color: #f1f3f4; padding: 15px; border-radius: 6px; margin: 20px 0; }
+        .old-price { text-decoration: line-through; color: #6c757d; }
+        .new-price { color: #16a34a; font-weight: bold; }
+        .button { display: inline-block; background-color: #007bff; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; margin: 20px 0; }
+        .footer { margin-top: 30px; padding-top: 20px; border-top: 1px solid #dee2e6; font-size: 12px; color: #6c757d; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h2 style="margin: 0; color: #495057;">Price Drop on Parts Pile</h2>
+        </div>
+        
+        <p>An ad you bookmarked just got cheaper.</p>
+        <p><strong>Ad:</strong> %s</p>
+        
+        <div class="price-box">
+            <span class="old-price">$%.2f</span> &rarr; <span class="new-price">$%.2f</span>
+        </div>
+        
+        <a href="%s/ad/%d" class="button">View Ad</a>
+        
+        <div class="footer">
+            <p>This is an automated notification from Parts Pile.</p>
+            <p>You can turn off price-drop alerts in your account settings.</p>
+        </div>
+    </div>
+</body>
+</html>`, adTitle, oldPrice, newPrice, config.BaseURL, adID)
+
+	return s.SendEmail(to, subject, htmlBody)
+}
+
+// SendAdExpiredEmail tells a seller that their ad expired and was archived
+func (s *EmailService) SendAdExpiredEmail(to, adTitle string) error {
+	subject := fmt.Sprintf("Your ad '%s' expired", adTitle)
+
+	htmlBody := fmt.Sprintf(`
+<html>
+<head>
+    <title>Ad Expired</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: #f8f9fa; padding: 20px; border-radius: 8px; margin-bottom: 20px; }
+        .button { display: inline-block; background-color: #007bff; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; margin: 20px 0; }
+        .footer { margin-top: 30px; padding-top: 20px; border-top: 1px solid #dee2e6; font-size: 12px; color: #6c757d; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h2 style="margin: 0; color: #495057;">Ad Expired on Parts Pile</h2>
+        </div>
+        
+        <p>Your ad wasn't renewed for a while, so it was archived and no longer shows in search.</p>
+        <p><strong>Ad:</strong> %s</p>
+        <p>Restore it from My Ads to list it again.</p>
+        
+        <a href="%s/my-ads" class="button">Go to My Ads</a>
+        
+        <div class="footer">
+            <p>This is an automated notification from Parts Pile.</p>
+            <p>You can manage your notification preferences in your account settings.</p>
+        </div>
+    </div>
+</body>
+</html>`, adTitle, config.BaseURL)
+
+	return s.SendEmail(to, subject, htmlBody)
+}
+
 // MockEmailService is used for testing without sending actual emails
 type MockEmailService struct {
 	sentEmails []struct {
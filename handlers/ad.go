@@ -6,33 +6,34 @@ import (
 	"mime/multipart"
 
 	"log"
-	"path/filepath"
 
 	"net/http"
 	"time"
 
 	"bytes"
-	"image"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
 
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
 
-	"github.com/chai2010/webp"
 	"github.com/gofiber/fiber/v2"
 	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/adimage"
+	"github.com/parts-pile/site/analytics"
 	"github.com/parts-pile/site/b2util"
 	"github.com/parts-pile/site/config"
 	"github.com/parts-pile/site/db"
 	"github.com/parts-pile/site/grok"
+	"github.com/parts-pile/site/imagestore"
+	"github.com/parts-pile/site/moderation"
+	"github.com/parts-pile/site/notification"
 	"github.com/parts-pile/site/part"
 	"github.com/parts-pile/site/ui"
 	"github.com/parts-pile/site/vector"
 	"github.com/parts-pile/site/vehicle"
-	"golang.org/x/image/draw"
-	"gopkg.in/kothar/go-backblaze.v0"
+	g "maragu.dev/gomponents"
 )
 
 func HandleNewAd(c *fiber.Ctx) error {
@@ -43,7 +44,27 @@ func HandleNewAd(c *fiber.Ctx) error {
 	makes := vehicle.GetMakes()
 	categories := part.GetCategories() // Use cached static data
 
-	return render(c, ui.NewAdPage(currentUser, c.Path(), makes, categories))
+	// Resume a saved draft if one was requested
+	var draft ad.Draft
+	var draftImages []ad.DraftImage
+	var fitmentOpts []ui.FitmentGroupOptions
+	var subcategories []string
+	if draftID := c.QueryInt("draft"); draftID != 0 {
+		draft, err = ad.GetDraft(draftID, currentUser.ID)
+		if err != nil || draft.IsEdit() {
+			return fiber.NewError(fiber.StatusNotFound, "Draft not found")
+		}
+		draftImages, _ = ad.GetDraftImages(draft.ID)
+		f := draft.Fields
+		var draftAd ad.Ad
+		draft.ApplyTo(&draftAd)
+		fitmentOpts = fitmentOptions(draftAd.FitmentGroups())
+		if f.Category != "" {
+			subcategories = part.GetSubCategories(f.Category)
+		}
+	}
+
+	return render(c, ui.NewAdPage(currentUser, c.Path(), draft, draftImages, makes, fitmentOpts, categories, subcategories))
 }
 
 // Helper to resolve location using Grok and upsert into Location table
@@ -114,18 +135,37 @@ func HandleNewAdSubmission(c *fiber.Ctx) error {
 	if err != nil {
 		return ValidationErrorResponse(c, err.Error())
 	}
-	adID := ad.AddAd(newAd)
-	fmt.Printf("[DEBUG] Created ad ID=%d with ImageCount=%d\n", adID, newAd.ImageCount)
+	draft, draftImages := submittedDraft(c, currentUser.ID)
+	uploads, err := validUploads(0, draftImages, imageFiles)
+	if err != nil {
+		return ValidationErrorResponse(c, err.Error())
+	}
+	adID, fitment, err := ad.AddAd(newAd)
+	if errors.Is(err, ad.ErrNoFitmentMatches) {
+		return ValidationErrorResponse(c, "None of the selected vehicles exist in the catalog. Please check the years, models and engines.")
+	}
+	if err != nil {
+		log.Printf("[ad] Failed to create ad: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create ad")
+	}
+	fmt.Printf("[DEBUG] Created ad ID=%d\n", adID)
 	fmt.Printf("[DEBUG] Image files count: %d\n", len(imageFiles))
 	if len(imageFiles) > 0 {
 		for i, file := range imageFiles {
 			fmt.Printf("[DEBUG] Image file %d: %s (size: %d bytes)\n", i+1, file.Filename, file.Size)
 		}
 	}
-	uploadAdImagesToB2(adID, imageFiles)
+	if err := adimage.Enqueue(adID, uploads); err != nil {
+		log.Printf("[images] Failed to queue images for ad %d: %v", adID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "The ad was created but its images could not be saved. Please add them again from the edit page.")
+	}
+	discardDraft(draft)
+	flagScreenedAd(c, adID)
 
-	// Update the ad with the correct ID for embedding processing
+	// Update the ad with the correct ID and the resolved vehicles for
+	// embedding processing
 	newAd.ID = adID
+	newAd.SetFitment(ad.GetVehicleData(adID))
 
 	// Attempt inline vector processing, fallback to queue if it fails
 	log.Printf("[embedding] Attempting inline vector processing for ad %d", adID)
@@ -137,7 +177,7 @@ func HandleNewAdSubmission(c *fiber.Ctx) error {
 		log.Printf("[embedding] Successfully processed ad %d inline", adID)
 	}
 
-	return render(c, ui.SuccessMessage("Ad created successfully", "/"))
+	return render(c, ui.SuccessMessage("Ad created successfully. "+fitment.Summary(), "/"))
 }
 
 func HandleAdPage(c *fiber.Ctx) error {
@@ -173,14 +213,13 @@ func HandleEditAd(c *fiber.Ctx) error {
 		return err
 	}
 
+	// Pick up unsaved changes from an earlier editing session
+	draft, draftImages := editDraft(&adObj)
+
 	// Prepare make options
 	makes := vehicle.GetMakes()
-	// Prepare year checkboxes
-	years := vehicle.GetYears(adObj.Make)
-	// Prepare model checkboxes
-	models := vehicle.GetModels(adObj.Make, adObj.Years)
-	// Prepare engine checkboxes
-	engines := vehicle.GetEngines(adObj.Make, adObj.Years, adObj.Models)
+	// Prepare year/model/engine checkboxes for each fitment group
+	fitmentOpts := fitmentOptions(adObj.FitmentGroups())
 
 	// Get categories (use cached static data)
 	categoryNames := part.GetCategories()
@@ -191,7 +230,7 @@ func HandleEditAd(c *fiber.Ctx) error {
 		subcategoryNames = part.GetSubCategories(adObj.Category.String) // Use cached static data
 	}
 
-	return render(c, ui.EditAdPage(currentUser, c.Path(), adObj, makes, years, models, engines, categoryNames, subcategoryNames))
+	return render(c, ui.EditAdPage(currentUser, c.Path(), adObj, draft, draftImages, makes, fitmentOpts, categoryNames, subcategoryNames))
 }
 
 func HandleUpdateAdSubmission(c *fiber.Ctx) error {
@@ -227,28 +266,61 @@ func HandleUpdateAdSubmission(c *fiber.Ctx) error {
 	if err != nil {
 		return ValidationErrorResponse(c, err.Error())
 	}
-	ad.UpdateAd(updatedAd)
-	// Delete images from B2 if needed
-	if len(deletedImages) > 0 {
-		deleteAdImagesFromB2(updatedAd.ID, deletedImages)
+	draft, draftImages := submittedDraft(c, currentUser.ID)
+	uploads, err := validUploads(adID, draftImages, imageFiles)
+	if err != nil {
+		return ValidationErrorResponse(c, err.Error())
+	}
+	fitment, err := ad.UpdateAd(updatedAd)
+	if errors.Is(err, ad.ErrNoFitmentMatches) {
+		return ValidationErrorResponse(c, "None of the selected vehicles exist in the catalog. Please check the years, models and engines.")
 	}
-	uploadAdImagesToB2(updatedAd.ID, imageFiles)
-
-	// Attempt inline vector processing, fallback to queue if it fails
-	log.Printf("[embedding] Attempting inline vector processing for updated ad %d", adID)
-	err = vector.BuildAdEmbedding(updatedAd)
 	if err != nil {
-		log.Printf("[embedding] Inline processing failed for ad %d: %v, queuing for background processing", adID, err)
-		vector.QueueAd(updatedAd)
+		log.Printf("[ad] Failed to update ad %d: %v", adID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update ad")
+	}
+	updatedAd.SetFitment(ad.GetVehicleData(adID))
+	if updatedAd.Price < existingAd.Price {
+		notifyPriceDrop(updatedAd.ID, existingAd.Price, updatedAd.Price)
+	}
+	// Apply the seller's changes to existing images. New ones show up once
+	// processed.
+	editAdImages(c, adID, deletedImages)
+	updatedAd.Images, err = ad.GetImages(adID)
+	if err != nil {
+		log.Printf("[images] Failed to load images of ad %d: %v", adID, err)
+	}
+	updatedAd.ImageCount = len(updatedAd.Images)
+	if err := adimage.Enqueue(adID, uploads); err != nil {
+		log.Printf("[images] Failed to queue images for ad %d: %v", adID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "The ad was updated but its new images could not be saved. Please add them again.")
+	}
+	discardDraft(draft)
+	flagScreenedAd(c, adID)
+
+	// Hidden ads stay out of search until a moderator reviews the changes
+	if existingAd.IsHidden() {
+		updatedAd.HiddenAt = existingAd.HiddenAt
+		if err := moderation.AdEdited(adID); err != nil {
+			log.Printf("[moderation] Failed to re-queue edited ad %d: %v", adID, err)
+		}
 	} else {
-		log.Printf("[embedding] Successfully processed updated ad %d inline", adID)
+		// Attempt inline vector processing, fallback to queue if it fails
+		log.Printf("[embedding] Attempting inline vector processing for updated ad %d", adID)
+		err = vector.BuildAdEmbedding(updatedAd)
+		if err != nil {
+			log.Printf("[embedding] Inline processing failed for ad %d: %v, queuing for background processing", adID, err)
+			vector.QueueAd(updatedAd)
+		} else {
+			log.Printf("[embedding] Successfully processed updated ad %d inline", adID)
+		}
 	}
 
 	if c.Get("HX-Request") != "" {
 		// For htmx, return the updated detail partial
-		return render(c, ui.AdDetail(updatedAd, getLocation(c), currentUser.ID, getView(c)))
+		return render(c, g.Group{ui.FitmentNotice(fitment), ui.AdDetail(updatedAd, getLocation(c), currentUser.ID, getView(c))})
 	}
-	return render(c, ui.SuccessMessage("Ad updated successfully", fmt.Sprintf("/ad/%d", adID)))
+	return render(c, ui.SuccessMessage("Ad updated successfully. "+fitment.Summary(), fmt.Sprintf("/ad/%d", adID)))
 }
 
 func HandleArchiveAd(c *fiber.Ctx) error {
@@ -305,11 +377,106 @@ func HandleAdDetail(c *fiber.Ctx) error {
 	if !ok {
 		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
 	}
+	if userID != adObj.UserID {
+		recordAdEvent(c, adID, analytics.EventView)
+	}
 	loc := getLocation(c)
 	view := getView(c)
 	return render(c, ui.AdDetail(adObj, loc, userID, view))
 }
 
+// HandleClearAdPending puts the seller's pending ad back on the market
+func HandleClearAdPending(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	adObj, ok := ad.GetAd(adID, currentUser)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	}
+	if _, err := RequireOwnership(c, adObj.UserID); err != nil {
+		return err
+	}
+	if err := ad.ClearAdPending(adID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update ad")
+	}
+	adObj.PendingAt = nil
+	return render(c, ui.AdDetail(adObj, getLocation(c), currentUser.ID, getView(c)))
+}
+
+// HandleAdPriceHistory renders the price trend shown in the ad detail
+func HandleAdPriceHistory(c *fiber.Ctx) error {
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	history, err := ad.GetPriceHistory(adID)
+	if err != nil {
+		log.Printf("[price] Failed to get price history for ad %d: %v", adID, err)
+		return render(c, ui.EmptyResponse())
+	}
+	return render(c, ui.PriceTrend(history, getLocation(c)))
+}
+
+// HandleAdImageStatus shows the seller the processing status of the images
+// they uploaded to an ad
+func HandleAdImageStatus(c *fiber.Ctx) error {
+	adID, err := ownedAdID(c)
+	if err != nil {
+		return err
+	}
+	jobs, err := adimage.GetJobs(adID)
+	if err != nil {
+		log.Printf("[images] Failed to get image jobs for ad %d: %v", adID, err)
+		return render(c, ui.EmptyResponse())
+	}
+	return render(c, ui.AdImageStatus(adID, jobs, c.Query("polled") != ""))
+}
+
+// HandleDismissFailedImages clears the seller's failed uploads from the status
+func HandleDismissFailedImages(c *fiber.Ctx) error {
+	adID, err := ownedAdID(c)
+	if err != nil {
+		return err
+	}
+	if err := adimage.DismissFailed(adID); err != nil {
+		log.Printf("[images] Failed to dismiss failed images for ad %d: %v", adID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to dismiss images")
+	}
+	jobs, err := adimage.GetJobs(adID)
+	if err != nil {
+		log.Printf("[images] Failed to get image jobs for ad %d: %v", adID, err)
+		return render(c, ui.EmptyResponse())
+	}
+	return render(c, ui.AdImageStatus(adID, jobs, false))
+}
+
+// ownedAdID returns the ad ID from the route after checking the current user
+// owns the ad
+func ownedAdID(c *fiber.Ctx) (int, error) {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return 0, err
+	}
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return 0, err
+	}
+	adObj, ok := ad.GetAd(adID, currentUser)
+	if !ok {
+		return 0, fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	}
+	if _, err := RequireOwnership(c, adObj.UserID); err != nil {
+		return 0, err
+	}
+	return adID, nil
+}
+
 // Add this handler for deleting an ad
 func HandleDeleteAd(c *fiber.Ctx) error {
 	adID, err := ParseIntParam(c, "id")
@@ -358,17 +525,16 @@ func HandleEditAdPartial(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	adObj, ok := ad.GetAd(adID, currentUser)
+	adObj, ok := ad.GetAdWithVehicle(adID, currentUser)
 	if !ok {
 		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
 	}
 	if adObj.UserID != currentUser.ID {
 		return fiber.NewError(fiber.StatusForbidden, "You do not own this ad")
 	}
+	draft, draftImages := editDraft(&adObj)
 	makes := vehicle.GetMakes()
-	years := vehicle.GetYears(adObj.Make)
-	models := vehicle.GetModels(adObj.Make, adObj.Years)
-	engines := vehicle.GetEngines(adObj.Make, adObj.Years, adObj.Models)
+	fitmentOpts := fitmentOptions(adObj.FitmentGroups())
 
 	// Get categories (use cached static data)
 	categoryNames := part.GetCategories()
@@ -385,132 +551,67 @@ func HandleEditAdPartial(c *fiber.Ctx) error {
 	if view == "grid" {
 		htmxTarget = fmt.Sprintf("#ad-grid-wrap-%d", adObj.ID)
 	}
-	return render(c, ui.AdEditPartial(adObj, makes, years, models, engines, categoryNames, subcategoryNames, cancelTarget, htmxTarget, view))
+	return render(c, ui.AdEditPartial(adObj, draft, draftImages, makes, fitmentOpts, categoryNames, subcategoryNames, cancelTarget, htmxTarget, view))
 }
 
-// uploadAdImagesToB2 uploads user-uploaded images to B2 with multiple sizes
-func uploadAdImagesToB2(adID int, files []*multipart.FileHeader) {
-	log.Printf("[B2] Starting upload for ad %d with %d images", adID, len(files))
-
-	accountID := config.B2MasterKeyID
-	keyID := config.B2KeyID
-	appKey := config.B2AppKey
-
-	log.Printf("[B2] B2 config check for ad %d: accountID=%s, keyID=%s, appKey=%s", adID,
-		func() string {
-			if accountID == "" {
-				return "EMPTY"
-			} else {
-				return "SET"
-			}
-		}(),
-		func() string {
-			if keyID == "" {
-				return "EMPTY"
-			} else {
-				return "SET"
-			}
-		}(),
-		func() string {
-			if appKey == "" {
-				return "EMPTY"
-			} else {
-				return "SET"
-			}
-		}())
-
-	if accountID == "" || appKey == "" || keyID == "" {
-		log.Printf("[B2] ERROR: B2 credentials not set in env vars for ad %d", adID)
-		return
+// editAdImages deletes, reorders and picks the cover among an ad's existing
+// images as submitted with the edit form
+func editAdImages(c *fiber.Ctx, adID int, deleted []int) {
+	if err := adimage.Delete(adID, deleted); err != nil {
+		log.Printf("[images] Failed to delete images of ad %d: %v", adID, err)
 	}
-
-	b2, err := backblaze.NewB2(backblaze.Credentials{
-		AccountID:      accountID,
-		ApplicationKey: appKey,
-		KeyID:          keyID,
-	})
-	if err != nil {
-		log.Printf("[B2] ERROR: B2 auth error for ad %d: %v", adID, err)
-		return
+	if err := ad.ReorderImages(adID, parseIDList(c.FormValue("existing_image_order"))); err != nil {
+		log.Printf("[images] Failed to reorder images of ad %d: %v", adID, err)
 	}
-
-	log.Printf("[B2] Using bucket name: %s for ad %d", config.B2BucketName, adID)
-	bucket, err := b2.Bucket(config.B2BucketName)
-	if err != nil {
-		log.Printf("[B2] ERROR: B2 bucket error for ad %d: %v", adID, err)
-		return
+	if primary, err := strconv.Atoi(c.FormValue("primary_image")); err == nil && !slices.Contains(deleted, primary) {
+		if err := ad.SetPrimaryImage(adID, primary); err != nil {
+			log.Printf("[images] Failed to set cover image of ad %d: %v", adID, err)
+		}
 	}
-	log.Printf("[B2] Successfully connected to bucket for ad %d", adID)
+}
 
-	sizes := []struct {
-		Width   int
-		Suffix  string
-		Quality float32
-	}{
-		{160, "160w", 60},
-		{480, "480w", 70},
-		{1200, "1200w", 80},
+// validUploads gathers the draft's images and the uploaded files, rejecting
+// the submission if there are too many or any of them can't be used
+func validUploads(adID int, draftImages []ad.DraftImage, files []*multipart.FileHeader) ([]adimage.Upload, error) {
+	uploads := append(draftUploads(draftImages), readImageFiles(adID, files)...)
+	if len(uploads) > config.ImageMaxUploads {
+		return nil, fmt.Errorf("Upload at most %d images at a time", config.ImageMaxUploads)
 	}
+	for _, u := range uploads {
+		if err := adimage.Validate(u); err != nil {
+			return nil, err
+		}
+	}
+	return uploads, nil
+}
 
-	successCount := 0
-	totalExpected := len(files) * len(sizes)
-
+// readImageFiles reads uploaded image files into memory, skipping unreadable ones
+func readImageFiles(adID int, files []*multipart.FileHeader) []adimage.Upload {
+	images := make([]adimage.Upload, 0, len(files))
 	for i, fileHeader := range files {
-		log.Printf("[B2] Processing image %d/%d for ad %d", i+1, len(files), adID)
-
 		file, err := fileHeader.Open()
 		if err != nil {
-			log.Printf("[B2] ERROR: Failed to open file %d for ad %d: %v", i+1, adID, err)
+			log.Printf("[images] ERROR: Failed to open file %d for ad %d: %v", i+1, adID, err)
 			continue
 		}
 
 		var buf bytes.Buffer
 		if _, err := buf.ReadFrom(file); err != nil {
-			log.Printf("[B2] ERROR: Failed to read file %d for ad %d: %v", i+1, adID, err)
+			log.Printf("[images] ERROR: Failed to read file %d for ad %d: %v", i+1, adID, err)
 			file.Close()
 			continue
 		}
 		file.Close()
-
-		img, _, err := image.Decode(bytes.NewReader(buf.Bytes()))
-		if err != nil {
-			log.Printf("[B2] ERROR: Failed to decode image %d for ad %d: %v", i+1, adID, err)
-			continue
-		}
-
-		bounds := img.Bounds()
-		log.Printf("[B2] Image %d for ad %d: %dx%d pixels", i+1, adID, bounds.Dx(), bounds.Dy())
-
-		for _, sz := range sizes {
-			w := sz.Width
-			h := bounds.Dy() * w / bounds.Dx()
-			dst := image.NewRGBA(image.Rect(0, 0, w, h))
-			draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
-
-			var webpBuf bytes.Buffer
-			opt := &webp.Options{Lossless: false, Quality: sz.Quality}
-			if err := webp.Encode(&webpBuf, dst, opt); err != nil {
-				log.Printf("[B2] ERROR: WebP encode error for image %d size %s ad %d: %v", i+1, sz.Suffix, adID, err)
-				continue
-			}
-
-			b2Path := filepath.Join(
-				fmt.Sprintf("%d", adID),
-				fmt.Sprintf("%d-%s.webp", i+1, sz.Suffix),
-			)
-
-			log.Printf("[B2] Uploading %s to %s for ad %d", sz.Suffix, b2Path, adID)
-			_, err = bucket.UploadTypedFile(b2Path, "image/webp", nil, bytes.NewReader(webpBuf.Bytes()))
-			if err != nil {
-				log.Printf("[B2] ERROR: Upload failed for %s to %s ad %d: %v", sz.Suffix, b2Path, adID, err)
-			} else {
-				log.Printf("[B2] SUCCESS: Uploaded %s to %s for ad %d", sz.Suffix, b2Path, adID)
-				successCount++
-			}
-		}
+		images = append(images, adimage.Upload{Filename: fileHeader.Filename, Data: buf.Bytes()})
 	}
+	return images
+}
 
-	log.Printf("[B2] Upload complete for ad %d: %d/%d files uploaded successfully", adID, successCount, totalExpected)
+// AdImageURL is a download token for every image under an ad's prefix
+type AdImageURL struct {
+	Prefix  string `json:"prefix"`
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"` // Unix seconds
 }
 
 // Handler to get a signed B2 download URL for all images under an ad (prefix)
@@ -523,53 +624,26 @@ func HandleAdImageSignedURL(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(fiber.Map{
-		"prefix":  "/" + adID + "/",
-		"token":   token,
-		"expires": time.Now().Unix() + config.B2DownloadTokenExpiry,
+	return c.JSON(AdImageURL{
+		Prefix:  "/" + adID + "/",
+		Token:   token,
+		Expires: time.Now().Unix() + config.B2DownloadTokenExpiry,
 	})
 }
 
-func deleteAdImagesFromB2(adID int, indices []int) {
-	accountID := config.B2MasterKeyID
-	keyID := config.B2KeyID
-	appKey := config.B2AppKey
-	if accountID == "" || appKey == "" || keyID == "" {
-		log.Println("B2 credentials not set in env vars")
-		return
-	}
-	b2, err := backblaze.NewB2(backblaze.Credentials{
-		AccountID:      accountID,
-		ApplicationKey: appKey,
-		KeyID:          keyID,
-	})
-	if err != nil {
-		log.Println("B2 auth error:", err)
-		return
+// HandleStoredImage serves an image from the local image store once its
+// signed URL checks out
+func HandleStoredImage(c *fiber.Ctx) error {
+	local, ok := imagestore.Default().(*imagestore.LocalStore)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Image not found")
 	}
-	bucket, err := b2.Bucket(config.B2BucketName)
+	path, err := local.Open(c.Params("*"), c.Query("expires"), c.Query("sig"))
 	if err != nil {
-		log.Println("B2 bucket error:", err)
-		return
-	}
-	for _, idx := range indices {
-		b2Path := filepath.Join(
-			fmt.Sprintf("%d", adID),
-			fmt.Sprintf("%d.webp", idx),
-		)
-		// List file versions for this file name
-		resp, err := bucket.ListFileVersions(b2Path, "", 10)
-		if err != nil {
-			log.Println("B2 list file versions error for", b2Path, ":", err)
-			continue
-		}
-		for _, file := range resp.Files {
-			_, err := bucket.DeleteFileVersion(file.Name, file.ID)
-			if err != nil {
-				log.Println("B2 delete error for", b2Path, file.ID, ":", err)
-			}
-		}
+		return fiber.NewError(fiber.StatusForbidden, "Image link expired")
 	}
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", int(config.LocalImageURLExpiry/time.Second)))
+	return c.SendFile(path)
 }
 
 // Handler for HTMX image carousel
@@ -578,9 +652,27 @@ func HandleAdImage(c *fiber.Ctx) error {
 	if err != nil {
 		return fiber.NewError(fiber.StatusBadRequest, "Invalid ad ID")
 	}
-	idx, err := c.ParamsInt("idx")
+	imageID, err := c.ParamsInt("imageID")
 	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid image index")
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid image ID")
 	}
-	return render(c, ui.AdCarouselImage(adID, idx))
+	img, err := ad.GetImage(adID, imageID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Image not found")
+	}
+	return render(c, ui.AdCarouselImage(img))
+}
+
+// notifyPriceDrop alerts the ad's bookmarkers about a price drop in the background
+func notifyPriceDrop(adID int, oldPrice, newPrice float64) {
+	notificationService, err := notification.NewNotificationService()
+	if err != nil {
+		log.Printf("Failed to create notification service: %v", err)
+		return
+	}
+	go func() {
+		if err := notificationService.NotifyPriceDrop(adID, oldPrice, newPrice); err != nil {
+			log.Printf("Failed to send price drop notifications for ad %d: %v", adID, err)
+		}
+	}()
 }
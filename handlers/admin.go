@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/parts-pile/site/b2util"
@@ -11,6 +13,16 @@ import (
 	g "maragu.dev/gomponents"
 )
 
+// adminError turns a failed admin change into a notice, logging anything
+// that isn't the admin's mistake under the given log prefix
+func adminError(prefix, action string, err, notFound error) g.Node {
+	if errors.Is(err, notFound) {
+		return ui.ValidationError("That entry no longer exists.")
+	}
+	log.Printf("[%s] Failed to %s: %v", prefix, action, err)
+	return ui.ValidationError(err.Error())
+}
+
 func HandleAdminDashboard(c *fiber.Ctx) error {
 	currentUser, err := CurrentUser(c)
 	if err != nil {
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/analytics"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/ui"
+)
+
+// eventSource works out where the visitor was when they acted on an ad.
+// Search results are only shown on the home page, so anything else is direct;
+// there the last results view and the search box decide the source.
+func eventSource(c *fiber.Ctx) analytics.Source {
+	current := c.Get("HX-Current-URL")
+	if current == "" {
+		current = c.Get(fiber.HeaderReferer)
+	}
+	u, err := url.Parse(current)
+	if current == "" || err != nil || (u.Path != "/" && u.Path != "") {
+		return analytics.SourceDirect
+	}
+
+	query := getQueryParam(c, "q")
+	if query == "" {
+		query = u.Query().Get("q")
+	}
+	return analytics.SourceFor(getCookieLastView(c), query)
+}
+
+// recordAdEvent records an event for an ad, logging rather than failing the
+// request if it can't be stored
+func recordAdEvent(c *fiber.Ctx, adID int, eventType analytics.EventType) {
+	if err := analytics.RecordEvent(adID, eventType, eventSource(c)); err != nil {
+		log.Printf("[analytics] Failed to record %s for ad %d: %v", eventType, adID, err)
+	}
+}
+
+// recordImpressions records impressions for a page of results shown in a view
+func recordImpressions(c *fiber.Ctx, viewType string, adIDs []int) {
+	source := analytics.SourceFor(viewType, getQueryParam(c, "q"))
+	if err := analytics.RecordImpressions(adIDs, source); err != nil {
+		log.Printf("[analytics] Failed to record %d impressions: %v", len(adIDs), err)
+	}
+}
+
+// recordTreeImpressions records impressions for the ads under an expanded tree leaf
+func recordTreeImpressions(c *fiber.Ctx, ads []ad.Ad) {
+	adIDs := make([]int, 0, len(ads))
+	for _, a := range ads {
+		adIDs = append(adIDs, a.ID)
+	}
+	recordImpressions(c, "tree", adIDs)
+}
+
+// HandleAnalyticsPage shows the seller's ads with their recent event totals
+func HandleAnalyticsPage(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	summaries, err := analytics.GetSellerSummaries(currentUser.ID, analytics.Since(config.AnalyticsDashboardDays))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get analytics")
+	}
+	return render(c, ui.AnalyticsPage(summaries, config.AnalyticsDashboardDays, currentUser, c.Path()))
+}
+
+// HandleAdAnalytics shows the daily events and traffic sources of one of the
+// seller's ads
+func HandleAdAnalytics(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	adObj, ok := ad.GetAd(adID, currentUser)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	}
+	if _, err := RequireOwnership(c, adObj.UserID); err != nil {
+		return err
+	}
+
+	since := analytics.Since(config.AnalyticsDashboardDays)
+	series, err := analytics.GetAdSeries(adID, since)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get analytics")
+	}
+	sources, err := analytics.GetAdSources(adID, since)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get analytics")
+	}
+	return render(c, ui.AdAnalyticsPage(adObj, series, sources, currentUser, c.Path()))
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/adimage"
+	"github.com/parts-pile/site/analytics"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/moderation"
+	"github.com/parts-pile/site/part"
+	"github.com/parts-pile/site/partnumber"
+	"github.com/parts-pile/site/vector"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// APIAd is an ad as the API returns it
+type APIAd struct {
+	ID          int     `json:"id"`
+	URL         string  `json:"url"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	// Status is "active", "pending" while a sale is pending, or "hidden"
+	// while moderators review it, which only its seller sees
+	Status      string            `json:"status"`
+	Condition   string            `json:"condition,omitempty"`
+	PartNumber  string            `json:"part_number,omitempty"`
+	Quantity    int               `json:"quantity"`
+	Position    string            `json:"position,omitempty"`
+	CoreCharge  float64           `json:"core_charge,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Subcategory string            `json:"subcategory,omitempty"`
+	Fitment     []ad.FitmentGroup `json:"fitment,omitempty"`
+	Location    *APILocation      `json:"location,omitempty"`
+	Images      []string          `json:"images"`
+	SellerID    int               `json:"seller_id"`
+	Bookmarked  bool              `json:"bookmarked"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// APIImagesQueued answers image uploads, which are processed in the
+// background
+type APIImagesQueued struct {
+	Queued int `json:"queued"`
+}
+
+// APIAdPage is one page of search results
+type APIAdPage struct {
+	Data []APIAd `json:"data"`
+	// NextCursor fetches the next page when passed as cursor; it's empty
+	// on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+type APILocation struct {
+	City      string   `json:"city,omitempty"`
+	AdminArea string   `json:"admin_area,omitempty"`
+	Country   string   `json:"country,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// APIAdInput is the body of requests creating or replacing an ad
+type APIAdInput struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Price       *float64          `json:"price"`
+	Category    string            `json:"category"`
+	Subcategory string            `json:"subcategory"`
+	Fitment     []ad.FitmentGroup `json:"fitment"`
+	// Location is free text such as a city or postal code. Edits keep the
+	// ad's location when it's left out.
+	Location   string  `json:"location"`
+	Condition  string  `json:"condition"`
+	PartNumber string  `json:"part_number"`
+	Quantity   int     `json:"quantity"`
+	Position   string  `json:"position"`
+	CoreCharge float64 `json:"core_charge"`
+}
+
+func apiAd(a ad.Ad) APIAd {
+	status := "active"
+	if a.IsHidden() {
+		status = "hidden"
+	} else if a.IsPending() {
+		status = "pending"
+	}
+	out := APIAd{
+		ID:          a.ID,
+		URL:         siteURL(fmt.Sprintf("/ad/%d", a.ID)),
+		Title:       a.Title,
+		Description: a.Description,
+		Price:       a.Price,
+		Status:      status,
+		Condition:   a.Condition,
+		PartNumber:  a.PartNumber,
+		Quantity:    a.Quantity,
+		Position:    a.Position,
+		CoreCharge:  a.CoreCharge,
+		Category:    a.Category.String,
+		Subcategory: a.SubCategory.String,
+		Fitment:     a.Fitment,
+		Images:      []string{},
+		SellerID:    a.UserID,
+		Bookmarked:  a.Bookmarked,
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.LastChanged(),
+	}
+	if a.City.Valid || a.AdminArea.Valid || a.Country.Valid {
+		out.Location = &APILocation{City: a.City.String, AdminArea: a.AdminArea.String, Country: a.Country.String}
+		if a.Latitude.Valid && a.Longitude.Valid {
+			out.Location.Latitude, out.Location.Longitude = &a.Latitude.Float64, &a.Longitude.Float64
+		}
+	}
+	for _, img := range a.Images {
+		out.Images = append(out.Images, feedImageURL(img))
+	}
+	return out
+}
+
+func apiAds(ads []ad.Ad) []APIAd {
+	out := make([]APIAd, len(ads))
+	for i, a := range ads {
+		out[i] = apiAd(a)
+	}
+	return out
+}
+
+// apiOwnedAd loads an ad from the route for its seller
+func apiOwnedAd(c *fiber.Ctx) (ad.Ad, error) {
+	currentUser, _ := getUser(c)
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return ad.Ad{}, err
+	}
+	adObj, ok := ad.GetAdWithVehicle(adID, currentUser)
+	if !ok {
+		return ad.Ad{}, fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	}
+	if adObj.UserID != currentUser.ID {
+		return ad.Ad{}, fiber.NewError(fiber.StatusForbidden, "You do not own this ad")
+	}
+	return adObj, nil
+}
+
+// buildAdFromAPI validates an ad sent to the API the way BuildAdFromForm
+// validates the ad form
+func buildAdFromAPI(c *fiber.Ctx, in APIAdInput, userID, locationID, adID int) (ad.Ad, error) {
+	// Ads sent without fitment take it from the interchange when their part
+	// number is known
+	if len(in.Fitment) == 0 && in.PartNumber != "" {
+		groups, _, err := partnumber.Fitment(in.PartNumber)
+		if err != nil {
+			log.Printf("[api] Part number fitment lookup failed for %q: %v", in.PartNumber, err)
+		}
+		in.Fitment = groups
+	}
+	switch {
+	case in.Title == "":
+		return ad.Ad{}, fmt.Errorf("Title is required")
+	case in.Description == "":
+		return ad.Ad{}, fmt.Errorf("Description is required")
+	case in.Price == nil:
+		return ad.Ad{}, fmt.Errorf("Price is required")
+	case *in.Price < 0:
+		return ad.Ad{}, fmt.Errorf("Price cannot be negative")
+	case len(in.Fitment) == 0:
+		return ad.Ad{}, fmt.Errorf("Please select a make")
+	}
+	for i, f := range in.Fitment {
+		label := ""
+		if i > 0 {
+			label = fmt.Sprintf("additional make #%d", i)
+		}
+		if err := ValidateFitmentGroup(f, label); err != nil {
+			return ad.Ad{}, err
+		}
+	}
+
+	if _, ok := part.MatchCategory(in.Category); !ok {
+		return ad.Ad{}, fmt.Errorf("invalid category: %s", in.Category)
+	}
+	category, subcategory, ok := part.MatchSubCategory(in.Category, in.Subcategory)
+	if !ok {
+		return ad.Ad{}, fmt.Errorf("invalid subcategory: %s", in.Subcategory)
+	}
+	in.Category, in.Subcategory = category, subcategory
+	subcategoryID, err := part.GetSubCategoryID(in.Category, in.Subcategory)
+	if err != nil {
+		return ad.Ad{}, fmt.Errorf("invalid subcategory: %s", in.Subcategory)
+	}
+
+	// The attributes share the form's validation, so pass them as a form
+	attrs := &multipart.Form{Value: map[string][]string{
+		ad.AttrCondition:  {in.Condition},
+		ad.AttrPartNumber: {in.PartNumber},
+		ad.AttrPosition:   {in.Position},
+	}}
+	if in.Quantity != 0 {
+		attrs.Value[ad.AttrQuantity] = []string{strconv.Itoa(in.Quantity)}
+	}
+	if in.CoreCharge != 0 {
+		attrs.Value[ad.AttrCoreCharge] = []string{strconv.FormatFloat(in.CoreCharge, 'f', -1, 64)}
+	}
+	condition, partNumber, quantity, position, coreCharge, err := ValidatePartAttributes(attrs, part.GetAttributeSchema(in.Subcategory))
+	if err != nil {
+		return ad.Ad{}, err
+	}
+	if err := screenAd(c, in.Title, in.Description, partNumber); err != nil {
+		return ad.Ad{}, err
+	}
+
+	adObj := ad.Ad{
+		ID:            adID,
+		Title:         in.Title,
+		SubCategoryID: subcategoryID,
+		Description:   in.Description,
+		Price:         *in.Price,
+		UserID:        userID,
+		LocationID:    locationID,
+		Condition:     condition,
+		PartNumber:    partNumber,
+		Quantity:      quantity,
+		Position:      position,
+		CoreCharge:    coreCharge,
+	}
+	adObj.Category.String, adObj.Category.Valid = in.Category, true
+	adObj.SetFitment(in.Fitment)
+	return adObj, nil
+}
+
+// embedAd indexes a saved ad for search, queuing it if that fails
+func embedAd(a ad.Ad) {
+	if err := vector.BuildAdEmbedding(a); err != nil {
+		log.Printf("[embedding] Inline processing failed for ad %d: %v, queuing for background processing", a.ID, err)
+		vector.QueueAd(a)
+	}
+}
+
+// apiSearchFilter builds the vector search filter from the vehicle, category
+// and bounding box query parameters
+func apiSearchFilter(c *fiber.Ctx) (*qdrant.Filter, error) {
+	filter := vector.BuildTreeFilter(map[string]string{
+		"make":        c.Query("make"),
+		"year":        c.Query("year"),
+		"model":       c.Query("model"),
+		"engine":      c.Query("engine"),
+		"category":    c.Query("category"),
+		"subcategory": c.Query("subcategory"),
+	})
+	if c.Query("minLat") == "" && c.Query("maxLat") == "" && c.Query("minLon") == "" && c.Query("maxLon") == "" {
+		return filter, nil
+	}
+	bounds := extractMapBounds(c)
+	if bounds == nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "minLat, maxLat, minLon and maxLon must all be numbers")
+	}
+	geo := vector.BuildBoundingBoxGeoFilter(bounds.MinLat, bounds.MaxLat, bounds.MinLon, bounds.MaxLon)
+	if filter == nil {
+		return geo, nil
+	}
+	filter.Must = append(filter.Must, geo.Must...)
+	return filter, nil
+}
+
+// HandleAPISearchAds searches ads by text and filters, a page at a time.
+// Pass next_cursor back as cursor for the next page.
+func HandleAPISearchAds(c *fiber.Ctx) error {
+	filter, err := apiSearchFilter(c)
+	if err != nil {
+		return err
+	}
+	currentUser, _ := getUser(c)
+	ids, nextCursor, err := performSearch(c.Query("q"), currentUser, c.Query("cursor"), getThreshold(c), config.QdrantSearchPageSize, filter)
+	if err != nil {
+		log.Printf("[api] Search failed: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Search failed")
+	}
+	ads, err := ad.GetAdsByIDs(ids, currentUser)
+	if err != nil {
+		log.Printf("[api] Failed to load search results: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load ads")
+	}
+	return c.JSON(APIAdPage{Data: apiAds(ads), NextCursor: nextCursor})
+}
+
+// HandleAPIGetAd returns one ad with its fitment
+func HandleAPIGetAd(c *fiber.Ctx) error {
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	currentUser, _ := getUser(c)
+	adObj, ok := ad.GetAdWithVehicle(adID, currentUser)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	}
+	return apiData(c, fiber.StatusOK, apiAd(adObj))
+}
+
+// HandleAPIMyAds lists the key owner's current ads, including hidden ones
+func HandleAPIMyAds(c *fiber.Ctx) error {
+	currentUser, _ := getUser(c)
+	owned, err := ad.GetAdsByUser(currentUser.ID, false)
+	if err != nil {
+		log.Printf("[api] Failed to load ads of user %d: %v", currentUser.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load ads")
+	}
+	ids := make([]int, len(owned))
+	for i, a := range owned {
+		ids[i] = a.ID
+	}
+	// Reload through the public query, which includes the images
+	ads, err := ad.GetAdsByIDs(ids, currentUser)
+	if err != nil {
+		log.Printf("[api] Failed to load ads of user %d: %v", currentUser.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load ads")
+	}
+	return apiData(c, fiber.StatusOK, apiAds(ads))
+}
+
+// HandleAPICreateAd creates an ad from a JSON body. Images are added
+// afterwards with HandleAPIAddAdImages.
+func HandleAPICreateAd(c *fiber.Ctx) error {
+	currentUser, _ := getUser(c)
+	var in APIAdInput
+	if err := c.BodyParser(&in); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	locID, err := resolveAndStoreLocation(in.Location)
+	if err != nil {
+		return apiInvalid(errors.New("Could not resolve location."))
+	}
+	newAd, err := buildAdFromAPI(c, in, currentUser.ID, locID, 0)
+	if err != nil {
+		return apiInvalid(err)
+	}
+	adID, _, err := ad.AddAd(newAd)
+	if errors.Is(err, ad.ErrNoFitmentMatches) {
+		return apiInvalid(errors.New("None of the selected vehicles exist in the catalog. Please check the years, models and engines."))
+	}
+	if err != nil {
+		log.Printf("[api] Failed to create ad: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create ad")
+	}
+	flagScreenedAd(c, adID)
+	newAd.ID = adID
+	newAd.SetFitment(ad.GetVehicleData(adID))
+	embedAd(newAd)
+
+	created, ok := ad.GetAdWithVehicle(adID, currentUser)
+	if !ok {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load the new ad")
+	}
+	c.Location(fmt.Sprintf("/api/v1/ads/%d", adID))
+	return apiData(c, fiber.StatusCreated, apiAd(created))
+}
+
+// HandleAPIUpdateAd replaces one of the key owner's ads with a JSON body
+func HandleAPIUpdateAd(c *fiber.Ctx) error {
+	currentUser, _ := getUser(c)
+	existingAd, err := apiOwnedAd(c)
+	if err != nil {
+		return err
+	}
+	var in APIAdInput
+	if err := c.BodyParser(&in); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	locID := existingAd.LocationID
+	if in.Location != "" {
+		if locID, err = resolveAndStoreLocation(in.Location); err != nil {
+			return apiInvalid(errors.New("Could not resolve location."))
+		}
+	}
+	updatedAd, err := buildAdFromAPI(c, in, currentUser.ID, locID, existingAd.ID)
+	if err != nil {
+		return apiInvalid(err)
+	}
+	if _, err := ad.UpdateAd(updatedAd); errors.Is(err, ad.ErrNoFitmentMatches) {
+		return apiInvalid(errors.New("None of the selected vehicles exist in the catalog. Please check the years, models and engines."))
+	} else if err != nil {
+		log.Printf("[api] Failed to update ad %d: %v", existingAd.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update ad")
+	}
+	if updatedAd.Price < existingAd.Price {
+		notifyPriceDrop(updatedAd.ID, existingAd.Price, updatedAd.Price)
+	}
+	flagScreenedAd(c, existingAd.ID)
+
+	updated, ok := ad.GetAdWithVehicle(existingAd.ID, currentUser)
+	if !ok {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load the updated ad")
+	}
+	// Hidden ads stay out of search until a moderator reviews the changes
+	if updated.IsHidden() {
+		if err := moderation.AdEdited(updated.ID); err != nil {
+			log.Printf("[moderation] Failed to re-queue edited ad %d: %v", updated.ID, err)
+		}
+	} else {
+		embedAd(updated)
+	}
+	return apiData(c, fiber.StatusOK, apiAd(updated))
+}
+
+// HandleAPIDeleteAd archives one of the key owner's ads
+func HandleAPIDeleteAd(c *fiber.Ctx) error {
+	adObj, err := apiOwnedAd(c)
+	if err != nil {
+		return err
+	}
+	if err := ad.ArchiveAd(adObj.ID); err != nil {
+		log.Printf("[api] Failed to archive ad %d: %v", adObj.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete ad")
+	}
+	if err := vector.DeleteAdEmbedding(adObj.ID); err != nil {
+		log.Printf("Warning: Failed to delete ad %d from vector database: %v", adObj.ID, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleAPIAddAdImages queues images uploaded as multipart "images" files
+// for one of the key owner's ads. They appear on the ad once processed.
+func HandleAPIAddAdImages(c *fiber.Ctx) error {
+	adObj, err := apiOwnedAd(c)
+	if err != nil {
+		return err
+	}
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["images"]) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Upload images as multipart form files named \"images\"")
+	}
+	uploads, err := validUploads(adObj.ID, nil, form.File["images"])
+	if err != nil {
+		return apiInvalid(err)
+	}
+	if err := adimage.Enqueue(adObj.ID, uploads); err != nil {
+		log.Printf("[images] Failed to queue images for ad %d: %v", adObj.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to save images")
+	}
+	return apiData(c, fiber.StatusAccepted, APIImagesQueued{Queued: len(uploads)})
+}
+
+// HandleAPIBookmarks lists the key owner's bookmarked ads
+func HandleAPIBookmarks(c *fiber.Ctx) error {
+	currentUser, userID := getUser(c)
+	adIDs, err := ad.GetBookmarkedAdIDs(userID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get bookmarked ad IDs")
+	}
+	ads, err := ad.GetAdsByIDs(adIDs, currentUser)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get bookmarked ads")
+	}
+	return apiData(c, fiber.StatusOK, apiAds(ads))
+}
+
+// HandleAPIBookmarkAd bookmarks an ad. Bookmarking it again does nothing.
+func HandleAPIBookmarkAd(c *fiber.Ctx) error {
+	currentUser, userID := getUser(c)
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if _, ok := ad.GetAd(adID, currentUser); !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	}
+	if err := ad.BookmarkAd(userID, adID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to bookmark ad")
+	}
+	recordAdEvent(c, adID, analytics.EventBookmark)
+	vector.QueueUserForUpdate(userID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleAPIUnbookmarkAd removes a bookmark
+func HandleAPIUnbookmarkAd(c *fiber.Ctx) error {
+	_, userID := getUser(c)
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := ad.UnbookmarkAd(userID, adID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to unbookmark ad")
+	}
+	vector.QueueUserForUpdate(userID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
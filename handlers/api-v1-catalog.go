@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/part"
+	"github.com/parts-pile/site/vehicle"
+)
+
+// apiList sends a list of names, empty rather than null when there are none
+func apiList(c *fiber.Ctx, names []string) error {
+	if names == nil {
+		names = []string{}
+	}
+	return apiData(c, fiber.StatusOK, names)
+}
+
+// apiQueryValues returns every value of a repeated query parameter, e.g.
+// ?year=2004&year=2005
+func apiQueryValues(c *fiber.Ctx, key string) ([]string, error) {
+	q, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid query string")
+	}
+	return q[key], nil
+}
+
+// apiRequiredQuery returns a required query parameter
+func apiRequiredQuery(c *fiber.Ctx, key string) (string, error) {
+	value := c.Query(key)
+	if value == "" {
+		return "", fiber.NewError(fiber.StatusBadRequest, key+" is required")
+	}
+	return value, nil
+}
+
+// HandleAPIMakes lists every make in the vehicle catalog
+func HandleAPIMakes(c *fiber.Ctx) error {
+	return apiList(c, vehicle.GetMakes())
+}
+
+// HandleAPIYears lists a make's years
+func HandleAPIYears(c *fiber.Ctx) error {
+	makeName, err := apiRequiredQuery(c, "make")
+	if err != nil {
+		return err
+	}
+	return apiList(c, vehicle.GetYears(makeName))
+}
+
+// HandleAPIModels lists a make's models in any of the given years
+func HandleAPIModels(c *fiber.Ctx) error {
+	makeName, err := apiRequiredQuery(c, "make")
+	if err != nil {
+		return err
+	}
+	years, err := apiQueryValues(c, "year")
+	if err != nil {
+		return err
+	}
+	if len(years) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one year is required")
+	}
+	return apiList(c, vehicle.GetModels(makeName, years))
+}
+
+// HandleAPIEngines lists the engines of a make's models in the given years
+func HandleAPIEngines(c *fiber.Ctx) error {
+	makeName, err := apiRequiredQuery(c, "make")
+	if err != nil {
+		return err
+	}
+	years, err := apiQueryValues(c, "year")
+	if err != nil {
+		return err
+	}
+	models, err := apiQueryValues(c, "model")
+	if err != nil {
+		return err
+	}
+	if len(years) == 0 || len(models) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "At least one year and one model are required")
+	}
+	return apiList(c, vehicle.GetEngines(makeName, years, models))
+}
+
+// HandleAPICategories lists every part category
+func HandleAPICategories(c *fiber.Ctx) error {
+	return apiList(c, part.GetCategories())
+}
+
+// HandleAPISubCategories lists a category's subcategories
+func HandleAPISubCategories(c *fiber.Ctx) error {
+	category, err := apiRequiredQuery(c, "category")
+	if err != nil {
+		return err
+	}
+	return apiList(c, part.GetSubCategories(category))
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/analytics"
+	"github.com/parts-pile/site/messaging"
+	"github.com/parts-pile/site/moderation"
+	"github.com/parts-pile/site/user"
+)
+
+// APIConversation is a conversation as the API returns it, from the key
+// owner's side
+type APIConversation struct {
+	ID            int        `json:"id"`
+	AdID          int        `json:"ad_id"`
+	AdTitle       string     `json:"ad_title"`
+	OtherUserID   int        `json:"other_user_id"`
+	OtherUserName string     `json:"other_user_name"`
+	LastMessage   string     `json:"last_message,omitempty"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+	UnreadCount   int        `json:"unread_count"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type APIMessage struct {
+	ID         int        `json:"id"`
+	SenderID   int        `json:"sender_id"`
+	SenderName string     `json:"sender_name,omitempty"`
+	Content    string     `json:"content"`
+	Type       string     `json:"type"`
+	OfferID    *int       `json:"offer_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+}
+
+// APIMessageInput is the body of requests sending a message. AdID is only
+// read when starting a conversation.
+type APIMessageInput struct {
+	AdID    int    `json:"ad_id"`
+	Message string `json:"message"`
+}
+
+func apiConversation(conv messaging.Conversation, userID int) APIConversation {
+	out := APIConversation{
+		ID:            conv.ID,
+		AdID:          conv.AdID,
+		AdTitle:       conv.AdTitle,
+		OtherUserID:   conv.User2ID,
+		OtherUserName: conv.User2Name,
+		LastMessage:   conv.LastMessage,
+		UnreadCount:   conv.UnreadCount,
+		UpdatedAt:     conv.UpdatedAt,
+	}
+	if conv.User2ID == userID {
+		out.OtherUserID, out.OtherUserName = conv.User1ID, conv.User1Name
+	}
+	if !conv.LastMessageAt.IsZero() {
+		out.LastMessageAt = &conv.LastMessageAt
+	}
+	return out
+}
+
+func apiMessages(messages []messaging.Message) []APIMessage {
+	out := make([]APIMessage, len(messages))
+	for i, m := range messages {
+		out[i] = APIMessage{
+			ID:         m.ID,
+			SenderID:   m.SenderID,
+			SenderName: m.SenderName,
+			Content:    m.Content,
+			Type:       m.Type,
+			OfferID:    m.OfferID,
+			CreatedAt:  m.CreatedAt,
+			ReadAt:     m.ReadAt,
+		}
+	}
+	return out
+}
+
+// apiConversationForUser loads a conversation from the route for one of its
+// participants
+func apiConversationForUser(c *fiber.Ctx, currentUser *user.User) (messaging.Conversation, error) {
+	conversationID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return messaging.Conversation{}, err
+	}
+	conversation, err := messaging.GetConversationWithDetails(conversationID)
+	if err != nil {
+		return messaging.Conversation{}, fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+	}
+	if conversation.User1ID != currentUser.ID && conversation.User2ID != currentUser.ID {
+		return messaging.Conversation{}, fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+	}
+	return conversation, nil
+}
+
+// parseAPIMessage reads and screens a message sent to the API
+func parseAPIMessage(c *fiber.Ctx) (APIMessageInput, moderation.Verdict, error) {
+	var in APIMessageInput
+	if err := c.BodyParser(&in); err != nil {
+		return in, moderation.Verdict{}, fiber.NewError(fiber.StatusBadRequest, "Invalid JSON body")
+	}
+	in.Message = strings.TrimSpace(in.Message)
+	if in.Message == "" {
+		return in, moderation.Verdict{}, apiInvalid(errors.New("Message cannot be empty"))
+	}
+	verdict := screenContent(moderation.KindMessage, in.Message)
+	if verdict.Outcome == moderation.OutcomeBlock {
+		return in, verdict, apiInvalid(errors.New(verdict.Reason))
+	}
+	return in, verdict, nil
+}
+
+// sendAPIMessage adds a screened message to a conversation and notifies the
+// other participant, as the chat form does
+func sendAPIMessage(conversation messaging.Conversation, senderID int, content string, verdict moderation.Verdict) (messaging.Message, error) {
+	messageID, err := messaging.AddMessage(conversation.ID, senderID, content)
+	if err != nil {
+		log.Printf("[api] Failed to send message in conversation %d: %v", conversation.ID, err)
+		return messaging.Message{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to send message")
+	}
+	flagScreenedMessage(conversation.ID, messageID, senderID, content, verdict)
+	notifyConversationMessage(conversation, senderID, content)
+	return messaging.Message{
+		ID:             messageID,
+		ConversationID: conversation.ID,
+		SenderID:       senderID,
+		Content:        content,
+		Type:           messaging.MessageTypeText,
+		CreatedAt:      time.Now().UTC(),
+	}, nil
+}
+
+// HandleAPIConversations lists the key owner's conversations, most recently
+// active first
+func HandleAPIConversations(c *fiber.Ctx) error {
+	currentUser, _ := getUser(c)
+	conversations, err := messaging.GetConversationsForUser(currentUser.ID)
+	if err != nil {
+		log.Printf("[api] Failed to load conversations of user %d: %v", currentUser.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load conversations")
+	}
+	out := make([]APIConversation, len(conversations))
+	for i, conv := range conversations {
+		out[i] = apiConversation(conv, currentUser.ID)
+	}
+	return apiData(c, fiber.StatusOK, out)
+}
+
+// HandleAPIConversationMessages returns a conversation's messages, oldest
+// first, and marks them read
+func HandleAPIConversationMessages(c *fiber.Ctx) error {
+	currentUser, _ := getUser(c)
+	conversation, err := apiConversationForUser(c, currentUser)
+	if err != nil {
+		return err
+	}
+	if err := messaging.MarkConversationAsRead(conversation.ID, currentUser.ID); err != nil {
+		log.Printf("Failed to mark conversation as read: %v", err)
+	}
+	if err := messaging.MarkMessagesAsRead(conversation.ID, currentUser.ID); err != nil {
+		log.Printf("Failed to mark messages as read: %v", err)
+	}
+	messages, err := messaging.GetMessages(conversation.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load messages")
+	}
+	return apiData(c, fiber.StatusOK, apiMessages(messages))
+}
+
+// HandleAPIStartConversation messages an ad's seller, starting a
+// conversation about the ad or continuing the one already started
+func HandleAPIStartConversation(c *fiber.Ctx) error {
+	currentUser, _ := getUser(c)
+	in, verdict, err := parseAPIMessage(c)
+	if err != nil {
+		return err
+	}
+	adObj, ok := ad.GetAd(in.AdID, currentUser)
+	if !ok {
+		return apiInvalid(errors.New("Ad not found"))
+	}
+	if err := messaging.CanUserMessageAd(currentUser.ID, adObj.UserID); err != nil {
+		return apiInvalid(err)
+	}
+
+	conversationID, err := messaging.FindConversation(currentUser.ID, adObj.UserID, adObj.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create conversation")
+	}
+	status := fiber.StatusOK
+	if conversationID == 0 {
+		conversationID, err = messaging.CreateConversation(currentUser.ID, adObj.UserID, adObj.ID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to create conversation")
+		}
+		recordAdEvent(c, adObj.ID, analytics.EventConversation)
+		status = fiber.StatusCreated
+	}
+	conversation, err := messaging.GetConversationWithDetails(conversationID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load conversation")
+	}
+	if _, err := sendAPIMessage(conversation, currentUser.ID, in.Message, verdict); err != nil {
+		return err
+	}
+
+	c.Location(fmt.Sprintf("/api/v1/conversations/%d/messages", conversationID))
+	return apiData(c, status, apiConversation(conversation, currentUser.ID))
+}
+
+// HandleAPISendMessage sends a message in one of the key owner's
+// conversations
+func HandleAPISendMessage(c *fiber.Ctx) error {
+	currentUser, _ := getUser(c)
+	conversation, err := apiConversationForUser(c, currentUser)
+	if err != nil {
+		return err
+	}
+	in, verdict, err := parseAPIMessage(c)
+	if err != nil {
+		return err
+	}
+	message, err := sendAPIMessage(conversation, currentUser.ID, in.Message, verdict)
+	if err != nil {
+		return err
+	}
+	message.SenderName = currentUser.Name
+	return apiData(c, fiber.StatusCreated, apiMessages([]messaging.Message{message})[0])
+}
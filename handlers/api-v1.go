@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/parts-pile/site/apikey"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/user"
+)
+
+// apiKeyLocal is where APIKeyRequired keeps the request's key
+const apiKeyLocal = "api_key"
+
+// APIError is the body of every failed /api/v1 response
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+type APIErrorDetail struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiErrorCodes gives API clients a stable code to branch on for each status
+var apiErrorCodes = map[int]string{
+	fiber.StatusBadRequest:            "bad_request",
+	fiber.StatusUnauthorized:          "unauthorized",
+	fiber.StatusForbidden:             "forbidden",
+	fiber.StatusNotFound:              "not_found",
+	fiber.StatusMethodNotAllowed:      "method_not_allowed",
+	fiber.StatusConflict:              "conflict",
+	fiber.StatusRequestEntityTooLarge: "too_large",
+	fiber.StatusUnprocessableEntity:   "validation_failed",
+	fiber.StatusTooManyRequests:       "rate_limited",
+	fiber.StatusInternalServerError:   "internal_error",
+}
+
+// apiError writes the error envelope
+func apiError(c *fiber.Ctx, status int, message string) error {
+	code, ok := apiErrorCodes[status]
+	if !ok {
+		code = "error"
+	}
+	return c.Status(status).JSON(APIError{Error: APIErrorDetail{Status: status, Code: code, Message: message}})
+}
+
+// apiData writes a successful response, wrapping the payload as {"data": ...}
+func apiData(c *fiber.Ctx, status int, data any) error {
+	return c.Status(status).JSON(fiber.Map{"data": data})
+}
+
+// apiInvalid is returned by API handlers for request bodies that fail
+// validation
+func apiInvalid(err error) error {
+	return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+}
+
+// APIErrors turns any error returned below it into the error envelope, so
+// API clients never see the HTML error page
+func APIErrors(c *fiber.Ctx) error {
+	err := c.Next()
+	if err == nil {
+		return nil
+	}
+	var e *fiber.Error
+	if errors.As(err, &e) {
+		return apiError(c, e.Code, e.Message)
+	}
+	log.Printf("[api] %s %s failed: %v", c.Method(), c.Path(), err)
+	return apiError(c, fiber.StatusInternalServerError, "Something went wrong")
+}
+
+// HandleAPINotFound answers requests to routes the API doesn't have
+func HandleAPINotFound(c *fiber.Ctx) error {
+	return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("No such endpoint: %s %s", c.Method(), c.Path()))
+}
+
+// apiToken returns the API key sent as a bearer token or in X-API-Key
+func apiToken(c *fiber.Ctx) string {
+	if token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(c.Get("X-API-Key"))
+}
+
+// APIKeyRequired is a middleware that authenticates API requests by their
+// key and acts as the key's owner
+func APIKeyRequired(c *fiber.Ctx) error {
+	token := apiToken(c)
+	if token == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "An API key is required. Send it as \"Authorization: Bearer <key>\".")
+	}
+	key, err := apikey.Authenticate(token)
+	if errors.Is(err, apikey.ErrInvalidKey) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or revoked API key")
+	}
+	if err != nil {
+		log.Printf("[api] Failed to authenticate API key: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to authenticate API key")
+	}
+	u, status, found := user.GetUserByID(key.UserID)
+	if !found || status == user.StatusArchived {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or revoked API key")
+	}
+
+	c.Locals("user", &u)
+	c.Locals(apiKeyLocal, key)
+	return c.Next()
+}
+
+// APIScope is a middleware that requires the request's key to grant a scope
+func APIScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, _ := c.Locals(apiKeyLocal).(apikey.Key)
+		if !key.HasScope(scope) {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("This API key doesn't have the %q scope", scope))
+		}
+		return c.Next()
+	}
+}
+
+// APIRateLimit limits how often each key may call the API. It runs after
+// APIKeyRequired, which identifies the key.
+func APIRateLimit() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        config.APIRateLimitMax,
+		Expiration: config.APIRateLimitExp,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			key, _ := c.Locals(apiKeyLocal).(apikey.Key)
+			return "apikey:" + strconv.Itoa(key.ID)
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return apiError(c, fiber.StatusTooManyRequests, "Rate limit exceeded. Please slow down and try again shortly.")
+		},
+	})
+}
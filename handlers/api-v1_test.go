@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/apikey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiTestError sends a request and decodes the error envelope of the response
+func apiTestError(t *testing.T, app *fiber.App, path string) (int, APIErrorDetail) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get("Content-Type"))
+	var body APIError
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body.Error
+}
+
+func TestAPIErrors_Envelope(t *testing.T) {
+	app := fiber.New()
+	v1 := app.Group("/api/v1", APIErrors)
+	v1.Get("/missing", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	})
+	v1.Get("/invalid", func(c *fiber.Ctx) error {
+		return apiInvalid(errors.New("Title is required"))
+	})
+	v1.Get("/broken", func(c *fiber.Ctx) error {
+		return errors.New("database is locked")
+	})
+	v1.Use(HandleAPINotFound)
+
+	status, detail := apiTestError(t, app, "/api/v1/missing")
+	assert.Equal(t, fiber.StatusNotFound, status)
+	assert.Equal(t, APIErrorDetail{Status: 404, Code: "not_found", Message: "Ad not found"}, detail)
+
+	status, detail = apiTestError(t, app, "/api/v1/invalid")
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	assert.Equal(t, "validation_failed", detail.Code)
+
+	// Internal errors aren't leaked to clients
+	status, detail = apiTestError(t, app, "/api/v1/broken")
+	assert.Equal(t, fiber.StatusInternalServerError, status)
+	assert.Equal(t, "internal_error", detail.Code)
+	assert.NotContains(t, detail.Message, "database")
+
+	status, detail = apiTestError(t, app, "/api/v1/nowhere")
+	assert.Equal(t, fiber.StatusNotFound, status)
+	assert.Contains(t, detail.Message, "/api/v1/nowhere")
+}
+
+func TestAPIKeyRequired_MissingKey(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/v1/ads", APIErrors, APIKeyRequired, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	status, detail := apiTestError(t, app, "/api/v1/ads")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, "unauthorized", detail.Code)
+}
+
+func TestAPIScope(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/v1/ads", APIErrors, func(c *fiber.Ctx) error {
+		c.Locals(apiKeyLocal, apikey.Key{ID: 1, Scopes: "read"})
+		return c.Next()
+	}, APIScope(apikey.ScopeWrite), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	status, detail := apiTestError(t, app, "/api/v1/ads")
+	assert.Equal(t, fiber.StatusForbidden, status)
+	assert.Contains(t, detail.Message, `"write"`)
+}
+
+func TestAPIToken(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(apiToken(c))
+	})
+	for header, value := range map[string]string{
+		fiber.HeaderAuthorization: "Bearer pp_abc",
+		"X-API-Key":               "pp_abc",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(header, value)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		buf := make([]byte, 16)
+		n, _ := resp.Body.Read(buf)
+		assert.Equal(t, "pp_abc", string(buf[:n]), header)
+	}
+}
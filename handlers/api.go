@@ -3,8 +3,10 @@ package handlers
 import (
 	"log"
 	"net/url"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
 	"github.com/parts-pile/site/part"
 	"github.com/parts-pile/site/sms"
 	"github.com/parts-pile/site/ui"
@@ -18,18 +20,23 @@ func HandleMakes(c *fiber.Ctx) error {
 	return c.JSON(makes)
 }
 
+// HandleYears, HandleModels and HandleEngines serve the cascading vehicle
+// checkboxes. The group query value picks which fitment group's fields
+// (make, make_1, ...) are read and rendered.
 func HandleYears(c *fiber.Ctx) error {
-	makeName := c.Query("make")
+	group := c.QueryInt("group")
+	makeName := c.Query(ad.FitmentField("make", group))
 	if makeName == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "Make is required")
 	}
 
 	years := vehicle.GetYears(makeName)
-	return render(c, ui.YearsFormGroup(years))
+	return render(c, ui.FitmentYearsFormGroup(group, years, ad.FitmentGroup{}))
 }
 
 func HandleModels(c *fiber.Ctx) error {
-	makeName := c.Query("make")
+	group := c.QueryInt("group")
+	makeName := c.Query(ad.FitmentField("make", group))
 	if makeName == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "Make is required")
 	}
@@ -38,17 +45,18 @@ func HandleModels(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	years := q["years"]
+	years := q[ad.FitmentField("years", group)]
 	if len(years) == 0 {
 		return fiber.NewError(fiber.StatusBadRequest, "At least one year is required")
 	}
 
 	models := vehicle.GetModels(makeName, years)
-	return render(c, ui.ModelsFormGroup(models))
+	return render(c, ui.FitmentModelsFormGroup(group, models, ad.FitmentGroup{}))
 }
 
 func HandleEngines(c *fiber.Ctx) error {
-	makeName := c.Query("make")
+	group := c.QueryInt("group")
+	makeName := c.Query(ad.FitmentField("make", group))
 	if makeName == "" {
 		return fiber.NewError(fiber.StatusBadRequest, "Make is required")
 	}
@@ -57,18 +65,18 @@ func HandleEngines(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
-	years := q["years"]
+	years := q[ad.FitmentField("years", group)]
 	if len(years) == 0 {
 		return fiber.NewError(fiber.StatusBadRequest, "At least one year is required")
 	}
 
-	models := q["models"]
+	models := q[ad.FitmentField("models", group)]
 	if len(models) == 0 {
 		return fiber.NewError(fiber.StatusBadRequest, "At least one model is required")
 	}
 
 	engines := vehicle.GetEngines(makeName, years, models)
-	return render(c, ui.EnginesFormGroup(engines))
+	return render(c, ui.FitmentEnginesFormGroup(group, engines, ad.FitmentGroup{}))
 }
 
 func HandleCategories(c *fiber.Ctx) error {
@@ -92,6 +100,42 @@ func HandleSubCategories(c *fiber.Ctx) error {
 	return render(c, ui.SubCategoriesFormGroupFromStruct(subCategories, ""))
 }
 
+// HandlePartAttributes renders the part attribute inputs for the selected
+// subcategory, keeping any values already entered
+func HandlePartAttributes(c *fiber.Ctx) error {
+	return render(c, ui.PartAttributesFormGroup(partAttributesFromQuery(c), part.GetAttributeSchema(c.Query("subcategory"))))
+}
+
+// partAttributesFromQuery reads the part attribute values already entered,
+// so swapping in another subcategory's inputs keeps them
+func partAttributesFromQuery(c *fiber.Ctx) ad.Ad {
+	quantity, _ := strconv.Atoi(c.Query(ad.AttrQuantity))
+	coreCharge, _ := strconv.ParseFloat(c.Query(ad.AttrCoreCharge), 64)
+	return ad.Ad{
+		Condition:  c.Query(ad.AttrCondition),
+		PartNumber: c.Query(ad.AttrPartNumber),
+		Quantity:   quantity,
+		Position:   c.Query(ad.AttrPosition),
+		CoreCharge: coreCharge,
+	}
+}
+
+// HandleCategoryMatch fills in the category and subcategory for what a
+// seller typed, by name, alias or synonym. Nothing is swapped when it
+// matches neither.
+func HandleCategoryMatch(c *fiber.Ctx) error {
+	typed := c.Query("category_search")
+	category, subCategory, ok := part.MatchSubCategory("", typed)
+	if !ok {
+		category, ok = part.MatchCategory(typed)
+	}
+	if !ok {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	return render(c, ui.CategoryMatch(partAttributesFromQuery(c), part.GetCategories(), category,
+		part.GetSubCategories(category), subCategory))
+}
+
 // HandleSMSWebhook processes Twilio webhook callbacks for SMS status updates
 func HandleSMSWebhook(c *fiber.Ctx) error {
 	// Parse the webhook data from Twilio
@@ -3,6 +3,7 @@ package handlers
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/analytics"
 	"github.com/parts-pile/site/ui"
 	"github.com/parts-pile/site/vector"
 )
@@ -17,6 +18,7 @@ func HandleBookmarkAd(c *fiber.Ctx) error {
 	if err := ad.BookmarkAd(userID, adID); err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, "Failed to bookmark ad")
 	}
+	recordAdEvent(c, adID, analytics.EventBookmark)
 	// Queue user for background embedding update
 	vector.QueueUserForUpdate(userID)
 	// Get the updated ad with bookmark status
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/browse"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/ui"
+)
+
+// HandleBrowsePage renders a crawlable browse tree page such as
+// /parts/ford/2005/f-150/electrical/alternator
+func HandleBrowsePage(c *fiber.Ctx) error {
+	var slugs []string
+	for _, s := range strings.Split(c.Params("*"), "/") {
+		if s, err := url.PathUnescape(s); err == nil && s != "" {
+			slugs = append(slugs, s)
+		}
+	}
+	names, ok, err := browse.Resolve(slugs)
+	if err != nil {
+		log.Printf("[browse] Failed to resolve %s: %v", c.Path(), err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load page")
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Page not found")
+	}
+
+	page := max(c.QueryInt("page", 1), 1)
+
+	// Send other spellings of the path, e.g. /parts/Ford, to the one true URL
+	for i, name := range names {
+		if slugs[i] != browse.Slug(name) {
+			canonical := browse.Path(names...)
+			if page > 1 {
+				canonical += "?page=" + strconv.Itoa(page)
+			}
+			return c.Redirect(canonical, fiber.StatusMovedPermanently)
+		}
+	}
+
+	children, err := browse.Children(names)
+	if err != nil {
+		log.Printf("[browse] Failed to load children of %s: %v", c.Path(), err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load page")
+	}
+
+	var ads []ad.Ad
+	totalPages := 1
+	if len(names) > 0 {
+		criteria := make([]string, len(browse.Levels))
+		copy(criteria, names)
+		var total int
+		ads, total, err = ad.GetAdsPageForAll(criteria[0], criteria[1], criteria[2], "", criteria[3], criteria[4],
+			(page-1)*config.BrowsePageSize, config.BrowsePageSize)
+		if err != nil {
+			log.Printf("[browse] Failed to load ads of %s: %v", c.Path(), err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load page")
+		}
+		totalPages = max((total+config.BrowsePageSize-1)/config.BrowsePageSize, 1)
+		if page > totalPages {
+			return fiber.NewError(fiber.StatusNotFound, "Page not found")
+		}
+	}
+
+	currentUser, _ := getUser(c)
+	return render(c, ui.BrowsePage(currentUser, c.Path(), names, children, ads, page, totalPages, getLocation(c)))
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/vector"
+	"github.com/parts-pile/site/vehicle"
+	g "maragu.dev/gomponents"
+)
+
+// catalogKind reads the make/model/engine being edited, defaulting to makes
+func catalogKind(value string) vehicle.Kind {
+	kind := vehicle.Kind(value)
+	if !kind.IsValid() {
+		return vehicle.KindMake
+	}
+	return kind
+}
+
+// catalogSection loads the catalog entries of one kind, filtered by name
+func catalogSection(kind vehicle.Kind, filter string, notice g.Node) (g.Node, error) {
+	entries, err := vehicle.GetEntries(kind, filter, config.CatalogEntriesListed)
+	if err != nil {
+		return nil, err
+	}
+	companies, err := vehicle.GetParentCompanies()
+	if err != nil {
+		return nil, err
+	}
+	return ui.AdminCatalogSection(kind, filter, entries, vehicle.GetMakes(), companies, notice), nil
+}
+
+// renderCatalog re-renders the section an admin was looking at after a change
+func renderCatalog(c *fiber.Ctx, kind vehicle.Kind, notice g.Node) error {
+	section, err := catalogSection(kind, c.FormValue("q"), notice)
+	if err != nil {
+		log.Printf("[catalog] Failed to load %ss: %v", kind, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load vehicle catalog")
+	}
+	return render(c, section)
+}
+
+// reembedAds starts rebuilding the embeddings of ads a rename or merge
+// flagged, so search sees the new names
+func reembedAds(ads int) string {
+	if ads == 0 {
+		return ""
+	}
+	go vector.ProcessAdsWithoutVectors()
+	return fmt.Sprintf(" %d ads queued for re-indexing.", ads)
+}
+
+func HandleAdminCatalog(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	kind := catalogKind(c.Query("kind"))
+	section, err := catalogSection(kind, c.Query("q"), nil)
+	if err != nil {
+		log.Printf("[catalog] Failed to load %ss: %v", kind, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load vehicle catalog")
+	}
+
+	if c.Get("HX-Request") != "" {
+		return render(c, ui.AdminSectionPage(currentUser, c.Path(), "catalog", section))
+	}
+	return render(c, ui.Page(
+		"Admin Dashboard",
+		currentUser,
+		c.Path(),
+		[]g.Node{ui.AdminSectionPage(currentUser, c.Path(), "catalog", section)},
+	))
+}
+
+// HandleAddCatalogEntry adds a make, model or engine
+func HandleAddCatalogEntry(c *fiber.Ctx) error {
+	kind := vehicle.Kind(c.Params("kind"))
+	if !kind.IsValid() {
+		return fiber.NewError(fiber.StatusNotFound, "Unknown catalog kind")
+	}
+	notice := ui.SuccessMessage(kind.Label()+" added.", "")
+	if _, err := vehicle.AddEntry(kind, c.FormValue("name")); err != nil {
+		notice = ui.ValidationError(err.Error())
+	}
+	return renderCatalog(c, kind, notice)
+}
+
+// HandleRenameCatalogEntry renames a make, model or engine and re-indexes the
+// ads fitted to it
+func HandleRenameCatalogEntry(c *fiber.Ctx) error {
+	kind := vehicle.Kind(c.Params("kind"))
+	if !kind.IsValid() {
+		return fiber.NewError(fiber.StatusNotFound, "Unknown catalog kind")
+	}
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	ads, err := vehicle.RenameEntry(kind, id, c.FormValue("name"))
+	if err != nil {
+		return renderCatalog(c, kind, adminError("catalog", "rename "+string(kind), err, vehicle.ErrNotFound))
+	}
+	log.Printf("[catalog] Renamed %s %d to %q, %d ads to re-index", kind, id, c.FormValue("name"), ads)
+	return renderCatalog(c, kind, ui.SuccessMessage(kind.Label()+" renamed."+reembedAds(ads), ""))
+}
+
+// HandleMergeCatalogEntry folds a make, model or engine into the one named in
+// the form and re-indexes the ads fitted to it
+func HandleMergeCatalogEntry(c *fiber.Ctx) error {
+	kind := vehicle.Kind(c.Params("kind"))
+	if !kind.IsValid() {
+		return fiber.NewError(fiber.StatusNotFound, "Unknown catalog kind")
+	}
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	into, err := vehicle.FindEntry(kind, c.FormValue("into"))
+	if errors.Is(err, vehicle.ErrNotFound) {
+		return renderCatalog(c, kind, ui.ValidationError(
+			fmt.Sprintf("There is no %s named %q.", kind, strings.TrimSpace(c.FormValue("into")))))
+	}
+	if err != nil {
+		return renderCatalog(c, kind, adminError("catalog", "find "+string(kind), err, vehicle.ErrNotFound))
+	}
+	ads, err := vehicle.MergeEntry(kind, id, into)
+	if err != nil {
+		return renderCatalog(c, kind, adminError("catalog", "merge "+string(kind), err, vehicle.ErrNotFound))
+	}
+	log.Printf("[catalog] Merged %s %d into %d, %d ads to re-index", kind, id, into, ads)
+	return renderCatalog(c, kind, ui.SuccessMessage(kind.Label()+" merged."+reembedAds(ads), ""))
+}
+
+// HandleRetireCatalogEntry hides a make, model or engine from the vehicle
+// pickers, or brings it back
+func HandleRetireCatalogEntry(c *fiber.Ctx) error {
+	kind := vehicle.Kind(c.Params("kind"))
+	if !kind.IsValid() {
+		return fiber.NewError(fiber.StatusNotFound, "Unknown catalog kind")
+	}
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	retired := c.FormValue("retired") == "1"
+	if err := vehicle.RetireEntry(kind, id, retired); err != nil {
+		return renderCatalog(c, kind, adminError("catalog", "retire "+string(kind), err, vehicle.ErrNotFound))
+	}
+	if retired {
+		return renderCatalog(c, kind, ui.SuccessMessage(kind.Label()+" retired. Existing ads keep it.", ""))
+	}
+	return renderCatalog(c, kind, ui.SuccessMessage(kind.Label()+" restored.", ""))
+}
+
+// HandleAttachCar adds a year/model/engine combination to a make
+func HandleAttachCar(c *fiber.Ctx) error {
+	kind := catalogKind(c.FormValue("kind"))
+	makeID, err := vehicle.FindEntry(vehicle.KindMake, c.FormValue("make"))
+	if err != nil {
+		return renderCatalog(c, kind, adminError("catalog", "find make", err, vehicle.ErrNotFound))
+	}
+	year, err := strconv.Atoi(strings.TrimSpace(c.FormValue("year")))
+	if err != nil {
+		return renderCatalog(c, kind, ui.ValidationError("Enter a year."))
+	}
+	added, err := vehicle.AttachCar(makeID, year, c.FormValue("model"), c.FormValue("engine"))
+	if errors.Is(err, vehicle.ErrRetired) {
+		return renderCatalog(c, kind, ui.ValidationError("That make is retired. Restore it first."))
+	}
+	if err != nil {
+		return renderCatalog(c, kind, adminError("catalog", "attach car", err, vehicle.ErrNotFound))
+	}
+	if !added {
+		return renderCatalog(c, kind, ui.ValidationError("That car is already in the catalog."))
+	}
+	return renderCatalog(c, kind, ui.SuccessMessage("Car attached.", ""))
+}
+
+// HandleSetMakeParentCompany changes the parent company a make belongs to
+func HandleSetMakeParentCompany(c *fiber.Ctx) error {
+	makeID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	var parentCompanyID *int
+	if value := c.FormValue("parent_company_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid parent company")
+		}
+		parentCompanyID = &id
+	}
+	if err := vehicle.SetMakeParentCompany(makeID, parentCompanyID); err != nil {
+		return renderCatalog(c, vehicle.KindMake, adminError("catalog", "set parent company", err, vehicle.ErrNotFound))
+	}
+	return renderCatalog(c, vehicle.KindMake, ui.SuccessMessage("Parent company updated.", ""))
+}
+
+// HandleAddParentCompany adds a parent company makes can belong to
+func HandleAddParentCompany(c *fiber.Ctx) error {
+	kind := catalogKind(c.FormValue("kind"))
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" {
+		return renderCatalog(c, kind, ui.ValidationError("Parent company name is required."))
+	}
+	if _, err := vehicle.AddParentCompany(name, strings.TrimSpace(c.FormValue("country"))); err != nil {
+		log.Printf("[catalog] Failed to add parent company %q: %v", name, err)
+		return renderCatalog(c, kind, ui.ValidationError(fmt.Sprintf("Could not add %q. Is it already listed?", name)))
+	}
+	return renderCatalog(c, kind, ui.SuccessMessage("Parent company added.", ""))
+}
+
+// HandleUpdateParentCompanyCountry changes a parent company's country
+func HandleUpdateParentCompanyCountry(c *fiber.Ctx) error {
+	kind := catalogKind(c.FormValue("kind"))
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := vehicle.UpdateParentCompanyCountry(id, strings.TrimSpace(c.FormValue("country"))); err != nil {
+		log.Printf("[catalog] Failed to update parent company %d: %v", id, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update parent company")
+	}
+	return renderCatalog(c, kind, ui.SuccessMessage("Country updated.", ""))
+}
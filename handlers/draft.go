@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/adimage"
+	"github.com/parts-pile/site/ui"
+)
+
+// draftFieldsFromForm captures the ad form as-is. Nothing is validated here;
+// validation happens when the draft is published through BuildAdFromForm.
+func draftFieldsFromForm(c *fiber.Ctx) ad.DraftFields {
+	fields := ad.DraftFields{
+		Title:         c.FormValue("title"),
+		Make:          c.FormValue("make"),
+		Category:      c.FormValue("category"),
+		SubCategory:   c.FormValue("subcategory"),
+		Description:   c.FormValue("description"),
+		Price:         c.FormValue("price"),
+		Location:      c.FormValue("location"),
+		DeletedImages: c.FormValue("deleted_images"),
+		ImageOrder:    c.FormValue("existing_image_order"),
+		PrimaryImage:  c.FormValue("primary_image"),
+		Condition:     c.FormValue(ad.AttrCondition),
+		PartNumber:    c.FormValue(ad.AttrPartNumber),
+		Quantity:      c.FormValue(ad.AttrQuantity),
+		Position:      c.FormValue(ad.AttrPosition),
+		CoreCharge:    c.FormValue(ad.AttrCoreCharge),
+	}
+	if form, err := c.MultipartForm(); err == nil {
+		primary := fitmentGroupFromForm(form, 0)
+		fields.Years = primary.Years
+		fields.Models = primary.Models
+		fields.Engines = primary.Engines
+		fields.YearFrom = primary.YearFrom
+		fields.YearTo = primary.YearTo
+		fields.AllModels = primary.AllModels
+		fields.AllEngines = primary.AllEngines
+		fields.Fitment = extraFitmentGroupsFromForm(form)
+	}
+	return fields
+}
+
+// HandleSaveDraft autosaves the new/edit ad form into a draft
+func HandleSaveDraft(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	draftID, _ := strconv.Atoi(c.FormValue("draft_id"))
+	adID, _ := strconv.Atoi(c.FormValue("draft_ad_id"))
+	if adID != 0 {
+		adObj, ok := ad.GetAd(adID, currentUser)
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, "Ad not found")
+		}
+		if _, err := RequireOwnership(c, adObj.UserID); err != nil {
+			return err
+		}
+	}
+
+	draftID, err = ad.SaveDraft(ad.Draft{
+		ID:     draftID,
+		UserID: currentUser.ID,
+		AdID:   adID,
+		Fields: draftFieldsFromForm(c),
+	})
+	if err != nil {
+		log.Printf("[draft] Failed to save draft for user %d: %v", currentUser.ID, err)
+		return render(c, ui.DraftSaveFailed())
+	}
+
+	// Keep images the seller already picked so they survive a lost session
+	savedImages := false
+	if form, err := c.MultipartForm(); err == nil {
+		for _, fileHeader := range form.File["images"] {
+			file, err := fileHeader.Open()
+			if err != nil {
+				log.Printf("[draft] Failed to open image %s for draft %d: %v", fileHeader.Filename, draftID, err)
+				continue
+			}
+			var buf bytes.Buffer
+			_, err = buf.ReadFrom(file)
+			file.Close()
+			if err != nil {
+				log.Printf("[draft] Failed to read image %s for draft %d: %v", fileHeader.Filename, draftID, err)
+				continue
+			}
+			// Only images the ad form would accept are kept
+			if err := adimage.Validate(adimage.Upload{Filename: fileHeader.Filename, Data: buf.Bytes()}); err != nil {
+				continue
+			}
+			err = ad.AddDraftImage(draftID, fileHeader.Filename, buf.Bytes())
+			if errors.Is(err, ad.ErrDraftImagesFull) {
+				break
+			}
+			if err != nil {
+				log.Printf("[draft] Failed to store image %s for draft %d: %v", fileHeader.Filename, draftID, err)
+				continue
+			}
+			savedImages = true
+		}
+	}
+
+	draft, err := ad.GetDraft(draftID, currentUser.ID)
+	if err != nil {
+		return render(c, ui.DraftSaveFailed())
+	}
+	images, _ := ad.GetDraftImages(draftID)
+
+	if savedImages {
+		// Tells image-preview.js to drop its pending files now that the draft holds them
+		c.Set("HX-Trigger", "draftImagesSaved")
+	}
+	return render(c, ui.DraftSaved(draft, images))
+}
+
+func HandleDraftsPage(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	drafts, err := ad.GetDraftsByUser(currentUser.ID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get drafts")
+	}
+	return render(c, ui.DraftsPage(drafts, currentUser, c.Path()))
+}
+
+func HandleDeleteDraft(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	draftID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := ad.DeleteDraft(draftID, currentUser.ID); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Draft not found")
+	}
+	return render(c, ui.EmptyResponse())
+}
+
+func HandleDeleteDraftImage(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	draftID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	imageID, err := ParseIntParam(c, "imageID")
+	if err != nil {
+		return err
+	}
+	if _, err := ad.GetDraft(draftID, currentUser.ID); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Draft not found")
+	}
+	if err := ad.DeleteDraftImage(draftID, imageID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete image")
+	}
+	return render(c, ui.EmptyResponse())
+}
+
+// HandleDraftImage serves an original draft image to its owner
+func HandleDraftImage(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	draftID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	imageID, err := ParseIntParam(c, "imageID")
+	if err != nil {
+		return err
+	}
+	if _, err := ad.GetDraft(draftID, currentUser.ID); err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Draft not found")
+	}
+	img, err := ad.GetDraftImage(draftID, imageID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Image not found")
+	}
+	c.Set(fiber.HeaderContentType, http.DetectContentType(img.Data))
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	return c.Send(img.Data)
+}
+
+// submittedDraft returns the draft being published with the submitted form,
+// if any, along with its stored images
+func submittedDraft(c *fiber.Ctx, userID int) (ad.Draft, []ad.DraftImage) {
+	draftID, _ := strconv.Atoi(c.FormValue("draft_id"))
+	if draftID == 0 {
+		return ad.Draft{}, nil
+	}
+	draft, err := ad.GetDraft(draftID, userID)
+	if err != nil {
+		return ad.Draft{}, nil
+	}
+	images, err := ad.GetDraftImages(draftID)
+	if err != nil {
+		log.Printf("[draft] Failed to load images for draft %d: %v", draftID, err)
+	}
+	return draft, images
+}
+
+// discardDraft removes a draft once its ad has been published
+func discardDraft(draft ad.Draft) {
+	if draft.ID == 0 {
+		return
+	}
+	if err := ad.DeleteDraft(draft.ID, draft.UserID); err != nil {
+		log.Printf("[draft] Failed to remove published draft %d: %v", draft.ID, err)
+	}
+}
+
+// editDraft overlays the owner's pending edit draft, if any, onto the ad being
+// edited. When there is none, an empty draft bound to the ad is returned so
+// autosave creates one on the first change.
+func editDraft(adObj *ad.Ad) (ad.Draft, []ad.DraftImage) {
+	draft, ok := ad.GetDraftForAd(adObj.ID, adObj.UserID)
+	if !ok {
+		return ad.Draft{UserID: adObj.UserID, AdID: adObj.ID}, nil
+	}
+	draft.ApplyTo(adObj)
+	images, err := ad.GetDraftImages(draft.ID)
+	if err != nil {
+		log.Printf("[draft] Failed to load images for draft %d: %v", draft.ID, err)
+	}
+	return draft, images
+}
+
+// draftUploads returns draft images as uploads to process, in order
+func draftUploads(images []ad.DraftImage) []adimage.Upload {
+	uploads := make([]adimage.Upload, 0, len(images))
+	for _, img := range images {
+		uploads = append(uploads, adimage.Upload{Filename: img.Filename, Data: img.Data})
+	}
+	return uploads
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/browse"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/imagestore"
+	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/user"
+)
+
+const atomXmlns = "http://www.w3.org/2005/Atom"
+
+type AtomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type AtomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type AtomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type AtomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []AtomLink     `xml:"link"`
+	Categories []AtomCategory `xml:"category"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+}
+
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  AtomPerson  `xml:"author"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+// feedTime formats a time as Atom requires
+func feedTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// feedImageURL is a lasting link to an ad image for feed enclosures. Stored
+// image URLs are signed and expire, so it redirects to a fresh one.
+func feedImageURL(img ad.Image) string {
+	return siteURL(ui.AdImagePermalink(img))
+}
+
+func feedEntry(a ad.Ad) AtomEntry {
+	adURL := siteURL(fmt.Sprintf("/ad/%d", a.ID))
+	price := fmt.Sprintf("$%.2f", a.Price)
+
+	entry := AtomEntry{
+		Title:     fmt.Sprintf("%s - %s", a.Title, price),
+		ID:        adURL,
+		Updated:   feedTime(a.LastChanged()),
+		Published: feedTime(a.CreatedAt),
+		Links:     []AtomLink{{Rel: "alternate", Type: "text/html", Href: adURL}},
+		Summary:   AtomText{Type: "text", Body: a.Description},
+	}
+	if a.Category.Valid {
+		entry.Categories = append(entry.Categories, AtomCategory{Term: a.Category.String})
+	}
+	if a.SubCategory.Valid {
+		entry.Categories = append(entry.Categories, AtomCategory{Term: a.SubCategory.String})
+	}
+
+	var content strings.Builder
+	if cover, ok := a.Cover(); ok {
+		img := feedImageURL(cover)
+		entry.Links = append(entry.Links, AtomLink{Rel: "enclosure", Type: "image/webp", Href: img})
+		fmt.Fprintf(&content, `<p><img src="%s" alt="%s"></p>`, html.EscapeString(img), html.EscapeString(a.Title))
+	}
+	fmt.Fprintf(&content, "<p><strong>%s</strong>", price)
+	if a.Condition != "" {
+		fmt.Fprintf(&content, " &middot; %s", html.EscapeString(a.ConditionLabel()))
+	}
+	content.WriteString("</p>")
+	fmt.Fprintf(&content, "<p>%s</p>", html.EscapeString(a.Description))
+	entry.Content = AtomText{Type: "html", Body: content.String()}
+	return entry
+}
+
+// sendFeed writes an Atom feed of the given ads, newest first, with caching
+// headers derived from the newest change so unchanged feeds answer 304
+func sendFeed(c *fiber.Ctx, title, htmlPath string, ads []ad.Ad) error {
+	slices.SortFunc(ads, func(a, b ad.Ad) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if len(ads) > config.FeedSize {
+		ads = ads[:config.FeedSize]
+	}
+
+	var updated time.Time
+	for _, a := range ads {
+		if changed := a.LastChanged(); changed.After(updated) {
+			updated = changed
+		}
+	}
+	// Without ads there is nothing to compare against, so it's always fresh
+	feedUpdated := updated
+	if updated.IsZero() {
+		feedUpdated = time.Now()
+	}
+
+	self := siteURL(c.OriginalURL())
+	feed := AtomFeed{
+		Xmlns:   atomXmlns,
+		Title:   title + " - Parts Pile",
+		ID:      self,
+		Updated: feedTime(feedUpdated),
+		Author:  AtomPerson{Name: "Parts Pile", URI: siteURL("/")},
+		Links: []AtomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: self},
+			{Rel: "alternate", Type: "text/html", Href: siteURL(htmlPath)},
+		},
+	}
+	for _, a := range ads {
+		feed.Entries = append(feed.Entries, feedEntry(a))
+	}
+
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(config.FeedMaxAge/time.Second)))
+	if !updated.IsZero() {
+		c.Set(fiber.HeaderLastModified, updated.UTC().Format(http.TimeFormat))
+		c.Set(fiber.HeaderETag, fmt.Sprintf(`W/"%d-%d"`, len(ads), updated.UnixNano()))
+		if c.Fresh() {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	body, err := xml.Marshal(feed)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/atom+xml; charset=utf-8")
+	return c.Send(append([]byte(xml.Header), body...))
+}
+
+// HandleSearchFeed serves the newest ads matching a search, or the newest ads
+// overall without a query
+func HandleSearchFeed(c *fiber.Ctx) error {
+	q := getQueryParam(c, "q")
+	if q == "" {
+		ads, _, err := ad.GetAdsPageForAll("", "", "", "", "", "", 0, config.FeedSize)
+		if err != nil {
+			log.Printf("[feed] Failed to load newest ads: %v", err)
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+		}
+		return sendFeed(c, "Newest ads", "/", ads)
+	}
+
+	ids, _, err := queryEmbedding(q, "", getThreshold(c), config.QdrantSearchInitialK, nil)
+	if err != nil {
+		log.Printf("[feed] Search for %q failed: %v", q, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+	ads, err := ad.GetAdsByIDs(ids, nil)
+	if err != nil {
+		log.Printf("[feed] Failed to load ads for %q: %v", q, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+	return sendFeed(c, fmt.Sprintf("Ads matching %q", q), "/search-page?q="+url.QueryEscape(q), ads)
+}
+
+// HandlePartsFeed serves the newest ads for a make and model in any year,
+// e.g. /feeds/parts/ford/f-150.atom
+func HandlePartsFeed(c *fiber.Ctx) error {
+	modelSlug, ok := strings.CutSuffix(c.Params("model"), ".atom")
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Feed not found")
+	}
+	makes, found, err := browse.Resolve([]string{c.Params("make")})
+	if err != nil {
+		log.Printf("[feed] Failed to resolve %s: %v", c.Path(), err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+	if !found {
+		return fiber.NewError(fiber.StatusNotFound, "Feed not found")
+	}
+	makeName := makes[0]
+	model, found, err := browse.ResolveModel(makeName, modelSlug)
+	if err != nil {
+		log.Printf("[feed] Failed to resolve %s: %v", c.Path(), err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+	if !found {
+		return fiber.NewError(fiber.StatusNotFound, "Feed not found")
+	}
+
+	ads, _, err := ad.GetAdsPageForAll(makeName, "", model, "", "", "", 0, config.FeedSize)
+	if err != nil {
+		log.Printf("[feed] Failed to load ads for %s %s: %v", makeName, model, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+	return sendFeed(c, makeName+" "+model+" parts", browse.Path(makeName), ads)
+}
+
+// HandleSellerFeed serves a seller's newest ads, e.g. /feeds/seller/jo.atom
+func HandleSellerFeed(c *fiber.Ctx) error {
+	name, ok := strings.CutSuffix(c.Params("name"), ".atom")
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Feed not found")
+	}
+	name, _ = url.PathUnescape(name)
+	seller, err := user.GetUserByName(name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound, "Feed not found")
+	}
+	if err != nil {
+		log.Printf("[feed] Failed to load seller %q: %v", name, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+
+	owned, err := ad.GetAdsByUser(seller.ID, false)
+	if err != nil {
+		log.Printf("[feed] Failed to load ads of seller %d: %v", seller.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+	var ids []int
+	for _, a := range owned {
+		if !a.IsHidden() && len(ids) < config.FeedSize {
+			ids = append(ids, a.ID)
+		}
+	}
+	// Reload through the public query, which includes the images
+	ads, err := ad.GetAdsByIDs(ids, nil)
+	if err != nil {
+		log.Printf("[feed] Failed to load ads of seller %d: %v", seller.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load feed")
+	}
+	return sendFeed(c, "Ads by "+seller.Name, "/", ads)
+}
+
+// HandleFeedImage redirects a feed's lasting image link to a freshly signed
+// URL of the image
+func HandleFeedImage(c *fiber.Ctx) error {
+	adID, err := ParseIntParam(c, "adID")
+	if err != nil {
+		return err
+	}
+	imageID, err := ParseIntParam(c, "imageID")
+	if err != nil {
+		return err
+	}
+	if _, ok := ad.GetAd(adID, nil); !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Image not found")
+	}
+	img, err := ad.GetImage(adID, imageID)
+	if err != nil || len(img.Variants) == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "Image not found")
+	}
+	// Variants are listed smallest first
+	imageURL := imagestore.AdImageURL(adID, img.Idx, img.Variants[len(img.Variants)-1])
+	if imageURL == "" {
+		return fiber.NewError(fiber.StatusNotFound, "Image not found")
+	}
+	return c.Redirect(imageURL, fiber.StatusFound)
+}
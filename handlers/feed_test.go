@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedEntry(t *testing.T) {
+	created := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := feedEntry(ad.Ad{
+		ID:          7,
+		Title:       "Alternator",
+		Description: "Works <great>",
+		Price:       120,
+		Condition:   ad.ConditionUsed,
+		CreatedAt:   created,
+		Images:      []ad.Image{{ID: 3, AdID: 7, Variants: []string{"480w"}}},
+	})
+
+	assert.Equal(t, "Alternator - $120.00", entry.Title)
+	assert.Equal(t, "2026-05-01T12:00:00Z", entry.Updated)
+	require.Len(t, entry.Links, 2)
+	assert.Equal(t, "enclosure", entry.Links[1].Rel)
+	assert.Contains(t, entry.Links[1].Href, "/feeds/image/7/3")
+	assert.Contains(t, entry.Content.Body, "<strong>$120.00</strong>")
+	assert.Contains(t, entry.Content.Body, "Works &lt;great&gt;")
+}
+
+func TestSendFeed_NewestFirstAndCached(t *testing.T) {
+	older := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	app := fiber.New()
+	app.Get("/feed", func(c *fiber.Ctx) error {
+		return sendFeed(c, "Test", "/", []ad.Ad{
+			{ID: 1, Title: "Old", CreatedAt: older},
+			{ID: 2, Title: "New", CreatedAt: newer},
+		})
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/feed", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Cache-Control"), "max-age=")
+	assert.Equal(t, "Fri, 01 May 2026 13:00:00 GMT", resp.Header.Get("Last-Modified"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var feed AtomFeed
+	require.NoError(t, xml.Unmarshal(body, &feed))
+	require.Len(t, feed.Entries, 2)
+	assert.Equal(t, "New - $0.00", feed.Entries[0].Title)
+	assert.Equal(t, "2026-05-01T13:00:00Z", feed.Updated)
+
+	// Readers that already have it get a 304
+	req := httptest.NewRequest("GET", "/feed", nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusNotModified, resp.StatusCode)
+}
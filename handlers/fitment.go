@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"mime/multipart"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/vehicle"
+)
+
+// fitmentOptions returns the year/model/engine choices for each fitment group
+// based on what has been selected in it so far
+func fitmentOptions(groups []ad.FitmentGroup) []ui.FitmentGroupOptions {
+	opts := make([]ui.FitmentGroupOptions, len(groups))
+	for i, f := range groups {
+		if f.Make == "" {
+			continue
+		}
+		opts[i].Years = vehicle.GetYears(f.Make)
+		if len(f.Years) > 0 {
+			opts[i].Models = vehicle.GetModels(f.Make, f.Years)
+			models := f.Models
+			if f.AllModels {
+				models = opts[i].Models
+			}
+			if len(models) > 0 {
+				opts[i].Engines = vehicle.GetEngines(f.Make, f.Years, models)
+			}
+		}
+	}
+	return opts
+}
+
+// fitmentGroupFromForm reads one fitment group's make, selections and rules
+func fitmentGroupFromForm(form *multipart.Form, group int) ad.FitmentGroup {
+	f := ad.FitmentGroup{
+		Make:       formValue(form, ad.FitmentField("make", group)),
+		Years:      form.Value[ad.FitmentField("years", group)],
+		Models:     form.Value[ad.FitmentField("models", group)],
+		Engines:    form.Value[ad.FitmentField("engines", group)],
+		AllModels:  formValue(form, ad.FitmentField("all_models", group)) != "",
+		AllEngines: formValue(form, ad.FitmentField("all_engines", group)) != "",
+	}
+	f.YearFrom, _ = strconv.Atoi(formValue(form, ad.FitmentField("year_from", group)))
+	f.YearTo, _ = strconv.Atoi(formValue(form, ad.FitmentField("year_to", group)))
+	return f
+}
+
+// extraFitmentGroupsFromForm reads the fitment groups added beyond the first
+// (make_1, years_1, ...) in the order they were numbered. Groups left
+// completely blank are skipped.
+func extraFitmentGroupsFromForm(form *multipart.Form) []ad.FitmentGroup {
+	var indexes []int
+	for key := range form.Value {
+		suffix, ok := strings.CutPrefix(key, "make_")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(suffix); err == nil && n > 0 {
+			indexes = append(indexes, n)
+		}
+	}
+	sort.Ints(indexes)
+
+	var groups []ad.FitmentGroup
+	for _, n := range indexes {
+		if f := fitmentGroupFromForm(form, n); !f.IsEmpty() {
+			groups = append(groups, f)
+		}
+	}
+	return groups
+}
+
+// HandleFitmentGroup renders a blank fitment group for the new/edit ad forms
+func HandleFitmentGroup(c *fiber.Ctx) error {
+	group := c.QueryInt("group")
+	if group < 1 {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid fitment group")
+	}
+	return render(c, ui.FitmentGroupFields(group, vehicle.GetMakes(), ad.FitmentGroup{}, ui.FitmentGroupOptions{}))
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/analytics"
 	"github.com/parts-pile/site/messaging"
+	"github.com/parts-pile/site/moderation"
 	"github.com/parts-pile/site/notification"
 	"github.com/parts-pile/site/ui"
 	"github.com/parts-pile/site/user"
@@ -119,11 +121,18 @@ func HandleStartConversation(c *fiber.Ctx) error {
 		return render(c, ui.ErrorPage(400, err.Error()))
 	}
 
-	// Get or create conversation
-	conversationID, err := messaging.GetOrCreateConversation(currentUser.ID, ad.UserID, adID)
+	// Get or create conversation, counting only new ones for the seller
+	conversationID, err := messaging.FindConversation(currentUser.ID, ad.UserID, adID)
 	if err != nil {
 		return render(c, ui.ErrorPage(500, "Failed to create conversation"))
 	}
+	if conversationID == 0 {
+		conversationID, err = messaging.CreateConversation(currentUser.ID, ad.UserID, adID)
+		if err != nil {
+			return render(c, ui.ErrorPage(500, "Failed to create conversation"))
+		}
+		recordAdEvent(c, adID, analytics.EventConversation)
+	}
 
 	// Redirect to messages page with conversation expanded
 	return c.Redirect(fmt.Sprintf("/messages?expand=%d", conversationID))
@@ -153,12 +162,17 @@ func HandleSendMessage(c *fiber.Ctx) error {
 	if content == "" {
 		return render(c, ui.ErrorPage(400, "Message cannot be empty"))
 	}
+	verdict := screenContent(moderation.KindMessage, content)
+	if verdict.Outcome == moderation.OutcomeBlock {
+		return render(c, ui.ErrorPage(400, verdict.Reason))
+	}
 
 	// Add message to conversation
-	_, err = messaging.AddMessage(conversationID, currentUser.ID, content)
+	messageID, err := messaging.AddMessage(conversationID, currentUser.ID, content)
 	if err != nil {
 		return render(c, ui.ErrorPage(500, "Failed to send message"))
 	}
+	flagScreenedMessage(conversationID, messageID, currentUser.ID, content, verdict)
 
 	// Determine recipient ID
 	recipientID := conversation.User1ID
@@ -195,6 +209,155 @@ func HandleSendMessage(c *fiber.Ctx) error {
 	return render(c, ui.ExpandedConversation(currentUser, updatedConversation, updatedMessages))
 }
 
+// offerError shows an offer validation error next to the offer actions
+// instead of replacing the conversation
+func offerError(c *fiber.Ctx, conversationID int, message string) error {
+	c.Set("HX-Retarget", fmt.Sprintf("#offer-result-%d", conversationID))
+	c.Set("HX-Reswap", "innerHTML")
+	return render(c, ui.ValidationError(message))
+}
+
+// notifyConversationMessage sends the usual new-message notification for a
+// message added outside the chat form, such as an offer event
+func notifyConversationMessage(conversation messaging.Conversation, senderID int, content string) {
+	recipientID := conversation.User1ID
+	if senderID == conversation.User1ID {
+		recipientID = conversation.User2ID
+	}
+	notificationService, err := notification.NewNotificationService()
+	if err != nil {
+		log.Printf("Failed to create notification service: %v", err)
+		return
+	}
+	go func() {
+		if err := notificationService.NotifyNewMessage(conversation.ID, senderID, recipientID, content); err != nil {
+			log.Printf("Failed to send notification: %v", err)
+		}
+	}()
+}
+
+// renderExpandedConversation re-renders a conversation after it changed
+func renderExpandedConversation(c *fiber.Ctx, currentUser *user.User, conversationID int) error {
+	conversation, err := messaging.GetConversationWithDetails(conversationID)
+	if err != nil {
+		return render(c, ui.ErrorPage(500, "Failed to load updated conversation"))
+	}
+	messages, err := messaging.GetMessages(conversationID)
+	if err != nil {
+		return render(c, ui.ErrorPage(500, "Failed to load updated messages"))
+	}
+	return render(c, ui.ExpandedConversation(currentUser, conversation, messages))
+}
+
+// HandleMakeOffer handles a buyer proposing a price in a conversation
+func HandleMakeOffer(c *fiber.Ctx) error {
+	currentUser := c.Locals("user").(*user.User)
+
+	conversationID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return render(c, ui.ErrorPage(400, "Invalid conversation ID"))
+	}
+
+	conversation, err := messaging.GetConversationWithDetails(conversationID)
+	if err != nil {
+		return render(c, ui.ErrorPage(404, "Conversation not found"))
+	}
+	if conversation.User1ID != currentUser.ID && conversation.User2ID != currentUser.ID {
+		return render(c, ui.ErrorPage(403, "Access denied"))
+	}
+
+	amount, err := strconv.ParseFloat(c.FormValue("amount"), 64)
+	if err != nil {
+		return offerError(c, conversationID, "Invalid offer amount")
+	}
+
+	offer, err := messaging.MakeOffer(conversationID, currentUser.ID, amount)
+	if err != nil {
+		return offerError(c, conversationID, err.Error())
+	}
+	notifyConversationMessage(conversation, currentUser.ID, fmt.Sprintf("Offered $%.2f", offer.Amount))
+
+	return renderExpandedConversation(c, currentUser, conversationID)
+}
+
+// HandleRespondToOffer handles accepting, declining or countering an offer
+func HandleRespondToOffer(c *fiber.Ctx) error {
+	currentUser := c.Locals("user").(*user.User)
+
+	offerID, err := ParseIntParam(c, "offerID")
+	if err != nil {
+		return err
+	}
+	offer, err := messaging.GetOffer(offerID)
+	if err != nil {
+		return render(c, ui.ErrorPage(404, "Offer not found"))
+	}
+	conversation, err := messaging.GetConversationByID(offer.ConversationID)
+	if err != nil {
+		return render(c, ui.ErrorPage(404, "Conversation not found"))
+	}
+
+	action := c.FormValue("action")
+	var counterAmount float64
+	if action == messaging.OfferActionCounter {
+		counterAmount, err = strconv.ParseFloat(c.FormValue("amount"), 64)
+		if err != nil {
+			return offerError(c, offer.ConversationID, "Invalid counter-offer amount")
+		}
+	}
+
+	result, err := messaging.RespondToOffer(offerID, currentUser.ID, action, counterAmount)
+	if err != nil {
+		return offerError(c, offer.ConversationID, err.Error())
+	}
+
+	var content string
+	switch action {
+	case messaging.OfferActionAccept:
+		content = fmt.Sprintf("Accepted your offer of $%.2f", offer.Amount)
+	case messaging.OfferActionDecline:
+		content = fmt.Sprintf("Declined your offer of $%.2f", offer.Amount)
+	default:
+		content = fmt.Sprintf("Countered with $%.2f", result.Amount)
+	}
+	notifyConversationMessage(conversation, currentUser.ID, content)
+
+	return renderExpandedConversation(c, currentUser, offer.ConversationID)
+}
+
+// HandleMarkOfferAdPending lets the seller mark the ad pending after accepting an offer
+func HandleMarkOfferAdPending(c *fiber.Ctx) error {
+	offerID, err := ParseIntParam(c, "offerID")
+	if err != nil {
+		return err
+	}
+	offer, err := messaging.GetOffer(offerID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Offer not found")
+	}
+	conversation, err := messaging.GetConversationWithDetails(offer.ConversationID)
+	if err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Conversation not found")
+	}
+	if _, err := RequireOwnership(c, conversation.AdUserID); err != nil {
+		return err
+	}
+	if offer.Status != messaging.OfferStatusAccepted {
+		return ValidationErrorResponse(c, "Only an accepted offer can mark the ad pending")
+	}
+
+	if err := ad.MarkAdPending(conversation.AdID); err != nil {
+		log.Printf("[offer] Failed to mark ad %d pending: %v", conversation.AdID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to mark ad pending")
+	}
+	return render(c, ui.SuccessMessage("Ad marked as pending", ""))
+}
+
+// UnreadCount is the body of /api/messages/unread-count responses
+type UnreadCount struct {
+	Count int `json:"count"`
+}
+
 // HandleMessagesAPI handles AJAX requests for messages
 func HandleMessagesAPI(c *fiber.Ctx) error {
 	currentUser := c.Locals("user").(*user.User)
@@ -212,7 +375,7 @@ func HandleMessagesAPI(c *fiber.Ctx) error {
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to get unread count"})
 		}
-		return c.JSON(fiber.Map{"count": count})
+		return c.JSON(UnreadCount{Count: count})
 	default:
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid action"})
 	}
@@ -255,6 +418,9 @@ func HandleSSE(c *fiber.Ctx) error {
 			case "new_message":
 				// Send new message event with conversation ID
 				c.WriteString(fmt.Sprintf("event: new_message\ndata: %d\n\n", update.ConversationID))
+			case messaging.UpdateTypeOfferUpdated:
+				// Send offer update event with conversation ID
+				c.WriteString(fmt.Sprintf("event: %s\ndata: %d\n\n", messaging.UpdateTypeOfferUpdated, update.ConversationID))
 			case "unread_count":
 				// Send unread count update
 				c.WriteString(fmt.Sprintf("event: unread_count\ndata: %d\n\n", update.UnreadCount))
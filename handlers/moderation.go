@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/messaging"
+	"github.com/parts-pile/site/moderation"
+	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/user"
+	"github.com/parts-pile/site/vector"
+	g "maragu.dev/gomponents"
+)
+
+// moderationDecisionLimit is how many past decisions the queue page lists
+const moderationDecisionLimit = 50
+
+// moderationFlagKey holds the reason a submitted ad was flagged until the ad
+// is saved and can be queued
+const moderationFlagKey = "moderationFlag"
+
+// screenContent classifies user content. A classifier that can't be reached
+// doesn't stop the user; the verdict of the others stands.
+func screenContent(kind moderation.Kind, text string) moderation.Verdict {
+	verdict, err := moderation.Classify(kind, text)
+	if err != nil {
+		log.Printf("[moderation] Failed to screen %s: %v", kind, err)
+	}
+	return verdict
+}
+
+// screenAd rejects blocked ad text and remembers flagged ad text for
+// flagScreenedAd
+func screenAd(c *fiber.Ctx, fields ...string) error {
+	verdict := screenContent(moderation.KindAd, strings.Join(fields, "\n"))
+	switch verdict.Outcome {
+	case moderation.OutcomeBlock:
+		return errors.New(verdict.Reason)
+	case moderation.OutcomeFlag:
+		c.Locals(moderationFlagKey, verdict.Reason)
+	}
+	return nil
+}
+
+// flagScreenedAd queues a saved ad whose text was flagged by screenAd
+func flagScreenedAd(c *fiber.Ctx, adID int) {
+	reason, ok := c.Locals(moderationFlagKey).(string)
+	if !ok {
+		return
+	}
+	if _, err := moderation.FlagAd(adID, reason); err != nil {
+		log.Printf("[moderation] Failed to flag ad %d: %v", adID, err)
+	}
+}
+
+// flagScreenedMessage queues a sent message whose text was flagged by
+// screenContent. The case is about the message and its sender, not the ad
+// the conversation is about.
+func flagScreenedMessage(conversationID, messageID, senderID int, content string, verdict moderation.Verdict) {
+	if verdict.Outcome != moderation.OutcomeFlag {
+		return
+	}
+	details := fmt.Sprintf("%s\n\n%s", verdict.Reason, content)
+	if _, err := moderation.FlagMessage(messageID, senderID, details); err != nil {
+		log.Printf("[moderation] Failed to flag message %d in conversation %d: %v", messageID, conversationID, err)
+	}
+}
+
+// screenUsername returns the error shown to the user for a name that isn't
+// allowed. Usernames have nothing to queue before the account exists, so
+// flagged names are refused like blocked ones. Unlike other content, names
+// aren't accepted while a classifier is unavailable.
+func screenUsername(name string) error {
+	verdict, err := moderation.Classify(moderation.KindUsername, name)
+	if err != nil {
+		log.Printf("[moderation] Failed to screen username: %v", err)
+		return fmt.Errorf("Could not validate username. Please try again later.")
+	}
+	if verdict.Outcome != moderation.OutcomeAllow {
+		return errors.New(verdict.Reason)
+	}
+	return nil
+}
+
+// moderationSection loads the ad and message queues and the recent decisions
+func moderationSection(notice g.Node) (g.Node, error) {
+	queue, err := moderation.GetQueue()
+	if err != nil {
+		return nil, err
+	}
+	messages, err := moderation.GetMessageQueue()
+	if err != nil {
+		return nil, err
+	}
+	decisions, err := moderation.GetRecentDecisions(moderationDecisionLimit)
+	if err != nil {
+		return nil, err
+	}
+	return ui.AdminModerationSection(queue, messages, decisions, notice), nil
+}
+
+func HandleAdminModeration(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	section, err := moderationSection(nil)
+	if err != nil {
+		log.Printf("[moderation] Failed to load queue: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load moderation queue")
+	}
+
+	if c.Get("HX-Request") != "" {
+		return render(c, ui.AdminSectionPage(currentUser, c.Path(), "moderation", section))
+	}
+	return render(c, ui.Page(
+		"Admin Dashboard",
+		currentUser,
+		c.Path(),
+		[]g.Node{ui.AdminSectionPage(currentUser, c.Path(), "moderation", section)},
+	))
+}
+
+// HandleModerationDecision applies an admin's decision to a queued ad and
+// tells the seller about it
+func HandleModerationDecision(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	adID, err := ParseIntParam(c, "adID")
+	if err != nil {
+		return err
+	}
+	action := moderation.Action(c.FormValue("action"))
+	if !action.IsValid() {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown action")
+	}
+
+	decision, err := moderation.Decide(adID, currentUser.ID, action, c.FormValue("note"))
+	if err != nil {
+		log.Printf("[moderation] Failed to %s ad %d: %v", action, adID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record decision")
+	}
+
+	switch action {
+	case moderation.ActionApprove:
+		if adObj, ok := ad.GetAd(adID, currentUser); ok {
+			requeueAd(adObj)
+		}
+	case moderation.ActionHide, moderation.ActionEditRequest:
+		if err := vector.DeleteAdEmbedding(adID); err != nil {
+			log.Printf("Warning: Failed to delete ad %d from vector database: %v", adID, err)
+		}
+	case moderation.ActionBanSeller:
+		banUser(decision.SellerID)
+	}
+
+	notifyModerationDecision(currentUser.ID, decision)
+
+	section, err := moderationSection(ui.SuccessMessage(action.Label()+": "+decision.AdTitle, ""))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load moderation queue")
+	}
+	return render(c, section)
+}
+
+// HandleMessageModerationDecision applies an admin's decision to a flagged
+// message
+func HandleMessageModerationDecision(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	caseID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	action := moderation.MessageAction(c.FormValue("action"))
+	if !action.IsValid() {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown action")
+	}
+
+	var notice g.Node
+	decided, err := moderation.DecideMessage(caseID, currentUser.ID, action)
+	switch {
+	case errors.Is(err, moderation.ErrCaseNotOpen):
+		notice = ui.ValidationError("That message was already reviewed.")
+	case err != nil:
+		log.Printf("[moderation] Failed to %s for message case %d: %v", action, caseID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to record decision")
+	default:
+		if action == moderation.MessageActionBanSender {
+			banUser(decided.SenderID)
+		}
+		notice = ui.SuccessMessage(fmt.Sprintf("%s: message %d", action.Label(), decided.MessageID), "")
+	}
+
+	section, err := moderationSection(notice)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load moderation queue")
+	}
+	return render(c, section)
+}
+
+// banUser archives a banned user's ads and account
+func banUser(userID int) {
+	ads, err := ad.GetAdsByUser(userID, false)
+	if err != nil {
+		log.Printf("[moderation] Failed to list ads of user %d: %v", userID, err)
+	}
+	if err := ad.ArchiveAdsByUserID(userID); err != nil {
+		log.Printf("[moderation] Failed to archive ads of user %d: %v", userID, err)
+		return
+	}
+	for _, adObj := range ads {
+		if err := vector.DeleteAdEmbedding(adObj.ID); err != nil {
+			log.Printf("Warning: Failed to delete ad %d from vector database: %v", adObj.ID, err)
+		}
+	}
+	if err := user.ArchiveUser(userID); err != nil {
+		log.Printf("[moderation] Failed to archive user %d: %v", userID, err)
+	}
+}
+
+// notifyModerationDecision messages the seller about a decision on their ad
+func notifyModerationDecision(adminID int, decision moderation.Decision) {
+	if decision.SellerID == adminID {
+		return
+	}
+	content := decision.Action.SellerMessage(decision.AdTitle, decision.Note)
+	conversationID, err := messaging.GetOrCreateConversation(adminID, decision.SellerID, decision.AdID)
+	if err != nil {
+		log.Printf("[moderation] Failed to open conversation with user %d: %v", decision.SellerID, err)
+		return
+	}
+	if _, err := messaging.AddMessage(conversationID, adminID, content); err != nil {
+		log.Printf("[moderation] Failed to message user %d: %v", decision.SellerID, err)
+		return
+	}
+	conversation, err := messaging.GetConversationByID(conversationID)
+	if err != nil {
+		log.Printf("[moderation] Failed to load conversation %d: %v", conversationID, err)
+		return
+	}
+	notifyConversationMessage(conversation, adminID, content)
+}
+
+// HandleReportAd queues an ad reported by a signed-in user
+func HandleReportAd(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	adID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	adObj, ok := ad.GetAd(adID, currentUser)
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Ad not found")
+	}
+	if adObj.UserID == currentUser.ID {
+		return render(c, ui.ReportAdResult(ui.ValidationError("You can't report your own ad.")))
+	}
+
+	details := strings.TrimSpace(c.FormValue("details"))
+	if details == "" {
+		return render(c, ui.ReportAdResult(ui.ValidationError("Please tell us what's wrong with this ad.")))
+	}
+	if _, err := moderation.ReportAd(adID, currentUser.ID, details); err != nil {
+		log.Printf("[moderation] Failed to report ad %d: %v", adID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to report ad")
+	}
+	return render(c, ui.ReportAdResult(ui.SuccessMessage("Thanks, a moderator will review this ad.", "")))
+}
+
+// moderationRulesSection loads the screening rules
+func moderationRulesSection(notice g.Node) (g.Node, error) {
+	rules, err := moderation.GetRules()
+	if err != nil {
+		return nil, err
+	}
+	return ui.AdminModerationRulesSection(rules, notice), nil
+}
+
+func HandleAdminModerationRules(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	section, err := moderationRulesSection(nil)
+	if err != nil {
+		log.Printf("[moderation] Failed to load rules: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load moderation rules")
+	}
+
+	if c.Get("HX-Request") != "" {
+		return render(c, ui.AdminSectionPage(currentUser, c.Path(), "moderation-rules", section))
+	}
+	return render(c, ui.Page(
+		"Admin Dashboard",
+		currentUser,
+		c.Path(),
+		[]g.Node{ui.AdminSectionPage(currentUser, c.Path(), "moderation-rules", section)},
+	))
+}
+
+// HandleAddModerationRules adds a rule for each line of the submitted patterns
+func HandleAddModerationRules(c *fiber.Ctx) error {
+	template := moderation.Rule{
+		MatchType: moderation.MatchType(c.FormValue("match_type")),
+		Kind:      moderation.Kind(c.FormValue("kind")),
+		Outcome:   moderation.Outcome(c.FormValue("outcome")),
+		Reason:    c.FormValue("reason"),
+	}
+	var rules []moderation.Rule
+	for _, line := range strings.Split(c.FormValue("patterns"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			r := template
+			r.Pattern = line
+			rules = append(rules, r)
+		}
+	}
+
+	notice := ui.SuccessMessage(fmt.Sprintf("Added %d rules.", len(rules)), "")
+	if len(rules) == 0 {
+		notice = ui.ValidationError("Enter at least one pattern.")
+	} else if err := moderation.AddRules(rules); err != nil {
+		notice = ui.ValidationError(err.Error())
+	}
+
+	section, err := moderationRulesSection(notice)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load moderation rules")
+	}
+	return render(c, section)
+}
+
+func HandleDeleteModerationRule(c *fiber.Ctx) error {
+	ruleID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := moderation.DeleteRule(ruleID); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete rule")
+	}
+	section, err := moderationRulesSection(ui.SuccessMessage("Rule deleted.", ""))
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load moderation rules")
+	}
+	return render(c, section)
+}
+
+// HandleTestModerationRules shows how the saved rules classify sample text
+func HandleTestModerationRules(c *fiber.Ctx) error {
+	kind := moderation.Kind(c.FormValue("kind"))
+	if kind == "" {
+		kind = moderation.KindAd
+	}
+	verdict, err := moderation.Rules.Classify(kind, c.FormValue("text"))
+	if err != nil {
+		return render(c, ui.ValidationError(err.Error()))
+	}
+	return render(c, ui.ModerationRuleTestResult(verdict))
+}
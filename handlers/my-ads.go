@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/notification"
+	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/vector"
+	g "maragu.dev/gomponents"
+)
+
+// myAdsActions maps the bulk actions of the My Ads page to how their outcome
+// is reported
+var myAdsActions = map[string]string{
+	"archive": "Archived",
+	"restore": "Restored",
+	"renew":   "Renewed",
+	"price":   "Changed the price of",
+}
+
+// myAdsTab returns the requested My Ads tab, defaulting to active ads
+func myAdsTab(tab string) string {
+	switch tab {
+	case ui.MyAdsArchived, ui.MyAdsDrafts:
+		return tab
+	}
+	return ui.MyAdsActive
+}
+
+// loadMyAds loads what a My Ads tab lists for the seller
+func loadMyAds(userID int, tab string) ([]ad.Ad, []ad.Draft, error) {
+	if tab == ui.MyAdsDrafts {
+		drafts, err := ad.GetDraftsByUser(userID)
+		return nil, drafts, err
+	}
+	ads, err := ad.GetAdsByUser(userID, tab == ui.MyAdsArchived)
+	return ads, nil, err
+}
+
+// HandleMyAdsPage lists the seller's active, archived or draft ads
+func HandleMyAdsPage(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	tab := myAdsTab(c.Query("tab"))
+	ads, drafts, err := loadMyAds(currentUser.ID, tab)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to get ads")
+	}
+	return render(c, ui.MyAdsPage(currentUser, c.Path(), tab, ads, drafts, getLocation(c)))
+}
+
+// bulkPrice returns the function computing each ad's new price for a bulk
+// price change: either a fixed price or a percentage off the current one
+func bulkPrice(mode, value string) (func(float64) float64, error) {
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || amount < 0 {
+		return nil, fmt.Errorf("Please enter a valid price.")
+	}
+	if mode == "percent" {
+		if amount <= 0 || amount >= 100 {
+			return nil, fmt.Errorf("Please enter a percentage between 0 and 100.")
+		}
+		return func(old float64) float64 {
+			return math.Round(old*(100-amount)) / 100
+		}, nil
+	}
+	return func(float64) float64 { return amount }, nil
+}
+
+// requeueAd rebuilds an ad's embedding in the background. Ads hidden by
+// moderators are left out of search until approved.
+func requeueAd(adObj ad.Ad) {
+	if adObj.IsHidden() {
+		return
+	}
+	adObj.SetFitment(ad.GetVehicleData(adObj.ID))
+	vector.QueueAd(adObj)
+}
+
+// HandleMyAdsBulk applies an action to the ads selected on the My Ads page
+// and re-renders the tab
+func HandleMyAdsBulk(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	tab := myAdsTab(c.FormValue("tab"))
+	action := c.FormValue("action")
+	if _, ok := myAdsActions[action]; !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown action")
+	}
+
+	var ids []int
+	if form, err := c.MultipartForm(); err == nil {
+		for _, v := range form.Value["ad_ids"] {
+			if id, err := strconv.Atoi(v); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	respond := func(notice g.Node) error {
+		ads, drafts, err := loadMyAds(currentUser.ID, tab)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to get ads")
+		}
+		return render(c, ui.MyAdsTab(tab, ads, drafts, getLocation(c), notice))
+	}
+	if len(ids) == 0 {
+		return respond(ui.ValidationError("Select at least one ad."))
+	}
+
+	var newPrice func(float64) float64
+	if action == "price" {
+		if newPrice, err = bulkPrice(c.FormValue("price_mode"), c.FormValue("price")); err != nil {
+			return respond(ui.ValidationError(err.Error()))
+		}
+	}
+
+	done := 0
+	for _, id := range ids {
+		// Ads the seller doesn't own are skipped like missing ones
+		adObj, ok := ad.GetUserAd(id, currentUser.ID)
+		if !ok {
+			continue
+		}
+
+		switch action {
+		case "archive":
+			if adObj.IsArchived() {
+				continue
+			}
+			if err = ad.ArchiveAd(id); err == nil {
+				if err := vector.DeleteAdEmbedding(id); err != nil {
+					log.Printf("Warning: Failed to delete ad %d from vector database: %v", id, err)
+				}
+			}
+		case "restore":
+			if !adObj.IsArchived() {
+				continue
+			}
+			if err = ad.RestoreAd(id); err == nil {
+				adObj.DeletedAt = nil
+				requeueAd(adObj)
+			}
+		case "renew":
+			if adObj.IsArchived() {
+				continue
+			}
+			err = ad.RenewAd(id)
+		case "price":
+			if adObj.IsArchived() {
+				continue
+			}
+			price := newPrice(adObj.Price)
+			if price == adObj.Price {
+				continue
+			}
+			if err = ad.UpdateAdPrice(id, price); err == nil {
+				if price < adObj.Price {
+					notifyPriceDrop(id, adObj.Price, price)
+				}
+				adObj.Price = price
+				requeueAd(adObj)
+			}
+		}
+
+		if err != nil {
+			log.Printf("[my-ads] Failed to %s ad %d: %v", action, id, err)
+			return respond(ui.ValidationError(fmt.Sprintf("Failed to update ad %d. %d other ads were updated.", id, done)))
+		}
+		done++
+	}
+
+	suffix := "s"
+	if done == 1 {
+		suffix = ""
+	}
+	return respond(ui.SuccessMessage(fmt.Sprintf("%s %d ad%s.", myAdsActions[action], done, suffix), ""))
+}
+
+// StartAdExpiryProcessor periodically expires ads that weren't renewed in the
+// background, dropping them from search and telling their sellers. It does
+// nothing unless config.AdExpirySince is set.
+func StartAdExpiryProcessor() {
+	if config.AdExpirySince == "" {
+		log.Printf("[ad] Ad expiry is off")
+		return
+	}
+	since, err := time.Parse(time.DateOnly, config.AdExpirySince)
+	if err != nil {
+		log.Printf("[ad] Ad expiry is off, invalid AD_EXPIRY_SINCE %q: %v", config.AdExpirySince, err)
+		return
+	}
+	go func() {
+		log.Printf("[ad] Ad expiry processor started, counting from %s", config.AdExpirySince)
+		ticker := time.NewTicker(config.AdExpirySweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ids, err := ad.ExpireAds(since)
+			for _, id := range ids {
+				if err := vector.DeleteAdEmbedding(id); err != nil {
+					log.Printf("Warning: Failed to delete ad %d from vector database: %v", id, err)
+				}
+				notifyAdExpired(id)
+			}
+			if err != nil {
+				log.Printf("[ad] Failed to expire ads: %v", err)
+				continue
+			}
+			if len(ids) > 0 {
+				log.Printf("[ad] Expired %d ads", len(ids))
+			}
+		}
+	}()
+}
+
+// notifyAdExpired tells an expired ad's seller through their notification
+// preference
+func notifyAdExpired(adID int) {
+	notificationService, err := notification.NewNotificationService()
+	if err != nil {
+		log.Printf("Failed to create notification service: %v", err)
+		return
+	}
+	if err := notificationService.NotifyAdExpired(adID); err != nil {
+		log.Printf("Failed to notify the seller of expired ad %d: %v", adID, err)
+	}
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/apikey"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/messaging"
+	"github.com/parts-pile/site/part"
+	"github.com/parts-pile/site/sms"
+)
+
+// APIOperation documents one JSON route for the OpenAPI document. Request
+// and response schemas are generated from the structs the handler reads and
+// writes, so they can't drift from what goes over the wire.
+type APIOperation struct {
+	Method string
+	// Path is the route as registered with Fiber, e.g. /api/v1/ads/:id
+	Path    string
+	Handler fiber.Handler
+	Summary string
+	Tag     string
+	// Scope is the API key scope a /api/v1 route requires
+	Scope string
+	// Session marks routes that need a logged in browser session
+	Session bool
+	// PathEnums lists the values of path parameters that aren't IDs
+	PathEnums map[string][]string
+	Query     []apiParam
+	// Body is a value of the request body's type, nil when there's none
+	Body any
+	// BodyType is the body's MIME type, JSON unless set. Form bodies are
+	// read by their form tags instead of their json tags.
+	BodyType string
+	Status   int
+	Response any
+	// Wrapped marks responses sent as {"data": ...}
+	Wrapped bool
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	Type        string // string unless set
+	Required    bool
+	// Repeated parameters may be given more than once, e.g. ?year=2004&year=2005
+	Repeated bool
+}
+
+// apiFile is a file in a multipart request body
+type apiFile struct{}
+
+// apiOneOf is a response whose shape depends on the request
+type apiOneOf []any
+
+var searchFilterParams = []apiParam{
+	{Name: "q", Description: "Free text query"},
+	{Name: "cursor", Description: "Cursor of the page to fetch, from a previous response"},
+	{Name: "threshold", Type: "number", Description: "Minimum similarity of results"},
+	{Name: "minLat", Type: "number", Description: "Bounding box, given with maxLat, minLon and maxLon"},
+	{Name: "maxLat", Type: "number"},
+	{Name: "minLon", Type: "number"},
+	{Name: "maxLon", Type: "number"},
+}
+
+// APIOperations is every JSON route the site serves
+func APIOperations() []APIOperation {
+	return []APIOperation{
+		{Method: "GET", Path: "/api/openapi.json", Handler: HandleOpenAPI, Tag: "Meta",
+			Summary: "This document", Response: map[string]any{}},
+
+		// Public API
+		{Method: "GET", Path: "/api/v1/ads", Handler: HandleAPISearchAds, Tag: "Ads", Scope: apikey.ScopeRead,
+			Summary: "Search ads",
+			Query: append(append([]apiParam{}, searchFilterParams...),
+				apiParam{Name: "make"}, apiParam{Name: "year"}, apiParam{Name: "model"},
+				apiParam{Name: "engine"}, apiParam{Name: "category"}, apiParam{Name: "subcategory"}),
+			Response: APIAdPage{}},
+		{Method: "POST", Path: "/api/v1/ads", Handler: HandleAPICreateAd, Tag: "Ads", Scope: apikey.ScopeWrite,
+			Summary: "Post an ad", Body: APIAdInput{}, Status: fiber.StatusCreated, Response: APIAd{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/ads/:id", Handler: HandleAPIGetAd, Tag: "Ads", Scope: apikey.ScopeRead,
+			Summary: "Get an ad", Response: APIAd{}, Wrapped: true},
+		{Method: "PUT", Path: "/api/v1/ads/:id", Handler: HandleAPIUpdateAd, Tag: "Ads", Scope: apikey.ScopeWrite,
+			Summary: "Replace one of your ads", Body: APIAdInput{}, Response: APIAd{}, Wrapped: true},
+		{Method: "DELETE", Path: "/api/v1/ads/:id", Handler: HandleAPIDeleteAd, Tag: "Ads", Scope: apikey.ScopeWrite,
+			Summary: "Delete one of your ads", Status: fiber.StatusNoContent},
+		{Method: "POST", Path: "/api/v1/ads/:id/images", Handler: HandleAPIAddAdImages, Tag: "Ads", Scope: apikey.ScopeWrite,
+			Summary: "Upload images to one of your ads",
+			Body: struct {
+				Images []apiFile `form:"images"`
+			}{},
+			BodyType: fiber.MIMEMultipartForm, Status: fiber.StatusAccepted, Response: APIImagesQueued{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/me/ads", Handler: HandleAPIMyAds, Tag: "Ads", Scope: apikey.ScopeRead,
+			Summary: "List your ads", Response: []APIAd{}, Wrapped: true},
+
+		{Method: "GET", Path: "/api/v1/catalog/makes", Handler: HandleAPIMakes, Tag: "Catalog", Scope: apikey.ScopeRead,
+			Summary: "List makes", Response: []string{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/catalog/years", Handler: HandleAPIYears, Tag: "Catalog", Scope: apikey.ScopeRead,
+			Summary: "List a make's years", Query: []apiParam{{Name: "make", Required: true}},
+			Response: []string{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/catalog/models", Handler: HandleAPIModels, Tag: "Catalog", Scope: apikey.ScopeRead,
+			Summary:  "List a make's models",
+			Query:    []apiParam{{Name: "make", Required: true}, {Name: "year", Required: true, Repeated: true}},
+			Response: []string{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/catalog/engines", Handler: HandleAPIEngines, Tag: "Catalog", Scope: apikey.ScopeRead,
+			Summary: "List the engines of a make's models",
+			Query: []apiParam{{Name: "make", Required: true}, {Name: "year", Required: true, Repeated: true},
+				{Name: "model", Required: true, Repeated: true}},
+			Response: []string{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/catalog/categories", Handler: HandleAPICategories, Tag: "Catalog", Scope: apikey.ScopeRead,
+			Summary: "List part categories", Response: []string{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/catalog/subcategories", Handler: HandleAPISubCategories, Tag: "Catalog", Scope: apikey.ScopeRead,
+			Summary: "List a category's subcategories", Query: []apiParam{{Name: "category", Required: true}},
+			Response: []string{}, Wrapped: true},
+
+		{Method: "GET", Path: "/api/v1/bookmarks", Handler: HandleAPIBookmarks, Tag: "Bookmarks", Scope: apikey.ScopeRead,
+			Summary: "List your bookmarked ads", Response: []APIAd{}, Wrapped: true},
+		{Method: "PUT", Path: "/api/v1/bookmarks/:id", Handler: HandleAPIBookmarkAd, Tag: "Bookmarks", Scope: apikey.ScopeWrite,
+			Summary: "Bookmark an ad", Status: fiber.StatusNoContent},
+		{Method: "DELETE", Path: "/api/v1/bookmarks/:id", Handler: HandleAPIUnbookmarkAd, Tag: "Bookmarks", Scope: apikey.ScopeWrite,
+			Summary: "Remove a bookmark", Status: fiber.StatusNoContent},
+
+		{Method: "GET", Path: "/api/v1/conversations", Handler: HandleAPIConversations, Tag: "Conversations", Scope: apikey.ScopeMessages,
+			Summary: "List your conversations", Response: []APIConversation{}, Wrapped: true},
+		{Method: "POST", Path: "/api/v1/conversations", Handler: HandleAPIStartConversation, Tag: "Conversations", Scope: apikey.ScopeMessages,
+			Summary: "Message an ad's seller, starting a conversation or continuing it",
+			Body:    APIMessageInput{}, Status: fiber.StatusCreated, Response: APIConversation{}, Wrapped: true},
+		{Method: "GET", Path: "/api/v1/conversations/:id/messages", Handler: HandleAPIConversationMessages, Tag: "Conversations", Scope: apikey.ScopeMessages,
+			Summary: "List a conversation's messages and mark them read", Response: []APIMessage{}, Wrapped: true},
+		{Method: "POST", Path: "/api/v1/conversations/:id/messages", Handler: HandleAPISendMessage, Tag: "Conversations", Scope: apikey.ScopeMessages,
+			Summary: "Send a message", Body: APIMessageInput{}, Status: fiber.StatusCreated, Response: APIMessage{}, Wrapped: true},
+
+		// Routes the site's own pages call
+		{Method: "GET", Path: "/api/search", Handler: HandleSearchAPI, Tag: "Site",
+			Summary:  "Search ads for the site's views",
+			Query:    append([]apiParam{{Name: "view", Description: "list, grid, tree or map"}}, searchFilterParams...),
+			Response: SearchAPIResponse{}},
+		{Method: "GET", Path: "/api/makes", Handler: HandleMakes, Tag: "Site",
+			Summary: "List makes", Response: []string{}},
+		{Method: "GET", Path: "/api/categories", Handler: HandleCategories, Tag: "Site",
+			Summary: "List part categories", Response: []part.Category{}},
+		{Method: "GET", Path: "/api/ad-image-url/:adID", Handler: HandleAdImageSignedURL, Tag: "Site",
+			Summary: "Get a download token for an ad's images", Response: AdImageURL{}},
+		{Method: "GET", Path: "/api/messages/:action", Handler: HandleMessagesAPI, Tag: "Site", Session: true,
+			Summary:   "List your conversations, or count your unread messages",
+			PathEnums: map[string][]string{"action": {"conversations", "unread-count"}},
+			Response:  apiOneOf{[]messaging.Conversation{}, UnreadCount{}}},
+		{Method: "POST", Path: "/api/sms/webhook", Handler: HandleSMSWebhook, Tag: "Site",
+			Summary: "Twilio SMS status callback", Body: sms.SMSWebhookData{}, BodyType: fiber.MIMEApplicationForm,
+			Response: struct {
+				Status string `json:"status"`
+			}{}},
+	}
+}
+
+// openAPISchemas collects the named schemas of the document's components
+type openAPISchemas struct {
+	schemas map[string]any
+	names   map[reflect.Type]string
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema describes a Go type as it's marshaled, reading field names from
+// the given struct tag. Named structs are described once under
+// components.schemas and referenced after that.
+func (s *openAPISchemas) schema(t reflect.Type, tag string) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(apiFile{}):
+		return map[string]any{"type": "string", "format": "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := s.schema(t.Elem(), tag)
+		if _, ok := elem["$ref"]; ok {
+			return map[string]any{"allOf": []any{elem}, "nullable": true}
+		}
+		elem["nullable"] = true
+		return elem
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.schema(t.Elem(), tag)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem(), tag)}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Struct:
+		if t.Name() == "" || tag != "json" {
+			return s.object(t, tag)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = t.Name()
+			if _, taken := s.schemas[name]; taken {
+				name = path.Base(t.PkgPath()) + "." + name
+			}
+			s.names[t] = name
+			s.schemas[name] = s.object(t, tag)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// object describes a struct's fields, flattening embedded structs the way
+// encoding/json does
+func (s *openAPISchemas) object(t reflect.Type, tag string) map[string]any {
+	properties := map[string]any{}
+	s.fields(t, tag, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+func (s *openAPISchemas) fields(t reflect.Type, tag string, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			s.fields(f.Type, tag, properties)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = s.schema(f.Type, tag)
+	}
+}
+
+// response describes an operation's response body
+func (s *openAPISchemas) response(op APIOperation) map[string]any {
+	var schema map[string]any
+	if oneOf, ok := op.Response.(apiOneOf); ok {
+		var alternatives []any
+		for _, v := range oneOf {
+			alternatives = append(alternatives, s.schema(reflect.TypeOf(v), "json"))
+		}
+		schema = map[string]any{"oneOf": alternatives}
+	} else {
+		schema = s.schema(reflect.TypeOf(op.Response), "json")
+	}
+	if op.Wrapped {
+		schema = map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"data": schema},
+			"required":   []string{"data"},
+		}
+	}
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+var pathParamPattern = regexp.MustCompile(`:(\w+)`)
+
+// OpenAPIPath turns a Fiber route path into an OpenAPI one, e.g.
+// /api/v1/ads/:id becomes /api/v1/ads/{id}
+func OpenAPIPath(route string) string {
+	return pathParamPattern.ReplaceAllString(route, "{$1}")
+}
+
+func (s *openAPISchemas) operation(op APIOperation) map[string]any {
+	out := map[string]any{
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+		"operationId": strings.TrimPrefix(HandlerName(op.Handler), "Handle"),
+	}
+
+	var params []any
+	for _, m := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+		schema := map[string]any{"type": "integer"}
+		if values, ok := op.PathEnums[m[1]]; ok {
+			schema = map[string]any{"type": "string", "enum": values}
+		}
+		params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": schema})
+	}
+	for _, p := range op.Query {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		schema := map[string]any{"type": typ}
+		if p.Repeated {
+			schema = map[string]any{"type": "array", "items": schema}
+		}
+		param := map[string]any{"name": p.Name, "in": "query", "required": p.Required, "schema": schema}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if params != nil {
+		out["parameters"] = params
+	}
+
+	if op.Body != nil {
+		mime, tag := op.BodyType, "form"
+		if mime == "" {
+			mime, tag = fiber.MIMEApplicationJSON, "json"
+		}
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{mime: map[string]any{"schema": s.schema(reflect.TypeOf(op.Body), tag)}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = fiber.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = s.response(op)
+	}
+	if status == fiber.StatusCreated {
+		success["headers"] = map[string]any{
+			"Location": map[string]any{"description": "URL of the created resource", "schema": map[string]any{"type": "string"}},
+		}
+	}
+	responses := map[string]any{fmt.Sprint(status): success}
+
+	switch {
+	case op.Scope != "":
+		out["description"] = fmt.Sprintf("Requires an API key with the `%s` scope.", op.Scope)
+		out["security"] = []any{map[string]any{"bearerAuth": []string{}}, map[string]any{"apiKeyHeader": []string{}}}
+		responses["default"] = map[string]any{
+			"description": "Error",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": s.schema(reflect.TypeOf(APIError{}), "json")},
+			},
+		}
+	case op.Session:
+		out["security"] = []any{map[string]any{"sessionCookie": []string{}}}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// HandlerName returns the name of a handler function without its package,
+// e.g. HandleAPIGetAd
+func HandlerName(h fiber.Handler) string {
+	name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// OpenAPIDocument builds the OpenAPI 3 document of every JSON route
+func OpenAPIDocument() map[string]any {
+	s := &openAPISchemas{schemas: map[string]any{}, names: map[reflect.Type]string{}}
+	paths := map[string]map[string]any{}
+	for _, op := range APIOperations() {
+		p := OpenAPIPath(op.Path)
+		if paths[p] == nil {
+			paths[p] = map[string]any{}
+		}
+		paths[p][strings.ToLower(op.Method)] = s.operation(op)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Parts Pile API",
+			"version": "1.0.0",
+			"description": "The /api/v1 endpoints are the public API. Authenticate with an API key created in " +
+				"Settings, sent as \"Authorization: Bearer <key>\" or in X-API-Key. Failed requests answer with " +
+				"an APIError body. The other endpoints serve the site's own pages and may change without notice.",
+		},
+		"servers": []any{map[string]any{"url": config.BaseURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": s.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth":    map[string]any{"type": "http", "scheme": "bearer"},
+				"apiKeyHeader":  map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"sessionCookie": map[string]any{"type": "apiKey", "in": "cookie", "name": "session_id"},
+			},
+		},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+	openAPIErr  error
+)
+
+// HandleOpenAPI serves the OpenAPI document, built on first request
+func HandleOpenAPI(c *fiber.Ctx) error {
+	openAPIOnce.Do(func() {
+		openAPIJSON, openAPIErr = json.Marshal(OpenAPIDocument())
+	})
+	doc, err := openAPIJSON, openAPIErr
+	if err != nil {
+		log.Printf("[api] Failed to build the OpenAPI document: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build the API description")
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+	return c.Send(doc)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	assert.Equal(t, "/api/v1/ads/{id}/images", OpenAPIPath("/api/v1/ads/:id/images"))
+	assert.Equal(t, "/api/ad-image-url/{adID}", OpenAPIPath("/api/ad-image-url/:adID"))
+}
+
+func TestOpenAPIDocument_Schemas(t *testing.T) {
+	doc := OpenAPIDocument()
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	apiAd := schemas["APIAd"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string", "format": "date-time"}, apiAd["created_at"])
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, apiAd["images"])
+	assert.Equal(t, map[string]any{"allOf": []any{map[string]any{"$ref": "#/components/schemas/APILocation"}}, "nullable": true}, apiAd["location"])
+
+	// Every reference resolves
+	body, err := json.Marshal(doc)
+	require.NoError(t, err)
+	for _, m := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(body), -1) {
+		assert.Contains(t, schemas, m[1])
+	}
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/openapi.json", HandleOpenAPI)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/openapi.json", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Contains(t, doc.Paths["/api/v1/ads/{id}"], "put")
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/partnumber"
+	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/vehicle"
+	g "maragu.dev/gomponents"
+)
+
+// HandlePartNumberFitment offers the fitment the interchange lists for the
+// part number a seller typed on the new ad form. It's filled in straight
+// away while no make is chosen, otherwise only when the seller asks. An
+// unknown number clears the offer.
+func HandlePartNumberFitment(c *fiber.Ctx) error {
+	number := strings.TrimSpace(c.Query("part_number"))
+	if number == "" {
+		return c.SendString("")
+	}
+	groups, vehicles, err := partnumber.Fitment(number)
+	if err != nil {
+		log.Printf("[partnumber] Failed to look up fitment for %q: %v", number, err)
+		return c.SendString("")
+	}
+	if vehicles == 0 {
+		return c.SendString("")
+	}
+	filled := c.Query("make") == "" || c.Query("apply") == "1"
+	return render(c, ui.PartNumberFitment(number, vehicles, vehicle.GetMakes(), groups, fitmentOptions(groups), filled))
+}
+
+// partNumbersSection loads the part number list, or one number's detail
+// when id is set
+func partNumbersSection(id int, filter string, notice g.Node) (g.Node, error) {
+	if id == 0 {
+		numbers, err := partnumber.List(filter, config.PartNumbersListed)
+		if err != nil {
+			return nil, err
+		}
+		return ui.AdminPartNumbersSection(filter, numbers, notice), nil
+	}
+	pn, err := partnumber.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	cars, err := partnumber.GetCars(id)
+	if err != nil {
+		return nil, err
+	}
+	links, err := partnumber.GetLinks(id)
+	if err != nil {
+		return nil, err
+	}
+	interchangeable, err := partnumber.Interchangeable(pn.Number)
+	if err != nil {
+		return nil, err
+	}
+	return ui.AdminPartNumberDetail(pn, cars, links, interchangeable, notice), nil
+}
+
+// renderPartNumbers re-renders the list or a number's detail after a change
+func renderPartNumbers(c *fiber.Ctx, id int, notice g.Node) error {
+	section, err := partNumbersSection(id, "", notice)
+	if errors.Is(err, partnumber.ErrNotFound) {
+		section, err = partNumbersSection(0, "", ui.ValidationError("That part number no longer exists."))
+	}
+	if err != nil {
+		log.Printf("[partnumber] Failed to load part numbers: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load part numbers")
+	}
+	return render(c, section)
+}
+
+func HandleAdminPartNumbers(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	section, err := partNumbersSection(c.QueryInt("id"), c.Query("q"), nil)
+	if errors.Is(err, partnumber.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Part number not found")
+	}
+	if err != nil {
+		log.Printf("[partnumber] Failed to load part numbers: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load part numbers")
+	}
+
+	if c.Get("HX-Request") != "" {
+		return render(c, ui.AdminSectionPage(currentUser, c.Path(), "part-numbers", section))
+	}
+	return render(c, ui.Page(
+		"Admin Dashboard",
+		currentUser,
+		c.Path(),
+		[]g.Node{ui.AdminSectionPage(currentUser, c.Path(), "part-numbers", section)},
+	))
+}
+
+// HandleAddPartNumber adds a part number and opens it
+func HandleAddPartNumber(c *fiber.Ctx) error {
+	id, err := partnumber.Add(c.FormValue("number"), c.FormValue("brand"),
+		partnumber.Kind(c.FormValue("kind")), c.FormValue("description"))
+	if err != nil {
+		return renderPartNumbers(c, 0, adminError("partnumber", "add part number", err, partnumber.ErrNotFound))
+	}
+	return renderPartNumbers(c, id, ui.SuccessMessage("Part number added.", ""))
+}
+
+// HandleImportPartNumbers adds part numbers, their cars and links from an
+// uploaded CSV
+func HandleImportPartNumbers(c *fiber.Ctx) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return renderPartNumbers(c, 0, ui.ValidationError("Choose a CSV file to import."))
+	}
+	file, err := header.Open()
+	if err != nil {
+		return renderPartNumbers(c, 0, adminError("partnumber", "open import", err, partnumber.ErrNotFound))
+	}
+	defer file.Close()
+
+	report, err := partnumber.Import(file)
+	if err != nil {
+		return renderPartNumbers(c, 0, adminError("partnumber", "import part numbers", err, partnumber.ErrNotFound))
+	}
+	log.Printf("[partnumber] Imported %s: %s", header.Filename, report.Summary())
+	return renderPartNumbers(c, 0, ui.PartNumberImportNotice(report, config.PartNumberImportShown))
+}
+
+// HandleUpdatePartNumber changes a part number's brand, kind and description
+func HandleUpdatePartNumber(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := partnumber.Update(id, c.FormValue("brand"), partnumber.Kind(c.FormValue("kind")), c.FormValue("description")); err != nil {
+		return renderPartNumbers(c, id, adminError("partnumber", "update part number", err, partnumber.ErrNotFound))
+	}
+	return renderPartNumbers(c, id, ui.SuccessMessage("Part number saved.", ""))
+}
+
+// HandleDeletePartNumber deletes a part number with its cars and links
+func HandleDeletePartNumber(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := partnumber.Delete(id); err != nil {
+		return renderPartNumbers(c, id, adminError("partnumber", "delete part number", err, partnumber.ErrNotFound))
+	}
+	return renderPartNumbers(c, 0, ui.SuccessMessage("Part number deleted.", ""))
+}
+
+// HandleAddPartNumberCars lists a part number for catalog cars
+func HandleAddPartNumberCars(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	yearFrom, yearTo, err := partnumber.ParseYears(c.FormValue("year"))
+	if err != nil {
+		return renderPartNumbers(c, id, ui.ValidationError(err.Error()))
+	}
+	added, err := partnumber.AddCars(id, partnumber.CarSpec{
+		Make:     strings.TrimSpace(c.FormValue("make")),
+		YearFrom: yearFrom,
+		YearTo:   yearTo,
+		Model:    strings.TrimSpace(c.FormValue("model")),
+		Engine:   strings.TrimSpace(c.FormValue("engine")),
+	})
+	if err != nil {
+		return renderPartNumbers(c, id, adminError("partnumber", "add cars", err, partnumber.ErrNotFound))
+	}
+	return renderPartNumbers(c, id, ui.SuccessMessage(fmt.Sprintf("Listed for %d more cars.", added), ""))
+}
+
+// HandleRemovePartNumberCar stops listing a part number for a car
+func HandleRemovePartNumberCar(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	carID, err := ParseIntParam(c, "car")
+	if err != nil {
+		return err
+	}
+	if err := partnumber.RemoveCar(id, carID); err != nil {
+		return renderPartNumbers(c, id, adminError("partnumber", "remove car", err, partnumber.ErrNotFound))
+	}
+	return renderPartNumbers(c, id, ui.SuccessMessage("Car removed.", ""))
+}
+
+// HandleAddPartNumberLink relates a part number to another
+func HandleAddPartNumberLink(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	kind := partnumber.LinkKind(c.FormValue("kind"))
+	if !kind.IsValid() {
+		return renderPartNumbers(c, id, ui.ValidationError("Choose how the numbers are related."))
+	}
+	if err := partnumber.AddLink(id, c.FormValue("other"), kind); err != nil {
+		return renderPartNumbers(c, id, adminError("partnumber", "link part numbers", err, partnumber.ErrNotFound))
+	}
+	return renderPartNumbers(c, id, ui.SuccessMessage("Part numbers linked.", ""))
+}
+
+// HandleRemovePartNumberLink unrelates two part numbers
+func HandleRemovePartNumberLink(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	otherID, err := ParseIntParam(c, "other")
+	if err != nil {
+		return err
+	}
+	if err := partnumber.RemoveLink(id, otherID); err != nil {
+		return renderPartNumbers(c, id, adminError("partnumber", "unlink part numbers", err, partnumber.ErrNotFound))
+	}
+	return renderPartNumbers(c, id, ui.SuccessMessage("Part numbers unlinked.", ""))
+}
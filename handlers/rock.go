@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"sort"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/analytics"
+	"github.com/parts-pile/site/moderation"
 	"github.com/parts-pile/site/rock"
 	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/vector"
 )
 
 // HandleAdRocks displays the rock section for an ad
@@ -75,6 +79,7 @@ func HandleThrowRock(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(400).SendString(fmt.Sprintf("Failed to throw rock: %v", err))
 	}
+	recordAdEvent(c, adID, analytics.EventRock)
 
 	// Get updated rock count
 	rockCount, err := rock.GetAdRockCount(adID)
@@ -82,6 +87,16 @@ func HandleThrowRock(c *fiber.Ctx) error {
 		rockCount = 0
 	}
 
+	// Hide the ad until reviewed once enough rocks pile up
+	hidden, err := moderation.CheckRockThreshold(adID, rockCount)
+	if err != nil {
+		log.Printf("[moderation] Failed to check rock threshold for ad %d: %v", adID, err)
+	} else if hidden {
+		if err := vector.DeleteAdEmbedding(adID); err != nil {
+			log.Printf("Warning: Failed to delete ad %d from vector database: %v", adID, err)
+		}
+	}
+
 	// Check if user can still throw rocks
 	canThrow, err := rock.CanThrowRock(currentUser.ID)
 	if err != nil {
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/part"
+	"github.com/parts-pile/site/partnumber"
 	"github.com/parts-pile/site/ui"
 	"github.com/parts-pile/site/user"
 	"github.com/parts-pile/site/vector"
@@ -43,7 +45,9 @@ func runEmbeddingSearch(embedding []float32, cursor string, threshold float64, k
 // Embedding-based search with user query
 func queryEmbedding(userPrompt string, cursor string, threshold float64, k int, filter *qdrant.Filter) ([]int, string, error) {
 	log.Printf("[queryEmbedding] Generating embedding for user query: %s", userPrompt)
-	embedding, err := vector.GetQueryEmbedding(userPrompt)
+	// Spell out aliases and synonyms, e.g. "genny" -> Alternator, so ads
+	// filed under the taxonomy's names are found
+	embedding, err := vector.GetQueryEmbedding(part.ExpandQuery(userPrompt))
 	if err != nil {
 		return nil, "", err
 	}
@@ -94,6 +98,17 @@ func performSearch(userPrompt string, currentUser *user.User, cursorStr string,
 	log.Printf("[performSearch] userPrompt='%s', userID=%d, cursorStr='%s', threshold=%.2f, k=%d, filter=%v", userPrompt, userID, cursorStr, threshold, k, filter)
 
 	if userPrompt != "" {
+		// A part number finds the ads carrying it or any number that
+		// interchanges with it, however weakly they match semantically
+		if partnumber.LooksLikePartNumber(userPrompt) {
+			adIDs, err := partnumber.AdIDs(userPrompt)
+			if err != nil {
+				log.Printf("[performSearch] Part number lookup failed for %q: %v", userPrompt, err)
+			} else if len(adIDs) > 0 {
+				log.Printf("[performSearch] Part number %q matches %d ads", userPrompt, len(adIDs))
+				return queryEmbedding(userPrompt, cursorStr, 0, k, vector.BuildAdIDFilter(filter, adIDs))
+			}
+		}
 		return queryEmbedding(userPrompt, cursorStr, threshold, k, filter)
 	}
 
@@ -122,6 +137,10 @@ func handleSearch(c *fiber.Ctx, viewType string) error {
 
 	saveUserSearch(c)
 	saveCookieLastView(c, viewType)
+	// The tree only shows ads once a leaf is expanded
+	if viewType != "tree" {
+		recordImpressions(c, viewType, adIDs)
+	}
 
 	return view.RenderSearchResults(adIDs, nextCursor)
 }
@@ -129,7 +148,8 @@ func handleSearch(c *fiber.Ctx, viewType string) error {
 func HandleSearchPage(c *fiber.Ctx) error {
 	c.Set("Content-Type", "text/html")
 
-	view, err := NewView(c, c.Query("view", "list"))
+	viewType := c.Query("view", "list")
+	view, err := NewView(c, viewType)
 	if err != nil {
 		return err
 	}
@@ -138,6 +158,9 @@ func HandleSearchPage(c *fiber.Ctx) error {
 	if err != nil {
 		return err
 	}
+	if viewType != "tree" {
+		recordImpressions(c, viewType, adIDs)
+	}
 
 	return view.RenderSearchPage(adIDs, nextCursor)
 }
@@ -146,13 +169,21 @@ func HandleSearch(c *fiber.Ctx) error {
 	return handleSearch(c, c.Query("view", "list"))
 }
 
+// SearchAPIResponse is the body of /api/search responses
+type SearchAPIResponse struct {
+	Ads        []ad.Ad `json:"ads"`
+	NextCursor string  `json:"nextCursor"`
+	Count      int     `json:"count"`
+	Error      string  `json:"error,omitempty"`
+}
+
 // HandleSearchAPI returns search results as JSON for JavaScript consumption
 func HandleSearchAPI(c *fiber.Ctx) error {
 	view, err := NewView(c, c.Query("view", "list"))
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": fmt.Sprintf("Invalid view type: %s", c.Query("view", "list")),
-			"ads":   []ad.Ad{},
+		return c.Status(400).JSON(SearchAPIResponse{
+			Error: fmt.Sprintf("Invalid view type: %s", c.Query("view", "list")),
+			Ads:   []ad.Ad{},
 		})
 	}
 	currentUser, _ := getUser(c)
@@ -160,18 +191,18 @@ func HandleSearchAPI(c *fiber.Ctx) error {
 	adIDs, nextCursor, err := view.GetAdIDs()
 	if err != nil {
 		log.Printf("[HandleSearchAPI] Search error: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Search failed",
-			"ads":   []ad.Ad{},
+		return c.Status(500).JSON(SearchAPIResponse{
+			Error: "Search failed",
+			Ads:   []ad.Ad{},
 		})
 	}
 
 	ads, err := ad.GetAdsByIDs(adIDs, currentUser)
 	if err != nil {
 		log.Printf("[HandleSearchAPI] GetAdsByIDs error: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Failed to retrieve ads",
-			"ads":   []ad.Ad{},
+		return c.Status(500).JSON(SearchAPIResponse{
+			Error: "Failed to retrieve ads",
+			Ads:   []ad.Ad{},
 		})
 	}
 
@@ -180,10 +211,10 @@ func HandleSearchAPI(c *fiber.Ctx) error {
 	log.Printf("[HandleSearchAPI] ads returned: %d", len(ads))
 
 	// Return JSON response
-	return c.JSON(fiber.Map{
-		"ads":        ads,
-		"nextCursor": nextCursor,
-		"count":      len(ads),
+	return c.JSON(SearchAPIResponse{
+		Ads:        ads,
+		NextCursor: nextCursor,
+		Count:      len(ads),
 	})
 }
 
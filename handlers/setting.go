@@ -1,11 +1,197 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/apikey"
+	"github.com/parts-pile/site/config"
 	"github.com/parts-pile/site/ui"
+	"github.com/parts-pile/site/user"
+	"github.com/parts-pile/site/webhook"
+	g "maragu.dev/gomponents"
 )
 
 func HandleSettings(c *fiber.Ctx) error {
 	currentUser, _ := getUser(c)
-	return render(c, ui.SettingsPage(currentUser, c.Path()))
+	priceDropAlerts, err := user.GetPriceDropAlerts(currentUser.ID)
+	if err != nil {
+		log.Printf("[settings] Failed to get price drop alert setting for user %d: %v", currentUser.ID, err)
+		priceDropAlerts = true
+	}
+	keys, err := apikey.GetKeysForUser(currentUser.ID)
+	if err != nil {
+		log.Printf("[settings] Failed to get API keys for user %d: %v", currentUser.ID, err)
+	}
+	webhooks, err := webhook.GetWebhooksForUser(currentUser.ID)
+	if err != nil {
+		log.Printf("[settings] Failed to get webhooks for user %d: %v", currentUser.ID, err)
+	}
+	deliveries, err := webhook.GetRecentDeliveries(currentUser.ID, config.WebhookDeliveriesListed)
+	if err != nil {
+		log.Printf("[settings] Failed to get webhook deliveries for user %d: %v", currentUser.ID, err)
+	}
+	return render(c, ui.SettingsPage(currentUser, c.Path(), priceDropAlerts, keys, webhooks, deliveries))
+}
+
+// HandleUpdatePriceDropAlerts opts the user in to or out of price-drop alerts
+func HandleUpdatePriceDropAlerts(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	enabled := c.FormValue("priceDropAlerts") != ""
+	if err := user.UpdatePriceDropAlerts(currentUser.ID, enabled); err != nil {
+		log.Printf("[settings] Failed to update price drop alerts for user %d: %v", currentUser.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to update price drop alerts")
+	}
+	if enabled {
+		return render(c, ui.SuccessMessage("Price-drop alerts turned on", ""))
+	}
+	return render(c, ui.SuccessMessage("Price-drop alerts turned off", ""))
+}
+
+// renderAPIKeys re-renders the user's API keys after a change
+func renderAPIKeys(c *fiber.Ctx, userID int, notice g.Node) error {
+	keys, err := apikey.GetKeysForUser(userID)
+	if err != nil {
+		log.Printf("[settings] Failed to get API keys for user %d: %v", userID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load API keys")
+	}
+	return render(c, ui.APIKeysSection(keys, notice))
+}
+
+// HandleCreateAPIKey creates an API key and shows it to the user once
+func HandleCreateAPIKey(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	active, err := apikey.CountActiveKeys(currentUser.ID)
+	if err != nil {
+		log.Printf("[settings] Failed to count API keys for user %d: %v", currentUser.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to create API key")
+	}
+	if active >= config.APIKeysPerUser {
+		return renderAPIKeys(c, currentUser.ID, ui.ValidationError(
+			fmt.Sprintf("You can have up to %d API keys. Revoke one you no longer use first.", config.APIKeysPerUser)))
+	}
+
+	var scopes []string
+	if form, err := c.MultipartForm(); err == nil {
+		scopes = form.Value["scopes"]
+	}
+	_, token, err := apikey.Create(currentUser.ID, c.FormValue("name"), scopes)
+	if err != nil {
+		return renderAPIKeys(c, currentUser.ID, ui.ValidationError(err.Error()))
+	}
+	log.Printf("[settings] Created API key for user %d", currentUser.ID)
+	return renderAPIKeys(c, currentUser.ID, ui.NewAPIKeyNotice(token))
+}
+
+// HandleRevokeAPIKey stops one of the user's API keys from working
+func HandleRevokeAPIKey(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	keyID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	err = apikey.Revoke(currentUser.ID, keyID)
+	if errors.Is(err, apikey.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "API key not found")
+	}
+	if err != nil {
+		log.Printf("[settings] Failed to revoke API key %d: %v", keyID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke API key")
+	}
+	return renderAPIKeys(c, currentUser.ID, ui.SuccessMessage("API key revoked.", ""))
+}
+
+// renderWebhooks re-renders the user's webhooks and deliveries after a change
+func renderWebhooks(c *fiber.Ctx, userID int, notice g.Node) error {
+	webhooks, err := webhook.GetWebhooksForUser(userID)
+	if err != nil {
+		log.Printf("[settings] Failed to get webhooks for user %d: %v", userID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load webhooks")
+	}
+	deliveries, err := webhook.GetRecentDeliveries(userID, config.WebhookDeliveriesListed)
+	if err != nil {
+		log.Printf("[settings] Failed to get webhook deliveries for user %d: %v", userID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load webhooks")
+	}
+	return render(c, ui.WebhooksSection(webhooks, deliveries, notice))
+}
+
+// HandleCreateWebhook registers an endpoint for the events the user chose
+func HandleCreateWebhook(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	count, err := webhook.CountWebhooks(currentUser.ID)
+	if err != nil {
+		log.Printf("[settings] Failed to count webhooks for user %d: %v", currentUser.ID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to add webhook")
+	}
+	if count >= config.WebhooksPerUser {
+		return renderWebhooks(c, currentUser.ID, ui.ValidationError(
+			fmt.Sprintf("You can have up to %d webhooks. Delete one you no longer use first.", config.WebhooksPerUser)))
+	}
+
+	var events []string
+	if form, err := c.MultipartForm(); err == nil {
+		events = form.Value["events"]
+	}
+	if _, err := webhook.Create(currentUser.ID, c.FormValue("url"), events); err != nil {
+		return renderWebhooks(c, currentUser.ID, ui.ValidationError(err.Error()))
+	}
+	log.Printf("[settings] Created webhook for user %d", currentUser.ID)
+	return renderWebhooks(c, currentUser.ID, ui.SuccessMessage("Webhook added. Use its signing secret to verify deliveries.", ""))
+}
+
+// HandleDeleteWebhook removes one of the user's webhooks
+func HandleDeleteWebhook(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	webhookID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	err = webhook.Delete(currentUser.ID, webhookID)
+	if errors.Is(err, webhook.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Webhook not found")
+	}
+	if err != nil {
+		log.Printf("[settings] Failed to delete webhook %d: %v", webhookID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to delete webhook")
+	}
+	return renderWebhooks(c, currentUser.ID, ui.SuccessMessage("Webhook deleted.", ""))
+}
+
+// HandleResendWebhookDelivery queues one of the user's deliveries again
+func HandleResendWebhookDelivery(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+	deliveryID, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	err = webhook.Resend(currentUser.ID, deliveryID)
+	if errors.Is(err, webhook.ErrNotFound) {
+		return renderWebhooks(c, currentUser.ID, ui.ValidationError("That delivery is already queued."))
+	}
+	if err != nil {
+		log.Printf("[settings] Failed to resend webhook delivery %d: %v", deliveryID, err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to resend delivery")
+	}
+	return renderWebhooks(c, currentUser.ID, ui.SuccessMessage("Delivery queued to be sent again.", ""))
 }
@@ -2,16 +2,20 @@ package handlers
 
 import (
 	"encoding/xml"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/sitemap"
 )
 
+const sitemapXmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
 type SitemapURL struct {
-	Loc        string    `xml:"loc"`
-	LastMod    time.Time `xml:"lastmod"`
-	ChangeFreq string    `xml:"changefreq"`
-	Priority   string    `xml:"priority"`
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
 }
 
 type Sitemap struct {
@@ -20,45 +24,71 @@ type Sitemap struct {
 	URLs    []SitemapURL `xml:"url"`
 }
 
+type SitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []SitemapRef `xml:"sitemap"`
+}
+
+// sitemapLastMod formats a change time for a sitemap, leaving unknown
+// times out
+func sitemapLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func siteURL(path string) string {
+	return strings.TrimSuffix(config.BaseURL, "/") + path
+}
+
+// HandleSitemap serves the sitemap index, pointing at one child sitemap per
+// chunk of pages and ads
 func HandleSitemap(c *fiber.Ctx) error {
-	baseURL := "https://parts-pile.com"
+	chunks, err := sitemap.Chunks()
+	if err != nil {
+		log.Printf("[sitemap] Failed to build sitemaps: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build sitemap")
+	}
+
+	index := SitemapIndex{Xmlns: sitemapXmlns}
+	for _, chunk := range chunks {
+		index.Sitemaps = append(index.Sitemaps, SitemapRef{
+			Loc:     siteURL("/sitemaps/" + chunk.Name + ".xml"),
+			LastMod: sitemapLastMod(chunk.LastMod),
+		})
+	}
+
+	c.Set("Content-Type", "application/xml")
+	return c.XML(index)
+}
+
+// HandleSitemapChunk serves one child sitemap of the index
+func HandleSitemapChunk(c *fiber.Ctx) error {
+	name, ok := strings.CutSuffix(c.Params("name"), ".xml")
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Sitemap not found")
+	}
+	chunk, found, err := sitemap.Find(name)
+	if err != nil {
+		log.Printf("[sitemap] Failed to build sitemaps: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to build sitemap")
+	}
+	if !found {
+		return fiber.NewError(fiber.StatusNotFound, "Sitemap not found")
+	}
 
-	sitemap := Sitemap{
-		Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9",
-		URLs: []SitemapURL{
-			{
-				Loc:        baseURL + "/",
-				LastMod:    time.Now(),
-				ChangeFreq: "daily",
-				Priority:   "1.0",
-			},
-			{
-				Loc:        baseURL + "/register",
-				LastMod:    time.Now(),
-				ChangeFreq: "monthly",
-				Priority:   "0.6",
-			},
-			{
-				Loc:        baseURL + "/login",
-				LastMod:    time.Now(),
-				ChangeFreq: "monthly",
-				Priority:   "0.5",
-			},
-			{
-				Loc:        baseURL + "/terms",
-				LastMod:    time.Now(),
-				ChangeFreq: "yearly",
-				Priority:   "0.3",
-			},
-			{
-				Loc:        baseURL + "/privacy",
-				LastMod:    time.Now(),
-				ChangeFreq: "yearly",
-				Priority:   "0.3",
-			},
-		},
+	urlset := Sitemap{Xmlns: sitemapXmlns, URLs: make([]SitemapURL, len(chunk.URLs))}
+	for i, u := range chunk.URLs {
+		urlset.URLs[i] = SitemapURL{Loc: siteURL(u.Loc), LastMod: sitemapLastMod(u.LastMod)}
 	}
 
 	c.Set("Content-Type", "application/xml")
-	return c.XML(sitemap)
+	return c.XML(urlset)
 }
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/part"
+	"github.com/parts-pile/site/ui"
+	g "maragu.dev/gomponents"
+)
+
+// taxonomySection loads the part categories, aliases and synonyms
+func taxonomySection(notice g.Node) (g.Node, error) {
+	categories, err := part.GetTaxonomy()
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := part.GetAliases()
+	if err != nil {
+		return nil, err
+	}
+	synonyms, err := part.GetSynonyms()
+	if err != nil {
+		return nil, err
+	}
+	return ui.AdminTaxonomySection(categories, aliases, synonyms, notice), nil
+}
+
+// renderTaxonomy re-renders the section after a change
+func renderTaxonomy(c *fiber.Ctx, notice g.Node) error {
+	section, err := taxonomySection(notice)
+	if err != nil {
+		log.Printf("[taxonomy] Failed to load part categories: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load part categories")
+	}
+	return render(c, section)
+}
+
+// formID reads a required ID posted in a form field
+func formID(c *fiber.Ctx, field string) (int, bool) {
+	id, err := strconv.Atoi(c.FormValue(field))
+	return id, err == nil && id > 0
+}
+
+func HandleAdminTaxonomy(c *fiber.Ctx) error {
+	currentUser, err := CurrentUser(c)
+	if err != nil {
+		return err
+	}
+
+	section, err := taxonomySection(nil)
+	if err != nil {
+		log.Printf("[taxonomy] Failed to load part categories: %v", err)
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to load part categories")
+	}
+
+	if c.Get("HX-Request") != "" {
+		return render(c, ui.AdminSectionPage(currentUser, c.Path(), "taxonomy", section))
+	}
+	return render(c, ui.Page(
+		"Admin Dashboard",
+		currentUser,
+		c.Path(),
+		[]g.Node{ui.AdminSectionPage(currentUser, c.Path(), "taxonomy", section)},
+	))
+}
+
+// HandleAddPartCategory adds a part category
+func HandleAddPartCategory(c *fiber.Ctx) error {
+	if _, err := part.AddCategory(c.FormValue("name")); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "add category", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Category added.", ""))
+}
+
+// HandleRenamePartCategory renames a part category and re-indexes its ads
+func HandleRenamePartCategory(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	ads, err := part.RenameCategory(id, c.FormValue("name"))
+	if err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "rename category", err, part.ErrNotFound))
+	}
+	log.Printf("[taxonomy] Renamed category %d to %q, %d ads to re-index", id, c.FormValue("name"), ads)
+	return renderTaxonomy(c, ui.SuccessMessage("Category renamed."+reembedAds(ads), ""))
+}
+
+// HandleDeletePartCategory deletes a part category with no subcategories
+func HandleDeletePartCategory(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := part.DeleteCategory(id); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "delete category", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Category deleted.", ""))
+}
+
+// HandleAddPartCategoryAlias adds another name for a part category
+func HandleAddPartCategoryAlias(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := part.AddAlias(id, 0, c.FormValue("alias")); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "add alias", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Alias added.", ""))
+}
+
+// HandleAddPartSubCategory adds a subcategory to a part category
+func HandleAddPartSubCategory(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if _, err := part.AddSubCategory(id, c.FormValue("name")); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "add subcategory", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Subcategory added.", ""))
+}
+
+// HandleRenamePartSubCategory renames a subcategory and re-indexes its ads
+func HandleRenamePartSubCategory(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	ads, err := part.RenameSubCategory(id, c.FormValue("name"))
+	if err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "rename subcategory", err, part.ErrNotFound))
+	}
+	log.Printf("[taxonomy] Renamed subcategory %d to %q, %d ads to re-index", id, c.FormValue("name"), ads)
+	return renderTaxonomy(c, ui.SuccessMessage("Subcategory renamed."+reembedAds(ads), ""))
+}
+
+// HandleMovePartSubCategory moves a subcategory and its ads under another
+// category
+func HandleMovePartSubCategory(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	categoryID, ok := formID(c, "category_id")
+	if !ok {
+		return renderTaxonomy(c, ui.ValidationError("Choose a category to move it to."))
+	}
+	ads, err := part.MoveSubCategory(id, categoryID)
+	if err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "move subcategory", err, part.ErrNotFound))
+	}
+	log.Printf("[taxonomy] Moved subcategory %d to category %d, %d ads to re-index", id, categoryID, ads)
+	return renderTaxonomy(c, ui.SuccessMessage("Subcategory moved."+reembedAds(ads), ""))
+}
+
+// HandleMergePartSubCategory folds a subcategory and its ads into another
+func HandleMergePartSubCategory(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	into, ok := formID(c, "into")
+	if !ok {
+		return renderTaxonomy(c, ui.ValidationError("Choose a subcategory to merge into."))
+	}
+	ads, err := part.MergeSubCategory(id, into)
+	if err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "merge subcategory", err, part.ErrNotFound))
+	}
+	log.Printf("[taxonomy] Merged subcategory %d into %d, %d ads to re-index", id, into, ads)
+	return renderTaxonomy(c, ui.SuccessMessage("Subcategory merged."+reembedAds(ads), ""))
+}
+
+// HandleAddPartSubCategoryAlias adds another name for a subcategory
+func HandleAddPartSubCategoryAlias(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := part.AddAlias(0, id, c.FormValue("alias")); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "add alias", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Alias added.", ""))
+}
+
+// HandleDeletePartAlias deletes an alias
+func HandleDeletePartAlias(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := part.DeleteAlias(id); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "delete alias", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Alias deleted.", ""))
+}
+
+// HandleAddPartSynonyms adds a list of words that mean the same part
+func HandleAddPartSynonyms(c *fiber.Ctx) error {
+	if err := part.AddSynonyms(c.FormValue("terms")); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "add synonyms", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Synonyms added.", ""))
+}
+
+// HandleDeletePartSynonyms deletes a synonym list
+func HandleDeletePartSynonyms(c *fiber.Ctx) error {
+	id, err := ParseIntParam(c, "id")
+	if err != nil {
+		return err
+	}
+	if err := part.DeleteSynonyms(id); err != nil {
+		return renderTaxonomy(c, adminError("taxonomy", "delete synonyms", err, part.ErrNotFound))
+	}
+	return renderTaxonomy(c, ui.SuccessMessage("Synonyms deleted.", ""))
+}
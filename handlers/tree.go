@@ -100,6 +100,7 @@ func HandleTreeExpandBrowse(c *fiber.Ctx) error {
 			return err
 		}
 		log.Printf("[tree-view] Found %d ads", len(ads))
+		recordTreeImpressions(c, ads)
 	}
 
 	if err != nil {
@@ -171,6 +172,7 @@ func HandleTreeExpandSearch(c *fiber.Ctx) error {
 		if err != nil {
 			return err
 		}
+		recordTreeImpressions(c, ads)
 	}
 
 	if err != nil {
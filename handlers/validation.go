@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"mime/multipart"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -110,54 +112,41 @@ func ValidationErrorResponseWithStatus(c *fiber.Ctx, message string, statusCode
 	return render(c, ui.ValidationError(message))
 }
 
-// ValidateAdForm validates the common ad form fields (years, models, engines, category, subcategory)
-func ValidateAdForm(form *multipart.Form) error {
-	if _, err := ValidateRequiredMultipart(form, "years", "year"); err != nil {
-		return err
-	}
-	if _, err := ValidateRequiredMultipart(form, "models", "model"); err != nil {
-		return err
-	}
-	if _, err := ValidateRequiredMultipart(form, "engines", "engine size"); err != nil {
-		return err
-	}
-	if _, err := ValidateRequiredMultipart(form, "category", "category"); err != nil {
-		return err
-	}
-	if _, err := ValidateRequiredMultipart(form, "subcategory", "subcategory"); err != nil {
-		return err
+// ValidateFitmentGroup checks that a fitment group has a make and years,
+// models and engines, each given either explicitly or as a rule. label names
+// the group in error messages and is empty for the first group.
+func ValidateFitmentGroup(f ad.FitmentGroup, label string) error {
+	suffix := ""
+	if label != "" {
+		suffix = " for the " + label
+	}
+	switch {
+	case f.Make == "":
+		return fmt.Errorf("Please select a make%s", suffix)
+	case len(f.Years) == 0 && !f.HasYearRange():
+		return fmt.Errorf("Please select at least one year%s", suffix)
+	case len(f.Models) == 0 && !f.AllModels:
+		return fmt.Errorf("Please select at least one model%s", suffix)
+	case len(f.Engines) == 0 && !f.AllEngines:
+		return fmt.Errorf("Please select at least one engine size%s", suffix)
 	}
 	return nil
 }
 
-// ValidateAdFormAndReturn validates ad form and returns the values
-func ValidateAdFormAndReturn(form *multipart.Form) (years, models, engines, categories, subcategories []string, err error) {
-	years, err = ValidateRequiredMultipart(form, "years", "year")
-	if err != nil {
-		return nil, nil, nil, nil, nil, err
-	}
-
-	models, err = ValidateRequiredMultipart(form, "models", "model")
-	if err != nil {
-		return nil, nil, nil, nil, nil, err
-	}
-
-	engines, err = ValidateRequiredMultipart(form, "engines", "engine size")
-	if err != nil {
-		return nil, nil, nil, nil, nil, err
-	}
-
-	categories, err = ValidateRequiredMultipart(form, "category", "category")
-	if err != nil {
-		return nil, nil, nil, nil, nil, err
-	}
-
-	subcategories, err = ValidateRequiredMultipart(form, "subcategory", "subcategory")
-	if err != nil {
-		return nil, nil, nil, nil, nil, err
+// ValidateFitmentGroups validates the first fitment group and any added after
+// it, returning them in order
+func ValidateFitmentGroups(form *multipart.Form) ([]ad.FitmentGroup, error) {
+	groups := append([]ad.FitmentGroup{fitmentGroupFromForm(form, 0)}, extraFitmentGroupsFromForm(form)...)
+	for i, f := range groups {
+		label := ""
+		if i > 0 {
+			label = fmt.Sprintf("additional make #%d", i)
+		}
+		if err := ValidateFitmentGroup(f, label); err != nil {
+			return nil, err
+		}
 	}
-
-	return years, models, engines, categories, subcategories, nil
+	return groups, nil
 }
 
 // ValidateAndParsePrice validates and parses a price field
@@ -179,21 +168,93 @@ func ValidateAndParsePrice(c *fiber.Ctx) (float64, error) {
 	return price, nil
 }
 
+// partNumberPattern matches OEM part numbers: letters and digits separated by
+// dashes, dots, slashes or spaces
+var partNumberPattern = regexp.MustCompile(`^[A-Z0-9]+([ ./-][A-Z0-9]+)*$`)
+
+// formValue returns the first trimmed value of a multipart form field
+func formValue(form *multipart.Form, fieldName string) string {
+	if values := form.Value[fieldName]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// ValidatePartAttributes validates the structured part attributes against the
+// subcategory's attribute schema and returns the parsed values
+func ValidatePartAttributes(form *multipart.Form, schema part.AttributeSchema) (condition, partNumber string, quantity int, position string, coreCharge float64, err error) {
+	condition = strings.ToLower(formValue(form, ad.AttrCondition))
+	if condition == "" && schema.IsRequired(ad.AttrCondition) {
+		return "", "", 0, "", 0, fmt.Errorf("Condition is required for this part")
+	}
+	if condition != "" && !ad.IsValidCondition(condition) {
+		return "", "", 0, "", 0, fmt.Errorf("Invalid condition: %s", condition)
+	}
+
+	partNumber = strings.ToUpper(formValue(form, ad.AttrPartNumber))
+	if partNumber == "" && schema.IsRequired(ad.AttrPartNumber) {
+		return "", "", 0, "", 0, fmt.Errorf("OEM part number is required for this part")
+	}
+	if partNumber != "" && (len(partNumber) > 40 || !partNumberPattern.MatchString(partNumber)) {
+		return "", "", 0, "", 0, fmt.Errorf("Invalid OEM part number format")
+	}
+
+	quantity = 1
+	if quantityStr := formValue(form, ad.AttrQuantity); quantityStr != "" {
+		quantity, err = strconv.Atoi(quantityStr)
+		if err != nil {
+			return "", "", 0, "", 0, fmt.Errorf("Invalid quantity format")
+		}
+		if quantity < 1 {
+			return "", "", 0, "", 0, fmt.Errorf("Quantity must be at least 1")
+		}
+	}
+
+	position = formValue(form, ad.AttrPosition)
+	if position == "" && schema.IsRequired(ad.AttrPosition) {
+		return "", "", 0, "", 0, fmt.Errorf("Side/position is required for this part")
+	}
+	if position != "" && !slices.Contains(schema.AllowedPositions(), position) {
+		return "", "", 0, "", 0, fmt.Errorf("Invalid side/position for this part: %s", position)
+	}
+
+	if coreChargeStr := formValue(form, ad.AttrCoreCharge); coreChargeStr != "" {
+		coreCharge, err = strconv.ParseFloat(coreChargeStr, 64)
+		if err != nil {
+			return "", "", 0, "", 0, fmt.Errorf("Invalid core charge format")
+		}
+		if coreCharge < 0 {
+			return "", "", 0, "", 0, fmt.Errorf("Core charge cannot be negative")
+		}
+	} else if schema.IsRequired(ad.AttrCoreCharge) {
+		return "", "", 0, "", 0, fmt.Errorf("Core charge is required for this part")
+	}
+
+	return condition, partNumber, quantity, position, coreCharge, nil
+}
+
 // BuildAdFromForm builds an Ad struct from form data
 func BuildAdFromForm(c *fiber.Ctx, userID int, locationID int, adID ...int) (ad.Ad, []*multipart.FileHeader, []int, error) {
 	title, err := ValidateRequired(c, "title", "Title")
 	if err != nil {
 		return ad.Ad{}, nil, nil, err
 	}
-	make, err := ValidateRequired(c, "make", "Make")
-	if err != nil {
+	if _, err := ValidateRequired(c, "make", "Make"); err != nil {
 		return ad.Ad{}, nil, nil, err
 	}
 	form, err := c.MultipartForm()
 	if err != nil {
 		return ad.Ad{}, nil, nil, err
 	}
-	years, models, engines, categories, subcategories, err := ValidateAdFormAndReturn(form)
+	fitment, err := ValidateFitmentGroups(form)
+	if err != nil {
+		return ad.Ad{}, nil, nil, err
+	}
+	categories, err := ValidateRequiredMultipart(form, "category", "category")
+	if err != nil {
+		return ad.Ad{}, nil, nil, err
+	}
+	subcategories, err := ValidateRequiredMultipart(form, "subcategory", "subcategory")
 	if err != nil {
 		return ad.Ad{}, nil, nil, err
 	}
@@ -204,17 +265,27 @@ func BuildAdFromForm(c *fiber.Ctx, userID int, locationID int, adID ...int) (ad.
 		category = categories[0]
 	}
 
-	// Get subcategory ID from the validated arrays
+	// Get subcategory ID from the validated arrays. What was typed may be an
+	// alias or synonym, so resolve it to the taxonomy's own names first.
 	subcategoryID := 0
+	subcategoryName := ""
 	if len(subcategories) > 0 {
-		subcategoryName := subcategories[0]
-		// Look up subcategory ID by name
-		subcategoryID, err = part.GetSubCategoryIDByName(subcategoryName)
+		matchedCategory, matchedSubcategory, ok := part.MatchSubCategory(category, subcategories[0])
+		if !ok {
+			return ad.Ad{}, nil, nil, fmt.Errorf("invalid subcategory: %s", subcategories[0])
+		}
+		category, subcategoryName = matchedCategory, matchedSubcategory
+		subcategoryID, err = part.GetSubCategoryID(category, subcategoryName)
 		if err != nil {
 			return ad.Ad{}, nil, nil, fmt.Errorf("invalid subcategory: %s", subcategoryName)
 		}
 	}
 
+	condition, partNumber, quantity, position, coreCharge, err := ValidatePartAttributes(form, part.GetAttributeSchema(subcategoryName))
+	if err != nil {
+		return ad.Ad{}, nil, nil, err
+	}
+
 	// Extract image files
 	imageFiles := form.File["images"]
 	// Don't require at least one image for edit
@@ -226,42 +297,44 @@ func BuildAdFromForm(c *fiber.Ctx, userID int, locationID int, adID ...int) (ad.
 	if err != nil {
 		return ad.Ad{}, nil, nil, err
 	}
+	if err := screenAd(c, title, description, partNumber); err != nil {
+		return ad.Ad{}, nil, nil, err
+	}
 
 	id := 0
 	if len(adID) > 0 {
 		id = adID[0]
 	}
 
-	// Parse deleted images
-	deletedImagesStr := c.FormValue("deleted_images")
-	deletedImages := []int{}
-	if deletedImagesStr != "" {
-		for _, s := range strings.Split(deletedImagesStr, ",") {
-			if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
-				deletedImages = append(deletedImages, n)
-			}
-		}
-	}
-
-	// Calculate final image count: new images - deleted images
-	imageCount := len(imageFiles) - len(deletedImages)
-	if imageCount < 0 {
-		imageCount = 0
-	}
+	// IDs of existing images the seller removed
+	deletedImages := parseIDList(c.FormValue("deleted_images"))
 
-	return ad.Ad{
+	adObj := ad.Ad{
 		ID:            id,
 		Title:         title,
-		Make:          make,
-		Years:         years,
-		Models:        models,
-		Engines:       engines,
 		Category:      sql.NullString{String: category, Valid: category != ""},
 		SubCategoryID: subcategoryID,
 		Description:   description,
 		Price:         price,
 		UserID:        userID,
 		LocationID:    locationID,
-		ImageCount:    imageCount,
-	}, imageFiles, deletedImages, nil
+		Condition:     condition,
+		PartNumber:    partNumber,
+		Quantity:      quantity,
+		Position:      position,
+		CoreCharge:    coreCharge,
+	}
+	adObj.SetFitment(fitment)
+	return adObj, imageFiles, deletedImages, nil
+}
+
+// parseIDList parses a comma-separated list of IDs, skipping invalid entries
+func parseIDList(s string) []int {
+	ids := []int{}
+	for _, part := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			ids = append(ids, n)
+		}
+	}
+	return ids
 }
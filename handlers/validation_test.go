@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/parts-pile/site/part"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -199,172 +200,154 @@ func TestParseFormInt(t *testing.T) {
 	}
 }
 
-func TestValidateAdForm(t *testing.T) {
+func TestValidatePartAttributes(t *testing.T) {
+	alternator := part.AttributeSchema{Required: []string{"condition"}, CoreCharge: true}
+	idlerPulley := part.AttributeSchema{Positions: []string{"Upper", "Lower"}}
+
 	tests := []struct {
-		name          string
-		years         []string
-		models        []string
-		engines       []string
-		categories    []string
-		subcategories []string
-		expectError   bool
+		name           string
+		values         map[string][]string
+		schema         part.AttributeSchema
+		expectError    bool
+		expectQuantity int
 	}{
 		{
-			name:          "valid ad form",
-			years:         []string{"2020", "2021"},
-			models:        []string{"Civic", "Accord"},
-			engines:       []string{"2.0L", "2.5L"},
-			categories:    []string{"Engine"},
-			subcategories: []string{"Engine Block"},
-			expectError:   false,
-		},
-		{
-			name:          "missing years",
-			years:         []string{},
-			models:        []string{"Civic"},
-			engines:       []string{"2.0L"},
-			categories:    []string{"Engine"},
-			subcategories: []string{"Engine Block"},
-			expectError:   true,
-		},
-		{
-			name:          "missing models",
-			years:         []string{"2020"},
-			models:        []string{},
-			engines:       []string{"2.0L"},
-			categories:    []string{"Engine"},
-			subcategories: []string{"Engine Block"},
-			expectError:   true,
-		},
-		{
-			name:          "missing engines",
-			years:         []string{"2020"},
-			models:        []string{"Civic"},
-			engines:       []string{},
-			categories:    []string{"Engine"},
-			subcategories: []string{"Engine Block"},
-			expectError:   true,
-		},
-		{
-			name:          "missing category",
-			years:         []string{"2020"},
-			models:        []string{"Civic"},
-			engines:       []string{"2.0L"},
-			categories:    []string{},
-			subcategories: []string{"Engine Block"},
-			expectError:   true,
-		},
-		{
-			name:          "missing subcategory",
-			years:         []string{"2020"},
-			models:        []string{"Civic"},
-			engines:       []string{"2.0L"},
-			categories:    []string{"Engine"},
-			subcategories: []string{},
-			expectError:   true,
+			name:           "no attributes on optional schema",
+			values:         map[string][]string{},
+			expectQuantity: 1,
+		},
+		{
+			name: "all attributes valid",
+			values: map[string][]string{
+				"condition":   {"Remanufactured"},
+				"part_number": {" 3l3z-10346-ba "},
+				"quantity":    {"2"},
+				"position":    {"Front Left"},
+				"core_charge": {"45.00"},
+			},
+			schema:         alternator,
+			expectQuantity: 2,
+		},
+		{
+			name:        "missing required condition",
+			values:      map[string][]string{},
+			schema:      alternator,
+			expectError: true,
+		},
+		{
+			name:        "unknown condition",
+			values:      map[string][]string{"condition": {"mint"}},
+			expectError: true,
+		},
+		{
+			name:        "invalid part number",
+			values:      map[string][]string{"part_number": {"ABC#123"}},
+			expectError: true,
+		},
+		{
+			name:        "zero quantity",
+			values:      map[string][]string{"quantity": {"0"}},
+			expectError: true,
+		},
+		{
+			name:        "position not allowed by schema",
+			values:      map[string][]string{"position": {"Front"}},
+			schema:      idlerPulley,
+			expectError: true,
+		},
+		{
+			name:        "negative core charge",
+			values:      map[string][]string{"core_charge": {"-5"}},
+			expectError: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			form := &multipart.Form{
-				Value: map[string][]string{
-					"years":       tt.years,
-					"models":      tt.models,
-					"engines":     tt.engines,
-					"category":    tt.categories,
-					"subcategory": tt.subcategories,
-				},
-			}
+			form := &multipart.Form{Value: tt.values}
 
-			err := ValidateAdForm(form)
+			condition, partNumber, quantity, position, coreCharge, err := ValidatePartAttributes(form, tt.schema)
 
 			if tt.expectError {
 				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectQuantity, quantity)
+			if tt.name == "all attributes valid" {
+				assert.Equal(t, "remanufactured", condition)
+				assert.Equal(t, "3L3Z-10346-BA", partNumber)
+				assert.Equal(t, "Front Left", position)
+				assert.Equal(t, 45.0, coreCharge)
 			}
 		})
 	}
 }
 
-func TestValidateAdFormAndReturn(t *testing.T) {
+func TestValidateFitmentGroups(t *testing.T) {
 	tests := []struct {
-		name          string
-		years         []string
-		models        []string
-		engines       []string
-		categories    []string
-		subcategories []string
-		expectError   bool
+		name         string
+		values       map[string][]string
+		expectError  string
+		expectGroups int
 	}{
 		{
-			name:          "valid ad form",
-			years:         []string{"2020", "2021"},
-			models:        []string{"Civic", "Accord"},
-			engines:       []string{"2.0L", "2.5L"},
-			categories:    []string{"Engine"},
-			subcategories: []string{"Engine Block"},
-			expectError:   false,
-		},
-		{
-			name:          "missing years",
-			years:         []string{},
-			models:        []string{"Civic"},
-			engines:       []string{"2.0L"},
-			categories:    []string{"Engine"},
-			subcategories: []string{"Engine Block"},
-			expectError:   true,
-		},
-		{
-			name:          "missing category",
-			years:         []string{"2020"},
-			models:        []string{"Civic"},
-			engines:       []string{"2.0L"},
-			categories:    []string{},
-			subcategories: []string{"Engine Block"},
-			expectError:   true,
-		},
-		{
-			name:          "missing subcategory",
-			years:         []string{"2020"},
-			models:        []string{"Civic"},
-			engines:       []string{"2.0L"},
-			categories:    []string{"Engine"},
-			subcategories: []string{},
-			expectError:   true,
+			name: "explicit first group",
+			values: map[string][]string{
+				"make": {"Ford"}, "years": {"2005"}, "models": {"F-150"}, "engines": {"4.6L"},
+			},
+			expectGroups: 1,
+		},
+		{
+			name: "year range and wildcards",
+			values: map[string][]string{
+				"make": {"Ford"}, "year_from": {"1995"}, "year_to": {"2010"}, "all_models": {"1"}, "all_engines": {"1"},
+			},
+			expectGroups: 1,
+		},
+		{
+			name: "missing engines",
+			values: map[string][]string{
+				"make": {"Ford"}, "years": {"2005"}, "models": {"F-150"},
+			},
+			expectError: "Please select at least one engine size",
+		},
+		{
+			name: "additional group with sparse index",
+			values: map[string][]string{
+				"make": {"Ford"}, "years": {"2005"}, "models": {"Ranger"}, "engines": {"3.0L"},
+				"make_3": {"Mazda"}, "years_3": {"2005"}, "models_3": {"B3000"}, "all_engines_3": {"1"},
+			},
+			expectGroups: 2,
+		},
+		{
+			name: "blank additional group is ignored",
+			values: map[string][]string{
+				"make": {"Ford"}, "years": {"2005"}, "models": {"Ranger"}, "engines": {"3.0L"},
+				"make_1": {""},
+			},
+			expectGroups: 1,
+		},
+		{
+			name: "incomplete additional group",
+			values: map[string][]string{
+				"make": {"Ford"}, "years": {"2005"}, "models": {"Ranger"}, "engines": {"3.0L"},
+				"make_1": {"Mazda"},
+			},
+			expectError: "Please select at least one year for the additional make #1",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			form := &multipart.Form{
-				Value: map[string][]string{
-					"years":       tt.years,
-					"models":      tt.models,
-					"engines":     tt.engines,
-					"category":    tt.categories,
-					"subcategory": tt.subcategories,
-				},
-			}
+			groups, err := ValidateFitmentGroups(&multipart.Form{Value: tt.values})
 
-			years, models, engines, categories, subcategories, err := ValidateAdFormAndReturn(form)
-
-			if tt.expectError {
-				assert.Error(t, err)
-				assert.Nil(t, years)
-				assert.Nil(t, models)
-				assert.Nil(t, engines)
-				assert.Nil(t, categories)
-				assert.Nil(t, subcategories)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.years, years)
-				assert.Equal(t, tt.models, models)
-				assert.Equal(t, tt.engines, engines)
-				assert.Equal(t, tt.categories, categories)
-				assert.Equal(t, tt.subcategories, subcategories)
+			if tt.expectError != "" {
+				assert.EqualError(t, err, tt.expectError)
+				return
 			}
+			assert.NoError(t, err)
+			assert.Len(t, groups, tt.expectGroups)
 		})
 	}
 }
@@ -0,0 +1,120 @@
+package imagestore
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/parts-pile/site/b2util"
+	"github.com/parts-pile/site/config"
+	"gopkg.in/kothar/go-backblaze.v0"
+)
+
+// B2Store keeps images in the Backblaze B2 bucket config.B2BucketName and
+// signs URLs with cached download tokens from b2util
+type B2Store struct {
+	mu     sync.Mutex
+	bucket *backblaze.Bucket
+}
+
+// NewB2Store returns a store for the configured bucket. It connects on first
+// use.
+func NewB2Store() *B2Store {
+	return &B2Store{}
+}
+
+func (s *B2Store) connect() (*backblaze.Bucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bucket != nil {
+		return s.bucket, nil
+	}
+
+	if config.B2MasterKeyID == "" || config.B2AppKey == "" || config.B2KeyID == "" {
+		return nil, fmt.Errorf("B2 credentials not set")
+	}
+	b2, err := backblaze.NewB2(backblaze.Credentials{
+		AccountID:      config.B2MasterKeyID,
+		ApplicationKey: config.B2AppKey,
+		KeyID:          config.B2KeyID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("B2 auth error: %w", err)
+	}
+	bucket, err := b2.Bucket(config.B2BucketName)
+	if err != nil {
+		return nil, fmt.Errorf("B2 bucket error: %w", err)
+	}
+	if bucket == nil {
+		return nil, fmt.Errorf("B2 bucket %s not found", config.B2BucketName)
+	}
+	s.bucket = bucket
+	return bucket, nil
+}
+
+func (s *B2Store) Put(key, contentType string, data []byte) error {
+	bucket, err := s.connect()
+	if err != nil {
+		return err
+	}
+	_, err = bucket.UploadTypedFile(key, contentType, nil, bytes.NewReader(data))
+	return err
+}
+
+// Delete removes every version of the file so it stops taking up space
+func (s *B2Store) Delete(key string) error {
+	bucket, err := s.connect()
+	if err != nil {
+		return err
+	}
+	resp, err := bucket.ListFileVersions(key, "", 10)
+	if err != nil {
+		return err
+	}
+	for _, file := range resp.Files {
+		// Versions are listed from key onwards, so later files can follow
+		if file.Name != key {
+			break
+		}
+		if _, err := bucket.DeleteFileVersion(file.Name, file.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *B2Store) List(prefix string) ([]string, error) {
+	bucket, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	start := ""
+	for {
+		resp, err := bucket.ListFileNamesWithPrefix(start, 1000, prefix, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range resp.Files {
+			keys = append(keys, file.Name)
+		}
+		if resp.NextFileName == "" {
+			return keys, nil
+		}
+		start = resp.NextFileName
+	}
+}
+
+// URL signs key with the download token of its ad's prefix, valid for
+// config.B2DownloadTokenExpiry
+func (s *B2Store) URL(key string) (string, error) {
+	token, err := b2util.GetB2DownloadTokenForPrefixCached(keyPrefix(key))
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", fmt.Errorf("no B2 download token for %s", key)
+	}
+	return fmt.Sprintf("%s/%s?Authorization=%s", config.B2FileServerURL, strings.TrimPrefix(key, "/"), token), nil
+}
@@ -0,0 +1,101 @@
+package imagestore
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/parts-pile/site/config"
+)
+
+// Store keeps ad images and hands out URLs browsers can load them from.
+// Keys are slash-separated paths like "22/1-480w.webp"; the first segment
+// groups an ad's images.
+type Store interface {
+	// Put stores data under key, replacing any existing file
+	Put(key, contentType string, data []byte) error
+	// Delete removes the file stored under key. Missing files aren't an error.
+	Delete(key string) error
+	// List returns the keys starting with prefix, in order
+	List(prefix string) ([]string, error)
+	// URL returns a signed URL for key that stops working after a while
+	URL(key string) (string, error)
+}
+
+var (
+	storeMu sync.RWMutex
+	store   Store
+)
+
+// Init picks the store from config.ImageStoreBackend. B2 is used by default
+// when its credentials are set, and local disk otherwise.
+func Init() error {
+	backend := config.ImageStoreBackend
+	if backend == "" {
+		backend = "local"
+		if config.B2MasterKeyID != "" && config.B2KeyID != "" && config.B2AppKey != "" {
+			backend = "b2"
+		}
+	}
+
+	var s Store
+	switch backend {
+	case "b2":
+		s = NewB2Store()
+	case "local":
+		local, err := NewLocalStore(config.ImageStoreDir, config.ImageURLSecret)
+		if err != nil {
+			return err
+		}
+		s = local
+	default:
+		return fmt.Errorf("unknown image store: %s", backend)
+	}
+
+	log.Printf("[images] Using %s image store", backend)
+	Set(s)
+	return nil
+}
+
+// Set replaces the store used by Default
+func Set(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store = s
+}
+
+// Default returns the configured store
+func Default() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return store
+}
+
+// AdImageKey returns the key of one size of an ad image, e.g. "22/1-480w.webp"
+func AdImageKey(adID, idx int, size string) string {
+	return fmt.Sprintf("%d/%d-%s.webp", adID, idx, size)
+}
+
+// AdImageURL returns a signed URL for one size of an ad image, or an empty
+// string when images aren't available - browser will show broken image
+func AdImageURL(adID, idx int, size string) string {
+	s := Default()
+	if s == nil {
+		return ""
+	}
+	url, err := s.URL(AdImageKey(adID, idx, size))
+	if err != nil {
+		return ""
+	}
+	return url
+}
+
+// keyPrefix returns the first segment of key including its slash, the unit
+// access is granted for
+func keyPrefix(key string) string {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i+1]
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package imagestore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parts-pile/site/config"
+)
+
+// ErrInvalidSignature is returned for expired or tampered local image URLs
+var ErrInvalidSignature = errors.New("invalid or expired image URL")
+
+// LocalStore keeps images on disk under a root directory. Its URLs point at
+// config.LocalImagePath, where the server checks the signature before
+// sending the file.
+type LocalStore struct {
+	root   string
+	secret []byte
+	now    func() time.Time
+}
+
+// NewLocalStore returns a store rooted at dir, creating it if needed. URLs
+// are signed with secret; without one a random secret is used, so URLs
+// handed out before a restart stop working.
+func NewLocalStore(dir, secret string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create image directory: %w", err)
+	}
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalStore{root: dir, secret: key, now: time.Now}, nil
+}
+
+// path maps a key to a file under the root. Keys can't reach outside it.
+func (s *LocalStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid image key: %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStore) Put(key, contentType string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see half an image
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *LocalStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+// sign returns the signature of key for the given expiry
+func (s *LocalStore) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s|%d", key, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// URL signs key until at least config.LocalImageURLExpiry from now. Expiry
+// times are rounded up so repeated renders reuse the same URL and browsers
+// can cache the image.
+func (s *LocalStore) URL(key string) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	window := int64(config.LocalImageURLExpiry / time.Second)
+	expires := (s.now().Unix()/window + 2) * window
+	return fmt.Sprintf("%s%s?expires=%d&sig=%s", config.LocalImagePath, key, expires, s.sign(key, expires)), nil
+}
+
+// Open checks a signed URL's expiry and signature and returns the path of the
+// file it grants access to
+func (s *LocalStore) Open(key, expires, sig string) (string, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || exp < s.now().Unix() {
+		return "", ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(key, exp))) {
+		return "", ErrInvalidSignature
+	}
+	return s.path(key)
+}
@@ -0,0 +1,89 @@
+package imagestore
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parts-pile/site/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore_PutListDelete(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir(), "secret")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put(AdImageKey(22, 1, "480w"), "image/webp", []byte("one")))
+	require.NoError(t, s.Put(AdImageKey(22, 1, "160w"), "image/webp", []byte("one small")))
+	require.NoError(t, s.Put(AdImageKey(220, 1, "160w"), "image/webp", []byte("other ad")))
+
+	keys, err := s.List("22/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"22/1-160w.webp", "22/1-480w.webp"}, keys)
+
+	require.NoError(t, s.Delete("22/1-160w.webp"))
+	// Deleting twice is fine
+	require.NoError(t, s.Delete("22/1-160w.webp"))
+	keys, err = s.List("22/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"22/1-480w.webp"}, keys)
+}
+
+func TestLocalStore_SignedURL(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStore(dir, "secret")
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	key := AdImageKey(22, 1, "480w")
+	require.NoError(t, s.Put(key, "image/webp", []byte("data")))
+
+	raw, err := s.URL(key)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(raw, config.LocalImagePath+key+"?"))
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	q := u.Query()
+
+	// Renders close together get the same URL so browsers can cache it
+	now = now.Add(time.Minute)
+	again, _ := s.URL(key)
+	assert.Equal(t, raw, again)
+
+	p, err := s.Open(key, q.Get("expires"), q.Get("sig"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	// The signature only covers its own key
+	_, err = s.Open(AdImageKey(22, 2, "480w"), q.Get("expires"), q.Get("sig"))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = s.Open(key, q.Get("expires")+"0", q.Get("sig"))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Links stop working once they expire
+	now = now.Add(3 * config.LocalImageURLExpiry)
+	_, err = s.Open(key, q.Get("expires"), q.Get("sig"))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestLocalStore_RejectsKeysOutsideRoot(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir(), "secret")
+	require.NoError(t, err)
+
+	assert.Error(t, s.Put("../escape.webp", "image/webp", []byte("x")))
+	_, err = s.URL("22/../../escape.webp")
+	assert.Error(t, err)
+	_, err = s.URL("")
+	assert.Error(t, err)
+}
+
+func TestKeyPrefix(t *testing.T) {
+	assert.Equal(t, "22/", keyPrefix("22/1-480w.webp"))
+	assert.Equal(t, "", keyPrefix("robots.txt"))
+}
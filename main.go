@@ -10,14 +10,21 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/adimage"
+	"github.com/parts-pile/site/analytics"
+	"github.com/parts-pile/site/apikey"
 	"github.com/parts-pile/site/b2util"
 	"github.com/parts-pile/site/config"
 	"github.com/parts-pile/site/db"
 	"github.com/parts-pile/site/handlers"
+	"github.com/parts-pile/site/imagestore"
+	"github.com/parts-pile/site/messaging"
 	"github.com/parts-pile/site/part"
 	"github.com/parts-pile/site/ui"
 	"github.com/parts-pile/site/vector"
 	"github.com/parts-pile/site/vehicle"
+	"github.com/parts-pile/site/webhook"
 )
 
 func main() {
@@ -31,6 +38,11 @@ func main() {
 		log.Fatalf("Failed to initialize B2 cache: %v", err)
 	}
 
+	// Initialize image storage
+	if err := imagestore.Init(); err != nil {
+		log.Fatalf("Failed to initialize image store: %v", err)
+	}
+
 	// Initialize embedding caches
 	if err := vector.InitEmbeddingCaches(); err != nil {
 		log.Fatalf("Failed to initialize embedding caches: %v", err)
@@ -74,6 +86,24 @@ func main() {
 	// Initially process existing ads without vectors
 	vector.ProcessAdsWithoutVectors()
 
+	// Start background expiry of stale offers
+	messaging.StartOfferExpiryProcessor()
+
+	// Start background expiry of ads that weren't renewed
+	handlers.StartAdExpiryProcessor()
+
+	// Start background deletion of abandoned ad drafts
+	ad.StartDraftExpiryProcessor()
+
+	// Start background rollup of ad analytics events
+	analytics.StartRollupProcessor()
+
+	// Start background processing of uploaded ad images
+	adimage.StartProcessor()
+
+	// Start background delivery of queued webhooks
+	webhook.StartProcessor()
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: customErrorHandler,
 		BodyLimit:    config.ServerUploadLimit,
@@ -97,8 +127,17 @@ func main() {
 	// Add logger middleware
 	app.Use(logger.New())
 
+	registerRoutes(app)
+
+	fmt.Printf("Starting server on port %s...\n", config.ServerPort)
+	log.Fatal(app.Listen(":" + config.ServerPort))
+}
+
+// registerRoutes registers every page and API route of the site
+func registerRoutes(app *fiber.App) {
 	// Static files and utility
 	app.Static("/", "./static")
+	app.Get(config.LocalImagePath+"*", handlers.HandleStoredImage)
 	app.Get("/.well-known/appspecific/com.chrome.devtools.json", func(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusNoContent)
 	})
@@ -114,20 +153,30 @@ func main() {
 	app.Get("/tree-search-expand/*", handlers.HandleTreeExpandSearch)     // x
 	app.Get("/tree-search-collapse/*", handlers.HandleTreeCollapseSearch) // x
 
+	// Crawlable browse pages, e.g. /parts/ford/2005/f-150/electrical
+	app.Get("/parts", handlers.OptionalAuth, handlers.HandleBrowsePage)
+	app.Get("/parts/*", handlers.OptionalAuth, handlers.HandleBrowsePage)
+
 	// Ad in-place expand/collapse partials for htmx
 	app.Get("/ad/card/:id", handlers.HandleAdCard)     // x
 	app.Get("/ad/detail/:id", handlers.HandleAdDetail) // x
 	app.Get("/ad/edit-partial/:id", handlers.AuthRequired, handlers.HandleEditAdPartial)
-	app.Get("/ad/image/:adID/:idx", handlers.HandleAdImage) // x
+	app.Get("/ad/image/:adID/:imageID", handlers.HandleAdImage) // x
+	app.Get("/ad/price-history/:id", handlers.HandleAdPriceHistory)
+	app.Get("/ad/image-status/:id", handlers.AuthRequired, handlers.HandleAdImageStatus)
 
 	// Ad management
 	app.Get("/ad/:id", handlers.OptionalAuth, handlers.HandleAdPage) // x
 	app.Get("/new-ad", handlers.AuthRequired, handlers.HandleNewAd)
 	app.Get("/edit-ad/:id", handlers.AuthRequired, handlers.HandleEditAd)
 	app.Delete("/delete-ad/:id", handlers.AuthRequired, handlers.HandleDeleteAd)
+	app.Get("/drafts", handlers.AuthRequired, handlers.HandleDraftsPage)
+	app.Get("/my-ads", handlers.AuthRequired, handlers.HandleMyAdsPage)
+	app.Get("/draft-image/:id/:imageID", handlers.AuthRequired, handlers.HandleDraftImage)
 
 	// API group
 	api := app.Group("/api")
+	api.Get("/openapi.json", handlers.HandleOpenAPI)
 
 	// Search API
 	api.Get("/search", handlers.HandleSearchAPI)
@@ -136,13 +185,23 @@ func main() {
 	api.Post("/new-ad", handlers.AuthRequired, handlers.HandleNewAdSubmission)
 	api.Post("/update-ad/:id", handlers.AuthRequired, handlers.HandleUpdateAdSubmission)
 	api.Post("/bookmark-ad/:id", handlers.AuthRequired, handlers.HandleBookmarkAd)
+	api.Post("/clear-pending/:id", handlers.AuthRequired, handlers.HandleClearAdPending)
 	api.Delete("/bookmark-ad/:id", handlers.AuthRequired, handlers.HandleUnbookmarkAd)
+	api.Post("/save-draft", handlers.AuthRequired, handlers.HandleSaveDraft)
+	api.Delete("/drafts/:id", handlers.AuthRequired, handlers.HandleDeleteDraft)
+	api.Delete("/drafts/:id/images/:imageID", handlers.AuthRequired, handlers.HandleDeleteDraftImage)
+	api.Post("/my-ads/bulk", handlers.AuthRequired, handlers.HandleMyAdsBulk)
+	api.Post("/ad-images/:id/dismiss", handlers.AuthRequired, handlers.HandleDismissFailedImages)
 	api.Get("/makes", handlers.HandleMakes)
 	api.Get("/years", handlers.HandleYears)
 	api.Get("/models", handlers.HandleModels)
 	api.Get("/engines", handlers.HandleEngines)
+	api.Get("/fitment-group", handlers.HandleFitmentGroup)
 	api.Get("/categories", handlers.HandleCategories)
 	api.Get("/subcategories", handlers.HandleSubCategories)
+	api.Get("/part-attributes", handlers.HandlePartAttributes)
+	api.Get("/category-match", handlers.HandleCategoryMatch)
+	api.Get("/part-number-fitment", handlers.HandlePartNumberFitment)
 	api.Get("/ad-image-url/:adID", handlers.HandleAdImageSignedURL)
 
 	// Rock system (API)
@@ -150,6 +209,7 @@ func main() {
 	api.Post("/throw-rock/:id", handlers.AuthRequired, handlers.HandleThrowRock)
 	api.Get("/ad-rocks/:id/conversations", handlers.HandleViewRockConversations)
 	api.Post("/resolve-rock/:id", handlers.AuthRequired, handlers.HandleResolveRock)
+	api.Post("/report-ad/:id", handlers.AuthRequired, handlers.HandleReportAd)
 
 	// Admin dashboard and management
 	admin := app.Group("/admin", handlers.AdminRequired)
@@ -157,6 +217,11 @@ func main() {
 	admin.Get("/b2-cache", handlers.HandleAdminB2Cache)
 	admin.Get("/embedding-cache", handlers.HandleAdminEmbeddingCache)
 	admin.Get("/vehicle-cache", handlers.HandleAdminVehicleCache)
+	admin.Get("/catalog", handlers.HandleAdminCatalog)
+	admin.Get("/taxonomy", handlers.HandleAdminTaxonomy)
+	admin.Get("/part-numbers", handlers.HandleAdminPartNumbers)
+	admin.Get("/moderation", handlers.HandleAdminModeration)
+	admin.Get("/moderation-rules", handlers.HandleAdminModerationRules)
 
 	// Admin API group
 	adminAPI := api.Group("/admin", handlers.AdminRequired)
@@ -169,6 +234,39 @@ func main() {
 	adminAPI.Post("/embedding-cache/site/clear", handlers.HandleClearSiteEmbeddingCache)
 	adminAPI.Post("/vehicle-cache/clear", handlers.HandleClearVehicleCache)
 	adminAPI.Get("/vehicle-cache/refresh", handlers.HandleRefreshVehicleCache)
+	adminAPI.Post("/catalog/cars", handlers.HandleAttachCar)
+	adminAPI.Post("/catalog/make/:id/parent-company", handlers.HandleSetMakeParentCompany)
+	adminAPI.Post("/catalog/:kind", handlers.HandleAddCatalogEntry)
+	adminAPI.Post("/catalog/:kind/:id/rename", handlers.HandleRenameCatalogEntry)
+	adminAPI.Post("/catalog/:kind/:id/merge", handlers.HandleMergeCatalogEntry)
+	adminAPI.Post("/catalog/:kind/:id/retire", handlers.HandleRetireCatalogEntry)
+	adminAPI.Post("/taxonomy/categories", handlers.HandleAddPartCategory)
+	adminAPI.Post("/taxonomy/categories/:id/rename", handlers.HandleRenamePartCategory)
+	adminAPI.Post("/taxonomy/categories/:id/delete", handlers.HandleDeletePartCategory)
+	adminAPI.Post("/taxonomy/categories/:id/aliases", handlers.HandleAddPartCategoryAlias)
+	adminAPI.Post("/taxonomy/categories/:id/subcategories", handlers.HandleAddPartSubCategory)
+	adminAPI.Post("/taxonomy/subcategories/:id/rename", handlers.HandleRenamePartSubCategory)
+	adminAPI.Post("/taxonomy/subcategories/:id/move", handlers.HandleMovePartSubCategory)
+	adminAPI.Post("/taxonomy/subcategories/:id/merge", handlers.HandleMergePartSubCategory)
+	adminAPI.Post("/taxonomy/subcategories/:id/aliases", handlers.HandleAddPartSubCategoryAlias)
+	adminAPI.Post("/taxonomy/aliases/:id/delete", handlers.HandleDeletePartAlias)
+	adminAPI.Post("/taxonomy/synonyms", handlers.HandleAddPartSynonyms)
+	adminAPI.Post("/taxonomy/synonyms/:id/delete", handlers.HandleDeletePartSynonyms)
+	adminAPI.Post("/part-numbers", handlers.HandleAddPartNumber)
+	adminAPI.Post("/part-numbers/import", handlers.HandleImportPartNumbers)
+	adminAPI.Post("/part-numbers/:id", handlers.HandleUpdatePartNumber)
+	adminAPI.Post("/part-numbers/:id/delete", handlers.HandleDeletePartNumber)
+	adminAPI.Post("/part-numbers/:id/cars", handlers.HandleAddPartNumberCars)
+	adminAPI.Post("/part-numbers/:id/cars/:car/delete", handlers.HandleRemovePartNumberCar)
+	adminAPI.Post("/part-numbers/:id/links", handlers.HandleAddPartNumberLink)
+	adminAPI.Post("/part-numbers/:id/links/:other/delete", handlers.HandleRemovePartNumberLink)
+	adminAPI.Post("/parent-companies", handlers.HandleAddParentCompany)
+	adminAPI.Post("/parent-companies/:id/country", handlers.HandleUpdateParentCompanyCountry)
+	adminAPI.Post("/moderation/:adID/decide", handlers.HandleModerationDecision)
+	adminAPI.Post("/moderation/messages/:id/decide", handlers.HandleMessageModerationDecision)
+	adminAPI.Post("/moderation-rules", handlers.HandleAddModerationRules)
+	adminAPI.Post("/moderation-rules/test", handlers.HandleTestModerationRules)
+	adminAPI.Post("/moderation-rules/:id/delete", handlers.HandleDeleteModerationRule)
 
 	// User registration/authentication
 	app.Get("/register", handlers.HandleRegistrationStep1)
@@ -187,14 +285,29 @@ func main() {
 
 	// Sitemap
 	app.Get("/sitemap.xml", handlers.HandleSitemap)
+	app.Get("/sitemaps/:name", handlers.HandleSitemapChunk)
+
+	// Atom feeds
+	app.Get("/feeds/search.atom", handlers.HandleSearchFeed)
+	app.Get("/feeds/parts/:make/:model", handlers.HandlePartsFeed)
+	app.Get("/feeds/seller/:name", handlers.HandleSellerFeed)
+	app.Get("/feeds/image/:adID/:imageID", handlers.HandleFeedImage)
 
 	// User settings
 	app.Get("/settings", handlers.AuthRequired, handlers.HandleSettings)       // x
 	app.Get("/bookmarks", handlers.AuthRequired, handlers.HandleBookmarksPage) // x
+	app.Get("/analytics", handlers.AuthRequired, handlers.HandleAnalyticsPage)
+	app.Get("/analytics/ad/:id", handlers.AuthRequired, handlers.HandleAdAnalytics)
 	api.Post("/change-password", handlers.AuthRequired, handlers.HandleChangePassword)
 	api.Post("/update-notification-method", handlers.AuthRequired, handlers.HandleUpdateNotificationMethod)
 	api.Post("/notification-method-changed", handlers.AuthRequired, handlers.HandleNotificationMethodChanged)
+	api.Post("/update-price-drop-alerts", handlers.AuthRequired, handlers.HandleUpdatePriceDropAlerts)
 	api.Post("/delete-account", handlers.AuthRequired, handlers.HandleDeleteAccount)
+	api.Post("/api-keys", handlers.AuthRequired, handlers.HandleCreateAPIKey)
+	api.Delete("/api-keys/:id", handlers.AuthRequired, handlers.HandleRevokeAPIKey)
+	api.Post("/webhooks", handlers.AuthRequired, handlers.HandleCreateWebhook)
+	api.Delete("/webhooks/:id", handlers.AuthRequired, handlers.HandleDeleteWebhook)
+	api.Post("/webhook-deliveries/:id/resend", handlers.AuthRequired, handlers.HandleResendWebhookDelivery)
 	app.Get("/user-menu", handlers.AuthRequired, handlers.HandleUserMenu) // x
 
 	// Messaging system
@@ -205,17 +318,44 @@ func main() {
 	app.Get("/messages/sse", handlers.AuthRequired, handlers.HandleSSE)
 	app.Get("/messages/:id/sse-update", handlers.AuthRequired, handlers.HandleSSEConversationUpdate)
 	app.Post("/messages/:id/send", handlers.AuthRequired, handlers.HandleSendMessage)
+	app.Post("/messages/:id/offer", handlers.AuthRequired, handlers.HandleMakeOffer)
+	app.Post("/messages/offers/:offerID/respond", handlers.AuthRequired, handlers.HandleRespondToOffer)
+	app.Post("/messages/offers/:offerID/pending", handlers.AuthRequired, handlers.HandleMarkOfferAdPending)
 	app.Get("/messages/start/:adID", handlers.AuthRequired, handlers.HandleStartConversation)
 	api.Get("/messages/:action", handlers.AuthRequired, handlers.HandleMessagesAPI)
 
+	// Versioned JSON API, authenticated by API keys created in /settings
+	v1 := app.Group("/api/v1", handlers.APIErrors, handlers.APIKeyRequired, handlers.APIRateLimit())
+	read := handlers.APIScope(apikey.ScopeRead)
+	write := handlers.APIScope(apikey.ScopeWrite)
+	messages := handlers.APIScope(apikey.ScopeMessages)
+	v1.Get("/ads", read, handlers.HandleAPISearchAds)
+	v1.Post("/ads", write, handlers.HandleAPICreateAd)
+	v1.Get("/ads/:id", read, handlers.HandleAPIGetAd)
+	v1.Put("/ads/:id", write, handlers.HandleAPIUpdateAd)
+	v1.Delete("/ads/:id", write, handlers.HandleAPIDeleteAd)
+	v1.Post("/ads/:id/images", write, handlers.HandleAPIAddAdImages)
+	v1.Get("/me/ads", read, handlers.HandleAPIMyAds)
+	v1.Get("/catalog/makes", read, handlers.HandleAPIMakes)
+	v1.Get("/catalog/years", read, handlers.HandleAPIYears)
+	v1.Get("/catalog/models", read, handlers.HandleAPIModels)
+	v1.Get("/catalog/engines", read, handlers.HandleAPIEngines)
+	v1.Get("/catalog/categories", read, handlers.HandleAPICategories)
+	v1.Get("/catalog/subcategories", read, handlers.HandleAPISubCategories)
+	v1.Get("/bookmarks", read, handlers.HandleAPIBookmarks)
+	v1.Put("/bookmarks/:id", write, handlers.HandleAPIBookmarkAd)
+	v1.Delete("/bookmarks/:id", write, handlers.HandleAPIUnbookmarkAd)
+	v1.Get("/conversations", messages, handlers.HandleAPIConversations)
+	v1.Post("/conversations", messages, handlers.HandleAPIStartConversation)
+	v1.Get("/conversations/:id/messages", messages, handlers.HandleAPIConversationMessages)
+	v1.Post("/conversations/:id/messages", messages, handlers.HandleAPISendMessage)
+	v1.Use(handlers.HandleAPINotFound)
+
 	// Views for HTMX view switching
 	app.Post("/view/list", handlers.HandleListView) // x
 	app.Post("/view/tree", handlers.HandleTreeView) // x
 	app.Post("/view/grid", handlers.HandleGridView) // x
 	app.Post("/view/map", handlers.HandleMapView)   // x
-
-	fmt.Printf("Starting server on port %s...\n", config.ServerPort)
-	log.Fatal(app.Listen(":" + config.ServerPort))
 }
 
 func customErrorHandler(ctx *fiber.Ctx, err error) error {
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/parts-pile/site/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nonJSONRoutes are the routes that render pages, HTMX fragments, feeds,
+// images or event streams. Every other route must be in the OpenAPI
+// document, so a new route is either documented or added here on purpose.
+var nonJSONRoutes = []string{
+	"GET /",
+	"GET /.well-known/appspecific/com.chrome.devtools.json",
+	"GET /ad/:id",
+	"GET /ad/card/:id",
+	"GET /ad/detail/:id",
+	"GET /ad/edit-partial/:id",
+	"GET /ad/image-status/:id",
+	"GET /ad/image/:adID/:imageID",
+	"GET /ad/price-history/:id",
+	"GET /admin/",
+	"GET /admin/b2-cache",
+	"GET /admin/catalog",
+	"GET /admin/embedding-cache",
+	"GET /admin/moderation",
+	"GET /admin/moderation-rules",
+	"GET /admin/part-numbers",
+	"GET /admin/taxonomy",
+	"GET /admin/vehicle-cache",
+	"GET /analytics",
+	"GET /analytics/ad/:id",
+	"POST /api/ad-images/:id/dismiss",
+	"GET /api/ad-rocks/:id",
+	"GET /api/ad-rocks/:id/conversations",
+	"POST /api/admin/b2-cache/clear",
+	"GET /api/admin/b2-cache/refresh",
+	"POST /api/admin/b2-cache/refresh",
+	"POST /api/admin/catalog/:kind",
+	"POST /api/admin/catalog/:kind/:id/merge",
+	"POST /api/admin/catalog/:kind/:id/rename",
+	"POST /api/admin/catalog/:kind/:id/retire",
+	"POST /api/admin/catalog/cars",
+	"POST /api/admin/catalog/make/:id/parent-company",
+	"POST /api/admin/embedding-cache/query/clear",
+	"GET /api/admin/embedding-cache/refresh",
+	"POST /api/admin/embedding-cache/site/clear",
+	"POST /api/admin/embedding-cache/user/clear",
+	"POST /api/admin/moderation-rules",
+	"POST /api/admin/moderation-rules/:id/delete",
+	"POST /api/admin/moderation-rules/test",
+	"POST /api/admin/moderation/:adID/decide",
+	"POST /api/admin/moderation/messages/:id/decide",
+	"POST /api/admin/parent-companies",
+	"POST /api/admin/parent-companies/:id/country",
+	"POST /api/admin/part-numbers",
+	"POST /api/admin/part-numbers/:id",
+	"POST /api/admin/part-numbers/:id/cars",
+	"POST /api/admin/part-numbers/:id/cars/:car/delete",
+	"POST /api/admin/part-numbers/:id/delete",
+	"POST /api/admin/part-numbers/:id/links",
+	"POST /api/admin/part-numbers/:id/links/:other/delete",
+	"POST /api/admin/part-numbers/import",
+	"POST /api/admin/taxonomy/aliases/:id/delete",
+	"POST /api/admin/taxonomy/categories",
+	"POST /api/admin/taxonomy/categories/:id/aliases",
+	"POST /api/admin/taxonomy/categories/:id/delete",
+	"POST /api/admin/taxonomy/categories/:id/rename",
+	"POST /api/admin/taxonomy/categories/:id/subcategories",
+	"POST /api/admin/taxonomy/subcategories/:id/aliases",
+	"POST /api/admin/taxonomy/subcategories/:id/merge",
+	"POST /api/admin/taxonomy/subcategories/:id/move",
+	"POST /api/admin/taxonomy/subcategories/:id/rename",
+	"POST /api/admin/taxonomy/synonyms",
+	"POST /api/admin/taxonomy/synonyms/:id/delete",
+	"POST /api/admin/vehicle-cache/clear",
+	"GET /api/admin/vehicle-cache/refresh",
+	"POST /api/api-keys",
+	"DELETE /api/api-keys/:id",
+	"DELETE /api/bookmark-ad/:id",
+	"POST /api/bookmark-ad/:id",
+	"GET /api/category-match",
+	"POST /api/change-password",
+	"POST /api/clear-pending/:id",
+	"POST /api/delete-account",
+	"DELETE /api/drafts/:id",
+	"DELETE /api/drafts/:id/images/:imageID",
+	"GET /api/engines",
+	"GET /api/fitment-group",
+	"POST /api/login",
+	"GET /api/models",
+	"POST /api/my-ads/bulk",
+	"POST /api/new-ad",
+	"POST /api/notification-method-changed",
+	"GET /api/part-attributes",
+	"GET /api/part-number-fitment",
+	"POST /api/register/step1",
+	"POST /api/register/verify",
+	"POST /api/report-ad/:id",
+	"POST /api/resolve-rock/:id",
+	"POST /api/save-draft",
+	"GET /api/subcategories",
+	"POST /api/throw-rock/:id",
+	"POST /api/update-ad/:id",
+	"POST /api/update-notification-method",
+	"POST /api/update-price-drop-alerts",
+	"POST /api/webhook-deliveries/:id/resend",
+	"POST /api/webhooks",
+	"DELETE /api/webhooks/:id",
+	"GET /api/years",
+	"GET /bookmarks",
+	"DELETE /delete-ad/:id",
+	"GET /draft-image/:id/:imageID",
+	"GET /drafts",
+	"GET /edit-ad/:id",
+	"GET /feeds/image/:adID/:imageID",
+	"GET /feeds/parts/:make/:model",
+	"GET /feeds/search.atom",
+	"GET /feeds/seller/:name",
+	"GET /login",
+	"POST /logout",
+	"GET /media/*",
+	"GET /messages",
+	"GET /messages/:id/collapse",
+	"GET /messages/:id/expand",
+	"POST /messages/:id/offer",
+	"POST /messages/:id/send",
+	"GET /messages/:id/sse-update",
+	"POST /messages/offers/:offerID/pending",
+	"POST /messages/offers/:offerID/respond",
+	"GET /messages/sse",
+	"GET /messages/start/:adID",
+	"GET /my-ads",
+	"GET /new-ad",
+	"GET /parts",
+	"GET /parts/*",
+	"GET /privacy",
+	"GET /register",
+	"GET /register/verify",
+	"GET /rocks",
+	"GET /search",
+	"GET /search-page",
+	"GET /settings",
+	"GET /sitemap.xml",
+	"GET /sitemaps/:name",
+	"GET /terms",
+	"GET /tree-browse-collapse/*",
+	"GET /tree-browse-expand/*",
+	"GET /tree-search-collapse/*",
+	"GET /tree-search-expand/*",
+	"GET /user-menu",
+	"POST /view/grid",
+	"POST /view/list",
+	"POST /view/map",
+	"POST /view/tree",
+}
+
+// TestOpenAPI_CoversJSONRoutes fails when a route is registered without an
+// entry in the OpenAPI document and isn't listed in nonJSONRoutes, or an
+// entry no longer matches a route
+func TestOpenAPI_CoversJSONRoutes(t *testing.T) {
+	app := fiber.New()
+	registerRoutes(app)
+
+	nonJSON := map[string]bool{}
+	for _, key := range nonJSONRoutes {
+		nonJSON[key] = true
+	}
+
+	documented := map[string]handlers.APIOperation{}
+	for _, op := range handlers.APIOperations() {
+		documented[op.Method+" "+op.Path] = op
+	}
+
+	registered := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == fiber.MethodHead || len(route.Handlers) == 0 {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		registered[key] = true
+
+		op, ok := documented[key]
+		if !ok {
+			assert.True(t, nonJSON[key], "%s isn't in the OpenAPI document", key)
+			continue
+		}
+		assert.False(t, nonJSON[key], "%s is documented but listed as a non-JSON route", key)
+		handler := route.Handlers[len(route.Handlers)-1]
+		assert.Equal(t, handlers.HandlerName(op.Handler), handlers.HandlerName(handler), "%s is documented with the wrong handler", key)
+	}
+
+	for key := range documented {
+		assert.True(t, registered[key], "%s is documented but not registered", key)
+	}
+	for key := range nonJSON {
+		assert.True(t, registered[key], "%s is listed as a non-JSON route but not registered", key)
+	}
+	require.NotEmpty(t, documented)
+}
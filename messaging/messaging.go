@@ -3,11 +3,13 @@ package messaging
 import (
 	"database/sql"
 	"fmt"
+	"log"
 	"time"
 
 	"sync"
 
 	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/webhook"
 )
 
 // Table name constants
@@ -30,6 +32,7 @@ type Conversation struct {
 	User1Name     string    `json:"user1_name,omitempty" db:"user1_name"`
 	User2Name     string    `json:"user2_name,omitempty" db:"user2_name"`
 	AdTitle       string    `json:"ad_title,omitempty" db:"ad_title"`
+	AdUserID      int       `json:"ad_user_id,omitempty" db:"ad_user_id"`
 	LastMessage   string    `json:"last_message,omitempty" db:"last_message"`
 	LastMessageAt time.Time `json:"last_message_at,omitempty" db:"last_message_at"`
 	UnreadCount   int       `json:"unread_count,omitempty" db:"unread_count"`
@@ -44,8 +47,16 @@ type Message struct {
 	Content        string     `json:"content" db:"content"`
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	ReadAt         *time.Time `json:"read_at,omitempty" db:"read_at"`
+	Type           string     `json:"type" db:"message_type"`
+	OfferID        *int       `json:"offer_id,omitempty" db:"offer_id"`
 	// Runtime fields
 	SenderName string `json:"sender_name,omitempty" db:"sender_name"`
+	Offer      *Offer `json:"offer,omitempty" db:"-"`
+}
+
+// IsOffer returns true if the message is part of an offer negotiation
+func (m Message) IsOffer() bool {
+	return m.Type == MessageTypeOffer || m.Type == MessageTypeOfferResponse
 }
 
 // CreateConversation creates a new conversation between two users about an ad
@@ -71,20 +82,30 @@ func GetOrCreateConversation(user1ID, user2ID, adID int) (int, error) {
 	}
 
 	// Try to find existing conversation
-	var id int
-	err := db.QueryRow(`SELECT id FROM Conversation WHERE user1_id = ? AND user2_id = ? AND ad_id = ?`, user1ID, user2ID, adID).Scan(&id)
-	if err == nil {
-		return id, nil
-	}
-
-	if err != sql.ErrNoRows {
-		return 0, err
+	id, err := FindConversation(user1ID, user2ID, adID)
+	if err != nil || id != 0 {
+		return id, err
 	}
 
 	// Create new conversation
 	return CreateConversation(user1ID, user2ID, adID)
 }
 
+// FindConversation returns the ID of the conversation between two users about
+// an ad, or 0 if they haven't started one
+func FindConversation(user1ID, user2ID, adID int) (int, error) {
+	if user1ID > user2ID {
+		user1ID, user2ID = user2ID, user1ID
+	}
+
+	var id int
+	err := db.QueryRow(`SELECT id FROM Conversation WHERE user1_id = ? AND user2_id = ? AND ad_id = ?`, user1ID, user2ID, adID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
 // CreateConversationWithTx creates a new conversation between two users about an ad within a transaction
 func CreateConversationWithTx(tx *sql.Tx, user1ID, user2ID, adID int) (int, error) {
 	// Ensure user1ID is always the smaller ID for consistent ordering
@@ -131,10 +152,10 @@ func GetConversationWithDetails(id int) (Conversation, error) {
 	conv.User1Name = user1Name
 	conv.User2Name = user2Name
 
-	// Get ad title
-	row := db.QueryRow(`SELECT title FROM Ad WHERE id = ?`, conv.AdID)
+	// Get ad title and seller
+	row := db.QueryRow(`SELECT title, user_id FROM Ad WHERE id = ?`, conv.AdID)
 	var adTitle string
-	err = row.Scan(&adTitle)
+	err = row.Scan(&adTitle, &conv.AdUserID)
 	if err != nil {
 		return Conversation{}, err
 	}
@@ -166,7 +187,7 @@ func GetConversationsForUser(userID int) ([]Conversation, error) {
 		SELECT c.id, c.user1_id, c.user2_id, c.ad_id, c.created_at, c.updated_at,
 		       c.user1_read, c.user2_read,
 		       u1.name as user1_name, u2.name as user2_name,
-		       a.title as ad_title,
+		       a.title as ad_title, a.user_id as ad_user_id,
 		       m.content as last_message, m.created_at as last_message_at,
 		       COUNT(CASE WHEN m2.read_at IS NULL AND m2.sender_id != ? THEN 1 END) as unread_count
 		FROM Conversation c
@@ -293,15 +314,30 @@ func AddMessage(conversationID, senderID int, content string) (int, error) {
 		ConversationID: conversationID,
 		SenderID:       senderID,
 		Content:        content,
+		Type:           MessageTypeText,
 		CreatedAt:      time.Now(),
 	}
 
 	// Notify all participants about the new message
 	NotifyConversationUpdate(conversationID, "new_message", &msg)
 
+	recipientID := conv.User1ID
+	if senderID == conv.User1ID {
+		recipientID = conv.User2ID
+	}
+	if err := webhook.Emit(recipientID, webhook.EventMessageCreated, messageEvent{msg, conv.AdID}); err != nil {
+		log.Printf("[webhook] Failed to queue %s for user %d: %v", webhook.EventMessageCreated, recipientID, err)
+	}
+
 	return int(messageID), nil
 }
 
+// messageEvent is the data of message.created webhooks
+type messageEvent struct {
+	Message
+	AdID int `json:"ad_id"`
+}
+
 // AddMessageWithTx adds a new message to a conversation within a transaction
 func AddMessageWithTx(tx *sql.Tx, conversationID, senderID int, content string) (int, error) {
 	res, err := tx.Exec(`INSERT INTO Message (conversation_id, sender_id, content) VALUES (?, ?, ?)`, conversationID, senderID, content)
@@ -312,18 +348,46 @@ func AddMessageWithTx(tx *sql.Tx, conversationID, senderID int, content string)
 	return int(id), nil
 }
 
-// GetMessages retrieves all messages for a conversation
+// GetMessages retrieves all messages for a conversation, with the offer
+// attached to offer messages
 func GetMessages(conversationID int) ([]Message, error) {
 	var messages []Message
 	err := db.Select(&messages, `
-		SELECT m.id, m.conversation_id, m.sender_id, m.content, m.created_at, m.read_at,
+		SELECT m.id, m.conversation_id, m.sender_id, m.content, m.message_type, m.offer_id, m.created_at, m.read_at,
 		       u.name as sender_name
 		FROM Message m
 		JOIN User u ON m.sender_id = u.id
 		WHERE m.conversation_id = ?
-		ORDER BY m.created_at ASC
+		ORDER BY m.created_at ASC, m.id ASC
 	`, conversationID)
-	return messages, err
+	if err != nil {
+		return nil, err
+	}
+
+	hasOffers := false
+	for _, m := range messages {
+		if m.OfferID != nil {
+			hasOffers = true
+			break
+		}
+	}
+	if !hasOffers {
+		return messages, nil
+	}
+
+	offers, err := GetOffersForConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		if messages[i].OfferID == nil {
+			continue
+		}
+		if offer, ok := offers[*messages[i].OfferID]; ok {
+			messages[i].Offer = &offer
+		}
+	}
+	return messages, nil
 }
 
 // MarkMessagesAsRead marks all messages in a conversation as read by a specific user
@@ -0,0 +1,412 @@
+package messaging
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/webhook"
+)
+
+// Message types
+const (
+	MessageTypeText          = "text"
+	MessageTypeOffer         = "offer"          // an offer or counter-offer that can be answered
+	MessageTypeOfferResponse = "offer_response" // an accept or decline of an offer
+)
+
+// Offer statuses
+const (
+	OfferStatusPending   = "pending"
+	OfferStatusAccepted  = "accepted"
+	OfferStatusDeclined  = "declined"
+	OfferStatusCountered = "countered"
+	OfferStatusExpired   = "expired"
+)
+
+// Offer responses
+const (
+	OfferActionAccept  = "accept"
+	OfferActionDecline = "decline"
+	OfferActionCounter = "counter"
+)
+
+// UpdateTypeOfferUpdated is the ConversationUpdate type sent when an offer changes
+const UpdateTypeOfferUpdated = "offer_updated"
+
+var (
+	ErrOfferNotFound      = errors.New("offer not found")
+	ErrOfferNotOpen       = errors.New("offer is no longer open")
+	ErrOfferAlreadyOpen   = errors.New("there is already an open offer in this conversation")
+	ErrOfferNotRecipient  = errors.New("only the recipient can respond to an offer")
+	ErrOfferFromSeller    = errors.New("sellers respond to offers rather than make them")
+	ErrOfferInvalidAmount = errors.New("offer amount must be greater than zero")
+)
+
+// Offer is a proposed price for the ad of a conversation. A counter-offer is a
+// new offer in the opposite direction whose parent is the countered offer.
+type Offer struct {
+	ID             int        `json:"id"`
+	ConversationID int        `json:"conversation_id"`
+	SenderID       int        `json:"sender_id"`
+	RecipientID    int        `json:"recipient_id"`
+	Amount         float64    `json:"amount"`
+	Status         string     `json:"status"`
+	ParentOfferID  *int       `json:"parent_offer_id,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RespondedAt    *time.Time `json:"responded_at,omitempty"`
+}
+
+// IsOpen returns true if the offer can still be answered
+func (o Offer) IsOpen() bool {
+	return o.Status == OfferStatusPending && time.Now().Before(o.ExpiresAt)
+}
+
+// CurrentStatus returns the offer's status, treating pending offers past their
+// expiry as expired before the background sweep has caught up with them
+func (o Offer) CurrentStatus() string {
+	if o.Status == OfferStatusPending && !o.IsOpen() {
+		return OfferStatusExpired
+	}
+	return o.Status
+}
+
+// IsCounter returns true if the offer counters an earlier one
+func (o Offer) IsCounter() bool {
+	return o.ParentOfferID != nil
+}
+
+const offerColumns = `id, conversation_id, sender_id, recipient_id, amount, status, parent_offer_id, expires_at, created_at, responded_at`
+
+func scanOffer(row interface{ Scan(...any) error }) (Offer, error) {
+	var o Offer
+	var parentID sql.NullInt64
+	var expiresAt, createdAt string
+	var respondedAt sql.NullString
+	err := row.Scan(&o.ID, &o.ConversationID, &o.SenderID, &o.RecipientID, &o.Amount, &o.Status,
+		&parentID, &expiresAt, &createdAt, &respondedAt)
+	if err != nil {
+		return Offer{}, err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		o.ParentOfferID = &id
+	}
+	o.ExpiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+	o.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	if respondedAt.Valid {
+		t, _ := time.Parse(time.RFC3339Nano, respondedAt.String)
+		o.RespondedAt = &t
+	}
+	return o, nil
+}
+
+// GetOffer retrieves an offer by ID
+func GetOffer(id int) (Offer, error) {
+	o, err := scanOffer(db.QueryRow(`SELECT `+offerColumns+` FROM Offer WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return Offer{}, ErrOfferNotFound
+	}
+	return o, err
+}
+
+// GetOffersForConversation returns the conversation's offers keyed by ID
+func GetOffersForConversation(conversationID int) (map[int]Offer, error) {
+	rows, err := db.Query(`SELECT `+offerColumns+` FROM Offer WHERE conversation_id = ?`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := make(map[int]Offer)
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers[o.ID] = o
+	}
+	return offers, rows.Err()
+}
+
+// GetOpenOffer returns the conversation's offer awaiting a response, if any
+func GetOpenOffer(conversationID int) (Offer, bool) {
+	o, err := scanOffer(db.QueryRow(`SELECT `+offerColumns+` FROM Offer
+		WHERE conversation_id = ? AND status = ? AND expires_at > ?
+		ORDER BY id DESC LIMIT 1`,
+		conversationID, OfferStatusPending, time.Now().UTC().Format(time.RFC3339Nano)))
+	if err != nil {
+		return Offer{}, false
+	}
+	return o, true
+}
+
+// getAdSellerID returns the owner of the ad a conversation is about
+func getAdSellerID(conversationID int) (int, error) {
+	var sellerID int
+	err := db.QueryRow(`SELECT a.user_id FROM Conversation c JOIN Ad a ON c.ad_id = a.id WHERE c.id = ?`, conversationID).Scan(&sellerID)
+	return sellerID, err
+}
+
+// insertOffer creates a pending offer and the message announcing it. The
+// insert itself checks there is no other open offer in the conversation, so
+// concurrent offers can't both be made.
+func insertOffer(tx *sql.Tx, conv Conversation, senderID int, amount float64, parentID *int, content string) (Offer, Message, error) {
+	recipientID := conv.User1ID
+	if senderID == conv.User1ID {
+		recipientID = conv.User2ID
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(config.OfferExpiry)
+	res, err := tx.Exec(`INSERT INTO Offer (conversation_id, sender_id, recipient_id, amount, status, parent_offer_id, expires_at, created_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM Offer WHERE conversation_id = ? AND status = ? AND expires_at > ?)`,
+		conv.ID, senderID, recipientID, amount, OfferStatusPending, parentID,
+		expiresAt.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano),
+		conv.ID, OfferStatusPending, now.Format(time.RFC3339Nano))
+	if err != nil {
+		return Offer{}, Message{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Offer{}, Message{}, ErrOfferAlreadyOpen
+	}
+	offerID, _ := res.LastInsertId()
+
+	offer := Offer{
+		ID:             int(offerID),
+		ConversationID: conv.ID,
+		SenderID:       senderID,
+		RecipientID:    recipientID,
+		Amount:         amount,
+		Status:         OfferStatusPending,
+		ParentOfferID:  parentID,
+		ExpiresAt:      expiresAt,
+		CreatedAt:      now,
+	}
+	msg, err := addOfferMessageWithTx(tx, conv, senderID, MessageTypeOffer, offer.ID, content)
+	return offer, msg, err
+}
+
+// addOfferMessageWithTx adds an offer message and marks the conversation unread for the other participant
+func addOfferMessageWithTx(tx *sql.Tx, conv Conversation, senderID int, messageType string, offerID int, content string) (Message, error) {
+	res, err := tx.Exec(`INSERT INTO Message (conversation_id, sender_id, content, message_type, offer_id) VALUES (?, ?, ?, ?, ?)`,
+		conv.ID, senderID, content, messageType, offerID)
+	if err != nil {
+		return Message{}, err
+	}
+	messageID, _ := res.LastInsertId()
+
+	unreadColumn := "user1_read"
+	if conv.User1ID == senderID {
+		unreadColumn = "user2_read"
+	}
+	_, err = tx.Exec(`UPDATE Conversation SET updated_at = CURRENT_TIMESTAMP, `+unreadColumn+` = FALSE WHERE id = ?`, conv.ID)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		ID:             int(messageID),
+		ConversationID: conv.ID,
+		SenderID:       senderID,
+		Content:        content,
+		Type:           messageType,
+		OfferID:        &offerID,
+		CreatedAt:      time.Now(),
+	}, nil
+}
+
+// MakeOffer lets the buyer in a conversation propose a price for the ad
+func MakeOffer(conversationID, buyerID int, amount float64) (Offer, error) {
+	if amount <= 0 {
+		return Offer{}, ErrOfferInvalidAmount
+	}
+
+	conv, err := GetConversationByID(conversationID)
+	if err != nil {
+		return Offer{}, err
+	}
+	if conv.User1ID != buyerID && conv.User2ID != buyerID {
+		return Offer{}, fmt.Errorf("user %d is not part of conversation %d", buyerID, conversationID)
+	}
+	sellerID, err := getAdSellerID(conversationID)
+	if err != nil {
+		return Offer{}, err
+	}
+	if sellerID == buyerID {
+		return Offer{}, ErrOfferFromSeller
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return Offer{}, err
+	}
+	defer tx.Rollback()
+
+	offer, msg, err := insertOffer(tx, conv, buyerID, amount, nil, fmt.Sprintf("Offered $%.2f", amount))
+	if err != nil {
+		return Offer{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Offer{}, err
+	}
+
+	NotifyConversationUpdate(conversationID, UpdateTypeOfferUpdated, &msg)
+	emitOfferUpdated(offer, conv.AdID)
+	return offer, nil
+}
+
+// RespondToOffer accepts, declines or counters an open offer. For a counter,
+// the returned offer is the new counter-offer.
+func RespondToOffer(offerID, userID int, action string, counterAmount float64) (Offer, error) {
+	offer, err := GetOffer(offerID)
+	if err != nil {
+		return Offer{}, err
+	}
+	if offer.RecipientID != userID {
+		return Offer{}, ErrOfferNotRecipient
+	}
+	if !offer.IsOpen() {
+		return Offer{}, ErrOfferNotOpen
+	}
+
+	var status, content string
+	switch action {
+	case OfferActionAccept:
+		status, content = OfferStatusAccepted, fmt.Sprintf("Accepted offer of $%.2f", offer.Amount)
+	case OfferActionDecline:
+		status, content = OfferStatusDeclined, fmt.Sprintf("Declined offer of $%.2f", offer.Amount)
+	case OfferActionCounter:
+		if counterAmount <= 0 {
+			return Offer{}, ErrOfferInvalidAmount
+		}
+		status, content = OfferStatusCountered, fmt.Sprintf("Countered with $%.2f", counterAmount)
+	default:
+		return Offer{}, fmt.Errorf("invalid offer action: %s", action)
+	}
+
+	conv, err := GetConversationByID(offer.ConversationID)
+	if err != nil {
+		return Offer{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Offer{}, err
+	}
+	defer tx.Rollback()
+
+	// Only answer the offer if it is still pending, so concurrent responses can't both win
+	respondedAt := time.Now().UTC()
+	res, err := tx.Exec(`UPDATE Offer SET status = ?, responded_at = ? WHERE id = ? AND status = ?`,
+		status, respondedAt.Format(time.RFC3339Nano), offer.ID, OfferStatusPending)
+	if err != nil {
+		return Offer{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Offer{}, ErrOfferNotOpen
+	}
+
+	var msg Message
+	answered := offer
+	answered.Status, answered.RespondedAt = status, &respondedAt
+	result := answered
+	if action == OfferActionCounter {
+		result, msg, err = insertOffer(tx, conv, userID, counterAmount, &offer.ID, content)
+	} else {
+		msg, err = addOfferMessageWithTx(tx, conv, userID, MessageTypeOfferResponse, offer.ID, content)
+	}
+	if err != nil {
+		return Offer{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Offer{}, err
+	}
+
+	NotifyConversationUpdate(offer.ConversationID, UpdateTypeOfferUpdated, &msg)
+	emitOfferUpdated(answered, conv.AdID)
+	if action == OfferActionCounter {
+		emitOfferUpdated(result, conv.AdID)
+	}
+	return result, nil
+}
+
+// ExpireOffers marks pending offers past their expiry as expired and notifies
+// the affected conversations
+func ExpireOffers() (int, error) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	// Only offers this update expired are returned, so ones answered in the
+	// meantime aren't reported as expired
+	rows, err := db.Query(`UPDATE Offer SET status = ? WHERE status = ? AND expires_at <= ? RETURNING `+offerColumns,
+		OfferStatusExpired, OfferStatusPending, now)
+	if err != nil {
+		return 0, err
+	}
+	var expired []Offer
+	for rows.Next() {
+		o, err := scanOffer(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	notified := make(map[int]bool)
+	for _, o := range expired {
+		if !notified[o.ConversationID] {
+			NotifyConversationUpdate(o.ConversationID, UpdateTypeOfferUpdated, nil)
+			notified[o.ConversationID] = true
+		}
+		conv, err := GetConversationByID(o.ConversationID)
+		if err != nil {
+			log.Printf("[webhook] Failed to load conversation %d of expired offer %d: %v", o.ConversationID, o.ID, err)
+			continue
+		}
+		emitOfferUpdated(o, conv.AdID)
+	}
+	return len(expired), nil
+}
+
+// offerEvent is the data of offer.updated webhooks
+type offerEvent struct {
+	Offer
+	AdID int `json:"ad_id"`
+}
+
+// emitOfferUpdated tells both sides' webhooks about an offer's new state
+func emitOfferUpdated(o Offer, adID int) {
+	for _, userID := range []int{o.SenderID, o.RecipientID} {
+		if err := webhook.Emit(userID, webhook.EventOfferUpdated, offerEvent{o, adID}); err != nil {
+			log.Printf("[webhook] Failed to queue %s for user %d: %v", webhook.EventOfferUpdated, userID, err)
+		}
+	}
+}
+
+// StartOfferExpiryProcessor periodically expires stale offers in the background
+func StartOfferExpiryProcessor() {
+	go func() {
+		log.Printf("[messaging] Offer expiry processor started")
+		ticker := time.NewTicker(config.OfferExpirySweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := ExpireOffers()
+			if err != nil {
+				log.Printf("[messaging] Failed to expire offers: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("[messaging] Expired %d offers", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+package messaging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffer_CurrentStatus(t *testing.T) {
+	open := Offer{Status: OfferStatusPending, ExpiresAt: time.Now().Add(time.Hour)}
+	assert.True(t, open.IsOpen())
+	assert.Equal(t, OfferStatusPending, open.CurrentStatus())
+
+	stale := Offer{Status: OfferStatusPending, ExpiresAt: time.Now().Add(-time.Minute)}
+	assert.False(t, stale.IsOpen())
+	assert.Equal(t, OfferStatusExpired, stale.CurrentStatus())
+
+	accepted := Offer{Status: OfferStatusAccepted, ExpiresAt: time.Now().Add(-time.Minute)}
+	assert.Equal(t, OfferStatusAccepted, accepted.CurrentStatus())
+}
+
+func TestMakeOffer_FromSeller(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	mock.ExpectQuery("SELECT id, user1_id, user2_id, ad_id, created_at, updated_at, user1_read, user2_read FROM Conversation WHERE id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user1_id", "user2_id", "ad_id", "created_at", "updated_at", "user1_read", "user2_read"}).
+			AddRow(5, 1, 2, 9, now, now, true, true))
+	mock.ExpectQuery("SELECT a.user_id FROM Conversation c JOIN Ad a ON c.ad_id = a.id WHERE c.id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+
+	_, err := MakeOffer(5, 2, 100)
+
+	assert.ErrorIs(t, err, ErrOfferFromSeller)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMakeOffer_AlreadyOpen(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	mock.ExpectQuery("SELECT id, user1_id, user2_id, ad_id, created_at, updated_at, user1_read, user2_read FROM Conversation WHERE id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user1_id", "user2_id", "ad_id", "created_at", "updated_at", "user1_read", "user2_read"}).
+			AddRow(5, 1, 2, 9, now, now, true, true))
+	mock.ExpectQuery("SELECT a.user_id FROM Conversation c JOIN Ad a ON c.ad_id = a.id WHERE c.id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+	mock.ExpectBegin()
+	// Another offer made concurrently is already open, so nothing is inserted
+	mock.ExpectExec("INSERT INTO Offer .* WHERE NOT EXISTS").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err := MakeOffer(5, 1, 100)
+
+	assert.ErrorIs(t, err, ErrOfferAlreadyOpen)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRespondToOffer_NotRecipient(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	now := time.Now().UTC()
+	mock.ExpectQuery("SELECT id, conversation_id, sender_id, recipient_id, amount, status, parent_offer_id, expires_at, created_at, responded_at FROM Offer WHERE id = \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "recipient_id", "amount", "status", "parent_offer_id", "expires_at", "created_at", "responded_at"}).
+			AddRow(3, 5, 1, 2, 80.0, OfferStatusPending, nil, now.Add(time.Hour).Format(time.RFC3339Nano), now.Format(time.RFC3339Nano), nil))
+
+	_, err := RespondToOffer(3, 1, OfferActionAccept, 0)
+
+	assert.ErrorIs(t, err, ErrOfferNotRecipient)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpireOffers_SkipsAnsweredOffers(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// The offer past its expiry was accepted before the sweep got to it, so
+	// the update returns nothing and nobody is told it expired
+	mock.ExpectQuery("UPDATE Offer SET status = \\? WHERE status = \\? AND expires_at <= \\? RETURNING id, conversation_id").
+		WithArgs(OfferStatusExpired, OfferStatusPending, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "conversation_id", "sender_id", "recipient_id", "amount", "status", "parent_offer_id", "expires_at", "created_at", "responded_at"}))
+
+	n, err := ExpireOffers()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
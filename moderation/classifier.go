@@ -0,0 +1,142 @@
+package moderation
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/parts-pile/site/config"
+)
+
+// Kind is the type of user content being screened
+type Kind string
+
+const (
+	KindAd       Kind = "ad"
+	KindMessage  Kind = "message"
+	KindUsername Kind = "username"
+)
+
+// Kinds lists the content a rule can apply to
+var Kinds = []Kind{KindAd, KindMessage, KindUsername}
+
+// Label returns the kind as shown to admins
+func (k Kind) Label() string {
+	switch k {
+	case KindAd:
+		return "Ads"
+	case KindMessage:
+		return "Messages"
+	case KindUsername:
+		return "Usernames"
+	case "":
+		return "Everything"
+	}
+	return string(k)
+}
+
+// Outcome is what happens to screened content
+type Outcome string
+
+const (
+	// OutcomeAllow lets the content through
+	OutcomeAllow Outcome = "allow"
+	// OutcomeFlag lets the content through and queues it for review
+	OutcomeFlag Outcome = "flag"
+	// OutcomeBlock rejects the content
+	OutcomeBlock Outcome = "block"
+)
+
+// severity orders outcomes so the strictest verdict wins
+func (o Outcome) severity() int {
+	switch o {
+	case OutcomeFlag:
+		return 1
+	case OutcomeBlock:
+		return 2
+	}
+	return 0
+}
+
+// Verdict is a classifier's decision on a piece of content
+type Verdict struct {
+	Outcome Outcome
+	// Reason explains a flag to admins or a block to the user
+	Reason string
+}
+
+// Allowed is the verdict for content nothing objects to
+var Allowed = Verdict{Outcome: OutcomeAllow}
+
+// Classifier screens user content before it is saved
+type Classifier interface {
+	Classify(kind Kind, text string) (Verdict, error)
+}
+
+// Chain runs classifiers in order and returns the strictest verdict. A block
+// stops the chain. A failing classifier doesn't discard the verdicts of the
+// others; its error is returned alongside them.
+type Chain []Classifier
+
+func (ch Chain) Classify(kind Kind, text string) (Verdict, error) {
+	verdict := Allowed
+	var firstErr error
+	for _, classifier := range ch {
+		v, err := classifier.Classify(kind, text)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if v.Outcome.severity() > verdict.Outcome.severity() {
+			verdict = v
+		}
+		if verdict.Outcome == OutcomeBlock {
+			break
+		}
+	}
+	return verdict, firstErr
+}
+
+var (
+	classifierMu sync.RWMutex
+	classifier   Classifier
+)
+
+// defaultClassifier applies the admin-editable rules, then asks Grok about
+// the kinds listed in config.ModerationGrokKinds
+func defaultClassifier() Classifier {
+	var kinds []Kind
+	for _, k := range strings.Split(config.ModerationGrokKinds, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			kinds = append(kinds, Kind(k))
+		}
+	}
+	if len(kinds) == 0 {
+		return Chain{Rules}
+	}
+	return Chain{Rules, NewGrokClassifier(kinds...)}
+}
+
+// SetClassifier replaces the classifier used by Classify
+func SetClassifier(c Classifier) {
+	classifierMu.Lock()
+	defer classifierMu.Unlock()
+	classifier = c
+}
+
+// Classify screens content with the configured classifier
+func Classify(kind Kind, text string) (Verdict, error) {
+	classifierMu.RLock()
+	c := classifier
+	classifierMu.RUnlock()
+	if c == nil {
+		classifierMu.Lock()
+		if classifier == nil {
+			classifier = defaultClassifier()
+		}
+		c = classifier
+		classifierMu.Unlock()
+	}
+	return c.Classify(kind, strings.TrimSpace(text))
+}
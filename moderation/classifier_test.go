@@ -0,0 +1,144 @@
+package moderation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesClassifier(t *testing.T) {
+	rc, err := NewRulesClassifier([]Rule{
+		{ID: 1, MatchType: MatchWord, Pattern: "scam", Outcome: OutcomeFlag, Reason: "Possible scam"},
+		{ID: 2, MatchType: MatchWord, Pattern: "gift card", Kind: KindMessage, Outcome: OutcomeBlock, Reason: "No gift cards"},
+		{ID: 3, MatchType: MatchRegex, Pattern: `\b\d{3}[-. ]\d{3}[-. ]\d{4}\b`, Kind: KindAd, Outcome: OutcomeFlag},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		kind Kind
+		text string
+		want Outcome
+	}{
+		{"clean", KindAd, "Alternator for a 2005 F-150", OutcomeAllow},
+		{"word", KindAd, "Not a SCAM, honest", OutcomeFlag},
+		{"word inside another word", KindAd, "Scampi delivery truck parts", OutcomeAllow},
+		{"substituted characters", KindMessage, "this is no 5c@m", OutcomeFlag},
+		{"phrase limited to messages", KindMessage, "Pay with a Gift Card please", OutcomeBlock},
+		{"phrase on other content", KindAd, "Pay with a gift card", OutcomeAllow},
+		{"regex", KindAd, "Call 555-123-4567", OutcomeFlag},
+		{"regex limited to ads", KindMessage, "Call 555-123-4567", OutcomeAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := rc.Classify(tt.kind, tt.text)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, v.Outcome)
+		})
+	}
+
+	v, _ := rc.Classify(KindMessage, "scam? send a gift card")
+	assert.Equal(t, Verdict{Outcome: OutcomeBlock, Reason: "No gift cards"}, v)
+	v, _ = rc.Classify(KindAd, "call 555.123.4567")
+	assert.Equal(t, "Matched regex rule: "+`\b\d{3}[-. ]\d{3}[-. ]\d{4}\b`, v.Reason)
+}
+
+func TestNewRulesClassifier_InvalidRegex(t *testing.T) {
+	_, err := NewRulesClassifier([]Rule{{ID: 4, MatchType: MatchRegex, Pattern: "(", Outcome: OutcomeBlock}})
+	assert.Error(t, err)
+}
+
+type stubClassifier struct {
+	verdict Verdict
+	err     error
+	calls   int
+}
+
+func (s *stubClassifier) Classify(Kind, string) (Verdict, error) {
+	s.calls++
+	return s.verdict, s.err
+}
+
+func TestChain(t *testing.T) {
+	flag := &stubClassifier{verdict: Verdict{Outcome: OutcomeFlag, Reason: "flagged"}}
+	down := &stubClassifier{err: errors.New("unavailable")}
+	block := &stubClassifier{verdict: Verdict{Outcome: OutcomeBlock, Reason: "blocked"}}
+	after := &stubClassifier{verdict: Allowed}
+
+	v, err := Chain{flag, down}.Classify(KindAd, "text")
+	assert.Error(t, err)
+	assert.Equal(t, OutcomeFlag, v.Outcome)
+
+	v, err = Chain{block, after}.Classify(KindAd, "text")
+	assert.NoError(t, err)
+	assert.Equal(t, "blocked", v.Reason)
+	assert.Equal(t, 0, after.calls)
+}
+
+func TestParseGrokVerdict(t *testing.T) {
+	assert.Equal(t, Allowed, parseGrokVerdict(" OK\n"))
+	assert.Equal(t, Verdict{Outcome: OutcomeFlag, Reason: "Asks to pay off-site"}, parseGrokVerdict("FLAG: Asks to pay off-site"))
+	assert.Equal(t, Verdict{Outcome: OutcomeBlock, Reason: "Slurs aren't allowed."}, parseGrokVerdict("BLOCK: Slurs aren't allowed."))
+	// The username prompt answers with the message itself
+	assert.Equal(t, Verdict{Outcome: OutcomeBlock, Reason: "Please pick another name."}, parseGrokVerdict("Please pick another name."))
+}
+
+func TestGrokClassifier_SkipsOtherKinds(t *testing.T) {
+	v, err := NewGrokClassifier(KindUsername).Classify(KindMessage, "anything")
+	assert.NoError(t, err)
+	assert.Equal(t, Allowed, v)
+}
+
+func TestAddRules(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// Invalid patterns are rejected before anything is stored
+	err := AddRules([]Rule{
+		{MatchType: MatchWord, Pattern: "scam", Outcome: OutcomeFlag},
+		{MatchType: MatchRegex, Pattern: "[", Outcome: OutcomeFlag},
+	})
+	assert.Error(t, err)
+	assert.Error(t, AddRules([]Rule{{MatchType: MatchWord, Pattern: "scam", Outcome: OutcomeAllow}}))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO ModerationRule").
+		WithArgs(MatchWord, "scam", Kind(""), OutcomeFlag, "Possible scam", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, AddRules([]Rule{{MatchType: MatchWord, Pattern: " scam ", Outcome: OutcomeFlag, Reason: "Possible scam"}}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRules_ReloadAfterEdit(t *testing.T) {
+	mock := dbtest.Mock(t)
+	Rules.Invalidate()
+	columns := []string{"id", "match_type", "pattern", "kind", "outcome", "reason", "created_at"}
+
+	mock.ExpectQuery("SELECT id, match_type, pattern, kind, outcome, reason, created_at FROM ModerationRule").
+		WillReturnRows(sqlmock.NewRows(columns))
+	v, err := Rules.Classify(KindAd, "scam")
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeAllow, v.Outcome)
+
+	// Rules are cached until they change
+	v, err = Rules.Classify(KindAd, "scam")
+	require.NoError(t, err)
+	assert.Equal(t, OutcomeAllow, v.Outcome)
+
+	mock.ExpectExec("DELETE FROM ModerationRule WHERE id = \\?").
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("FROM ModerationRule").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(8, "word", "scam", "", "block", "", "2026-01-02T10:00:00Z"))
+
+	require.NoError(t, DeleteRule(7))
+	v, err = Rules.Classify(KindAd, "scam")
+	require.NoError(t, err)
+	assert.Equal(t, Verdict{Outcome: OutcomeBlock, Reason: defaultBlockReason}, v)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,95 @@
+package moderation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/parts-pile/site/grok"
+)
+
+// usernamePrompt screens new usernames. Anything other than OK is the
+// message shown to the user.
+const usernamePrompt = `You are an expert parts technician. Your job is to screen potential user names for the parts-pile web site.
+Reject user names that the general public would find offensive.
+Car-guy humor, double entendres, and puns are allowed unless they are widely considered offensive or hateful.
+Examples of acceptable usernames:
+- rusty nuts
+- lugnut
+- fast wrench
+- shift happens
+
+Examples of unacceptable usernames:
+- racial slurs
+- hate speech
+- explicit sexual content
+
+If the user name is acceptable, return only: OK
+If the user name is unacceptable, return a short, direct error message (1-2 sentences), and do not mention yourself, AI, or Grok in the response.
+Only reject names that are truly offensive to a general audience.`
+
+// contentPrompt screens ad text and messages
+const contentPrompt = `You are an expert parts technician moderating the parts-pile web site, a marketplace for used auto parts.
+Screen the following %s for content that breaks the site's rules.
+
+Block content that is clearly:
+- hate speech, slurs or harassment
+- explicit sexual content
+- selling stolen goods, weapons, drugs or anything other than vehicles, parts and tools
+- a scam, such as asking for payment by gift card or wire transfer up front
+
+Flag content for a human moderator when it looks suspicious but you are not sure, such as requests to move the conversation off the site or contact details in an ad description.
+Car-guy humor, slang and blunt language are fine.
+
+If the content is acceptable, return only: OK
+If it should be flagged, return: FLAG: followed by a short reason for the moderator
+If it should be blocked, return: BLOCK: followed by a short, direct message to the user (1-2 sentences), and do not mention yourself, AI, or Grok in the response.`
+
+// GrokClassifier asks Grok to screen content
+type GrokClassifier struct {
+	kinds map[Kind]bool
+}
+
+// NewGrokClassifier returns a classifier that screens the given kinds of
+// content with Grok and allows everything else
+func NewGrokClassifier(kinds ...Kind) *GrokClassifier {
+	g := &GrokClassifier{kinds: make(map[Kind]bool)}
+	for _, k := range kinds {
+		g.kinds[k] = true
+	}
+	return g
+}
+
+func (g *GrokClassifier) Classify(kind Kind, text string) (Verdict, error) {
+	if !g.kinds[kind] || text == "" {
+		return Allowed, nil
+	}
+
+	systemPrompt := usernamePrompt
+	switch kind {
+	case KindAd:
+		systemPrompt = fmt.Sprintf(contentPrompt, "ad")
+	case KindMessage:
+		systemPrompt = fmt.Sprintf(contentPrompt, "message between a buyer and a seller")
+	}
+
+	resp, err := grok.CallGrok(systemPrompt, text)
+	if err != nil {
+		return Allowed, err
+	}
+	return parseGrokVerdict(resp), nil
+}
+
+// parseGrokVerdict reads Grok's answer. Answers that are neither OK nor a
+// flag are blocks, which is how the username prompt replies.
+func parseGrokVerdict(resp string) Verdict {
+	resp = strings.TrimSpace(resp)
+	switch {
+	case resp == "OK":
+		return Allowed
+	case strings.HasPrefix(resp, "FLAG:"):
+		return Verdict{Outcome: OutcomeFlag, Reason: strings.TrimSpace(strings.TrimPrefix(resp, "FLAG:"))}
+	case strings.HasPrefix(resp, "BLOCK:"):
+		return Verdict{Outcome: OutcomeBlock, Reason: strings.TrimSpace(strings.TrimPrefix(resp, "BLOCK:"))}
+	}
+	return Verdict{Outcome: OutcomeBlock, Reason: resp}
+}
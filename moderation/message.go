@@ -0,0 +1,153 @@
+package moderation
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// ErrCaseNotOpen is returned when deciding a message case that doesn't exist
+// or was already decided
+var ErrCaseNotOpen = errors.New("moderation case not found or already decided")
+
+// MessageAction is an admin's decision on a flagged message
+type MessageAction string
+
+const (
+	MessageActionDismiss   MessageAction = "dismiss"
+	MessageActionDelete    MessageAction = "delete_message"
+	MessageActionBanSender MessageAction = "ban_sender"
+)
+
+// MessageActions lists the decisions available for flagged messages
+var MessageActions = []MessageAction{MessageActionDismiss, MessageActionDelete, MessageActionBanSender}
+
+// Label returns the action as shown to admins
+func (a MessageAction) Label() string {
+	switch a {
+	case MessageActionDismiss:
+		return "Dismiss"
+	case MessageActionDelete:
+		return "Delete message"
+	case MessageActionBanSender:
+		return "Ban sender"
+	}
+	return string(a)
+}
+
+// IsValid returns true for the known actions
+func (a MessageAction) IsValid() bool {
+	for _, known := range MessageActions {
+		if a == known {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageCase is a flagged message waiting for review. The ad is only
+// context: decisions act on the message and its sender.
+type MessageCase struct {
+	ID             int
+	MessageID      int
+	ConversationID int
+	AdID           int
+	AdTitle        string
+	SenderID       int
+	SenderName     string
+	Details        string
+	CreatedAt      time.Time
+}
+
+// FlagMessage queues a message flagged by an automated check unless it
+// already has an open case. It returns true if a case was opened.
+func FlagMessage(messageID, senderID int, details string) (bool, error) {
+	res, err := db.Exec(`INSERT INTO MessageCase (message_id, sender_id, details, created_at)
+		SELECT ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM MessageCase WHERE message_id = ? AND resolved_at IS NULL)`,
+		messageID, senderID, details, time.Now().UTC().Format(time.RFC3339Nano), messageID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetMessageQueue returns the open message cases, oldest first
+func GetMessageQueue() ([]MessageCase, error) {
+	rows, err := db.Query(`
+		SELECT mc.id, mc.message_id, COALESCE(m.conversation_id, 0), COALESCE(c.ad_id, 0), COALESCE(a.title, ''),
+		       mc.sender_id, COALESCE(s.name, ''), mc.details, mc.created_at
+		FROM MessageCase mc
+		LEFT JOIN Message m ON m.id = mc.message_id
+		LEFT JOIN Conversation c ON c.id = m.conversation_id
+		LEFT JOIN Ad a ON a.id = c.ad_id
+		LEFT JOIN User s ON s.id = mc.sender_id
+		WHERE mc.resolved_at IS NULL
+		ORDER BY mc.created_at, mc.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cases []MessageCase
+	for rows.Next() {
+		var mc MessageCase
+		var createdAt string
+		if err := rows.Scan(&mc.ID, &mc.MessageID, &mc.ConversationID, &mc.AdID, &mc.AdTitle,
+			&mc.SenderID, &mc.SenderName, &mc.Details, &createdAt); err != nil {
+			return nil, err
+		}
+		mc.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		cases = append(cases, mc)
+	}
+	return cases, rows.Err()
+}
+
+// DecideMessage records an admin's decision on a flagged message and closes
+// its open cases. Deleting the message and banning the sender both remove
+// the message; a ban also closes every other open case of the sender.
+// Archiving the banned sender's account and ads is left to the caller.
+func DecideMessage(caseID, adminID int, action MessageAction) (MessageCase, error) {
+	if !action.IsValid() {
+		return MessageCase{}, fmt.Errorf("unknown moderation action: %s", action)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return MessageCase{}, err
+	}
+	defer tx.Rollback()
+
+	mc := MessageCase{ID: caseID}
+	err = tx.QueryRow(`SELECT message_id, sender_id FROM MessageCase WHERE id = ? AND resolved_at IS NULL`, caseID).
+		Scan(&mc.MessageID, &mc.SenderID)
+	if err == sql.ErrNoRows {
+		return MessageCase{}, ErrCaseNotOpen
+	}
+	if err != nil {
+		return MessageCase{}, err
+	}
+
+	if action != MessageActionDismiss {
+		if _, err := tx.Exec(`DELETE FROM Message WHERE id = ?`, mc.MessageID); err != nil {
+			return MessageCase{}, err
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	resolve := `UPDATE MessageCase SET resolved_at = ?, admin_id = ?, action = ? WHERE resolved_at IS NULL AND `
+	if action == MessageActionBanSender {
+		_, err = tx.Exec(resolve+`sender_id = ?`, now, adminID, action, mc.SenderID)
+	} else {
+		_, err = tx.Exec(resolve+`message_id = ?`, now, adminID, action, mc.MessageID)
+	}
+	if err != nil {
+		return MessageCase{}, err
+	}
+
+	return mc, tx.Commit()
+}
@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagMessage(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectExec("INSERT INTO MessageCase \\(message_id, sender_id, details, created_at\\)").
+		WithArgs(42, 7, "Spam\n\nbuy now", sqlmock.AnyArg(), 42).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	opened, err := FlagMessage(42, 7, "Spam\n\nbuy now")
+	require.NoError(t, err)
+	assert.True(t, opened)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecideMessage_BanSender(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT message_id, sender_id FROM MessageCase WHERE id = \\? AND resolved_at IS NULL").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "sender_id"}).AddRow(42, 7))
+	mock.ExpectExec("DELETE FROM Message WHERE id = \\?").
+		WithArgs(42).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Every open case of the sender is closed, not only this one
+	mock.ExpectExec("UPDATE MessageCase SET resolved_at = \\?, admin_id = \\?, action = \\? WHERE resolved_at IS NULL AND sender_id = \\?").
+		WithArgs(sqlmock.AnyArg(), 1, MessageActionBanSender, 7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	mc, err := DecideMessage(3, 1, MessageActionBanSender)
+	require.NoError(t, err)
+	assert.Equal(t, 7, mc.SenderID)
+	assert.Equal(t, 42, mc.MessageID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecideMessage_DismissKeepsMessage(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT message_id, sender_id FROM MessageCase").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "sender_id"}).AddRow(42, 7))
+	mock.ExpectExec("UPDATE MessageCase SET .* WHERE resolved_at IS NULL AND message_id = \\?").
+		WithArgs(sqlmock.AnyArg(), 1, MessageActionDismiss, 42).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err := DecideMessage(3, 1, MessageActionDismiss)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecideMessage_AlreadyDecided(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT message_id, sender_id FROM MessageCase").
+		WithArgs(3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err := DecideMessage(3, 1, MessageActionDelete)
+	assert.ErrorIs(t, err, ErrCaseNotOpen)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,326 @@
+package moderation
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+)
+
+// Reason is why an ad was put in the moderation queue
+type Reason string
+
+const (
+	// ReasonRocks is an ad reaching config.ModerationRockThreshold unresolved rocks
+	ReasonRocks Reason = "rocks"
+	// ReasonReport is a user reporting an ad
+	ReasonReport Reason = "report"
+	// ReasonFlag is an ad flagged by an automated check
+	ReasonFlag Reason = "flag"
+	// ReasonEdited is a seller updating an ad after moderators asked for changes
+	ReasonEdited Reason = "edited"
+)
+
+// Label returns the reason as shown to admins
+func (r Reason) Label() string {
+	switch r {
+	case ReasonRocks:
+		return "Rock threshold"
+	case ReasonReport:
+		return "Report"
+	case ReasonFlag:
+		return "Automated flag"
+	case ReasonEdited:
+		return "Edited after request"
+	}
+	return string(r)
+}
+
+// Action is an admin's decision on a queued ad
+type Action string
+
+const (
+	ActionApprove     Action = "approve"
+	ActionHide        Action = "hide"
+	ActionEditRequest Action = "edit_request"
+	ActionBanSeller   Action = "ban_seller"
+)
+
+// Actions lists the decisions available in the queue
+var Actions = []Action{ActionApprove, ActionHide, ActionEditRequest, ActionBanSeller}
+
+// Label returns the action as shown to admins
+func (a Action) Label() string {
+	switch a {
+	case ActionApprove:
+		return "Approve"
+	case ActionHide:
+		return "Hide"
+	case ActionEditRequest:
+		return "Request edit"
+	case ActionBanSeller:
+		return "Ban seller"
+	}
+	return string(a)
+}
+
+// IsValid returns true for the known actions
+func (a Action) IsValid() bool {
+	for _, known := range Actions {
+		if a == known {
+			return true
+		}
+	}
+	return false
+}
+
+// hides returns true if the ad stays out of public view after the decision
+func (a Action) hides() bool {
+	return a != ActionApprove
+}
+
+// SellerMessage explains the decision to the seller
+func (a Action) SellerMessage(adTitle, note string) string {
+	var msg string
+	switch a {
+	case ActionApprove:
+		msg = fmt.Sprintf("Your ad \"%s\" was reviewed by a moderator and is listed normally.", adTitle)
+	case ActionHide:
+		msg = fmt.Sprintf("Your ad \"%s\" was reviewed by a moderator and has been hidden from other users.", adTitle)
+	case ActionEditRequest:
+		msg = fmt.Sprintf("Your ad \"%s\" was reviewed by a moderator and is hidden until you edit it. It will be reviewed again once you save your changes.", adTitle)
+	case ActionBanSeller:
+		msg = fmt.Sprintf("Your ad \"%s\" was reviewed by a moderator. Your account has been banned and your ads archived.", adTitle)
+	}
+	if note = strings.TrimSpace(note); note != "" {
+		msg += "\n\nModerator note: " + note
+	}
+	return msg
+}
+
+// Case is a reason an ad needs review
+type Case struct {
+	ID           int
+	AdID         int
+	Reason       Reason
+	Details      string
+	ReporterID   int
+	ReporterName string
+	CreatedAt    time.Time
+}
+
+// QueueItem is an ad with open cases
+type QueueItem struct {
+	AdID       int
+	AdTitle    string
+	SellerID   int
+	SellerName string
+	Hidden     bool
+	Cases      []Case
+}
+
+// Decision is a recorded moderation decision
+type Decision struct {
+	ID         int
+	AdID       int
+	AdTitle    string
+	SellerID   int
+	SellerName string
+	AdminID    int
+	AdminName  string
+	Action     Action
+	Note       string
+	CreatedAt  time.Time
+}
+
+// openCase queues an ad for review unless the same reason, and for reports
+// the same reporter, already has an open case for it. It returns true if a
+// case was opened.
+func openCase(adID int, reason Reason, details string, reporterID int) (bool, error) {
+	var reporter interface{}
+	if reporterID != 0 {
+		reporter = reporterID
+	}
+	res, err := db.Exec(`INSERT INTO ModerationCase (ad_id, reason, details, reporter_id, created_at)
+		SELECT ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM ModerationCase
+			WHERE ad_id = ? AND reason = ? AND resolved_at IS NULL AND COALESCE(reporter_id, 0) = ?
+		)`,
+		adID, reason, details, reporter, time.Now().UTC().Format(time.RFC3339Nano),
+		adID, reason, reporterID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ReportAd queues an ad reported by a user
+func ReportAd(adID, reporterID int, details string) (bool, error) {
+	return openCase(adID, ReasonReport, details, reporterID)
+}
+
+// FlagAd queues an ad flagged by an automated check
+func FlagAd(adID int, details string) (bool, error) {
+	return openCase(adID, ReasonFlag, details, 0)
+}
+
+// CheckRockThreshold queues and hides an ad when its unresolved rocks reach
+// config.ModerationRockThreshold. Only reaching the threshold counts, so an
+// approved ad is not hidden again by every further rock. It returns true if
+// the ad was hidden.
+func CheckRockThreshold(adID, rockCount int) (bool, error) {
+	if rockCount != config.ModerationRockThreshold {
+		return false, nil
+	}
+	opened, err := openCase(adID, ReasonRocks, fmt.Sprintf("%d unresolved rocks", rockCount), 0)
+	if err != nil || !opened {
+		return false, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if _, err := db.Exec(`UPDATE Ad SET hidden_at = ?, updated_at = ? WHERE id = ? AND hidden_at IS NULL`,
+		now, now, adID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AdEdited re-queues a hidden ad whose seller saved changes after an edit
+// request
+func AdEdited(adID int) error {
+	var action string
+	err := db.QueryRow(`SELECT d.action FROM ModerationDecision d
+		JOIN Ad a ON a.id = d.ad_id
+		WHERE d.ad_id = ? AND a.hidden_at IS NOT NULL
+		ORDER BY d.created_at DESC, d.id DESC LIMIT 1`, adID).Scan(&action)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if Action(action) != ActionEditRequest {
+		return nil
+	}
+	_, err = openCase(adID, ReasonEdited, "", 0)
+	return err
+}
+
+// GetQueue returns the ads with open cases, oldest case first
+func GetQueue() ([]QueueItem, error) {
+	rows, err := db.Query(`
+		SELECT mc.id, mc.ad_id, mc.reason, mc.details, COALESCE(mc.reporter_id, 0), COALESCE(r.name, ''), mc.created_at,
+		       COALESCE(a.title, ''), a.user_id, COALESCE(s.name, ''), a.hidden_at IS NOT NULL
+		FROM ModerationCase mc
+		JOIN Ad a ON a.id = mc.ad_id
+		LEFT JOIN User s ON s.id = a.user_id
+		LEFT JOIN User r ON r.id = mc.reporter_id
+		WHERE mc.resolved_at IS NULL
+		ORDER BY mc.created_at, mc.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []QueueItem
+	index := make(map[int]int)
+	for rows.Next() {
+		var mc Case
+		var createdAt string
+		var item QueueItem
+		if err := rows.Scan(&mc.ID, &mc.AdID, &mc.Reason, &mc.Details, &mc.ReporterID, &mc.ReporterName, &createdAt,
+			&item.AdTitle, &item.SellerID, &item.SellerName, &item.Hidden); err != nil {
+			return nil, err
+		}
+		mc.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+
+		i, ok := index[mc.AdID]
+		if !ok {
+			item.AdID = mc.AdID
+			items = append(items, item)
+			i = len(items) - 1
+			index[mc.AdID] = i
+		}
+		items[i].Cases = append(items[i].Cases, mc)
+	}
+	return items, rows.Err()
+}
+
+// Decide records an admin's decision on an ad, closes its open cases and
+// hides or shows the ad accordingly. Banning the seller's account and
+// archiving their ads is left to the caller.
+func Decide(adID, adminID int, action Action, note string) (Decision, error) {
+	if !action.IsValid() {
+		return Decision{}, fmt.Errorf("unknown moderation action: %s", action)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Decision{}, err
+	}
+	defer tx.Rollback()
+
+	d := Decision{AdID: adID, AdminID: adminID, Action: action, Note: strings.TrimSpace(note), CreatedAt: time.Now().UTC()}
+	if err := tx.QueryRow(`SELECT COALESCE(title, ''), user_id FROM Ad WHERE id = ?`, adID).Scan(&d.AdTitle, &d.SellerID); err != nil {
+		return Decision{}, err
+	}
+
+	now := d.CreatedAt.Format(time.RFC3339Nano)
+	res, err := tx.Exec(`INSERT INTO ModerationDecision (ad_id, seller_id, admin_id, action, note, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		adID, d.SellerID, adminID, action, d.Note, now)
+	if err != nil {
+		return Decision{}, err
+	}
+	id, _ := res.LastInsertId()
+	d.ID = int(id)
+
+	if _, err := tx.Exec(`UPDATE ModerationCase SET resolved_at = ?, decision_id = ? WHERE ad_id = ? AND resolved_at IS NULL`,
+		now, d.ID, adID); err != nil {
+		return Decision{}, err
+	}
+
+	if action.hides() {
+		_, err = tx.Exec(`UPDATE Ad SET hidden_at = COALESCE(hidden_at, ?), updated_at = ? WHERE id = ?`, now, now, adID)
+	} else {
+		_, err = tx.Exec(`UPDATE Ad SET hidden_at = NULL, updated_at = ? WHERE id = ?`, now, adID)
+	}
+	if err != nil {
+		return Decision{}, err
+	}
+
+	return d, tx.Commit()
+}
+
+// GetRecentDecisions returns the latest moderation decisions, newest first
+func GetRecentDecisions(limit int) ([]Decision, error) {
+	rows, err := db.Query(`
+		SELECT d.id, d.ad_id, COALESCE(a.title, ''), d.seller_id, COALESCE(s.name, ''), d.admin_id, COALESCE(m.name, ''),
+		       d.action, d.note, d.created_at
+		FROM ModerationDecision d
+		LEFT JOIN Ad a ON a.id = d.ad_id
+		LEFT JOIN User s ON s.id = d.seller_id
+		LEFT JOIN User m ON m.id = d.admin_id
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []Decision
+	for rows.Next() {
+		var d Decision
+		var createdAt string
+		if err := rows.Scan(&d.ID, &d.AdID, &d.AdTitle, &d.SellerID, &d.SellerName, &d.AdminID, &d.AdminName,
+			&d.Action, &d.Note, &createdAt); err != nil {
+			return nil, err
+		}
+		d.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
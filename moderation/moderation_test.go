@@ -0,0 +1,153 @@
+package moderation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRockThreshold(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// Below and above the threshold nothing happens
+	hidden, err := CheckRockThreshold(5, config.ModerationRockThreshold-1)
+	assert.NoError(t, err)
+	assert.False(t, hidden)
+	hidden, err = CheckRockThreshold(5, config.ModerationRockThreshold+1)
+	assert.NoError(t, err)
+	assert.False(t, hidden)
+
+	mock.ExpectExec("INSERT INTO ModerationCase").
+		WithArgs(5, ReasonRocks, sqlmock.AnyArg(), nil, sqlmock.AnyArg(), 5, ReasonRocks, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE Ad SET hidden_at = \\?, updated_at = \\? WHERE id = \\? AND hidden_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	hidden, err = CheckRockThreshold(5, config.ModerationRockThreshold)
+	assert.NoError(t, err)
+	assert.True(t, hidden)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckRockThreshold_AlreadyQueued(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// An open rocks case means the ad was already hidden or is being reviewed
+	mock.ExpectExec("INSERT INTO ModerationCase").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	hidden, err := CheckRockThreshold(5, config.ModerationRockThreshold)
+	assert.NoError(t, err)
+	assert.False(t, hidden)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecide(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COALESCE\\(title, ''\\), user_id FROM Ad WHERE id = \\?").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"title", "user_id"}).AddRow("Alternator", 4))
+	mock.ExpectExec("INSERT INTO ModerationDecision").
+		WithArgs(9, 4, 1, ActionEditRequest, "Add photos", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectExec("UPDATE ModerationCase SET resolved_at = \\?, decision_id = \\? WHERE ad_id = \\? AND resolved_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), 12, 9).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE Ad SET hidden_at = COALESCE\\(hidden_at, \\?\\), updated_at = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	d, err := Decide(9, 1, ActionEditRequest, " Add photos ")
+	require.NoError(t, err)
+	assert.Equal(t, 12, d.ID)
+	assert.Equal(t, 4, d.SellerID)
+	assert.Equal(t, "Alternator", d.AdTitle)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecide_Approve(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COALESCE\\(title, ''\\), user_id FROM Ad").
+		WillReturnRows(sqlmock.NewRows([]string{"title", "user_id"}).AddRow("Alternator", 4))
+	mock.ExpectExec("INSERT INTO ModerationDecision").
+		WillReturnResult(sqlmock.NewResult(13, 1))
+	mock.ExpectExec("UPDATE ModerationCase").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE Ad SET hidden_at = NULL, updated_at = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err := Decide(9, 1, ActionApprove, "")
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecide_UnknownAction(t *testing.T) {
+	dbtest.Mock(t)
+
+	_, err := Decide(9, 1, Action("delete"), "")
+	assert.Error(t, err)
+}
+
+func TestGetQueue(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	columns := []string{"id", "ad_id", "reason", "details", "reporter_id", "reporter_name", "created_at",
+		"title", "user_id", "seller_name", "hidden"}
+	mock.ExpectQuery("FROM ModerationCase mc").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 9, "rocks", "3 unresolved rocks", 0, "", "2026-01-02T10:00:00Z", "Alternator", 4, "sam", true).
+			AddRow(2, 7, "report", "Wrong part", 6, "alex", "2026-01-02T11:00:00Z", "Radiator", 5, "kim", false).
+			AddRow(3, 9, "report", "Scam", 6, "alex", "2026-01-02T12:00:00Z", "Alternator", 4, "sam", true))
+
+	queue, err := GetQueue()
+	require.NoError(t, err)
+	require.Len(t, queue, 2)
+	assert.Equal(t, 9, queue[0].AdID)
+	assert.True(t, queue[0].Hidden)
+	require.Len(t, queue[0].Cases, 2)
+	assert.Equal(t, ReasonRocks, queue[0].Cases[0].Reason)
+	assert.Equal(t, "Scam", queue[0].Cases[1].Details)
+	assert.Equal(t, 7, queue[1].AdID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSellerMessage(t *testing.T) {
+	msg := ActionEditRequest.SellerMessage("Alternator", "Please add photos")
+	assert.Contains(t, msg, "\"Alternator\"")
+	assert.Contains(t, msg, "Moderator note: Please add photos")
+	assert.NotContains(t, ActionApprove.SellerMessage("Alternator", "  "), "Moderator note")
+}
+
+func TestAdEdited_ReturnsLookupErrors(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectQuery("SELECT d.action FROM ModerationDecision d").
+		WithArgs(7).
+		WillReturnError(errors.New("database is locked"))
+
+	err := AdEdited(7)
+	assert.ErrorContains(t, err, "database is locked")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdEdited_OnlyAfterEditRequest(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectQuery("SELECT d.action FROM ModerationDecision d").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"action"}).AddRow(string(ActionHide)))
+
+	assert.NoError(t, AdEdited(7))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,237 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// MatchType is how a rule's pattern is matched against content
+type MatchType string
+
+const (
+	// MatchWord matches a word or phrase, ignoring case and common character
+	// substitutions like "0" for "o"
+	MatchWord MatchType = "word"
+	// MatchRegex matches a regular expression
+	MatchRegex MatchType = "regex"
+)
+
+// Rule is an admin-editable screening rule
+type Rule struct {
+	ID        int
+	MatchType MatchType
+	Pattern   string
+	// Kind limits the rule to one type of content; empty applies to all
+	Kind    Kind
+	Outcome Outcome
+	// Reason is shown to admins for flags and to users for blocks
+	Reason    string
+	CreatedAt time.Time
+}
+
+// defaultBlockReason is shown when a blocking rule has no reason of its own
+const defaultBlockReason = "This content isn't allowed on parts-pile. Please change it and try again."
+
+func (r Rule) verdict() Verdict {
+	reason := r.Reason
+	if reason == "" {
+		if r.Outcome == OutcomeBlock {
+			reason = defaultBlockReason
+		} else {
+			reason = fmt.Sprintf("Matched %s rule: %s", r.MatchType, r.Pattern)
+		}
+	}
+	return Verdict{Outcome: r.Outcome, Reason: reason}
+}
+
+// leetReplacer undoes common character substitutions before word rules match
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+
+// normalize folds case and character substitutions so word rules match
+// "Sh1T" like "shit". Patterns and content are folded the same way.
+func normalize(s string) string {
+	return leetReplacer.Replace(strings.ToLower(s))
+}
+
+// compile builds the regular expression a rule matches with
+func (r Rule) compile() (*regexp.Regexp, error) {
+	switch r.MatchType {
+	case MatchWord:
+		word := normalize(strings.TrimSpace(r.Pattern))
+		if word == "" {
+			return nil, fmt.Errorf("word rules need a word or phrase")
+		}
+		return regexp.Compile(`(^|[^\pL\pN])` + regexp.QuoteMeta(word) + `($|[^\pL\pN])`)
+	case MatchRegex:
+		return regexp.Compile("(?i)" + r.Pattern)
+	}
+	return nil, fmt.Errorf("unknown match type: %s", r.MatchType)
+}
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+func (cr compiledRule) matches(text, normalized string) bool {
+	if cr.MatchType == MatchWord {
+		return cr.re.MatchString(normalized)
+	}
+	return cr.re.MatchString(text)
+}
+
+// RulesClassifier screens content against word and regex rules
+type RulesClassifier struct {
+	mu     sync.RWMutex
+	rules  []compiledRule
+	loaded bool
+	load   func() ([]Rule, error)
+}
+
+// Rules classifies with the rules stored in the database. It reloads them
+// after they are edited through AddRules or DeleteRule.
+var Rules = &RulesClassifier{load: GetRules}
+
+// NewRulesClassifier returns a classifier for a fixed set of rules
+func NewRulesClassifier(rules []Rule) (*RulesClassifier, error) {
+	rc := &RulesClassifier{loaded: true}
+	if err := rc.set(rules); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func (rc *RulesClassifier) set(rules []Rule) error {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, r := range rules {
+		re, err := r.compile()
+		if err != nil {
+			return fmt.Errorf("rule %d: %w", r.ID, err)
+		}
+		compiled = append(compiled, compiledRule{Rule: r, re: re})
+	}
+	rc.rules = compiled
+	return nil
+}
+
+// Invalidate makes the classifier reload its rules on next use
+func (rc *RulesClassifier) Invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.load != nil {
+		rc.loaded = false
+	}
+}
+
+func (rc *RulesClassifier) current() ([]compiledRule, error) {
+	rc.mu.RLock()
+	if rc.loaded {
+		defer rc.mu.RUnlock()
+		return rc.rules, nil
+	}
+	rc.mu.RUnlock()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if !rc.loaded {
+		rules, err := rc.load()
+		if err != nil {
+			return nil, err
+		}
+		if err := rc.set(rules); err != nil {
+			return nil, err
+		}
+		rc.loaded = true
+	}
+	return rc.rules, nil
+}
+
+func (rc *RulesClassifier) Classify(kind Kind, text string) (Verdict, error) {
+	rules, err := rc.current()
+	if err != nil {
+		return Allowed, err
+	}
+
+	normalized := normalize(text)
+	verdict := Allowed
+	for _, r := range rules {
+		if r.Kind != "" && r.Kind != kind {
+			continue
+		}
+		if r.Outcome.severity() <= verdict.Outcome.severity() || !r.matches(text, normalized) {
+			continue
+		}
+		verdict = r.verdict()
+		if verdict.Outcome == OutcomeBlock {
+			break
+		}
+	}
+	return verdict, nil
+}
+
+// GetRules returns all screening rules, oldest first
+func GetRules() ([]Rule, error) {
+	rows, err := db.Query(`SELECT id, match_type, pattern, kind, outcome, reason, created_at FROM ModerationRule ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var r Rule
+		var createdAt string
+		if err := rows.Scan(&r.ID, &r.MatchType, &r.Pattern, &r.Kind, &r.Outcome, &r.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// AddRules validates and stores rules. Nothing is stored if any rule is
+// invalid.
+func AddRules(rules []Rule) error {
+	for _, r := range rules {
+		if r.Outcome != OutcomeFlag && r.Outcome != OutcomeBlock {
+			return fmt.Errorf("rules must flag or block")
+		}
+		if _, err := r.compile(); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, r := range rules {
+		if _, err := tx.Exec(`INSERT INTO ModerationRule (match_type, pattern, kind, outcome, reason, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			r.MatchType, strings.TrimSpace(r.Pattern), r.Kind, r.Outcome, strings.TrimSpace(r.Reason), now); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	Rules.Invalidate()
+	return nil
+}
+
+// DeleteRule removes a screening rule
+func DeleteRule(id int) error {
+	if _, err := db.Exec(`DELETE FROM ModerationRule WHERE id = ?`, id); err != nil {
+		return err
+	}
+	Rules.Invalidate()
+	return nil
+}
@@ -83,6 +83,119 @@ func (n *NotificationService) NotifyNewMessage(conversationID int, senderID, rec
 	}
 }
 
+// NotifyPriceDrop alerts the users who bookmarked an ad, and have not opted
+// out, that its price dropped
+func (n *NotificationService) NotifyPriceDrop(adID int, oldPrice, newPrice float64) error {
+	if newPrice >= oldPrice {
+		return nil
+	}
+
+	adObj, found := ad.GetAd(adID, nil)
+	if !found {
+		return fmt.Errorf("ad not found")
+	}
+
+	userIDs, err := ad.GetPriceDropAlertUserIDs(adID)
+	if err != nil {
+		return fmt.Errorf("failed to get bookmarking users: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		// Sellers don't need to hear about their own price changes
+		if userID == adObj.UserID {
+			continue
+		}
+		recipient, _, found := user.GetUserByID(userID)
+		if !found {
+			continue
+		}
+
+		switch recipient.NotificationMethod {
+		case user.NotificationMethodSMS:
+			err = n.sendPriceDropSMS(recipient.Phone, adObj.Title, oldPrice, newPrice, adID)
+		case user.NotificationMethodEmail:
+			if recipient.EmailAddress == nil {
+				err = fmt.Errorf("user has email notifications enabled but no email address")
+			} else {
+				err = n.sendPriceDropEmail(*recipient.EmailAddress, adObj.Title, oldPrice, newPrice, adID)
+			}
+		default:
+			log.Printf("Unknown notification method: %s for user %d", recipient.NotificationMethod, userID)
+			err = nil
+		}
+		if err != nil {
+			// Keep notifying the other bookmarkers
+			log.Printf("Price drop notification for ad %d failed for user %d: %v", adID, userID, err)
+		}
+	}
+	return nil
+}
+
+// NotifyAdExpired tells a seller that their ad expired and how to list it
+// again
+func (n *NotificationService) NotifyAdExpired(adID int) error {
+	adObj, found := ad.GetAd(adID, nil)
+	if !found {
+		return fmt.Errorf("ad not found")
+	}
+
+	seller, _, found := user.GetUserByID(adObj.UserID)
+	if !found {
+		return fmt.Errorf("seller not found")
+	}
+
+	switch seller.NotificationMethod {
+	case user.NotificationMethodSMS:
+		if n.smsService == nil {
+			return fmt.Errorf("SMS service not available")
+		}
+		if len(seller.Phone) < 10 {
+			return fmt.Errorf("invalid phone number format: %s", seller.Phone)
+		}
+		message := fmt.Sprintf("Your ad '%s' expired and was archived. Restore it to list it again: %s/my-ads",
+			adObj.Title, config.BaseURL)
+		_, err := n.smsService.SendGeneralMessage(seller.Phone, message)
+		return err
+	case user.NotificationMethodEmail:
+		if seller.EmailAddress == nil {
+			return fmt.Errorf("seller has email notifications enabled but no email address")
+		}
+		if n.emailService == nil {
+			return fmt.Errorf("email service not available")
+		}
+		return n.emailService.SendAdExpiredEmail(*seller.EmailAddress, adObj.Title)
+	default:
+		log.Printf("Unknown notification method: %s for user %d", seller.NotificationMethod, adObj.UserID)
+		return nil
+	}
+}
+
+// sendPriceDropSMS sends an SMS notification about a price drop
+func (n *NotificationService) sendPriceDropSMS(phoneNumber, adTitle string, oldPrice, newPrice float64, adID int) error {
+	if n.smsService == nil {
+		return fmt.Errorf("SMS service not available")
+	}
+
+	if len(phoneNumber) < 10 {
+		return fmt.Errorf("invalid phone number format: %s", phoneNumber)
+	}
+
+	message := fmt.Sprintf("Price drop on '%s': $%.2f -> $%.2f. View at: %s/ad/%d",
+		adTitle, oldPrice, newPrice, config.BaseURL, adID)
+
+	_, err := n.smsService.SendGeneralMessage(phoneNumber, message)
+	return err
+}
+
+// sendPriceDropEmail sends an email notification about a price drop
+func (n *NotificationService) sendPriceDropEmail(emailAddress, adTitle string, oldPrice, newPrice float64, adID int) error {
+	if n.emailService == nil {
+		return fmt.Errorf("email service not available")
+	}
+
+	return n.emailService.SendPriceDropEmail(emailAddress, adTitle, oldPrice, newPrice, adID)
+}
+
 // sendSMSNotification sends an SMS notification about a new message
 func (n *NotificationService) sendSMSNotification(phoneNumber, senderName, adTitle, messageContent string, conversationID int) error {
 	if n.smsService == nil {
@@ -0,0 +1,71 @@
+package part
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/db"
+)
+
+// AttributeSchema describes how the structured part attributes apply to a
+// subcategory. It is stored as JSON in PartSubCategory.attribute_schema;
+// subcategories without one treat every attribute as optional.
+type AttributeSchema struct {
+	Required   []string `json:"required,omitempty"`    // attribute names that must be filled in
+	Positions  []string `json:"positions,omitempty"`   // allowed side/position values, any of ad.Positions when empty
+	CoreCharge bool     `json:"core_charge,omitempty"` // part is commonly sold with a core charge
+}
+
+// IsRequired returns true if the schema requires the named attribute
+func (s AttributeSchema) IsRequired(attr string) bool {
+	for _, r := range s.Required {
+		if r == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedPositions returns the side/position values valid for the subcategory
+func (s AttributeSchema) AllowedPositions() []string {
+	if len(s.Positions) > 0 {
+		return s.Positions
+	}
+	return ad.Positions
+}
+
+// subCategorySchemas maps subcategory name -> attribute schema, guarded by
+// taxonomyMu
+var subCategorySchemas = make(map[string]AttributeSchema)
+
+// loadAttributeSchemas reads the attribute schemas defined on PartSubCategory
+func loadAttributeSchemas() (map[string]AttributeSchema, error) {
+	rows, err := db.Query("SELECT name, attribute_schema FROM PartSubCategory WHERE attribute_schema IS NOT NULL AND attribute_schema != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schemas := make(map[string]AttributeSchema)
+	for rows.Next() {
+		var name, raw string
+		if err := rows.Scan(&name, &raw); err != nil {
+			return nil, err
+		}
+		var schema AttributeSchema
+		if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+			log.Printf("[parts] Ignoring invalid attribute schema for subcategory %s: %v", name, err)
+			continue
+		}
+		schemas[name] = schema
+	}
+	return schemas, rows.Err()
+}
+
+// GetAttributeSchema returns the attribute schema for a subcategory
+func GetAttributeSchema(subCategoryName string) AttributeSchema {
+	taxonomyMu.RLock()
+	defer taxonomyMu.RUnlock()
+	return subCategorySchemas[subCategoryName]
+}
@@ -0,0 +1,249 @@
+package part
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/parts-pile/site/db"
+)
+
+// subCategoryRef names a subcategory by its category, or just a category
+// when SubCategory is empty
+type subCategoryRef struct {
+	Category    string
+	SubCategory string
+}
+
+// taxonomyIndex holds the lookups behind MatchCategory, MatchSubCategory and
+// ExpandQuery. Keys are normalized with normalizeTerm.
+type taxonomyIndex struct {
+	categories    map[string]string           // category name -> category
+	subCategories map[string][]subCategoryRef // subcategory name -> every category using it
+	aliases       map[string]subCategoryRef   // alias -> what it stands for
+	synonyms      map[string][]string         // term -> the other terms it's listed with
+	terms         []string                    // alias and synonym keys, longest first
+}
+
+// normalizeTerm lowercases a term and reduces punctuation and runs of
+// whitespace to single spaces, so "Brakes & Wheel Hub" and "brakes wheel hub"
+// match
+func normalizeTerm(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// loadTaxonomyIndex reads the aliases and synonyms and indexes them together
+// with the category and subcategory names
+func loadTaxonomyIndex(categories []string, subCategories map[string][]string) (*taxonomyIndex, error) {
+	aliases, err := GetAliases()
+	if err != nil {
+		return nil, err
+	}
+	synonyms, err := GetSynonyms()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &taxonomyIndex{
+		categories:    make(map[string]string, len(categories)),
+		subCategories: make(map[string][]subCategoryRef),
+		aliases:       make(map[string]subCategoryRef, len(aliases)),
+		synonyms:      make(map[string][]string),
+	}
+	for _, category := range categories {
+		index.categories[normalizeTerm(category)] = category
+		for _, sub := range subCategories[category] {
+			key := normalizeTerm(sub)
+			index.subCategories[key] = append(index.subCategories[key], subCategoryRef{category, sub})
+		}
+	}
+	for _, a := range aliases {
+		index.aliases[normalizeTerm(a.Alias)] = subCategoryRef{a.Category, a.SubCategory}
+	}
+	for _, s := range synonyms {
+		for _, term := range s.Terms {
+			key := normalizeTerm(term)
+			for _, other := range s.Terms {
+				if normalizeTerm(other) != key {
+					index.synonyms[key] = append(index.synonyms[key], other)
+				}
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for key := range index.aliases {
+		seen[key] = true
+	}
+	for key := range index.synonyms {
+		seen[key] = true
+	}
+	for key := range seen {
+		if key != "" {
+			index.terms = append(index.terms, key)
+		}
+	}
+	sort.Slice(index.terms, func(i, j int) bool {
+		if len(index.terms[i]) != len(index.terms[j]) {
+			return len(index.terms[i]) > len(index.terms[j])
+		}
+		return index.terms[i] < index.terms[j]
+	})
+	return index, nil
+}
+
+func currentTaxonomy() *taxonomyIndex {
+	taxonomyMu.RLock()
+	defer taxonomyMu.RUnlock()
+	return taxonomy
+}
+
+// candidates returns what a typed term could mean: the term itself, then
+// each of its synonyms
+func (t *taxonomyIndex) candidates(typed string) []string {
+	key := normalizeTerm(typed)
+	if key == "" {
+		return nil
+	}
+	keys := []string{key}
+	for _, s := range t.synonyms[key] {
+		keys = append(keys, normalizeTerm(s))
+	}
+	return keys
+}
+
+// MatchCategory resolves what a seller typed to a category, by name, alias
+// or a synonym of either
+func MatchCategory(typed string) (string, bool) {
+	t := currentTaxonomy()
+	for _, key := range t.candidates(typed) {
+		if category, ok := t.categories[key]; ok {
+			return category, true
+		}
+		if a, ok := t.aliases[key]; ok {
+			return a.Category, true
+		}
+	}
+	return "", false
+}
+
+// MatchSubCategory resolves a typed category and subcategory to the ones in
+// the taxonomy. The subcategory is matched by name, alias or a synonym of
+// either; a name used by a single category is accepted whatever category was
+// typed, so the category may be left blank.
+func MatchSubCategory(category, subCategory string) (string, string, bool) {
+	t := currentTaxonomy()
+	matchedCategory, _ := MatchCategory(category)
+	for _, key := range t.candidates(subCategory) {
+		refs := t.subCategories[key]
+		for _, ref := range refs {
+			if ref.Category == matchedCategory {
+				return ref.Category, ref.SubCategory, true
+			}
+		}
+		if a, ok := t.aliases[key]; ok && a.SubCategory != "" {
+			return a.Category, a.SubCategory, true
+		}
+		if len(refs) == 1 {
+			return refs[0].Category, refs[0].SubCategory, true
+		}
+	}
+	return "", "", false
+}
+
+// ExpandQuery adds what the aliases and synonyms in a search query stand
+// for, so "genny for civic" also finds ads filed under Alternator. Queries
+// without any come back unchanged.
+func ExpandQuery(query string) string {
+	t := currentTaxonomy()
+	text := " " + normalizeTerm(query) + " "
+	if strings.TrimSpace(text) == "" {
+		return query
+	}
+
+	var extra []string
+	add := func(term string) {
+		key := " " + normalizeTerm(term) + " "
+		if strings.Contains(text, key) {
+			return
+		}
+		text += key[1:]
+		extra = append(extra, term)
+	}
+	for _, key := range t.terms {
+		if !strings.Contains(text, " "+key+" ") {
+			continue
+		}
+		if a, ok := t.aliases[key]; ok {
+			if a.SubCategory != "" {
+				add(a.SubCategory)
+			} else {
+				add(a.Category)
+			}
+		}
+		for _, s := range t.synonyms[key] {
+			add(s)
+		}
+	}
+	if len(extra) == 0 {
+		return query
+	}
+	return query + " (" + strings.Join(extra, ", ") + ")"
+}
+
+// GetAliases returns every alias with the category or subcategory it names
+func GetAliases() ([]Alias, error) {
+	query := `
+		SELECT pa.id, pa.alias,
+			COALESCE(pc.name, spc.name, '') AS category,
+			COALESCE(psc.name, '') AS subcategory
+		FROM PartAlias pa
+		LEFT JOIN PartCategory pc ON pa.category_id = pc.id
+		LEFT JOIN PartSubCategory psc ON pa.subcategory_id = psc.id
+		LEFT JOIN PartCategory spc ON psc.category_id = spc.id
+		ORDER BY pa.alias
+	`
+	var aliases []Alias
+	err := db.Select(&aliases, query)
+	return aliases, err
+}
+
+// GetSynonyms returns every synonym list
+func GetSynonyms() ([]Synonym, error) {
+	rows, err := db.Query("SELECT id, terms FROM PartSynonym ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var synonyms []Synonym
+	for rows.Next() {
+		var s Synonym
+		var terms string
+		if err := rows.Scan(&s.ID, &terms); err != nil {
+			return nil, err
+		}
+		s.Terms = splitTerms(terms)
+		synonyms = append(synonyms, s)
+	}
+	return synonyms, rows.Err()
+}
+
+// splitTerms splits a comma-separated synonym list, dropping blanks and
+// repeats
+func splitTerms(s string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range strings.Split(s, ",") {
+		term = strings.Join(strings.Fields(term), " ")
+		key := normalizeTerm(term)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		terms = append(terms, term)
+	}
+	return terms
+}
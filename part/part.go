@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/parts-pile/site/ad"
 	"github.com/parts-pile/site/db"
@@ -23,12 +24,16 @@ type SubCategory struct {
 }
 
 var (
-	// Simple maps for static data that never changes
+	// The taxonomy is read from the database at startup and reloaded
+	// whenever an admin edits it, so readers take taxonomyMu
+	taxonomyMu       sync.RWMutex
 	allCategories    []string
 	allSubCategories = make(map[string][]string) // category -> subcategories
+	taxonomy         = &taxonomyIndex{}          // aliases and synonyms
 )
 
-// Initialize parts static data
+// InitPartsData loads the categories, subcategories, attribute schemas,
+// aliases and synonyms. Admin edits call it again to pick up their changes.
 func InitPartsData() error {
 	// Load all categories
 	categories, err := GetAllCategories()
@@ -36,40 +41,62 @@ func InitPartsData() error {
 		return fmt.Errorf("failed to load categories: %w", err)
 	}
 
-	allCategories = make([]string, len(categories))
+	categoryNames := make([]string, len(categories))
 	for i, cat := range categories {
-		allCategories[i] = cat.Name
+		categoryNames[i] = cat.Name
 	}
 
 	// Load subcategories for each category
-	for _, categoryName := range allCategories {
-		subCategories, err := GetSubCategoriesForCategory(categoryName)
+	subCategories := make(map[string][]string, len(categoryNames))
+	for _, categoryName := range categoryNames {
+		subCats, err := GetSubCategoriesForCategory(categoryName)
 		if err != nil {
 			continue
 		}
 
-		subCategoryNames := make([]string, len(subCategories))
-		for i, subCat := range subCategories {
+		subCategoryNames := make([]string, len(subCats))
+		for i, subCat := range subCats {
 			subCategoryNames[i] = subCat.Name
 		}
-		allSubCategories[categoryName] = subCategoryNames
+		subCategories[categoryName] = subCategoryNames
 	}
 
-	log.Printf("[parts] Static data loaded - %d categories", len(allCategories))
+	schemas, err := loadAttributeSchemas()
+	if err != nil {
+		return fmt.Errorf("failed to load attribute schemas: %w", err)
+	}
+
+	index, err := loadTaxonomyIndex(categoryNames, subCategories)
+	if err != nil {
+		return fmt.Errorf("failed to load aliases and synonyms: %w", err)
+	}
+
+	taxonomyMu.Lock()
+	allCategories = categoryNames
+	allSubCategories = subCategories
+	subCategorySchemas = schemas
+	taxonomy = index
+	taxonomyMu.Unlock()
+
+	log.Printf("[parts] Static data loaded - %d categories", len(categoryNames))
 	return nil
 }
 
 // ============================================================================
-// STATIC DATA FUNCTIONS (No cache needed - loaded once)
+// STATIC DATA FUNCTIONS (No cache needed - reloaded on admin edits)
 // ============================================================================
 
-// GetCategories returns all categories (static data, no cache needed)
+// GetCategories returns all categories
 func GetCategories() []string {
+	taxonomyMu.RLock()
+	defer taxonomyMu.RUnlock()
 	return allCategories
 }
 
-// GetSubCategories returns all subcategories for a category (static data, no cache needed)
+// GetSubCategories returns all subcategories for a category
 func GetSubCategories(categoryName string) []string {
+	taxonomyMu.RLock()
+	defer taxonomyMu.RUnlock()
 	return allSubCategories[categoryName]
 }
 
@@ -127,6 +154,22 @@ func GetSubCategoryIDByName(subcategoryName string) (int, error) {
 	return id, nil
 }
 
+// GetSubCategoryID returns the ID of a subcategory within a category
+func GetSubCategoryID(categoryName, subcategoryName string) (int, error) {
+	query := `
+		SELECT psc.id
+		FROM PartSubCategory psc
+		JOIN PartCategory pc ON psc.category_id = pc.id
+		WHERE pc.name = ? AND psc.name = ?
+	`
+	var id int
+	err := db.QueryRow(query, categoryName, subcategoryName).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
 func GetMakes(query string) ([]string, error) {
 	// If there's a search query, filter makes based on matching ads
 	if query != "" {
@@ -539,6 +582,7 @@ func GetAdsForNode(parts []string, q string) ([]ad.Ad, error) {
 			ads[i].Years = fullAd.Years
 			ads[i].Models = fullAd.Models
 			ads[i].Engines = fullAd.Engines
+			ads[i].Fitment = fullAd.Fitment
 		}
 	}
 
@@ -699,6 +743,7 @@ func GetAdsForNodeStructured(parts []string, sq ad.SearchQuery, userID int) ([]a
 			adObj.Years = fullAd.Years
 			adObj.Models = fullAd.Models
 			adObj.Engines = fullAd.Engines
+			adObj.Fitment = fullAd.Fitment
 		}
 		ads = append(ads, adObj)
 	}
@@ -857,7 +902,7 @@ func GetAdsForTreeView(parts []string, sq ad.SearchQuery, userID int) ([]ad.Ad,
 		}
 
 		// Get vehicle data directly to avoid overwriting bookmark status
-		adObj.Make, adObj.Years, adObj.Models, adObj.Engines = ad.GetVehicleData(adID)
+		adObj.SetFitment(ad.GetVehicleData(adID))
 		ads = append(ads, adObj)
 	}
 
@@ -967,13 +1012,15 @@ func GetSubCategoriesForAdIDs(adIDs []int, makeName, year, model, engine, catego
 // NEW TREE VIEW FUNCTIONS - Browse mode (when adIDs is nil/empty)
 // ============================================================================
 
-// GetMakesForAll returns all makes that have ads
+// GetMakesForAll returns all makes that have active ads not hidden by moderation
 func GetMakesForAll() ([]string, error) {
 	query := `
 		SELECT DISTINCT m.name
 		FROM Make m
 		JOIN Car c ON m.id = c.make_id
 		JOIN AdCar ac ON c.id = ac.car_id
+		JOIN Ad a ON ac.ad_id = a.id
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL
 		ORDER BY m.name
 	`
 	var makes []string
@@ -981,7 +1028,7 @@ func GetMakesForAll() ([]string, error) {
 	return makes, err
 }
 
-// GetYearsForAll returns all years for a specific make
+// GetYearsForAll returns all years for a specific make with active, visible ads
 func GetYearsForAll(makeName string) ([]string, error) {
 	query := `
 		SELECT DISTINCT y.year
@@ -989,7 +1036,8 @@ func GetYearsForAll(makeName string) ([]string, error) {
 		JOIN Car c ON y.id = c.year_id
 		JOIN Make m ON c.make_id = m.id
 		JOIN AdCar ac ON c.id = ac.car_id
-		WHERE m.name = ?
+		JOIN Ad a ON ac.ad_id = a.id
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL AND m.name = ?
 		ORDER BY y.year DESC
 	`
 	var yearInts []int
@@ -1005,7 +1053,7 @@ func GetYearsForAll(makeName string) ([]string, error) {
 	return years, nil
 }
 
-// GetModelsForAll returns all models for a specific make/year
+// GetModelsForAll returns all models for a specific make/year with active, visible ads
 func GetModelsForAll(makeName, year string) ([]string, error) {
 	query := `
 		SELECT DISTINCT mo.name
@@ -1014,7 +1062,8 @@ func GetModelsForAll(makeName, year string) ([]string, error) {
 		JOIN Make m ON c.make_id = m.id
 		JOIN Year y ON c.year_id = y.id
 		JOIN AdCar ac ON c.id = ac.car_id
-		WHERE m.name = ? AND y.year = ?
+		JOIN Ad a ON ac.ad_id = a.id
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL AND m.name = ? AND y.year = ?
 		ORDER BY mo.name
 	`
 	var models []string
@@ -1022,7 +1071,7 @@ func GetModelsForAll(makeName, year string) ([]string, error) {
 	return models, err
 }
 
-// GetEnginesForAll returns all engines for a specific make/year/model
+// GetEnginesForAll returns all engines for a specific make/year/model with active, visible ads
 func GetEnginesForAll(makeName, year, model string) ([]string, error) {
 	query := `
 		SELECT DISTINCT e.name
@@ -1032,7 +1081,8 @@ func GetEnginesForAll(makeName, year, model string) ([]string, error) {
 		JOIN Year y ON c.year_id = y.id
 		JOIN Model mo ON c.model_id = mo.id
 		JOIN AdCar ac ON c.id = ac.car_id
-		WHERE m.name = ? AND y.year = ? AND mo.name = ?
+		JOIN Ad a ON ac.ad_id = a.id
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL AND m.name = ? AND y.year = ? AND mo.name = ?
 		ORDER BY e.name
 	`
 	var engines []string
@@ -1040,7 +1090,8 @@ func GetEnginesForAll(makeName, year, model string) ([]string, error) {
 	return engines, err
 }
 
-// GetCategoriesAll returns all categories for a specific make/year/model/engine
+// GetCategoriesAll returns all categories with active, visible ads for a specific make/year/model/engine.
+// An empty engine matches all of the model's engines.
 func GetCategoriesAll(makeName, year, model, engine string) ([]string, error) {
 	makeName, _ = url.QueryUnescape(makeName)
 	year, _ = url.QueryUnescape(year)
@@ -1058,15 +1109,21 @@ func GetCategoriesAll(makeName, year, model, engine string) ([]string, error) {
 		JOIN Year y ON c.year_id = y.id
 		JOIN Model mo ON c.model_id = mo.id
 		JOIN Engine e ON c.engine_id = e.id
-		WHERE m.name = ? AND y.year = ? AND mo.name = ? AND e.name = ?
-		ORDER BY pc.name
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL AND m.name = ? AND y.year = ? AND mo.name = ?
 	`
+	args := []interface{}{makeName, year, model}
+	if engine != "" {
+		query += " AND e.name = ?"
+		args = append(args, engine)
+	}
+	query += " ORDER BY pc.name"
 	var categories []string
-	err := db.Select(&categories, query, makeName, year, model, engine)
+	err := db.Select(&categories, query, args...)
 	return categories, err
 }
 
-// GetSubCategoriesForAll returns all subcategories for a specific make/year/model/engine/category
+// GetSubCategoriesForAll returns all subcategories with active, visible ads for a specific make/year/model/engine/category.
+// An empty engine matches all of the model's engines.
 func GetSubCategoriesForAll(makeName, year, model, engine, category string) ([]string, error) {
 	makeName, _ = url.QueryUnescape(makeName)
 	year, _ = url.QueryUnescape(year)
@@ -1085,10 +1142,15 @@ func GetSubCategoriesForAll(makeName, year, model, engine, category string) ([]s
 		JOIN Year y ON c.year_id = y.id
 		JOIN Model mo ON c.model_id = mo.id
 		JOIN Engine e ON c.engine_id = e.id
-		WHERE m.name = ? AND y.year = ? AND mo.name = ? AND e.name = ? AND pc.name = ?
-		ORDER BY psc.name
+		WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL AND m.name = ? AND y.year = ? AND mo.name = ? AND pc.name = ?
 	`
+	args := []interface{}{makeName, year, model, category}
+	if engine != "" {
+		query += " AND e.name = ?"
+		args = append(args, engine)
+	}
+	query += " ORDER BY psc.name"
 	var subCategories []string
-	err := db.Select(&subCategories, query, makeName, year, model, engine, category)
+	err := db.Select(&subCategories, query, args...)
 	return subCategories, err
 }
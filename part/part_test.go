@@ -6,6 +6,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 	"github.com/parts-pile/site/db"
+	"github.com/parts-pile/site/db/dbtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -158,3 +159,17 @@ func TestGetSubCategoriesForCategory_EmptyResult(t *testing.T) {
 	assert.Len(t, subCategories, 0)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestGetMakesForAll_SkipsHiddenAds(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	// Makes whose only ads are archived or hidden by moderation aren't listed
+	mock.ExpectQuery("JOIN Ad a ON ac.ad_id = a.id\\s+WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Ford"))
+
+	makes, err := GetMakesForAll()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Ford"}, makes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
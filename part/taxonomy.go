@@ -0,0 +1,487 @@
+package part
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// ErrNotFound is returned when the category, subcategory, alias or synonym
+// list being edited no longer exists
+var ErrNotFound = errors.New("taxonomy entry not found")
+
+// Alias is another name for a category or subcategory. SubCategory is empty
+// for category aliases.
+type Alias struct {
+	ID          int    `db:"id"`
+	Alias       string `db:"alias"`
+	Category    string `db:"category"`
+	SubCategory string `db:"subcategory"`
+}
+
+// Synonym is a list of words that mean the same part
+type Synonym struct {
+	ID    int
+	Terms []string
+}
+
+// TaxonomyCategory is a category with its subcategories, for the admin page
+type TaxonomyCategory struct {
+	ID            int
+	Name          string
+	SubCategories []TaxonomySubCategory
+}
+
+// TaxonomySubCategory is a subcategory with the number of live ads filed
+// under it
+type TaxonomySubCategory struct {
+	ID   int
+	Name string
+	Ads  int
+}
+
+// GetTaxonomy returns every category with its subcategories
+func GetTaxonomy() ([]TaxonomyCategory, error) {
+	rows, err := db.Query(`
+		SELECT pc.id, pc.name, psc.id, psc.name,
+			(SELECT COUNT(*) FROM Ad a WHERE a.subcategory_id = psc.id AND a.deleted_at IS NULL)
+		FROM PartCategory pc
+		LEFT JOIN PartSubCategory psc ON psc.category_id = pc.id
+		ORDER BY pc.name, psc.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []TaxonomyCategory
+	for rows.Next() {
+		var (
+			categoryID int
+			category   string
+			subID      sql.NullInt64
+			subName    sql.NullString
+			ads        int
+		)
+		if err := rows.Scan(&categoryID, &category, &subID, &subName, &ads); err != nil {
+			return nil, err
+		}
+		if len(categories) == 0 || categories[len(categories)-1].ID != categoryID {
+			categories = append(categories, TaxonomyCategory{ID: categoryID, Name: category})
+		}
+		if subID.Valid {
+			last := &categories[len(categories)-1]
+			last.SubCategories = append(last.SubCategories, TaxonomySubCategory{ID: int(subID.Int64), Name: subName.String, Ads: ads})
+		}
+	}
+	return categories, rows.Err()
+}
+
+// reloadTaxonomy refreshes the in-memory taxonomy after an admin edit. The
+// edit is already committed, so a failure is only logged.
+func reloadTaxonomy() {
+	if err := InitPartsData(); err != nil {
+		log.Printf("[parts] Failed to reload taxonomy: %v", err)
+	}
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+func cleanTaxonomyName(what, name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("%s name is required", what)
+	}
+	return name, nil
+}
+
+// aliasTaken reports whether a name is already used as an alias
+func aliasTaken(tx *sql.Tx, alias string) (bool, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM PartAlias WHERE alias = ?", alias).Scan(&n)
+	return n > 0, err
+}
+
+// markSubCategoryAds flags the live ads filed under a subcategory for
+// re-embedding, since their category names are part of the indexed ad
+func markSubCategoryAds(tx *sql.Tx, where string, id int) (int, error) {
+	res, err := tx.Exec(`UPDATE Ad SET has_vector = 0, updated_at = ?
+		WHERE deleted_at IS NULL AND subcategory_id IN (SELECT id FROM PartSubCategory WHERE `+where+` = ?)`,
+		now(), id)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// AddCategory adds a category
+func AddCategory(name string) (int, error) {
+	name, err := cleanTaxonomyName("category", name)
+	if err != nil {
+		return 0, err
+	}
+	var existing int
+	if err := db.QueryRow("SELECT COUNT(*) FROM PartCategory WHERE name = ? COLLATE NOCASE", name).Scan(&existing); err != nil {
+		return 0, err
+	}
+	if existing > 0 {
+		return 0, fmt.Errorf("category %q already exists", name)
+	}
+	res, err := db.Exec("INSERT INTO PartCategory (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	reloadTaxonomy()
+	return int(id), nil
+}
+
+// RenameCategory renames a category and flags its ads for re-embedding; it
+// returns how many
+func RenameCategory(id int, name string) (int, error) {
+	name, err := cleanTaxonomyName("category", name)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM PartCategory WHERE name = ? COLLATE NOCASE AND id != ?", name, id).Scan(&existing); err != nil {
+		return 0, err
+	}
+	if existing > 0 {
+		return 0, fmt.Errorf("category %q already exists", name)
+	}
+	res, err := tx.Exec("UPDATE PartCategory SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, ErrNotFound
+	}
+	ads, err := markSubCategoryAds(tx, "category_id", id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	reloadTaxonomy()
+	return ads, nil
+}
+
+// DeleteCategory deletes an empty category and its aliases. Categories that
+// still have subcategories are refused; move or merge those first.
+func DeleteCategory(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var subCategories int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM PartSubCategory WHERE category_id = ?", id).Scan(&subCategories); err != nil {
+		return err
+	}
+	if subCategories > 0 {
+		return fmt.Errorf("category still has %d subcategories; move or merge them first", subCategories)
+	}
+	if _, err := tx.Exec("DELETE FROM PartAlias WHERE category_id = ?", id); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM PartCategory WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	reloadTaxonomy()
+	return nil
+}
+
+// subCategoryNameTaken reports whether a category already has a subcategory
+// with the name, other than the one being edited
+func subCategoryNameTaken(tx *sql.Tx, categoryID int, name string, id int) (bool, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM PartSubCategory WHERE category_id = ? AND name = ? COLLATE NOCASE AND id != ?",
+		categoryID, name, id).Scan(&n)
+	return n > 0, err
+}
+
+// AddSubCategory adds a subcategory to a category
+func AddSubCategory(categoryID int, name string) (int, error) {
+	name, err := cleanTaxonomyName("subcategory", name)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var categories int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM PartCategory WHERE id = ?", categoryID).Scan(&categories); err != nil {
+		return 0, err
+	}
+	if categories == 0 {
+		return 0, ErrNotFound
+	}
+	taken, err := subCategoryNameTaken(tx, categoryID, name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, fmt.Errorf("subcategory %q already exists in that category", name)
+	}
+	res, err := tx.Exec("INSERT INTO PartSubCategory (category_id, name) VALUES (?, ?)", categoryID, name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	reloadTaxonomy()
+	return int(id), nil
+}
+
+// RenameSubCategory renames a subcategory and flags its ads for
+// re-embedding; it returns how many
+func RenameSubCategory(id int, name string) (int, error) {
+	name, err := cleanTaxonomyName("subcategory", name)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var categoryID int
+	err = tx.QueryRow("SELECT category_id FROM PartSubCategory WHERE id = ?", id).Scan(&categoryID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	taken, err := subCategoryNameTaken(tx, categoryID, name, id)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, fmt.Errorf("subcategory %q already exists in that category; merge into it instead", name)
+	}
+	if _, err := tx.Exec("UPDATE PartSubCategory SET name = ? WHERE id = ?", name, id); err != nil {
+		return 0, err
+	}
+	ads, err := markSubCategoryAds(tx, "id", id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	reloadTaxonomy()
+	return ads, nil
+}
+
+// MoveSubCategory moves a subcategory, with its ads, under another category.
+// The ads are flagged for re-embedding; it returns how many.
+func MoveSubCategory(id, categoryID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM PartSubCategory WHERE id = ?", id).Scan(&name)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	var categories int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM PartCategory WHERE id = ?", categoryID).Scan(&categories); err != nil {
+		return 0, err
+	}
+	if categories == 0 {
+		return 0, ErrNotFound
+	}
+	taken, err := subCategoryNameTaken(tx, categoryID, name, id)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, fmt.Errorf("that category already has a %q subcategory; merge into it instead", name)
+	}
+	if _, err := tx.Exec("UPDATE PartSubCategory SET category_id = ? WHERE id = ?", categoryID, id); err != nil {
+		return 0, err
+	}
+	ads, err := markSubCategoryAds(tx, "id", id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	reloadTaxonomy()
+	return ads, nil
+}
+
+// MergeSubCategory folds one subcategory into another: its ads and aliases
+// are re-linked, its name becomes an alias of the target so sellers typing it
+// still land there, and it is deleted. The ads are flagged for re-embedding;
+// it returns how many.
+func MergeSubCategory(fromID, intoID int) (int, error) {
+	if fromID == intoID {
+		return 0, fmt.Errorf("can't merge a subcategory into itself")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var fromName, intoName string
+	err = tx.QueryRow("SELECT name FROM PartSubCategory WHERE id = ?", fromID).Scan(&fromName)
+	if err == nil {
+		err = tx.QueryRow("SELECT name FROM PartSubCategory WHERE id = ?", intoID).Scan(&intoName)
+	}
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	ads, err := markSubCategoryAds(tx, "id", fromID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE Ad SET subcategory_id = ? WHERE subcategory_id = ?", intoID, fromID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE PartAlias SET subcategory_id = ? WHERE subcategory_id = ?", intoID, fromID); err != nil {
+		return 0, err
+	}
+	if !strings.EqualFold(fromName, intoName) {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO PartAlias (alias, subcategory_id, created_at) VALUES (?, ?, ?)",
+			fromName, intoID, now()); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM PartSubCategory WHERE id = ?", fromID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	reloadTaxonomy()
+	return ads, nil
+}
+
+// AddAlias adds another name for a category, or for a subcategory when
+// subCategoryID is set
+func AddAlias(categoryID, subCategoryID int, alias string) error {
+	alias, err := cleanTaxonomyName("alias", alias)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	taken, err := aliasTaken(tx, alias)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return fmt.Errorf("%q is already an alias", alias)
+	}
+	if subCategoryID != 0 {
+		_, err = tx.Exec("INSERT INTO PartAlias (alias, subcategory_id, created_at) VALUES (?, ?, ?)", alias, subCategoryID, now())
+	} else {
+		_, err = tx.Exec("INSERT INTO PartAlias (alias, category_id, created_at) VALUES (?, ?, ?)", alias, categoryID, now())
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	reloadTaxonomy()
+	return nil
+}
+
+// DeleteAlias deletes an alias
+func DeleteAlias(id int) error {
+	res, err := db.Exec("DELETE FROM PartAlias WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	reloadTaxonomy()
+	return nil
+}
+
+// AddSynonyms adds a comma-separated list of words that mean the same part
+func AddSynonyms(terms string) error {
+	list := splitTerms(terms)
+	if len(list) < 2 {
+		return fmt.Errorf("list at least two different words, separated by commas")
+	}
+	if _, err := db.Exec("INSERT INTO PartSynonym (terms, created_at) VALUES (?, ?)", strings.Join(list, ", "), now()); err != nil {
+		return err
+	}
+	reloadTaxonomy()
+	return nil
+}
+
+// DeleteSynonyms deletes a synonym list
+func DeleteSynonyms(id int) error {
+	res, err := db.Exec("DELETE FROM PartSynonym WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	reloadTaxonomy()
+	return nil
+}
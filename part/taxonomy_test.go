@@ -0,0 +1,177 @@
+package part
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTaxonomy indexes a small taxonomy for the matching tests
+func useTaxonomy(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectQuery("SELECT pa.id, pa.alias").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "category", "subcategory"}).
+			AddRow(1, "genny", "Electrical", "Alternator").
+			AddRow(2, "Elec", "Electrical", ""))
+	mock.ExpectQuery("SELECT id, terms FROM PartSynonym ORDER BY id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "terms"}).
+			AddRow(1, "alt, genny").
+			AddRow(2, "rotor, disc, brake disc"))
+
+	index, err := loadTaxonomyIndex(
+		[]string{"Brakes & Wheel Hub", "Electrical"},
+		map[string][]string{
+			"Brakes & Wheel Hub": {"Brake Disc"},
+			"Electrical":         {"Alternator", "Battery"},
+		})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	old := taxonomy
+	taxonomy = index
+	t.Cleanup(func() { taxonomy = old })
+}
+
+func TestMatchCategory(t *testing.T) {
+	useTaxonomy(t)
+
+	category, ok := MatchCategory("brakes wheel hub")
+	assert.True(t, ok)
+	assert.Equal(t, "Brakes & Wheel Hub", category)
+
+	category, ok = MatchCategory("elec")
+	assert.True(t, ok)
+	assert.Equal(t, "Electrical", category)
+
+	_, ok = MatchCategory("Exhaust")
+	assert.False(t, ok)
+}
+
+func TestMatchSubCategory(t *testing.T) {
+	useTaxonomy(t)
+
+	tests := []struct {
+		category, subCategory string
+		wantCategory, wantSub string
+	}{
+		{"Electrical", "battery", "Electrical", "Battery"},
+		{"", "Genny", "Electrical", "Alternator"},
+		{"", "alt", "Electrical", "Alternator"},                          // synonym of an alias
+		{"Electrical", "Brake Disc", "Brakes & Wheel Hub", "Brake Disc"}, // only one category uses the name
+		{"", "rotor", "Brakes & Wheel Hub", "Brake Disc"},                // synonym of a name
+	}
+	for _, tt := range tests {
+		category, sub, ok := MatchSubCategory(tt.category, tt.subCategory)
+		assert.True(t, ok, tt.subCategory)
+		assert.Equal(t, tt.wantCategory, category, tt.subCategory)
+		assert.Equal(t, tt.wantSub, sub, tt.subCategory)
+	}
+
+	_, _, ok := MatchSubCategory("Electrical", "tranny")
+	assert.False(t, ok)
+}
+
+func TestExpandQuery(t *testing.T) {
+	useTaxonomy(t)
+
+	assert.Equal(t, "genny for civic (Alternator, alt)", ExpandQuery("genny for civic"))
+	assert.Equal(t, "front brake disc (rotor)", ExpandQuery("front brake disc"), "words already in the query are not repeated")
+	assert.Equal(t, "alternator", ExpandQuery("alternator"))
+	assert.Equal(t, "generator", ExpandQuery("generator"), "only whole words expand")
+}
+
+func TestSplitTerms(t *testing.T) {
+	assert.Equal(t, []string{"rotor", "brake disc"}, splitTerms(" rotor ,brake   disc,, Rotor"))
+}
+
+func TestAddSynonyms_NeedsTwoTerms(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	err := AddSynonyms("rotor, Rotor")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteCategory_WithSubCategories(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM PartSubCategory WHERE category_id = \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectRollback()
+
+	err := DeleteCategory(3)
+	assert.ErrorContains(t, err, "still has 2 subcategories")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMoveSubCategory_NameTaken(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM PartSubCategory WHERE id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Rotor"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM PartCategory WHERE id = \\?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM PartSubCategory WHERE category_id = \\? AND name = \\? COLLATE NOCASE AND id != \\?").
+		WithArgs(2, "Rotor", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	_, err := MoveSubCategory(5, 2)
+	assert.ErrorContains(t, err, "merge into it instead")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeSubCategory(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM PartSubCategory WHERE id = \\?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Rotor"))
+	mock.ExpectQuery("SELECT name FROM PartSubCategory WHERE id = \\?").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Brake Disc"))
+	mock.ExpectExec("UPDATE Ad SET has_vector = 0, updated_at = \\?").
+		WithArgs(sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE Ad SET subcategory_id = \\? WHERE subcategory_id = \\?").
+		WithArgs(4, 5).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("UPDATE PartAlias SET subcategory_id = \\? WHERE subcategory_id = \\?").
+		WithArgs(4, 5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT OR IGNORE INTO PartAlias \\(alias, subcategory_id, created_at\\)").
+		WithArgs("Rotor", 4, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM PartSubCategory WHERE id = \\?").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// The reload afterwards reads the taxonomy back
+	mock.ExpectQuery("SELECT id, name FROM PartCategory ORDER BY name").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectQuery("SELECT name, attribute_schema FROM PartSubCategory").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "attribute_schema"}))
+	mock.ExpectQuery("SELECT pa.id, pa.alias").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "alias", "category", "subcategory"}))
+	mock.ExpectQuery("SELECT id, terms FROM PartSynonym ORDER BY id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "terms"}))
+
+	ads, err := MergeSubCategory(5, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, ads)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeSubCategory_IntoItself(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	_, err := MergeSubCategory(4, 4)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
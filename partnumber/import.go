@@ -0,0 +1,165 @@
+package partnumber
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/parts-pile/site/db"
+)
+
+// ImportColumns are the CSV columns Import understands. Only number is
+// required; the header row may list them in any order.
+//
+//   - number, brand, kind (oem or aftermarket), description
+//   - make, year, model, engine: a car the number fits. year may be a range
+//     such as 2003-2007, and a blank engine means every engine.
+//   - interchanges, supersedes: other numbers, separated by semicolons
+//
+// Repeat a number on more rows to list more cars.
+var ImportColumns = []string{"number", "brand", "kind", "description", "make", "year", "model", "engine", "interchanges", "supersedes"}
+
+// ImportReport counts what an import added. Rows that couldn't be used are
+// described in Warnings and skipped.
+type ImportReport struct {
+	Rows     int
+	Numbers  int // part numbers added
+	Cars     int // cars part numbers were newly listed for
+	Links    int // interchanges and supersessions added
+	Warnings []string
+}
+
+// Summary describes the report for the admin
+func (r ImportReport) Summary() string {
+	return fmt.Sprintf("Read %d rows: %d part numbers, %d cars and %d links added, %d warnings.",
+		r.Rows, r.Numbers, r.Cars, r.Links, len(r.Warnings))
+}
+
+// splitNumbers splits a semicolon-separated list of part numbers
+func splitNumbers(s string) []string {
+	var numbers []string
+	for _, n := range strings.Split(s, ";") {
+		if n = strings.TrimSpace(n); n != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// Import reads part numbers, their cars and their links from CSV in one
+// transaction. It only adds: importing the same file twice changes nothing
+// the second time. A malformed file writes nothing.
+func Import(r io.Reader) (ImportReport, error) {
+	var report ImportReport
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return report, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		return report, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["number"]; !ok {
+		return report, fmt.Errorf("the header row has no number column")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+		line++
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+		report.Rows++
+		warn := func(format string, args ...interface{}) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+		}
+
+		id, added, err := ensure(tx, field("number"), field("brand"), Kind(strings.ToLower(field("kind"))), field("description"))
+		if err != nil {
+			warn("%v", err)
+			continue
+		}
+		if added {
+			report.Numbers++
+		}
+
+		if makeName, year, model := field("make"), field("year"), field("model"); makeName != "" || year != "" || model != "" {
+			yearFrom, yearTo, err := ParseYears(year)
+			switch {
+			case makeName == "" || model == "":
+				warn("a car needs a make, year and model")
+			case err != nil:
+				warn("%v", err)
+			default:
+				spec := CarSpec{Make: makeName, YearFrom: yearFrom, YearTo: yearTo, Model: model, Engine: field("engine")}
+				matched, newCars, err := addCars(tx, id, spec)
+				if err != nil {
+					return report, err
+				}
+				if matched == 0 {
+					warn("no %s %s %s in the catalog", year, makeName, model)
+				}
+				report.Cars += newCars
+			}
+		}
+
+		for _, kind := range []LinkKind{LinkInterchange, LinkSupersedes} {
+			column := "interchanges"
+			if kind == LinkSupersedes {
+				column = "supersedes"
+			}
+			for _, other := range splitNumbers(field(column)) {
+				otherID, added, err := ensure(tx, other, "", "", "")
+				if err != nil {
+					warn("%v", err)
+					continue
+				}
+				if added {
+					report.Numbers++
+				}
+				if otherID == id {
+					continue
+				}
+				linked, err := link(tx, id, otherID, kind)
+				if err != nil {
+					return report, err
+				}
+				if linked {
+					report.Links++
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
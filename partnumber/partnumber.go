@@ -0,0 +1,560 @@
+// Package partnumber keeps the OEM and aftermarket part number interchange:
+// which cars each number fits, and which numbers interchange with or
+// supersede each other.
+package partnumber
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/db"
+)
+
+// Kind is who makes the part a number belongs to
+type Kind string
+
+const (
+	KindOEM         Kind = "oem"
+	KindAftermarket Kind = "aftermarket"
+)
+
+// Kinds lists the part number kinds in display order
+var Kinds = []Kind{KindOEM, KindAftermarket}
+
+// IsValid returns true for the known kinds
+func (k Kind) IsValid() bool {
+	return k == KindOEM || k == KindAftermarket
+}
+
+// Label returns the kind for display
+func (k Kind) Label() string {
+	if k == KindAftermarket {
+		return "Aftermarket"
+	}
+	return "OEM"
+}
+
+// LinkKind is how two part numbers relate
+type LinkKind string
+
+const (
+	// LinkInterchange numbers fit the same vehicles in either direction
+	LinkInterchange LinkKind = "interchange"
+	// LinkSupersedes numbers replace an older number
+	LinkSupersedes LinkKind = "supersedes"
+)
+
+// IsValid returns true for the known link kinds
+func (k LinkKind) IsValid() bool {
+	return k == LinkInterchange || k == LinkSupersedes
+}
+
+// ErrNotFound is returned when a part number isn't in the interchange
+var ErrNotFound = errors.New("part number not found")
+
+// PartNumber is one OEM or aftermarket number
+type PartNumber struct {
+	ID          int    `db:"id"`
+	Number      string `db:"number"`
+	Normalized  string `db:"normalized"`
+	Brand       string `db:"brand"`
+	Kind        Kind   `db:"kind"`
+	Description string `db:"description"`
+	Cars        int    `db:"cars"` // cars the number itself is listed for
+}
+
+// Link is a part number directly related to another. Relation reads from
+// the other number's side: "interchange", "supersedes" or "superseded by".
+type Link struct {
+	PartNumber
+	Relation string
+}
+
+// Car is a vehicle a part number fits
+type Car struct {
+	ID     int    `db:"id"`
+	Make   string `db:"make"`
+	Year   int    `db:"year"`
+	Model  string `db:"model"`
+	Engine string `db:"engine"`
+}
+
+// Normalize reduces a part number to its uppercase letters and digits, so
+// "31100-RAA-A01" and "31100 raa a01" are the same number
+func Normalize(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// LooksLikePartNumber reports whether a search query is a single part
+// number rather than words, e.g. "31100-RAA-A01" but not "2005 civic"
+func LooksLikePartNumber(query string) bool {
+	query = strings.TrimSpace(query)
+	if query == "" || strings.ContainsAny(query, " \t") {
+		return false
+	}
+	normalized := Normalize(query)
+	return len(normalized) >= 5 && strings.IndexFunc(normalized, unicode.IsDigit) >= 0
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+const partNumberColumns = `pn.id, pn.number, pn.normalized, pn.brand, pn.kind, pn.description,
+	(SELECT COUNT(*) FROM PartNumberCar pnc WHERE pnc.part_number_id = pn.id) AS cars`
+
+// Find looks up a part number however it was typed
+func Find(number string) (PartNumber, error) {
+	var pn PartNumber
+	err := db.GetRow(&pn, "SELECT "+partNumberColumns+" FROM PartNumber pn WHERE pn.normalized = ?", Normalize(number))
+	if err == sql.ErrNoRows {
+		return PartNumber{}, ErrNotFound
+	}
+	return pn, err
+}
+
+// Get returns a part number by ID
+func Get(id int) (PartNumber, error) {
+	var pn PartNumber
+	err := db.GetRow(&pn, "SELECT "+partNumberColumns+" FROM PartNumber pn WHERE pn.id = ?", id)
+	if err == sql.ErrNoRows {
+		return PartNumber{}, ErrNotFound
+	}
+	return pn, err
+}
+
+// List returns up to limit part numbers, those containing filter when it's
+// set
+func List(filter string, limit int) ([]PartNumber, error) {
+	query := "SELECT " + partNumberColumns + " FROM PartNumber pn"
+	var args []interface{}
+	if normalized := Normalize(filter); normalized != "" {
+		query += " WHERE pn.normalized LIKE ?"
+		args = append(args, "%"+normalized+"%")
+	}
+	query += " ORDER BY pn.normalized LIMIT ?"
+	args = append(args, limit)
+	var numbers []PartNumber
+	err := db.Select(&numbers, query, args...)
+	return numbers, err
+}
+
+// cleanNumber trims a part number and checks it has letters or digits
+func cleanNumber(number string) (string, string, error) {
+	number = strings.Join(strings.Fields(strings.ToUpper(number)), " ")
+	normalized := Normalize(number)
+	if normalized == "" {
+		return "", "", fmt.Errorf("part number is required")
+	}
+	if len(number) > 40 {
+		return "", "", fmt.Errorf("part number %q is too long", number)
+	}
+	return number, normalized, nil
+}
+
+// execer is the part of *sql.Tx the write helpers need, so imports can run
+// them inside one transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// ensure returns the ID of a part number, adding it when it's new. Brand,
+// kind and description fill in blanks on an existing number but never
+// overwrite what's there; it reports whether the number was added.
+func ensure(tx execer, number, brand string, kind Kind, description string) (int, bool, error) {
+	number, normalized, err := cleanNumber(number)
+	if err != nil {
+		return 0, false, err
+	}
+	if kind == "" {
+		kind = KindOEM
+	}
+	if !kind.IsValid() {
+		return 0, false, fmt.Errorf("unknown part number kind %q", kind)
+	}
+	brand, description = strings.TrimSpace(brand), strings.TrimSpace(description)
+
+	var id int
+	err = tx.QueryRow("SELECT id FROM PartNumber WHERE normalized = ?", normalized).Scan(&id)
+	if err == nil {
+		_, err = tx.Exec(`UPDATE PartNumber SET
+			brand = CASE WHEN brand = '' THEN ? ELSE brand END,
+			description = CASE WHEN description = '' THEN ? ELSE description END
+			WHERE id = ?`, brand, description, id)
+		return id, false, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	res, err := tx.Exec("INSERT INTO PartNumber (number, normalized, brand, kind, description, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		number, normalized, brand, string(kind), description, now())
+	if err != nil {
+		return 0, false, err
+	}
+	newID, err := res.LastInsertId()
+	return int(newID), true, err
+}
+
+// Add adds a part number, refusing one that's already listed
+func Add(number, brand string, kind Kind, description string) (int, error) {
+	if _, err := Find(number); err == nil {
+		return 0, fmt.Errorf("part number %q is already listed", strings.TrimSpace(number))
+	} else if !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	id, _, err := ensure(tx, number, brand, kind, description)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// Update changes a part number's brand, kind and description
+func Update(id int, brand string, kind Kind, description string) error {
+	if !kind.IsValid() {
+		return fmt.Errorf("unknown part number kind %q", kind)
+	}
+	res, err := db.Exec("UPDATE PartNumber SET brand = ?, kind = ?, description = ? WHERE id = ?",
+		strings.TrimSpace(brand), string(kind), strings.TrimSpace(description), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a part number with its fitment and links
+func Delete(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM PartNumberCar WHERE part_number_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM PartNumberLink WHERE part_number_id = ? OR other_id = ?", id, id); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM PartNumber WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// link relates two part numbers. Interchanges are stored lower id first so
+// each pair is kept once; it reports whether the link is new.
+func link(tx execer, id, otherID int, kind LinkKind) (bool, error) {
+	if id == otherID {
+		return false, fmt.Errorf("a part number can't be linked to itself")
+	}
+	if !kind.IsValid() {
+		return false, fmt.Errorf("unknown link kind %q", kind)
+	}
+	if kind == LinkInterchange && otherID < id {
+		id, otherID = otherID, id
+	}
+	var existing int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM PartNumberLink WHERE (part_number_id = ? AND other_id = ?) OR (part_number_id = ? AND other_id = ?)",
+		id, otherID, otherID, id).Scan(&existing); err != nil {
+		return false, err
+	}
+	if existing > 0 {
+		return false, nil
+	}
+	_, err := tx.Exec("INSERT INTO PartNumberLink (part_number_id, other_id, kind, created_at) VALUES (?, ?, ?, ?)",
+		id, otherID, string(kind), now())
+	return err == nil, err
+}
+
+// AddLink relates a part number to another, adding the other number if it
+// isn't listed yet. For LinkSupersedes, id is the newer number.
+func AddLink(id int, other string, kind LinkKind) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM PartNumber WHERE id = ?", id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrNotFound
+	}
+	otherID, _, err := ensure(tx, other, "", "", "")
+	if err != nil {
+		return err
+	}
+	added, err := link(tx, id, otherID, kind)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return fmt.Errorf("those part numbers are already linked")
+	}
+	return tx.Commit()
+}
+
+// RemoveLink unrelates two part numbers
+func RemoveLink(id, otherID int) error {
+	res, err := db.Exec("DELETE FROM PartNumberLink WHERE (part_number_id = ? AND other_id = ?) OR (part_number_id = ? AND other_id = ?)",
+		id, otherID, otherID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetLinks returns the part numbers directly linked to one
+func GetLinks(id int) ([]Link, error) {
+	rows, err := db.Query(`
+		SELECT pn.id, pn.number, pn.normalized, pn.brand, pn.kind, pn.description,
+			CASE WHEN l.kind = 'interchange' THEN 'interchange'
+				WHEN l.part_number_id = ? THEN 'superseded by'
+				ELSE 'supersedes' END
+		FROM PartNumberLink l
+		JOIN PartNumber pn ON pn.id = CASE WHEN l.part_number_id = ? THEN l.other_id ELSE l.part_number_id END
+		WHERE l.part_number_id = ? OR l.other_id = ?
+		ORDER BY pn.normalized
+	`, id, id, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []Link
+	for rows.Next() {
+		var l Link
+		var kind string
+		if err := rows.Scan(&l.ID, &l.Number, &l.Normalized, &l.Brand, &kind, &l.Description, &l.Relation); err != nil {
+			return nil, err
+		}
+		l.Kind = Kind(kind)
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// interchangeQuery collects a part number and every number linked to it,
+// directly or through other numbers, in either direction
+const interchangeQuery = `
+	WITH RECURSIVE linked(id) AS (
+		SELECT id FROM PartNumber WHERE normalized = ?
+		UNION
+		SELECT CASE WHEN l.part_number_id = linked.id THEN l.other_id ELSE l.part_number_id END
+		FROM PartNumberLink l
+		JOIN linked ON l.part_number_id = linked.id OR l.other_id = linked.id
+	)`
+
+// Interchangeable returns a part number and every number it interchanges
+// with or supersedes or is superseded by, however indirectly. Unknown
+// numbers return none.
+func Interchangeable(number string) ([]PartNumber, error) {
+	var numbers []PartNumber
+	err := db.Select(&numbers, interchangeQuery+`
+		SELECT `+partNumberColumns+`
+		FROM PartNumber pn JOIN linked ON pn.id = linked.id
+		ORDER BY pn.normalized`, Normalize(number))
+	return numbers, err
+}
+
+// adPartNumberKey normalizes Ad.part_number in SQL. Validated part numbers
+// only separate their letters and digits with spaces, dots, slashes and
+// dashes.
+const adPartNumberKey = `REPLACE(REPLACE(REPLACE(REPLACE(a.part_number, '-', ''), ' ', ''), '.', ''), '/', '')`
+
+// AdIDs returns the live ads carrying a part number or any number
+// interchangeable with it
+func AdIDs(number string) ([]int, error) {
+	normalized := Normalize(number)
+	if normalized == "" {
+		return nil, nil
+	}
+	var ids []int
+	err := db.Select(&ids, interchangeQuery+`
+		SELECT a.id FROM Ad a
+		WHERE a.deleted_at IS NULL AND a.part_number != ''
+			AND (`+adPartNumberKey+` = ? OR `+adPartNumberKey+` IN (
+				SELECT pn.normalized FROM PartNumber pn JOIN linked ON pn.id = linked.id))
+		ORDER BY a.id`, normalized, normalized)
+	return ids, err
+}
+
+const carColumns = `c.id, m.name AS make, y.year, mo.name AS model, e.name AS engine
+	FROM Car c
+	JOIN Make m ON c.make_id = m.id
+	JOIN Year y ON c.year_id = y.id
+	JOIN Model mo ON c.model_id = mo.id
+	JOIN Engine e ON c.engine_id = e.id`
+
+// GetCars returns the cars a part number itself is listed for
+func GetCars(id int) ([]Car, error) {
+	var cars []Car
+	err := db.Select(&cars, "SELECT "+carColumns+`
+		JOIN PartNumberCar pnc ON pnc.car_id = c.id
+		WHERE pnc.part_number_id = ?
+		ORDER BY m.name, mo.name, y.year, e.name`, id)
+	return cars, err
+}
+
+// CarSpec picks catalog cars for a part number: one make and model over a
+// range of years, and one engine or every engine when Engine is empty
+type CarSpec struct {
+	Make     string
+	YearFrom int
+	YearTo   int
+	Model    string
+	Engine   string
+}
+
+// ParseYears reads a year or a year range such as "2003-2007"
+func ParseYears(s string) (int, int, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	yearFrom, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid year %q", s)
+	}
+	yearTo := yearFrom
+	if isRange {
+		if yearTo, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || yearTo < yearFrom {
+			return 0, 0, fmt.Errorf("invalid year range %q", s)
+		}
+	}
+	return yearFrom, yearTo, nil
+}
+
+// addCars lists a part number for the catalog cars matching spec. It
+// returns how many cars matched and how many were newly added.
+func addCars(tx execer, id int, spec CarSpec) (int, int, error) {
+	where := `WHERE m.name = ? COLLATE NOCASE AND y.year BETWEEN ? AND ? AND mo.name = ? COLLATE NOCASE
+		AND (? = '' OR e.name = ? COLLATE NOCASE)`
+	engine := strings.TrimSpace(spec.Engine)
+	args := []interface{}{strings.TrimSpace(spec.Make), spec.YearFrom, spec.YearTo, strings.TrimSpace(spec.Model), engine, engine}
+
+	var matched int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM (SELECT "+carColumns+" "+where+")", args...).Scan(&matched); err != nil {
+		return 0, 0, err
+	}
+	if matched == 0 {
+		return 0, 0, nil
+	}
+	res, err := tx.Exec("INSERT OR IGNORE INTO PartNumberCar (part_number_id, car_id) SELECT ?, c.id FROM ("+
+		"SELECT "+carColumns+" "+where+") c", append([]interface{}{id}, args...)...)
+	if err != nil {
+		return 0, 0, err
+	}
+	added, err := res.RowsAffected()
+	return matched, int(added), err
+}
+
+// AddCars lists a part number for the catalog cars matching spec and
+// returns how many were added. Specs matching no car are refused.
+func AddCars(id int, spec CarSpec) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM PartNumber WHERE id = ?", id).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		return 0, ErrNotFound
+	}
+	matched, added, err := addCars(tx, id, spec)
+	if err != nil {
+		return 0, err
+	}
+	if matched == 0 {
+		return 0, fmt.Errorf("no %s %s from %d to %d in the catalog", spec.Make, spec.Model, spec.YearFrom, spec.YearTo)
+	}
+	return added, tx.Commit()
+}
+
+// RemoveCar stops listing a part number for a car
+func RemoveCar(id, carID int) error {
+	res, err := db.Exec("DELETE FROM PartNumberCar WHERE part_number_id = ? AND car_id = ?", id, carID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Fitment returns the cars a part number fits, counting the cars of every
+// interchangeable number, as ad fitment groups: one per make, model and
+// engine with exactly the years it fits. It also returns the number of cars.
+// Unknown numbers fit nothing.
+func Fitment(number string) ([]ad.FitmentGroup, int, error) {
+	var cars []Car
+	err := db.Select(&cars, interchangeQuery+`
+		SELECT DISTINCT `+carColumns+`
+		JOIN PartNumberCar pnc ON pnc.car_id = c.id
+		JOIN linked ON linked.id = pnc.part_number_id
+		ORDER BY m.name, mo.name, e.name, y.year`, Normalize(number))
+	if err != nil {
+		return nil, 0, err
+	}
+	return fitmentGroups(cars), len(cars), nil
+}
+
+// fitmentGroups groups cars by make, model and engine, listing their years.
+// Ads list every year × model × engine of a group, so a group never spans
+// more than one model or engine, or it would claim cars that don't exist.
+func fitmentGroups(cars []Car) []ad.FitmentGroup {
+	var groups []ad.FitmentGroup
+	index := make(map[string]int)
+	for _, car := range cars {
+		key := car.Make + "\x00" + car.Model + "\x00" + car.Engine
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, ad.FitmentGroup{Make: car.Make, Models: []string{car.Model}, Engines: []string{car.Engine}})
+		}
+		year := strconv.Itoa(car.Year)
+		if !slices.Contains(groups[i].Years, year) {
+			groups[i].Years = append(groups[i].Years, year)
+		}
+	}
+	for i := range groups {
+		sort.Strings(groups[i].Years)
+	}
+	return groups
+}
@@ -0,0 +1,159 @@
+package partnumber
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "31100RAAA01", Normalize("31100-RAA-A01"))
+	assert.Equal(t, "31100RAAA01", Normalize(" 31100 raa.a01 "))
+	assert.Equal(t, "", Normalize("- / ."))
+}
+
+func TestLooksLikePartNumber(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"31100-RAA-A01", true},
+		{"DG508", true},
+		{"2005 civic", false},
+		{"alternator", false},
+		{"A12", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, LooksLikePartNumber(tt.query), tt.query)
+	}
+}
+
+func TestParseYears(t *testing.T) {
+	from, to, err := ParseYears("2003-2007")
+	assert.NoError(t, err)
+	assert.Equal(t, 2003, from)
+	assert.Equal(t, 2007, to)
+
+	from, to, err = ParseYears(" 2005 ")
+	assert.NoError(t, err)
+	assert.Equal(t, 2005, from)
+	assert.Equal(t, 2005, to)
+
+	_, _, err = ParseYears("2007-2003")
+	assert.Error(t, err)
+	_, _, err = ParseYears("")
+	assert.Error(t, err)
+}
+
+func TestFitmentGroups(t *testing.T) {
+	groups := fitmentGroups([]Car{
+		{Make: "Honda", Year: 2004, Model: "Accord", Engine: "2.4L"},
+		{Make: "Honda", Year: 2003, Model: "Accord", Engine: "2.4L"},
+		{Make: "Honda", Year: 2003, Model: "Accord", Engine: "3.0L"},
+		{Make: "Acura", Year: 2004, Model: "TSX", Engine: "2.4L"},
+	})
+	assert.Equal(t, []ad.FitmentGroup{
+		{Make: "Honda", Years: []string{"2003", "2004"}, Models: []string{"Accord"}, Engines: []string{"2.4L"}},
+		{Make: "Honda", Years: []string{"2003"}, Models: []string{"Accord"}, Engines: []string{"3.0L"}},
+		{Make: "Acura", Years: []string{"2004"}, Models: []string{"TSX"}, Engines: []string{"2.4L"}},
+	}, groups)
+}
+
+func TestAddLink_InterchangeStoredLowerIDFirst(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM PartNumber WHERE id = \\?").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT id FROM PartNumber WHERE normalized = \\?").
+		WithArgs("DG508").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec("UPDATE PartNumber SET").
+		WithArgs("", "", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM PartNumberLink").
+		WithArgs(3, 7, 7, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO PartNumberLink").
+		WithArgs(3, 7, "interchange", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := AddLink(7, "dg-508", LinkInterchange)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddLink_AlreadyLinked(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM PartNumber WHERE id = \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT id FROM PartNumber WHERE normalized = \\?").
+		WithArgs("DG508").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec("UPDATE PartNumber SET").
+		WithArgs("", "", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM PartNumberLink").
+		WithArgs(3, 7, 7, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	err := AddLink(3, "DG508", LinkSupersedes)
+	assert.ErrorContains(t, err, "already linked")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoveLink_NotLinked(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectExec("DELETE FROM PartNumberLink").
+		WithArgs(3, 7, 7, 3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := RemoveLink(3, 7)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImport_BadFile(t *testing.T) {
+	mock := dbtest.Mock(t)
+
+	_, err := Import(strings.NewReader(""))
+	assert.ErrorContains(t, err, "empty")
+
+	_, err = Import(strings.NewReader("brand,make,year\nDenso,Honda,2004\n"))
+	assert.ErrorContains(t, err, "no number column")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestImport_WarnsAndSkipsBadRows(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM PartNumber WHERE normalized = \\?").
+		WithArgs("31100RAAA01").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("INSERT INTO PartNumber").
+		WithArgs("31100-RAA-A01", "31100RAAA01", "Honda", "oem", "Alternator", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectCommit()
+
+	report, err := Import(strings.NewReader("\ufeffNumber,Brand,Kind,Description,Make,Year,Model\n" +
+		"31100-RAA-A01,Honda,OEM,Alternator,,,\n" +
+		",,,,,,\n" +
+		"---,Honda,oem,,,,\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Rows)
+	assert.Equal(t, 1, report.Numbers)
+	require.Len(t, report.Warnings, 1)
+	assert.True(t, strings.HasPrefix(report.Warnings[0], "line 4: "), report.Warnings[0])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,10 +2,12 @@ package rock
 
 import (
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/parts-pile/site/db"
 	"github.com/parts-pile/site/messaging"
+	"github.com/parts-pile/site/webhook"
 )
 
 // UserRock represents a user's rock inventory
@@ -123,7 +125,23 @@ func ThrowRock(userID, adID int, initialMessage string) error {
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	event := rockEvent{AdID: adID, ThrowerID: userID, ConversationID: convID, Message: initialMessage}
+	if err := webhook.Emit(adOwnerID, webhook.EventAdRocked, event); err != nil {
+		log.Printf("[webhook] Failed to queue %s for user %d: %v", webhook.EventAdRocked, adOwnerID, err)
+	}
+	return nil
+}
+
+// rockEvent is the data of ad.rocked webhooks
+type rockEvent struct {
+	AdID           int    `json:"ad_id"`
+	ThrowerID      int    `json:"thrower_id"`
+	ConversationID int    `json:"conversation_id"`
+	Message        string `json:"message"`
 }
 
 // GetAdRocks retrieves all rocks for an ad
@@ -4,7 +4,8 @@
 CREATE TABLE Make (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     name TEXT NOT NULL UNIQUE,
-    parent_company_id INTEGER REFERENCES ParentCompany(id)
+    parent_company_id INTEGER REFERENCES ParentCompany(id),
+    retired_at TEXT
 );
 
 CREATE TABLE ParentCompany (
@@ -20,14 +21,27 @@ CREATE TABLE Year (
 
 CREATE TABLE Model (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL
+    name TEXT NOT NULL,
+    retired_at TEXT
 );
 
 CREATE TABLE Engine (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
-    name TEXT NOT NULL
+    name TEXT NOT NULL,
+    retired_at TEXT
 );
 
+-- Names admins renamed or merged away, and the make, model or engine
+-- (matching kind) they now belong to, so catalog imports don't add them back
+CREATE TABLE CatalogReplacedName (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL, -- make, model or engine
+    name TEXT NOT NULL,
+    entry_id INTEGER NOT NULL,
+    created_at TEXT NOT NULL
+);
+CREATE INDEX idx_catalogreplacedname_kind_entry ON CatalogReplacedName(kind, entry_id);
+
 CREATE TABLE Car (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     make_id INTEGER NOT NULL,
@@ -53,11 +67,65 @@ CREATE TABLE PartSubCategory (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     category_id INTEGER NOT NULL,
     name TEXT NOT NULL,
+    attribute_schema TEXT, -- optional JSON part.AttributeSchema
     FOREIGN KEY (category_id) REFERENCES PartCategory(id),
     UNIQUE (category_id, name)
 );
 CREATE INDEX idx_partsubcategory_category_name ON PartSubCategory(category_id, name);
 
+-- Another name for a category or subcategory, e.g. "genny" for Alternator.
+-- Exactly one of category_id and subcategory_id is set.
+CREATE TABLE PartAlias (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    alias TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    category_id INTEGER REFERENCES PartCategory(id),
+    subcategory_id INTEGER REFERENCES PartSubCategory(id),
+    created_at TEXT NOT NULL
+);
+CREATE INDEX idx_partalias_category_id ON PartAlias(category_id);
+CREATE INDEX idx_partalias_subcategory_id ON PartAlias(subcategory_id);
+
+-- Comma-separated words that mean the same part, e.g. "rotor, disc, brake disc"
+CREATE TABLE PartSynonym (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    terms TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+-- OEM and aftermarket part numbers, for interchange lookups
+CREATE TABLE PartNumber (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    number TEXT NOT NULL,            -- as printed, e.g. "31100-RAA-A01"
+    normalized TEXT NOT NULL UNIQUE, -- letters and digits only, uppercase, e.g. "31100RAAA01"
+    brand TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL DEFAULT 'oem', -- oem or aftermarket
+    description TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL
+);
+
+-- The cars a part number fits
+CREATE TABLE PartNumberCar (
+    part_number_id INTEGER NOT NULL,
+    car_id INTEGER NOT NULL,
+    PRIMARY KEY (part_number_id, car_id),
+    FOREIGN KEY (part_number_id) REFERENCES PartNumber(id),
+    FOREIGN KEY (car_id) REFERENCES Car(id)
+);
+CREATE INDEX idx_partnumbercar_car_id ON PartNumberCar(car_id);
+
+-- Part numbers that can replace each other. An interchange is stored once,
+-- lower id first; for a supersession part_number_id replaces other_id.
+CREATE TABLE PartNumberLink (
+    part_number_id INTEGER NOT NULL,
+    other_id INTEGER NOT NULL,
+    kind TEXT NOT NULL, -- interchange or supersedes
+    created_at TEXT NOT NULL,
+    PRIMARY KEY (part_number_id, other_id),
+    FOREIGN KEY (part_number_id) REFERENCES PartNumber(id),
+    FOREIGN KEY (other_id) REFERENCES PartNumber(id)
+);
+CREATE INDEX idx_partnumberlink_other_id ON PartNumberLink(other_id);
+
 -- Location table
 CREATE TABLE Location (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -93,6 +161,7 @@ CREATE TABLE User (
     verification_code TEXT,
     notification_method TEXT NOT NULL DEFAULT 'sms',
     email_address TEXT,
+    price_drop_alerts INTEGER NOT NULL DEFAULT 1,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     is_admin INTEGER NOT NULL DEFAULT 0,
     deleted_at DATETIME
@@ -110,19 +179,35 @@ CREATE TABLE Ad (
     subcategory_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
     image_count INTEGER DEFAULT 0,
+    -- Highest image storage number handed out (see AdImage); never decreases
+    last_image_idx INTEGER NOT NULL DEFAULT 0,
     location_id INTEGER REFERENCES Location(id),
     click_count INTEGER DEFAULT 0,
     last_clicked_at DATETIME,
     has_vector INTEGER DEFAULT 0,
+    condition TEXT NOT NULL DEFAULT '',
+    part_number TEXT NOT NULL DEFAULT '',
+    quantity INTEGER NOT NULL DEFAULT 1,
+    position TEXT NOT NULL DEFAULT '',
+    core_charge REAL NOT NULL DEFAULT 0,
+    pending_at DATETIME,
+    hidden_at DATETIME,
+    -- Last change to what the ad shows, e.g. its content, status or visibility
+    updated_at DATETIME,
     FOREIGN KEY (subcategory_id) REFERENCES PartSubCategory(id),
     FOREIGN KEY (user_id) REFERENCES User(id)
 );
 CREATE INDEX idx_ad_created_at_id ON Ad(created_at, id);
 CREATE INDEX idx_ad_deleted_at ON Ad(deleted_at);
+CREATE INDEX idx_ad_part_number ON Ad(part_number);
+CREATE INDEX idx_ad_updated_at ON Ad(updated_at);
 
+-- fitment_group numbers the make/years/models/engines sets an ad was listed
+-- with, so multi-make ads can be edited group by group
 CREATE TABLE AdCar (
     ad_id INTEGER NOT NULL,
     car_id INTEGER NOT NULL,
+    fitment_group INTEGER NOT NULL DEFAULT 0,
     FOREIGN KEY (ad_id) REFERENCES Ad(id),
     FOREIGN KEY (car_id) REFERENCES Car(id),
     PRIMARY KEY (ad_id, car_id)
@@ -130,6 +215,81 @@ CREATE TABLE AdCar (
 CREATE INDEX idx_adcar_car_id ON AdCar(car_id);
 CREATE INDEX idx_adcar_ad_id ON AdCar(ad_id);
 
+-- Ad drafts hold autosaved form state until the seller publishes. A draft with
+-- ad_id set is an unsaved edit of an existing ad. Drafts untouched for 30 days
+-- are deleted with their images.
+CREATE TABLE AdDraft (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    ad_id INTEGER,
+    form_data TEXT NOT NULL DEFAULT '{}',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES User(id),
+    FOREIGN KEY (ad_id) REFERENCES Ad(id)
+);
+CREATE INDEX idx_addraft_user_id ON AdDraft(user_id);
+CREATE INDEX idx_addraft_ad_id ON AdDraft(ad_id);
+
+-- Original image uploads attached to a draft, kept until the draft is published.
+-- Only valid images are kept, up to the ad form's limit.
+CREATE TABLE AdDraftImage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    draft_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    filename TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    data BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (draft_id) REFERENCES AdDraft(id)
+);
+CREATE INDEX idx_addraftimage_draft_id ON AdDraftImage(draft_id);
+
+-- Manifest of an ad's processed images. idx names the image's files in the
+-- image store ("{ad_id}/{idx}-{variant}.webp") and comes from Ad.last_image_idx,
+-- so it is never reused, even after the image is deleted; position orders the
+-- photos and is_primary marks the cover.
+CREATE TABLE AdImage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ad_id INTEGER NOT NULL,
+    idx INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    is_primary INTEGER NOT NULL DEFAULT 0,
+    variants TEXT NOT NULL, -- comma-separated sizes, e.g. 160w,480w,1200w
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (ad_id, idx),
+    FOREIGN KEY (ad_id) REFERENCES Ad(id)
+);
+CREATE INDEX idx_adimage_ad_id ON AdImage(ad_id, position);
+
+-- Uploaded images waiting to be resized into the image store. The original
+-- is kept until the job succeeds so failed attempts can be retried.
+CREATE TABLE AdImageJob (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ad_id INTEGER NOT NULL,
+    filename TEXT NOT NULL DEFAULT '',
+    data BLOB,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, processing, ready, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    image_id INTEGER, -- manifest entry created once ready
+    next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (ad_id) REFERENCES Ad(id)
+);
+CREATE INDEX idx_adimagejob_ad_id ON AdImageJob(ad_id);
+CREATE INDEX idx_adimagejob_status ON AdImageJob(status, next_attempt_at);
+
+CREATE TABLE AdPriceHistory (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ad_id INTEGER NOT NULL,
+    price REAL NOT NULL,
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (ad_id) REFERENCES Ad(id)
+);
+CREATE INDEX idx_adpricehistory_ad_id ON AdPriceHistory(ad_id);
+
 CREATE TABLE BookmarkedAd (
     user_id INTEGER NOT NULL,
     ad_id INTEGER NOT NULL,
@@ -185,15 +345,37 @@ CREATE INDEX idx_conversation_user2_id ON Conversation(user2_id);
 CREATE INDEX idx_conversation_ad_id ON Conversation(ad_id);
 CREATE INDEX idx_conversation_updated_at ON Conversation(updated_at);
 
+CREATE TABLE Offer (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    conversation_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    recipient_id INTEGER NOT NULL,
+    amount REAL NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    parent_offer_id INTEGER,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    responded_at DATETIME,
+    FOREIGN KEY (conversation_id) REFERENCES Conversation(id),
+    FOREIGN KEY (sender_id) REFERENCES User(id),
+    FOREIGN KEY (recipient_id) REFERENCES User(id),
+    FOREIGN KEY (parent_offer_id) REFERENCES Offer(id)
+);
+CREATE INDEX idx_offer_conversation_id ON Offer(conversation_id);
+CREATE INDEX idx_offer_status_expires_at ON Offer(status, expires_at);
+
 CREATE TABLE Message (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     conversation_id INTEGER NOT NULL,
     sender_id INTEGER NOT NULL,
     content TEXT NOT NULL,
+    message_type TEXT NOT NULL DEFAULT 'text',
+    offer_id INTEGER,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     read_at DATETIME,
     FOREIGN KEY (conversation_id) REFERENCES Conversation(id),
-    FOREIGN KEY (sender_id) REFERENCES User(id)
+    FOREIGN KEY (sender_id) REFERENCES User(id),
+    FOREIGN KEY (offer_id) REFERENCES Offer(id)
 );
 CREATE INDEX idx_message_conversation_id ON Message(conversation_id);
 CREATE INDEX idx_message_sender_id ON Message(sender_id);
@@ -228,4 +410,136 @@ CREATE TABLE AdRock (
 CREATE INDEX idx_adrock_ad_id ON AdRock(ad_id);
 CREATE INDEX idx_adrock_thrower_id ON AdRock(thrower_id);
 CREATE INDEX idx_adrock_conversation_id ON AdRock(conversation_id);
-CREATE INDEX idx_adrock_resolved_at ON AdRock(resolved_at);
\ No newline at end of file
+CREATE INDEX idx_adrock_resolved_at ON AdRock(resolved_at);
+-- Ad analytics. Events are appended to AdEvent as they happen and rolled up
+-- on a schedule into one AdEventDaily row per ad, UTC day, type and source.
+CREATE TABLE AdEvent (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ad_id INTEGER NOT NULL,
+    event_type TEXT NOT NULL,
+    source TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (ad_id) REFERENCES Ad(id)
+);
+CREATE INDEX idx_adevent_ad_id ON AdEvent(ad_id);
+
+CREATE TABLE AdEventDaily (
+    ad_id INTEGER NOT NULL,
+    day TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    source TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (ad_id, day, event_type, source),
+    FOREIGN KEY (ad_id) REFERENCES Ad(id)
+);
+
+-- Moderation. A case is opened when an ad crosses the rock threshold, is
+-- reported or is flagged automatically; admins close every open case of an
+-- ad with one decision, which is kept as a record and sent to the seller.
+CREATE TABLE ModerationCase (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ad_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    reporter_id INTEGER,
+    created_at DATETIME NOT NULL,
+    resolved_at DATETIME,
+    decision_id INTEGER,
+    FOREIGN KEY (ad_id) REFERENCES Ad(id),
+    FOREIGN KEY (reporter_id) REFERENCES User(id),
+    FOREIGN KEY (decision_id) REFERENCES ModerationDecision(id)
+);
+CREATE INDEX idx_moderationcase_ad_id ON ModerationCase(ad_id);
+CREATE INDEX idx_moderationcase_resolved_at ON ModerationCase(resolved_at);
+
+CREATE TABLE ModerationDecision (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    ad_id INTEGER NOT NULL,
+    seller_id INTEGER NOT NULL,
+    admin_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (ad_id) REFERENCES Ad(id),
+    FOREIGN KEY (seller_id) REFERENCES User(id),
+    FOREIGN KEY (admin_id) REFERENCES User(id)
+);
+CREATE INDEX idx_moderationdecision_ad_id ON ModerationDecision(ad_id);
+
+-- Flagged messages are reviewed apart from ads: the decision acts on the
+-- message and its sender, not on the ad the conversation is about.
+-- message_id is kept after the message is deleted.
+CREATE TABLE MessageCase (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL,
+    sender_id INTEGER NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    resolved_at DATETIME,
+    admin_id INTEGER,
+    action TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (sender_id) REFERENCES User(id),
+    FOREIGN KEY (admin_id) REFERENCES User(id)
+);
+CREATE INDEX idx_messagecase_message_id ON MessageCase(message_id);
+CREATE INDEX idx_messagecase_sender_id ON MessageCase(sender_id);
+CREATE INDEX idx_messagecase_resolved_at ON MessageCase(resolved_at);
+
+-- Admin-editable rules screening ads, messages and usernames
+CREATE TABLE ModerationRule (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    match_type TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    kind TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-user keys for the /api/v1 JSON API. Only a hash of each key is stored.
+CREATE TABLE ApiKey (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_used_at DATETIME,
+    revoked_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES User(id)
+);
+CREATE INDEX idx_apikey_user_id ON ApiKey(user_id);
+
+-- Endpoints users register to be told about events on their ads and
+-- conversations. The secret signs every delivery.
+CREATE TABLE Webhook (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL, -- space-separated event types
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES User(id)
+);
+CREATE INDEX idx_webhook_user_id ON Webhook(user_id);
+
+-- Queued webhook deliveries. Failed attempts are retried with backoff, and
+-- deliveries that use up their attempts stay dead until they're resent.
+CREATE TABLE WebhookDelivery (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, sending, delivered, dead
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_status INTEGER, -- of the last attempt, when there was a response
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    delivered_at DATETIME,
+    FOREIGN KEY (webhook_id) REFERENCES Webhook(id)
+);
+CREATE INDEX idx_webhookdelivery_webhook_id ON WebhookDelivery(webhook_id);
+CREATE INDEX idx_webhookdelivery_status ON WebhookDelivery(status, next_attempt_at);
@@ -0,0 +1,221 @@
+// Package sitemap lists the site's public pages for search engines: the
+// static pages, the browse tree landing pages and every active ad. The lists
+// are built from the database, split into chunks the size the sitemap
+// protocol allows, and cached until ads change.
+package sitemap
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/parts-pile/site/browse"
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+)
+
+// URL is one page listed in a sitemap. Loc is a path on the site.
+type URL struct {
+	Loc     string
+	LastMod time.Time // Zero when unknown
+}
+
+// Chunk is one child sitemap of the index
+type Chunk struct {
+	Name    string // e.g. "ads-2"
+	URLs    []URL
+	LastMod time.Time // Latest LastMod of its URLs
+}
+
+// staticPages are listed ahead of the browse pages
+var staticPages = []string{"/", "/register", "/login", "/terms", "/privacy"}
+
+// Ads moderators hid or sellers archived are left out
+const activeAd = "a.deleted_at IS NULL AND a.hidden_at IS NULL"
+
+var (
+	mu        sync.Mutex
+	chunks    []Chunk
+	stamp     string
+	checkedAt time.Time
+)
+
+// Chunks returns the child sitemaps, rebuilding them when ads have changed
+// since they were cached
+func Chunks() ([]Chunk, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if chunks != nil && time.Since(checkedAt) < config.SitemapCheckInterval {
+		return chunks, nil
+	}
+	current, err := changeStamp()
+	if err != nil {
+		return nil, err
+	}
+	checkedAt = time.Now()
+	if chunks != nil && current == stamp {
+		return chunks, nil
+	}
+
+	built, err := build()
+	if err != nil {
+		return nil, err
+	}
+	chunks, stamp = built, current
+	return chunks, nil
+}
+
+// Find returns the child sitemap with the given name
+func Find(name string) (Chunk, bool, error) {
+	all, err := Chunks()
+	if err != nil {
+		return Chunk{}, false, err
+	}
+	for _, c := range all {
+		if c.Name == name {
+			return c, true, nil
+		}
+	}
+	return Chunk{}, false, nil
+}
+
+// changeStamp summarizes the state of all ads, so any added, edited,
+// archived or hidden ad changes it
+func changeStamp() (string, error) {
+	var count int
+	var latest string
+	err := db.QueryRow("SELECT COUNT(*), COALESCE(MAX(COALESCE(updated_at, created_at)), '') FROM Ad").Scan(&count, &latest)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s", count, latest), nil
+}
+
+func build() ([]Chunk, error) {
+	pages, err := browsePages()
+	if err != nil {
+		return nil, fmt.Errorf("browse pages: %w", err)
+	}
+	ads, err := adPages()
+	if err != nil {
+		return nil, fmt.Errorf("ads: %w", err)
+	}
+
+	// The home page changes whenever any ad does
+	var latest time.Time
+	for _, u := range ads {
+		if u.LastMod.After(latest) {
+			latest = u.LastMod
+		}
+	}
+	static := make([]URL, len(staticPages))
+	for i, path := range staticPages {
+		static[i] = URL{Loc: path}
+	}
+	static[0].LastMod = latest
+
+	result := split("pages", append(static, pages...), config.SitemapMaxURLs)
+	return append(result, split("ads", ads, config.SitemapMaxURLs)...), nil
+}
+
+// split breaks a list of URLs into chunks of at most size URLs, named
+// kind-1, kind-2 and so on
+func split(kind string, urls []URL, size int) []Chunk {
+	var result []Chunk
+	for start := 0; start < len(urls); start += size {
+		end := min(start+size, len(urls))
+		c := Chunk{Name: kind + "-" + strconv.Itoa(len(result)+1), URLs: urls[start:end]}
+		for _, u := range c.URLs {
+			if u.LastMod.After(c.LastMod) {
+				c.LastMod = u.LastMod
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// adPages lists every active ad with the time it last changed
+func adPages() ([]URL, error) {
+	rows, err := db.Query("SELECT a.id, COALESCE(a.updated_at, a.created_at) FROM Ad a WHERE " + activeAd + " ORDER BY a.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []URL
+	for rows.Next() {
+		var id int
+		var changed string
+		if err := rows.Scan(&id, &changed); err != nil {
+			return nil, err
+		}
+		urls = append(urls, URL{Loc: fmt.Sprintf("/ad/%d", id), LastMod: parseTime(changed)})
+	}
+	return urls, rows.Err()
+}
+
+// browsePages lists the make, make/year, make/year/model and
+// make/year/model/category pages that have active ads, each with the time
+// its newest ad changed
+func browsePages() ([]URL, error) {
+	rows, err := db.Query(`
+		SELECT m.name, y.year, mo.name, pc.name, MAX(COALESCE(a.updated_at, a.created_at))
+		FROM Ad a
+		JOIN AdCar ac ON ac.ad_id = a.id
+		JOIN Car c ON c.id = ac.car_id
+		JOIN Make m ON m.id = c.make_id
+		JOIN Year y ON y.id = c.year_id
+		JOIN Model mo ON mo.id = c.model_id
+		JOIN PartSubCategory psc ON psc.id = a.subcategory_id
+		JOIN PartCategory pc ON pc.id = psc.category_id
+		WHERE ` + activeAd + `
+		GROUP BY m.name, y.year, mo.name, pc.name
+		ORDER BY m.name, y.year, mo.name, pc.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Each row also stands for its make, year and model pages, which come
+	// first and take the latest change below them
+	var urls []URL
+	index := make(map[string]int)
+	add := func(path string, changed time.Time) {
+		if i, ok := index[path]; ok {
+			if changed.After(urls[i].LastMod) {
+				urls[i].LastMod = changed
+			}
+			return
+		}
+		index[path] = len(urls)
+		urls = append(urls, URL{Loc: path, LastMod: changed})
+	}
+	for rows.Next() {
+		var makeName, model, category, latest string
+		var year int
+		if err := rows.Scan(&makeName, &year, &model, &category, &latest); err != nil {
+			return nil, err
+		}
+		changed := parseTime(latest)
+		y := strconv.Itoa(year)
+		add(browse.Path(makeName), changed)
+		add(browse.Path(makeName, y), changed)
+		add(browse.Path(makeName, y, model), changed)
+		add(browse.Path(makeName, y, model, category), changed)
+	}
+	return urls, rows.Err()
+}
+
+// parseTime reads a stored timestamp, written either by the app or by
+// SQLite's CURRENT_TIMESTAMP
+func parseTime(s string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,111 @@
+package sitemap
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupMockDB mocks the database and empties the sitemap cache
+func setupMockDB(t *testing.T) sqlmock.Sqlmock {
+	mock := dbtest.Mock(t)
+
+	mu.Lock()
+	chunks, stamp, checkedAt = nil, "", time.Time{}
+	mu.Unlock()
+	return mock
+}
+
+func TestSplit(t *testing.T) {
+	early := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	var urls []URL
+	for i := 1; i <= 5; i++ {
+		urls = append(urls, URL{Loc: fmt.Sprintf("/ad/%d", i), LastMod: early})
+	}
+	urls[4].LastMod = late
+
+	chunks := split("ads", urls, 2)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, []string{"ads-1", "ads-2", "ads-3"}, []string{chunks[0].Name, chunks[1].Name, chunks[2].Name})
+	assert.Len(t, chunks[0].URLs, 2)
+	assert.Len(t, chunks[2].URLs, 1)
+	assert.Equal(t, early, chunks[0].LastMod)
+	assert.Equal(t, late, chunks[2].LastMod)
+
+	assert.Empty(t, split("ads", nil, 2))
+}
+
+func expectBuild(mock sqlmock.Sqlmock, stamp string) {
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COALESCE\\(MAX").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "latest"}).AddRow(2, stamp))
+	mock.ExpectQuery("SELECT m.name, y.year, mo.name, pc.name").
+		WillReturnRows(sqlmock.NewRows([]string{"make", "year", "model", "category", "latest"}).
+			AddRow("Ford", 2005, "F-150", "Electrical", "2026-03-01T10:00:00Z").
+			AddRow("Ford", 2005, "F-150", "Engine", "2026-03-02T10:00:00Z"))
+	mock.ExpectQuery("SELECT a.id, COALESCE\\(a.updated_at, a.created_at\\) FROM Ad a WHERE a.deleted_at IS NULL AND a.hidden_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "changed"}).
+			AddRow(4, "2026-03-01T10:00:00Z").
+			AddRow(9, "2026-03-02 10:00:00"))
+}
+
+func TestChunks_ListsPagesAndAds(t *testing.T) {
+	mock := setupMockDB(t)
+	expectBuild(mock, "2026-03-02T10:00:00Z")
+
+	all, err := Chunks()
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	pages := all[0]
+	assert.Equal(t, "pages-1", pages.Name)
+	var locs []string
+	for _, u := range pages.URLs {
+		locs = append(locs, u.Loc)
+	}
+	assert.Equal(t, []string{
+		"/", "/register", "/login", "/terms", "/privacy",
+		"/parts/ford", "/parts/ford/2005", "/parts/ford/2005/f-150",
+		"/parts/ford/2005/f-150/electrical", "/parts/ford/2005/f-150/engine",
+	}, locs)
+	// Shared pages take the latest change below them
+	latest := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, latest, pages.URLs[7].LastMod)
+	assert.Equal(t, latest, pages.URLs[0].LastMod)
+	assert.True(t, pages.URLs[1].LastMod.IsZero())
+
+	ads := all[1]
+	assert.Equal(t, "ads-1", ads.Name)
+	assert.Equal(t, []URL{
+		{Loc: "/ad/4", LastMod: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{Loc: "/ad/9", LastMod: latest},
+	}, ads.URLs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChunks_RebuildsWhenAdsChange(t *testing.T) {
+	mock := setupMockDB(t)
+	expectBuild(mock, "2026-03-02T10:00:00Z")
+	_, err := Chunks()
+	require.NoError(t, err)
+
+	// Unchanged ads are served from the cache
+	checkedAt = time.Time{}
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COALESCE\\(MAX").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "latest"}).AddRow(2, "2026-03-02T10:00:00Z"))
+	_, err = Chunks()
+	require.NoError(t, err)
+
+	// A changed ad rebuilds them
+	checkedAt = time.Time{}
+	expectBuild(mock, "2026-03-03T10:00:00Z")
+	_, found, err := Find("ads-1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,49 @@
+// Fitment rule helpers for the ad create/edit forms. Year range selects and
+// "All models"/"All engines" wildcards tick the matching checkboxes so the
+// model/engine cascade keeps working, and hand-editing a checkbox drops the rule.
+(function() {
+  function optionBoxes(container) {
+    return Array.from(container.querySelectorAll('input[type=checkbox]:not([data-fitment-all])'));
+  }
+
+  // Reload the next step of the cascade from the first option checkbox
+  function refreshCascade(boxes) {
+    if (boxes.length > 0 && window.htmx) {
+      htmx.trigger(boxes[0], 'change');
+    }
+  }
+
+  function applyYearRange(container) {
+    const from = parseInt(container.querySelector('[data-year-from]').value, 10);
+    const to = parseInt(container.querySelector('[data-year-to]').value, 10);
+    if (isNaN(from) || isNaN(to)) return;
+    const boxes = optionBoxes(container);
+    boxes.forEach(function(box) {
+      const year = parseInt(box.value, 10);
+      box.checked = year >= Math.min(from, to) && year <= Math.max(from, to);
+    });
+    refreshCascade(boxes);
+  }
+
+  document.addEventListener('change', function(e) {
+    const el = e.target;
+    const container = el.closest('[data-fitment-options]');
+    if (!container) return;
+
+    if (el.matches('[data-year-from], [data-year-to]')) {
+      applyYearRange(container);
+      return;
+    }
+    if (el.matches('[data-fitment-all]')) {
+      const boxes = optionBoxes(container);
+      boxes.forEach(function(box) { box.checked = el.checked; });
+      refreshCascade(boxes);
+      return;
+    }
+    // A checkbox changed by hand no longer matches the range or wildcard
+    if (e.isTrusted && el.matches('input[type=checkbox]')) {
+      container.querySelectorAll('[data-year-from], [data-year-to]').forEach(function(sel) { sel.value = ''; });
+      container.querySelectorAll('[data-fitment-all]').forEach(function(box) { box.checked = false; });
+    }
+  });
+})();
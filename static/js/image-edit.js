@@ -1,79 +1,125 @@
-// image-edit.js: Handles drag/drop reordering and deletion of ad images on the edit page
+// image-edit.js: Handles drag/drop reordering, cover photo selection and deletion of ad images on the edit forms.
+// Listeners are attached to the document so galleries loaded by htmx work too.
 
-document.addEventListener('DOMContentLoaded', function () {
-  const gallery = document.getElementById('image-gallery');
-  const orderInput = document.getElementById('image_order');
-  const deletedInput = document.getElementById('deleted_images');
+(function () {
+  if (window.imageEditReady) return;
+  window.imageEditReady = true;
 
-  if (!gallery) return;
-
-  // Drag and drop reordering
   let dragged = null;
 
-  gallery.addEventListener('dragstart', function (e) {
-    if (e.target.closest('[data-image-idx]')) {
-      dragged = e.target.closest('[data-image-idx]');
+  function galleryOf(el) {
+    return el.closest('#image-gallery');
+  }
+
+  function thumbOf(el) {
+    return el.closest('[data-image-id]');
+  }
+
+  // Hidden inputs live next to the gallery in the same form
+  function input(gallery, name) {
+    return gallery.closest('form').querySelector('input[name="' + name + '"]');
+  }
+
+  function updateOrderInput(gallery) {
+    const order = Array.from(gallery.querySelectorAll('[data-image-id]'))
+      .map(el => el.getAttribute('data-image-id'))
+      .filter(Boolean)
+      .join(',');
+    input(gallery, 'existing_image_order').value = order;
+  }
+
+  function markCover(gallery, id) {
+    input(gallery, 'primary_image').value = id || '';
+    gallery.querySelectorAll('[data-image-id]').forEach(el => {
+      const btn = el.querySelector('.cover-image-btn');
+      if (!btn) return;
+      const isCover = el.getAttribute('data-image-id') === id;
+      btn.textContent = isCover ? 'Cover' : '☆';
+      btn.classList.toggle('bg-yellow-300', isCover);
+      btn.classList.toggle('font-semibold', isCover);
+      btn.classList.toggle('bg-white', !isCover);
+      btn.classList.toggle('bg-opacity-80', !isCover);
+    });
+  }
+
+  // Let autosave pick up the change
+  function changed(gallery) {
+    gallery.closest('form').dispatchEvent(new Event('change', { bubbles: true }));
+  }
+
+  document.addEventListener('dragstart', function (e) {
+    const thumb = thumbOf(e.target);
+    if (thumb && galleryOf(thumb)) {
+      dragged = thumb;
       e.dataTransfer.effectAllowed = 'move';
     }
   });
 
-  gallery.addEventListener('dragover', function (e) {
-    e.preventDefault();
-    const over = e.target.closest('[data-image-idx]');
-    if (dragged && over && dragged !== over) {
+  document.addEventListener('dragover', function (e) {
+    const over = thumbOf(e.target);
+    if (dragged && over && dragged !== over && galleryOf(over) === galleryOf(dragged)) {
+      e.preventDefault();
       over.style.border = '2px dashed #888';
     }
   });
 
-  gallery.addEventListener('dragleave', function (e) {
-    const over = e.target.closest('[data-image-idx]');
-    if (over) {
+  document.addEventListener('dragleave', function (e) {
+    const over = thumbOf(e.target);
+    if (over && galleryOf(over)) {
       over.style.border = '';
     }
   });
 
-  gallery.addEventListener('drop', function (e) {
+  document.addEventListener('drop', function (e) {
+    const over = thumbOf(e.target);
+    if (!dragged || !over || dragged === over || galleryOf(over) !== galleryOf(dragged)) return;
     e.preventDefault();
-    const over = e.target.closest('[data-image-idx]');
-    if (dragged && over && dragged !== over) {
-      over.style.border = '';
-      // Move dragged before over
-      gallery.insertBefore(dragged, over);
-      updateOrderInput();
-    }
+    over.style.border = '';
+    const gallery = galleryOf(over);
+    // Move dragged before over
+    gallery.insertBefore(dragged, over);
+    updateOrderInput(gallery);
+    changed(gallery);
   });
 
-  gallery.addEventListener('dragend', function () {
-    Array.from(gallery.children).forEach(el => {
-      el.style.border = '';
-    });
+  document.addEventListener('dragend', function () {
+    if (dragged) {
+      Array.from(galleryOf(dragged).children).forEach(el => {
+        el.style.border = '';
+      });
+    }
+    dragged = null;
   });
 
-  // Delete image
-  gallery.addEventListener('click', function (e) {
+  document.addEventListener('click', function (e) {
+    const thumb = thumbOf(e.target);
+    const gallery = thumb && galleryOf(thumb);
+    if (!gallery) return;
+    const id = thumb.getAttribute('data-image-id');
+
+    if (e.target.closest('.cover-image-btn')) {
+      markCover(gallery, id);
+      changed(gallery);
+      return;
+    }
+
     if (e.target.closest('.delete-image-btn')) {
-      const thumb = e.target.closest('[data-image-idx]');
-      if (thumb) {
-        const idx = thumb.getAttribute('data-image-idx');
-        // Add to deleted list
-        let deleted = deletedInput.value ? deletedInput.value.split(',') : [];
-        if (!deleted.includes(idx)) {
-          deleted.push(idx);
-          deletedInput.value = deleted.filter(Boolean).join(',');
-        }
-        // Remove from DOM
-        thumb.remove();
-        updateOrderInput();
+      // Add to deleted list
+      const deletedInput = input(gallery, 'deleted_images');
+      let deleted = deletedInput.value ? deletedInput.value.split(',') : [];
+      if (!deleted.includes(id)) {
+        deleted.push(id);
+        deletedInput.value = deleted.filter(Boolean).join(',');
       }
+      // Remove from DOM
+      thumb.remove();
+      updateOrderInput(gallery);
+      // The first remaining image becomes the cover, as on the server
+      if (input(gallery, 'primary_image').value === id) {
+        const first = gallery.querySelector('[data-image-id]');
+        markCover(gallery, first ? first.getAttribute('data-image-id') : '');
+      }
+      changed(gallery);
     }
   });
-
-  function updateOrderInput() {
-    // Update the order input to reflect current DOM order
-    const order = Array.from(gallery.querySelectorAll('[data-image-idx]'))
-      .map(el => el.getAttribute('data-image-idx'))
-      .filter(Boolean)
-      .join(',');
-    orderInput.value = order;
-  }
-}); 
\ No newline at end of file
+})();
@@ -113,6 +113,13 @@
       input.files = dt.files;
     }
 
+    // Autosave has stored the pending files on the draft, which now shows them
+    document.body.addEventListener('draftImagesSaved', function() {
+      files = [];
+      updateInputFiles();
+      renderPreviews();
+    });
+
     input.addEventListener('change', function(e) {
       // Instead of replacing, append new files (if any)
       const newFiles = Array.from(input.files);
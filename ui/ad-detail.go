@@ -9,8 +9,6 @@ import (
 	. "maragu.dev/gomponents/html"
 
 	"github.com/parts-pile/site/ad"
-	"github.com/parts-pile/site/b2util"
-	"github.com/parts-pile/site/config"
 )
 
 func AdDetail(ad ad.Ad, loc *time.Location, userID int, view string) g.Node {
@@ -25,7 +23,12 @@ func AdDetail(ad ad.Ad, loc *time.Location, userID int, view string) g.Node {
 			// Title and buttons row
 			Div(
 				Class("flex flex-row items-center justify-between mb-2"),
-				Div(Class("font-semibold text-xl truncate"), titleNode(ad)),
+				Div(Class("flex flex-row items-center gap-2 min-w-0"),
+					Div(Class("font-semibold text-xl truncate"), titleNode(ad)),
+					pendingBadge(ad),
+					g.If(userID == ad.UserID, hiddenBadge(ad)),
+					pendingClearButton(ad, userID),
+				),
 				Div(Class("flex flex-row items-center gap-2 ml-2"),
 					g.If(userID != 0, BookmarkButton(ad)),
 					g.If(userID != 0, messageButton(ad, userID)),
@@ -39,8 +42,15 @@ func AdDetail(ad ad.Ad, loc *time.Location, userID int, view string) g.Node {
 				Div(Class("text-gray-400"), ageNode(ad, loc)),
 				locationFlagNode(ad),
 			),
+			// Price trend, loaded after the detail renders
+			priceTrendLoader(ad),
+			// Uploaded images the seller is still waiting on
+			imageStatusLoader(ad, userID),
+			// Part attributes
+			partAttributesNode(ad),
 			// Description
 			Div(Class("text-base mt-2"), g.Text(ad.Description)),
+			reportAdForm(ad, userID),
 		),
 	)
 }
@@ -63,26 +73,18 @@ func closeButton(ad ad.Ad, view string) g.Node {
 	)
 }
 
-// adCarouselImageSrc generates a single signed B2 image URL for carousel context
-func AdCarouselImageSrc(adID int, idx int) string {
-	prefix := fmt.Sprintf("%d/", adID)
-	token, err := b2util.GetB2DownloadTokenForPrefixCached(prefix)
-	if err != nil || token == "" {
-		// Return empty string when B2 images aren't available - browser will show broken image
-		return ""
-	}
-
-	base := fmt.Sprintf("%s/%d/%d", config.B2FileServerURL, adID, idx)
+// AdCarouselImageSrc generates a single signed image URL for carousel context
+func AdCarouselImageSrc(img ad.Image) string {
 	// Use 1200w for carousel - high quality for main display
-	return fmt.Sprintf("%s-1200w.webp?Authorization=%s", base, token)
+	return adImageURL(img, "1200w")
 }
 
-func AdCarouselImage(adID int, idx int) g.Node {
+func AdCarouselImage(img ad.Image) g.Node {
 	return Img(
 		Class("object-contain w-full h-full bg-gray-100 transition-opacity duration-200"),
-		ID(fmt.Sprintf("ad-carousel-img-%d", adID)),
-		Src(AdCarouselImageSrc(adID, idx)),
-		Alt(fmt.Sprintf("Image %d", idx)),
+		ID(fmt.Sprintf("ad-carousel-img-%d", img.AdID)),
+		Src(AdCarouselImageSrc(img)),
+		Alt(fmt.Sprintf("Image %d", img.Position)),
 	)
 }
 
@@ -104,33 +106,33 @@ func imageNode(ad ad.Ad) g.Node {
 			Class("relative w-full h-full flex flex-col"),
 			Div(
 				Class("flex-1 flex items-center justify-center"),
-				g.If(ad.ImageCount > 0, AdCarouselImage(ad.ID, 1)),
-				g.If(ad.ImageCount == 0, AdNoImage()),
+				coverImageNode(ad),
 			),
 			Div(
 				Class("flex-shrink-0 p-4"),
-				g.If(ad.ImageCount > 0, thumbnails(ad)),
+				g.If(len(ad.Images) > 0, thumbnails(ad)),
 			),
 		),
 	)
 }
 
-// adThumbnailImageSrc generates a single signed B2 image URL for thumbnail context
-func adThumbnailImageSrc(adID int, idx int) string {
-	prefix := fmt.Sprintf("%d/", adID)
-	token, err := b2util.GetB2DownloadTokenForPrefixCached(prefix)
-	if err != nil || token == "" {
-		// Return empty string when B2 images aren't available - browser will show broken image
-		return ""
+// coverImageNode shows the ad's cover photo first
+func coverImageNode(ad ad.Ad) g.Node {
+	cover, ok := ad.Cover()
+	if !ok {
+		return AdNoImage()
 	}
+	return AdCarouselImage(cover)
+}
 
-	base := fmt.Sprintf("%s/%d/%d", config.B2FileServerURL, adID, idx)
+// adThumbnailImageSrc generates a single signed image URL for thumbnail context
+func adThumbnailImageSrc(img ad.Image) string {
 	// Use 160w for thumbnails - small size for navigation
-	return fmt.Sprintf("%s-160w.webp?Authorization=%s", base, token)
+	return adImageURL(img, "160w")
 }
 
-func adThumbnailImage(adID int, idx int, alt string) g.Node {
-	src := adThumbnailImageSrc(adID, idx)
+func adThumbnailImage(img ad.Image, alt string) g.Node {
+	src := adThumbnailImageSrc(img)
 
 	return Img(
 		Src(src),
@@ -144,14 +146,14 @@ func thumbnails(ad ad.Ad) g.Node {
 		Class("flex flex-row gap-2 mt-2 px-4 justify-center"),
 		g.Group(func() []g.Node {
 			nodes := []g.Node{}
-			for i := 1; i <= ad.ImageCount; i++ {
+			for i, img := range ad.Images {
 				nodes = append(nodes, Button(
 					Type("button"),
 					Class("border rounded w-16 h-16 overflow-hidden p-0 focus:outline-none"),
-					hx.Get(fmt.Sprintf("/ad/image/%d/%d", ad.ID, i)),
+					hx.Get(fmt.Sprintf("/ad/image/%d/%d", ad.ID, img.ID)),
 					hx.Target(fmt.Sprintf("#ad-carousel-img-%d", ad.ID)),
 					hx.Swap("outerHTML"),
-					adThumbnailImage(ad.ID, i, fmt.Sprintf("Image %d", i)),
+					adThumbnailImage(img, fmt.Sprintf("Image %d", i+1)),
 				))
 			}
 			return nodes
@@ -205,6 +207,22 @@ func deleteButton(ad ad.Ad, userID int) g.Node {
 	)
 }
 
+// pendingClearButton lets the seller put a pending ad back on the market
+func pendingClearButton(ad ad.Ad, userID int) g.Node {
+	if userID != ad.UserID || !ad.IsPending() {
+		return g.Node(nil)
+	}
+
+	return Button(
+		Type("button"),
+		Class("text-xs text-blue-500 hover:underline focus:outline-none"),
+		hx.Post(fmt.Sprintf("/api/clear-pending/%d", ad.ID)),
+		hx.Target(adTarget(ad)),
+		hx.Swap("outerHTML"),
+		g.Text("Mark available"),
+	)
+}
+
 func editButton(ad ad.Ad, userID int) g.Node {
 	if userID != ad.UserID {
 		return g.Node(nil)
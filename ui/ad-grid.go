@@ -9,15 +9,13 @@ import (
 	. "maragu.dev/gomponents/html"
 
 	"github.com/parts-pile/site/ad"
-	"github.com/parts-pile/site/b2util"
-	"github.com/parts-pile/site/config"
 )
 
 // AdGridNode renders a grid view of ad
 func AdGridNode(ad ad.Ad, loc *time.Location, userID int) g.Node {
 	imageNode := Div(
 		Class("relative w-full h-48 bg-gray-100 overflow-hidden"),
-		g.If(ad.ImageCount > 0, adGridImage(ad.ID, ad.Title)),
+		adGridImage(ad),
 		Div(
 			Class("absolute top-0 left-0 bg-white text-green-600 text-base font-normal px-2 rounded-br-md"),
 			priceNode(ad),
@@ -31,6 +29,7 @@ func AdGridNode(ad ad.Ad, loc *time.Location, userID int) g.Node {
 		hx.Get(fmt.Sprintf("/ad/detail/%d?view=grid", ad.ID)),
 		hx.Target(adTarget(ad)),
 		hx.Swap("outerHTML"),
+		hx.Include("#searchBox"),
 
 		Div(
 			Class("rounded-t-lg overflow-hidden"),
@@ -41,9 +40,20 @@ func AdGridNode(ad ad.Ad, loc *time.Location, userID int) g.Node {
 			// Title and bookmark row
 			Div(
 				Class("flex flex-row items-center justify-between"),
-				Div(Class("font-semibold text-base truncate"), titleNode(ad)),
+				Div(Class("flex flex-row items-center gap-1 min-w-0"),
+					Div(Class("font-semibold text-base truncate"), titleNode(ad)),
+					pendingBadge(ad),
+				),
 				g.If(userID != 0, BookmarkButton(ad)),
 			),
+			// Condition and part number row
+			g.If(ad.Condition != "" || ad.PartNumber != "",
+				Div(
+					Class("flex flex-row items-center justify-between text-xs text-gray-500"),
+					conditionBadge(ad),
+					g.If(ad.PartNumber != "", Span(Class("truncate"), g.Text(ad.PartNumber))),
+				),
+			),
 			// Age and location row
 			Div(
 				Class("flex flex-row items-center justify-between text-xs text-gray-500"),
@@ -54,26 +64,23 @@ func AdGridNode(ad ad.Ad, loc *time.Location, userID int) g.Node {
 	)
 }
 
-// adGridImageSrc generates a single signed B2 image URL for grid context
-func adGridImageSrc(adID int, idx int) string {
-	prefix := fmt.Sprintf("%d/", adID)
-	token, err := b2util.GetB2DownloadTokenForPrefixCached(prefix)
-	if err != nil || token == "" {
-		// Return empty string when B2 images aren't available - browser will show broken image
-		return ""
-	}
-
-	base := fmt.Sprintf("%s/%d/%d", config.B2FileServerURL, adID, idx)
+// adGridImageSrc generates a single signed image URL for grid context
+func adGridImageSrc(img ad.Image) string {
 	// Use 480w for grid cards - good balance of quality and file size for fixed grid layout
-	return fmt.Sprintf("%s-480w.webp?Authorization=%s", base, token)
+	return adImageURL(img, "480w")
 }
 
-func adGridImage(adID int, alt string) g.Node {
-	src := adGridImageSrc(adID, 1)
+// adGridImage shows the ad's cover photo on its card
+func adGridImage(ad ad.Ad) g.Node {
+	cover, ok := ad.Cover()
+	if !ok {
+		return nil
+	}
+	src := adGridImageSrc(cover)
 
 	return Img(
 		Src(src),
-		Alt(alt),
+		Alt(ad.Title),
 		Class("object-contain w-full aspect-square bg-gray-100"),
 	)
 }
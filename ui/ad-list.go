@@ -20,6 +20,8 @@ func AdListNode(ad ad.Ad, loc *time.Location, userID int) g.Node {
 		hx.Get(fmt.Sprintf("/ad/detail/%d?view=list", ad.ID)),
 		hx.Target(adTarget(ad)),
 		hx.Swap("outerHTML"),
+		// Send the search query along so the view is attributed to it
+		hx.Include("#searchBox"),
 
 		g.If(userID != 0, BookmarkButton(ad)),
 
@@ -27,6 +29,11 @@ func AdListNode(ad ad.Ad, loc *time.Location, userID int) g.Node {
 			Class("flex-1 text-blue-600 hover:text-blue-800"),
 			titleNode(ad),
 		),
+		Div(
+			Class("mr-4 flex gap-1"),
+			pendingBadge(ad),
+			conditionBadge(ad),
+		),
 		Div(
 			Class("mr-4 text-xs text-gray-500"),
 			locationFlagNode(ad),
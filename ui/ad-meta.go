@@ -0,0 +1,151 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	g "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/config"
+)
+
+// Prices are listed in US dollars
+const priceCurrency = "USD"
+
+// Longest description shown in link previews
+const shareDescriptionLength = 200
+
+// schemaConditions maps part conditions to schema.org item conditions
+var schemaConditions = map[string]string{
+	ad.ConditionNew:            "https://schema.org/NewCondition",
+	ad.ConditionUsed:           "https://schema.org/UsedCondition",
+	ad.ConditionRemanufactured: "https://schema.org/RefurbishedCondition",
+}
+
+// absoluteURL prefixes site-relative URLs with the site's base URL, as link
+// previews need full URLs
+func absoluteURL(url string) string {
+	if strings.HasPrefix(url, "/") {
+		return strings.TrimSuffix(config.BaseURL, "/") + url
+	}
+	return url
+}
+
+// adShareImage returns the full, lasting URL of the ad's cover photo, or an
+// empty string when it has none. Link previews are cached far longer than
+// signed image URLs last, so they get the permalink.
+func adShareImage(adObj ad.Ad) string {
+	cover, ok := adObj.Cover()
+	if !ok || len(cover.Variants) == 0 {
+		return ""
+	}
+	return absoluteURL(AdImagePermalink(cover))
+}
+
+// adShareDescription returns the start of the ad's description on one line
+func adShareDescription(adObj ad.Ad) string {
+	desc := strings.Join(strings.Fields(adObj.Description), " ")
+	if runes := []rune(desc); len(runes) > shareDescriptionLength {
+		desc = strings.TrimSpace(string(runes[:shareDescriptionLength-1])) + "…"
+	}
+	return desc
+}
+
+// adAvailability returns the ad's availability as a schema.org URL for the
+// Product markup and as the Open Graph product:availability value
+func adAvailability(adObj ad.Ad) (schema, og string) {
+	switch {
+	case adObj.IsArchived():
+		return "https://schema.org/SoldOut", "out of stock"
+	case adObj.IsPending():
+		return "https://schema.org/LimitedAvailability", "pending"
+	}
+	return "https://schema.org/InStock", "in stock"
+}
+
+// adShareMeta returns the Open Graph and Twitter card tags and the schema.org
+// Product markup that make shared ad links render as previews
+func adShareMeta(adObj ad.Ad) []g.Node {
+	url := absoluteURL(fmt.Sprintf("/ad/%d", adObj.ID))
+	price := fmt.Sprintf("%.2f", adObj.Price)
+	description := adShareDescription(adObj)
+	image := adShareImage(adObj)
+	location := locationText(adObj)
+
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+	_, availability := adAvailability(adObj)
+
+	return []g.Node{
+		Meta(Name("description"), Content(description)),
+		Link(Rel("canonical"), Href(url)),
+		Meta(g.Attr("property", "og:type"), Content("product")),
+		Meta(g.Attr("property", "og:site_name"), Content("Parts Pile")),
+		Meta(g.Attr("property", "og:url"), Content(url)),
+		Meta(g.Attr("property", "og:title"), Content(adObj.Title)),
+		Meta(g.Attr("property", "og:description"), Content(description)),
+		g.If(image != "", Meta(g.Attr("property", "og:image"), Content(image))),
+		Meta(g.Attr("property", "product:price:amount"), Content(price)),
+		Meta(g.Attr("property", "product:price:currency"), Content(priceCurrency)),
+		Meta(g.Attr("property", "product:availability"), Content(availability)),
+		g.If(adObj.Condition != "", Meta(g.Attr("property", "product:condition"), Content(adObj.Condition))),
+		Meta(Name("twitter:card"), Content(card)),
+		Meta(Name("twitter:title"), Content(adObj.Title)),
+		Meta(Name("twitter:description"), Content(description)),
+		g.If(image != "", Meta(Name("twitter:image"), Content(image))),
+		Meta(Name("twitter:label1"), Content("Price")),
+		Meta(Name("twitter:data1"), Content("$"+price)),
+		g.If(location != "", Meta(Name("twitter:label2"), Content("Location"))),
+		g.If(location != "", Meta(Name("twitter:data2"), Content(location))),
+		adProductJSONLD(adObj, url, description, image),
+	}
+}
+
+// adProductJSONLD returns the ad as schema.org Product and Offer markup
+func adProductJSONLD(adObj ad.Ad, url, description, image string) g.Node {
+	availability, _ := adAvailability(adObj)
+	offer := map[string]any{
+		"@type":         "Offer",
+		"url":           url,
+		"price":         fmt.Sprintf("%.2f", adObj.Price),
+		"priceCurrency": priceCurrency,
+		"availability":  availability,
+	}
+	if condition, ok := schemaConditions[adObj.Condition]; ok {
+		offer["itemCondition"] = condition
+	}
+	if location := locationText(adObj); location != "" {
+		offer["availableAtOrFrom"] = map[string]any{"@type": "Place", "name": location}
+	}
+
+	product := map[string]any{
+		"@context":    "https://schema.org",
+		"@type":       "Product",
+		"name":        adObj.Title,
+		"description": description,
+		"offers":      offer,
+	}
+	if image != "" {
+		product["image"] = image
+	}
+	if adObj.PartNumber != "" {
+		product["mpn"] = adObj.PartNumber
+	}
+	if adObj.SubCategory.Valid {
+		product["category"] = adObj.SubCategory.String
+	}
+
+	// Marshal escapes <, > and &, so the script can't be closed early
+	data, err := json.Marshal(product)
+	if err != nil {
+		log.Printf("[seo] Failed to encode product markup for ad %d: %v", adObj.ID, err)
+		return nil
+	}
+	return Script(Type("application/ld+json"), g.Raw(string(data)))
+}
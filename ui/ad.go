@@ -2,7 +2,8 @@ package ui
 
 import (
 	"fmt"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,7 +12,7 @@ import (
 	. "maragu.dev/gomponents/html"
 
 	"github.com/parts-pile/site/ad"
-	"github.com/parts-pile/site/b2util"
+	"github.com/parts-pile/site/imagestore"
 	"github.com/parts-pile/site/user"
 )
 
@@ -33,6 +34,49 @@ func titleNode(ad ad.Ad) g.Node {
 	return g.Text(ad.Title)
 }
 
+// pendingBadge marks ads with a pending sale, or returns nil
+func pendingBadge(ad ad.Ad) g.Node {
+	if !ad.IsPending() {
+		return nil
+	}
+	return Span(
+		Class("text-xs font-medium text-yellow-800 bg-yellow-100 rounded px-1"),
+		g.Text("Pending"),
+	)
+}
+
+// conditionBadge returns a small condition label, or nil when the condition is not set
+func conditionBadge(ad ad.Ad) g.Node {
+	if ad.Condition == "" {
+		return nil
+	}
+	return Span(
+		Class("text-xs text-gray-600 bg-gray-100 rounded px-1"),
+		g.Text(ad.ConditionLabel()),
+	)
+}
+
+// partAttributesNode returns the ad's structured part attributes as a definition list
+func partAttributesNode(a ad.Ad) g.Node {
+	if !a.HasPartAttributes() {
+		return nil
+	}
+	row := func(label, value string) g.Node {
+		return g.Group([]g.Node{
+			Dt(Class("text-gray-500"), g.Text(label)),
+			Dd(Class("text-gray-900"), g.Text(value)),
+		})
+	}
+	return Dl(
+		Class("grid grid-cols-2 md:grid-cols-4 gap-x-4 gap-y-1 text-sm"),
+		g.If(a.Condition != "", row("Condition", a.ConditionLabel())),
+		g.If(a.PartNumber != "", row("OEM Part #", a.PartNumber)),
+		g.If(a.Quantity > 1, row("Quantity", fmt.Sprintf("%d", a.Quantity))),
+		g.If(a.Position != "", row("Position", a.Position)),
+		g.If(a.CoreCharge > 0, row("Core Charge", fmt.Sprintf("$%.2f", a.CoreCharge))),
+	)
+}
+
 // Returns the Unicode flag for a given country code (e.g., "US" -> 🇺🇸)
 func countryFlag(country string) string {
 	if len(country) != 2 {
@@ -42,8 +86,9 @@ func countryFlag(country string) string {
 	return string(rune(int32(code[0])-'A'+0x1F1E6)) + string(rune(int32(code[1])-'A'+0x1F1E6))
 }
 
-// locationFlagNode returns a Div containing flag and location text
-func locationFlagNode(ad ad.Ad) g.Node {
+// locationText returns the ad's "City, Region" text, or whichever of the
+// two is known
+func locationText(ad ad.Ad) string {
 	var city string
 	if ad.City.Valid {
 		city = ad.City.String
@@ -52,31 +97,33 @@ func locationFlagNode(ad ad.Ad) g.Node {
 	if ad.AdminArea.Valid {
 		adminArea = ad.AdminArea.String
 	}
+
+	if city != "" && adminArea != "" {
+		return city + ", " + adminArea
+	} else if city != "" {
+		return city
+	}
+	return adminArea
+}
+
+// locationFlagNode returns a Div containing flag and location text
+func locationFlagNode(ad ad.Ad) g.Node {
 	var country string
 	if ad.Country.Valid {
 		country = ad.Country.String
 	}
+	text := locationText(ad)
 
 	// Return nil if no location data
-	if city == "" && adminArea == "" && country == "" {
+	if text == "" && country == "" {
 		return nil
 	}
 
-	// Build location text
-	var locationText string
-	if city != "" && adminArea != "" {
-		locationText = city + ", " + adminArea
-	} else if city != "" {
-		locationText = city
-	} else if adminArea != "" {
-		locationText = adminArea
-	}
-
 	// Return Div with flag and location text
 	return Div(
 		Class("flex items-center"),
 		g.Text(countryFlag(country)),
-		Span(Class("ml-1"), g.Text(locationText)),
+		Span(Class("ml-1"), g.Text(text)),
 	)
 }
 
@@ -160,10 +207,11 @@ func BookmarkButton(ad ad.Ad) g.Node {
 }
 
 func AdPage(adObj ad.Ad, currentUser *user.User, userID int, path string, loc *time.Location, view string) g.Node {
-	return Page(
+	return PageWithMeta(
 		fmt.Sprintf("Ad %d - Parts Pile", adObj.ID),
 		currentUser,
 		path,
+		adShareMeta(adObj),
 		[]g.Node{
 			AdDetail(adObj, loc, userID, view),
 		},
@@ -173,7 +221,8 @@ func AdPage(adObj ad.Ad, currentUser *user.User, userID int, path string, loc *t
 // ---- Ad Components ----
 
 // AdEditPartial renders the ad edit form for inline editing
-func AdEditPartial(adObj ad.Ad, makes, years, models, engines, categories, subcategories []string, cancelTarget, htmxTarget string, view ...string) g.Node {
+func AdEditPartial(adObj ad.Ad, draft ad.Draft, draftImages []ad.DraftImage, makes []string, fitmentOpts []FitmentGroupOptions, categories, subcategories []string, cancelTarget, htmxTarget string, view ...string) g.Node {
+	opts := primaryFitmentOptions(fitmentOpts)
 	editForm := Div(
 		ID(fmt.Sprintf("ad-%d", adObj.ID)),
 		Class("border p-4 mb-4 rounded bg-white shadow-lg relative"),
@@ -220,70 +269,8 @@ func AdEditPartial(adObj ad.Ad, makes, years, models, engines, categories, subca
 					}()),
 				),
 			),
-			formGroup("Years", "years", Div(ID("yearsDiv"), GridContainer(5, func() []g.Node {
-				yearCheckboxes := []g.Node{}
-				for _, year := range years {
-					isChecked := false
-					for _, adYear := range adObj.Years {
-						if year == adYear {
-							isChecked = true
-							break
-						}
-					}
-					yearCheckboxes = append(yearCheckboxes,
-						Checkbox("years", year, year, isChecked, false,
-							hx.Trigger("change"),
-							hx.Get("/api/models"),
-							hx.Target("#modelsDiv"),
-							hx.Include("[name='make'],[name='years']:checked"),
-						),
-					)
-				}
-				return yearCheckboxes
-			}()...))),
-			formGroup("Models", "models", Div(ID("modelsDiv"), GridContainer(5, func() []g.Node {
-				modelCheckboxes := []g.Node{}
-				sortedModels := make([]string, len(models))
-				copy(sortedModels, models)
-				sort.Strings(sortedModels)
-				for _, modelName := range sortedModels {
-					isChecked := false
-					for _, adModel := range adObj.Models {
-						if modelName == adModel {
-							isChecked = true
-							break
-						}
-					}
-					modelCheckboxes = append(modelCheckboxes,
-						Checkbox("models", modelName, modelName, isChecked, false,
-							hx.Trigger("change"),
-							hx.Get("/api/engines"),
-							hx.Target("#enginesDiv"),
-							hx.Include("[name='make'],[name='years']:checked,[name='models']:checked"),
-						),
-					)
-				}
-				return modelCheckboxes
-			}()...))),
-			formGroup("Engines", "engines", Div(ID("enginesDiv"), GridContainer(5, func() []g.Node {
-				engineCheckboxes := []g.Node{}
-				sortedEngines := make([]string, len(engines))
-				copy(sortedEngines, engines)
-				sort.Strings(sortedEngines)
-				for _, engineName := range sortedEngines {
-					isChecked := false
-					for _, adEngine := range adObj.Engines {
-						if engineName == adEngine {
-							isChecked = true
-							break
-						}
-					}
-					engineCheckboxes = append(engineCheckboxes,
-						Checkbox("engines", engineName, engineName, isChecked, false),
-					)
-				}
-				return engineCheckboxes
-			}()...))),
+			fitmentOptionFields(0, opts, primaryFitment(adObj.FitmentGroups())),
+			extraFitmentGroups(makes, adObj.FitmentGroups(), fitmentOpts),
 			CategoriesFormGroup(categories, func() string {
 				if adObj.Category.Valid {
 					return adObj.Category.String
@@ -296,56 +283,13 @@ func AdEditPartial(adObj ad.Ad, makes, years, models, engines, categories, subca
 				// Show subcategories if they exist
 				func() g.Node {
 					if len(subcategories) > 0 {
-						return SubCategoriesFormGroup(subcategories, "")
+						return SubCategoriesFormGroup(subcategories, adObj.SubCategory.String)
 					}
 					return g.Text("")
 				}(),
 			),
-			formGroup("Images", "images",
-				Div(
-					// New: Image gallery for existing images
-					Div(
-						ID("image-gallery"),
-						Class("flex flex-row gap-2 mb-2"),
-						g.Group(func() []g.Node {
-							imageNodes := []g.Node{}
-							for i := 1; i <= adObj.ImageCount; i++ {
-								imageNodes = append(imageNodes,
-									Div(
-										Class("relative group"),
-										g.Attr("data-image-idx", fmt.Sprintf("%d", i)),
-										AdImageWithFallbackSrcSet(adObj.ID, i, fmt.Sprintf("Image %d", i), "grid"),
-										Button(
-											Type("button"),
-											Class("absolute top-0 right-0 bg-white bg-opacity-80 rounded-full p-1 text-red-600 hover:text-red-800 z-10 delete-image-btn"),
-											g.Attr("onclick", fmt.Sprintf("deleteImage(this, %d)", i)),
-											Img(Src("/images/trashcan.svg"), Alt("Delete"), Class("w-4 h-4")),
-										),
-									),
-								)
-							}
-							return imageNodes
-						}()),
-					),
-					// Hidden input for deleted images (comma-separated indices)
-					Input(
-						Type("hidden"),
-						ID("deleted_images"),
-						Name("deleted_images"),
-						Value(""),
-					),
-					// File input for adding new images
-					Input(
-						Type("file"),
-						ID("images"),
-						Name("images"),
-						Class("w-full p-2 border rounded"),
-						g.Attr("accept", "image/*"),
-						g.Attr("multiple"),
-					),
-					Div(ID("image-preview")),
-				),
-			),
+			partAttributesDiv(adObj, adObj.SubCategory.String),
+			formGroup("Images", "images", imageGallery(adObj, draft)),
 			formGroup("Description", "description",
 				Textarea(
 					ID("description"),
@@ -373,8 +317,10 @@ func AdEditPartial(adObj ad.Ad, makes, years, models, engines, categories, subca
 					Name("location"),
 					Class("w-full p-2 border rounded"),
 					Placeholder("(Optional)"),
+					Value(draft.Fields.Location),
 				),
 			),
+			draftAutosave("editAdForm", draft, draftImages),
 			Div(
 				Class("flex flex-row gap-2 justify-end"),
 				Button(
@@ -396,13 +342,14 @@ func AdEditPartial(adObj ad.Ad, makes, years, models, engines, categories, subca
 
 // ---- Ad Pages ----
 
-func NewAdPage(currentUser *user.User, path string, makes []string, categories []string) g.Node {
-	makeOptions := []g.Node{}
-	for _, makeName := range makes {
-		makeOptions = append(makeOptions,
-			Option(Value(makeName), g.Text(makeName)),
-		)
-	}
+// NewAdPage renders the new ad form. When resuming a draft, the draft's values
+// and the option lists for its make/years/models/category pre-fill the form.
+func NewAdPage(currentUser *user.User, path string, draft ad.Draft, draftImages []ad.DraftImage, makes []string, fitmentOpts []FitmentGroupOptions, categories, subcategories []string) g.Node {
+	f := draft.Fields
+
+	// Part attribute inputs and fitment groups read their values from an ad
+	var draftAd ad.Ad
+	draft.ApplyTo(&draftAd)
 
 	return Page(
 		"New Ad - Parts Pile",
@@ -424,39 +371,20 @@ func NewAdPage(currentUser *user.User, path string, makes []string, categories [
 						Name("title"),
 						Class("w-full p-2 border rounded"),
 						Required(),
+						Value(f.Title),
 					),
 				),
-				formGroup("Make", "make",
-					Select(
-						ID("make"),
-						Name("make"),
-						Class("w-full p-2 border rounded"),
-						hx.Trigger("change"),
-						hx.Get("/api/years"),
-						hx.Target("#yearsDiv"),
-						hx.Include("this"),
-						g.Attr("onchange", "document.getElementById('modelsDiv').innerHTML = ''; document.getElementById('enginesDiv').innerHTML = '';"),
-						Option(Value(""), g.Text("Select a make")),
-						g.Group(makeOptions),
-					),
-				),
-				Div(
-					ID("yearsDiv"),
-					Class("space-y-2"),
-				),
-				Div(
-					ID("modelsDiv"),
-					Class("space-y-2"),
-				),
-				Div(
-					ID("enginesDiv"),
-					Class("space-y-2"),
-				),
-				CategoriesFormGroup(categories, ""),
+				// Entering a part number the interchange knows fills in fitment
 				Div(
-					ID("subcategoriesDiv"),
-					Class("space-y-2"),
+					ID("partNumberFitment"),
+					hx.Get("/api/part-number-fitment"),
+					hx.Trigger("change[target.id=='"+ad.AttrPartNumber+"'] from:body"),
+					hx.Include("#"+ad.AttrPartNumber+",#make"),
 				),
+				FitmentFields(makes, draftAd.FitmentGroups(), fitmentOpts),
+				CategorySearchFormGroup(),
+				CategoryFields(categories, f.Category, subcategories, f.SubCategory),
+				partAttributesDiv(draftAd, f.SubCategory),
 				formGroup("Images", "images",
 					Div(
 						Input(
@@ -476,6 +404,7 @@ func NewAdPage(currentUser *user.User, path string, makes []string, categories [
 						Name("description"),
 						Class("w-full p-2 border rounded"),
 						Rows("4"),
+						g.Text(f.Description),
 					),
 				),
 				formGroup("Price", "price",
@@ -486,6 +415,7 @@ func NewAdPage(currentUser *user.User, path string, makes []string, categories [
 						Class("w-full p-2 border rounded"),
 						Step("0.01"),
 						Min("0"),
+						Value(f.Price),
 					),
 				),
 				formGroup("Location", "location",
@@ -495,8 +425,10 @@ func NewAdPage(currentUser *user.User, path string, makes []string, categories [
 						Name("location"),
 						Class("w-full p-2 border rounded"),
 						Placeholder("(Optional)"),
+						Value(f.Location),
 					),
 				),
+				draftAutosave("newAdForm", draft, draftImages),
 				styledButton("Submit", buttonPrimary,
 					Type("submit"),
 				),
@@ -507,7 +439,8 @@ func NewAdPage(currentUser *user.User, path string, makes []string, categories [
 	)
 }
 
-func EditAdPage(currentUser *user.User, path string, currentAd ad.Ad, makes, years, models, engines, categories, subcategories []string) g.Node {
+func EditAdPage(currentUser *user.User, path string, currentAd ad.Ad, draft ad.Draft, draftImages []ad.DraftImage, makes []string, fitmentOpts []FitmentGroupOptions, categories, subcategories []string) g.Node {
+	opts := primaryFitmentOptions(fitmentOpts)
 	// Prepare make options
 	makeOptions := []g.Node{}
 	for _, makeName := range makes {
@@ -519,69 +452,6 @@ func EditAdPage(currentUser *user.User, path string, currentAd ad.Ad, makes, yea
 		makeOptions = append(makeOptions, Option(attrs...))
 	}
 
-	// Prepare year checkboxes
-	yearCheckboxes := []g.Node{}
-	for _, year := range years {
-		isChecked := false
-		for _, adYear := range currentAd.Years {
-			if year == adYear {
-				isChecked = true
-				break
-			}
-		}
-		yearCheckboxes = append(yearCheckboxes,
-			Checkbox("years", year, year, isChecked, false,
-				hx.Trigger("change"),
-				hx.Get("/api/models"),
-				hx.Target("#modelsDiv"),
-				hx.Include("[name='make'],[name='years']:checked"),
-			),
-		)
-	}
-
-	// Prepare model checkboxes
-	modelCheckboxes := []g.Node{}
-	sortedModels := make([]string, len(models))
-	copy(sortedModels, models)
-	sort.Strings(sortedModels)
-
-	for _, modelName := range sortedModels {
-		isChecked := false
-		for _, adModel := range currentAd.Models {
-			if modelName == adModel {
-				isChecked = true
-				break
-			}
-		}
-		modelCheckboxes = append(modelCheckboxes,
-			Checkbox("models", modelName, modelName, isChecked, false,
-				hx.Trigger("change"),
-				hx.Get("/api/engines"),
-				hx.Target("#enginesDiv"),
-				hx.Include("[name='make'],[name='years']:checked,[name='models']:checked"),
-			),
-		)
-	}
-
-	// Prepare engine checkboxes
-	engineCheckboxes := []g.Node{}
-	sortedEngines := make([]string, len(engines))
-	copy(sortedEngines, engines)
-	sort.Strings(sortedEngines)
-
-	for _, engineName := range sortedEngines {
-		isChecked := false
-		for _, adEngine := range currentAd.Engines {
-			if engineName == adEngine {
-				isChecked = true
-				break
-			}
-		}
-		engineCheckboxes = append(engineCheckboxes,
-			Checkbox("engines", engineName, engineName, isChecked, false),
-		)
-	}
-
 	// Define htmxTarget for this form
 	htmxTarget := fmt.Sprintf("#ad-%d", currentAd.ID)
 
@@ -606,6 +476,7 @@ func EditAdPage(currentUser *user.User, path string, currentAd ad.Ad, makes, yea
 						Name("title"),
 						Class("w-full p-2 border rounded"),
 						Required(),
+						Value(currentAd.Title),
 					),
 				),
 				formGroup("Make", "make",
@@ -622,9 +493,8 @@ func EditAdPage(currentUser *user.User, path string, currentAd ad.Ad, makes, yea
 						g.Group(makeOptions),
 					),
 				),
-				formGroup("Years", "years", Div(ID("yearsDiv"), GridContainer(5, yearCheckboxes...))),
-				formGroup("Models", "models", Div(ID("modelsDiv"), GridContainer(5, modelCheckboxes...))),
-				formGroup("Engines", "engines", Div(ID("enginesDiv"), GridContainer(5, engineCheckboxes...))),
+				fitmentOptionFields(0, opts, primaryFitment(currentAd.FitmentGroups())),
+				extraFitmentGroups(makes, currentAd.FitmentGroups(), fitmentOpts),
 				CategoriesFormGroup(categories, func() string {
 					if currentAd.Category.Valid {
 						return currentAd.Category.String
@@ -637,69 +507,20 @@ func EditAdPage(currentUser *user.User, path string, currentAd ad.Ad, makes, yea
 					// Show subcategories if they exist
 					func() g.Node {
 						if len(subcategories) > 0 {
-							return SubCategoriesFormGroup(subcategories, "")
+							return SubCategoriesFormGroup(subcategories, currentAd.SubCategory.String)
 						}
 						return g.Text("")
 					}(),
 				),
-				formGroup("Images", "images",
-					Div(
-						// New: Image gallery for existing images
-						Div(
-							ID("image-gallery"),
-							Class("flex flex-row gap-2 mb-2"),
-							g.Group(func() []g.Node {
-								imageNodes := []g.Node{}
-								imageURLs := AdImageURLs(currentAd.ID, currentAd.ImageCount)
-								for i, url := range imageURLs {
-									imageIdx := i + 1 // Images are numbered 1, 2, 3...
-									imageNodes = append(imageNodes,
-										Div(
-											Class("relative group"),
-											g.Attr("data-image-idx", fmt.Sprintf("%d", imageIdx)),
-											Img(
-												Src(url),
-												Alt(fmt.Sprintf("Image %d", imageIdx)),
-												Class("object-cover w-24 h-24 rounded border cursor-move"),
-												g.Attr("draggable", "true"),
-											),
-											Button(
-												Type("button"),
-												Class("absolute top-0 right-0 bg-white bg-opacity-80 rounded-full p-1 text-red-600 hover:text-red-800 z-10 delete-image-btn"),
-												g.Attr("onclick", fmt.Sprintf("deleteImage(this, %d)", imageIdx)),
-												Img(Src("/images/trashcan.svg"), Alt("Delete"), Class("w-4 h-4")),
-											),
-										),
-									)
-								}
-								return imageNodes
-							}()),
-						),
-						// Hidden input for deleted images (comma-separated indices)
-						Input(
-							Type("hidden"),
-							ID("deleted_images"),
-							Name("deleted_images"),
-							Value(""),
-						),
-						// File input for adding new images
-						Input(
-							Type("file"),
-							ID("images"),
-							Name("images"),
-							Class("w-full p-2 border rounded"),
-							g.Attr("accept", "image/*"),
-							g.Attr("multiple"),
-						),
-						Div(ID("image-preview")),
-					),
-				),
+				partAttributesDiv(currentAd, currentAd.SubCategory.String),
+				formGroup("Images", "images", imageGallery(currentAd, draft)),
 				formGroup("Description", "description",
 					Textarea(
 						ID("description"),
 						Name("description"),
 						Class("w-full p-2 border rounded"),
 						Rows("4"),
+						g.Text(currentAd.Description),
 					),
 				),
 				formGroup("Price", "price",
@@ -720,72 +541,64 @@ func EditAdPage(currentUser *user.User, path string, currentAd ad.Ad, makes, yea
 						Name("location"),
 						Class("w-full p-2 border rounded"),
 						Placeholder("Optional zipcode, e.g. 90210"),
+						Value(draft.Fields.Location),
 					),
 				),
+				draftAutosave("editAdForm", draft, draftImages),
 				styledButton("Submit", buttonPrimary,
 					Type("submit"),
 				),
 				g.Raw(`<script src="/js/image-preview.js" defer></script>`),
-				g.Raw(`<script src="/js/image-edit.js" defer></script>`),
 			),
 		},
 	)
 }
 
-// Helper to generate signed B2 image URLs for an ad
-func AdImageURLs(adID int, imageCount int) []string {
-	urls := []string{}
-
-	prefix := fmt.Sprintf("%d/", adID)
-	token, err := b2util.GetB2DownloadTokenForPrefixCached(prefix)
-	if err != nil || token == "" {
-		// Return empty strings when B2 images aren't available - browser will show broken images
-		for i := 0; i < imageCount; i++ {
-			urls = append(urls, "")
-		}
-		return urls
+// adImageURL returns a signed URL for one size of an image, falling back to
+// the largest size stored when the manifest doesn't list the requested one
+func adImageURL(img ad.Image, size string) string {
+	if !img.HasVariant(size) && len(img.Variants) > 0 {
+		size = img.Variants[len(img.Variants)-1]
 	}
+	return imagestore.AdImageURL(img.AdID, img.Idx, size)
+}
 
-	for i := 1; i <= imageCount; i++ {
-		// Use 160w size for gallery thumbnails
-		urls = append(urls, fmt.Sprintf(
-			"https://f004.backblazeb2.com/file/parts-pile/%d/%d-160w.webp?Authorization=%s",
-			adID, i, token,
-		))
-	}
-	return urls
+// AdImagePermalink returns a lasting, site-relative link to an image for
+// pages and feeds that outlive signed URLs. It redirects to a fresh signed
+// URL of the largest size.
+func AdImagePermalink(img ad.Image) string {
+	return fmt.Sprintf("/feeds/image/%d/%d", img.AdID, img.ID)
 }
 
-// Helper to generate signed B2 image URLs for an ad and all sizes
-func AdImageSrcSet(adID int, idx int, context string) (src, srcset string) {
-	prefix := fmt.Sprintf("%d/", adID)
-	token, err := b2util.GetB2DownloadTokenForPrefixCached(prefix)
-	if err != nil || token == "" {
-		// Return empty strings when B2 images aren't available - browser will show broken image
-		return "", ""
+// Helper to generate signed image URLs for all sizes of an image listed in
+// its manifest
+func AdImageSrcSet(img ad.Image, context string) (src, srcset string) {
+	candidates := make([]string, 0, len(img.Variants))
+	for _, size := range img.Variants {
+		url := imagestore.AdImageURL(img.AdID, img.Idx, size)
+		if url == "" {
+			// Return empty strings when images aren't available - browser will show broken image
+			return "", ""
+		}
+		candidates = append(candidates, url+" "+size)
 	}
-
-	base := fmt.Sprintf("https://f004.backblazeb2.com/file/parts-pile/%d/%d", adID, idx)
-	src160 := fmt.Sprintf("%s-160w.webp?Authorization=%s 160w", base, token)
-	src480 := fmt.Sprintf("%s-480w.webp?Authorization=%s 480w", base, token)
-	src1200 := fmt.Sprintf("%s-1200w.webp?Authorization=%s 1200w", base, token)
-	srcset = strings.Join([]string{src160, src480, src1200}, ", ")
+	srcset = strings.Join(candidates, ", ")
 
 	// Choose default src based on context
 	switch context {
 	case "thumbnail":
-		src = fmt.Sprintf("%s-160w.webp?Authorization=%s", base, token)
+		src = adImageURL(img, "160w")
 	case "carousel":
-		src = fmt.Sprintf("%s-1200w.webp?Authorization=%s", base, token)
+		src = adImageURL(img, "1200w")
 	default:
-		src = fmt.Sprintf("%s-480w.webp?Authorization=%s", base, token) // default
+		src = adImageURL(img, "480w") // default
 	}
 	return src, srcset
 }
 
 // Helper to render an image with srcset and fallback
-func AdImageWithFallbackSrcSet(adID int, idx int, alt string, context string) g.Node {
-	src, srcset := AdImageSrcSet(adID, idx, context)
+func AdImageWithFallbackSrcSet(img ad.Image, alt string, context string) g.Node {
+	src, srcset := AdImageSrcSet(img, context)
 
 	// Set appropriate sizes attribute based on context
 	var sizes string
@@ -806,3 +619,91 @@ func AdImageWithFallbackSrcSet(adID int, idx int, alt string, context string) g.
 		Class("object-contain w-full aspect-square bg-gray-100"),
 	)
 }
+
+// imageGallery lets the seller drag existing images into order, pick the
+// cover photo and delete images, and add new ones. Changes are kept in hidden
+// inputs until the form is submitted; an edit draft's pending changes are
+// shown as already made.
+func imageGallery(adObj ad.Ad, draft ad.Draft) g.Node {
+	deleted := strings.Split(draft.Fields.DeletedImages, ",")
+	primary := draft.Fields.PrimaryImage
+	if cover, ok := adObj.Cover(); ok && primary == "" {
+		primary = strconv.Itoa(cover.ID)
+	}
+
+	images := slices.Clone(adObj.Images)
+	if draft.Fields.ImageOrder != "" {
+		order := strings.Split(draft.Fields.ImageOrder, ",")
+		slices.SortStableFunc(images, func(a, b ad.Image) int {
+			ai, bi := slices.Index(order, strconv.Itoa(a.ID)), slices.Index(order, strconv.Itoa(b.ID))
+			if ai < 0 {
+				ai = len(order)
+			}
+			if bi < 0 {
+				bi = len(order)
+			}
+			return ai - bi
+		})
+	}
+
+	thumbs := []g.Node{}
+	order := []string{}
+	for i, img := range images {
+		id := strconv.Itoa(img.ID)
+		if slices.Contains(deleted, id) {
+			continue
+		}
+		order = append(order, id)
+		coverClass := "absolute bottom-0 left-0 bg-white bg-opacity-80 rounded px-1 text-xs cover-image-btn"
+		coverLabel := "☆"
+		if id == primary {
+			coverClass = "absolute bottom-0 left-0 bg-yellow-300 rounded px-1 text-xs font-semibold cover-image-btn"
+			coverLabel = "Cover"
+		}
+		thumbs = append(thumbs, Div(
+			Class("relative group"),
+			g.Attr("data-image-id", id),
+			g.Attr("draggable", "true"),
+			Img(
+				Src(adImageURL(img, "160w")),
+				Alt(fmt.Sprintf("Image %d", i+1)),
+				Class("object-cover w-24 h-24 rounded border cursor-move"),
+			),
+			Button(
+				Type("button"),
+				Class(coverClass),
+				Title("Use as cover photo"),
+				g.Text(coverLabel),
+			),
+			Button(
+				Type("button"),
+				Class("absolute top-0 right-0 bg-white bg-opacity-80 rounded-full p-1 text-red-600 hover:text-red-800 z-10 delete-image-btn"),
+				Title("Delete image"),
+				Img(Src("/images/trashcan.svg"), Alt("Delete"), Class("w-4 h-4")),
+			),
+		))
+	}
+
+	return Div(
+		Div(
+			ID("image-gallery"),
+			Class("flex flex-row flex-wrap gap-2 mb-2"),
+			g.Group(thumbs),
+		),
+		// IDs of the images to delete, their order and the cover photo
+		Input(Type("hidden"), ID("deleted_images"), Name("deleted_images"), Value(draft.Fields.DeletedImages)),
+		Input(Type("hidden"), ID("existing_image_order"), Name("existing_image_order"), Value(strings.Join(order, ","))),
+		Input(Type("hidden"), ID("primary_image"), Name("primary_image"), Value(primary)),
+		// File input for adding new images
+		Input(
+			Type("file"),
+			ID("images"),
+			Name("images"),
+			Class("w-full p-2 border rounded"),
+			g.Attr("accept", "image/*"),
+			g.Attr("multiple"),
+		),
+		Div(ID("image-preview")),
+		g.Raw(`<script src="/js/image-edit.js"></script>`),
+	)
+}
@@ -16,6 +16,11 @@ func AdminSectionPage(currentUser *user.User, path, activeSection string, conten
 		{"b2-cache", "B2 Cache"},
 		{"embedding-cache", "Embedding Cache"},
 		{"vehicle-cache", "Vehicle Cache"},
+		{"catalog", "Vehicle Catalog"},
+		{"taxonomy", "Part Categories"},
+		{"part-numbers", "Part Numbers"},
+		{"moderation", "Moderation"},
+		{"moderation-rules", "Moderation Rules"},
 	}
 	return Div(
 		ID("admin-section"),
@@ -0,0 +1,168 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	g "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/analytics"
+	"github.com/parts-pile/site/user"
+)
+
+// eventTotals renders one count per event type, as used by both dashboards
+func eventTotals(totals func(analytics.EventType) int) g.Node {
+	cells := make([]g.Node, 0, len(analytics.EventTypes))
+	for _, t := range analytics.EventTypes {
+		cells = append(cells, Div(
+			Class("text-center"),
+			Div(Class("text-lg font-semibold"), g.Text(fmt.Sprintf("%d", totals(t)))),
+			Div(Class("text-xs text-gray-500"), g.Text(t.Label())),
+		))
+	}
+	return GridContainer(len(cells), cells...)
+}
+
+// AnalyticsSummaryItem renders one of the seller's ads on the analytics page
+func AnalyticsSummaryItem(summary analytics.AdSummary) g.Node {
+	title := summary.Title
+	if title == "" {
+		title = fmt.Sprintf("Ad %d", summary.AdID)
+	}
+	return A(
+		Href(fmt.Sprintf("/analytics/ad/%d", summary.AdID)),
+		Class("block border p-4 mb-4 rounded bg-white hover:bg-gray-50"),
+		Div(
+			Class("flex items-center justify-between mb-2"),
+			Span(Class("font-semibold"), g.Text(title)),
+			g.If(summary.Archived, Span(Class("text-xs text-gray-500"), g.Text("Archived"))),
+		),
+		eventTotals(func(t analytics.EventType) int { return summary.Totals[t] }),
+	)
+}
+
+// AnalyticsPage lists the seller's ads with their event totals
+func AnalyticsPage(summaries []analytics.AdSummary, days int, currentUser *user.User, path string) g.Node {
+	var content g.Node
+	if len(summaries) == 0 {
+		content = Div(Class("text-center py-12"),
+			Div(Class("text-gray-500 text-lg mb-4"), g.Text("No ads yet.")),
+			Div(Class("text-gray-400 text-sm"), g.Text("Once you list a part you can see who is looking at it here.")),
+		)
+	} else {
+		nodes := make([]g.Node, 0, len(summaries))
+		for _, s := range summaries {
+			nodes = append(nodes, AnalyticsSummaryItem(s))
+		}
+		content = Div(g.Group(nodes))
+	}
+
+	return Page(
+		"Ad Analytics",
+		currentUser,
+		path,
+		[]g.Node{
+			pageHeader("Ad Analytics"),
+			Div(Class("text-gray-600 text-sm mb-6"), g.Text(fmt.Sprintf("Activity on your ads over the last %d days.", days))),
+			content,
+		},
+	)
+}
+
+// eventChart draws daily counts as a bar chart with a tooltip per day
+func eventChart(days []time.Time, counts []int) g.Node {
+	const width, height = 300.0, 60.0
+
+	peak := 1
+	for _, n := range counts {
+		peak = max(peak, n)
+	}
+
+	bars := make([]g.Node, 0, len(counts))
+	step := width / float64(max(len(counts), 1))
+	for i, n := range counts {
+		h := float64(n) / float64(peak) * height
+		bars = append(bars, g.El("rect",
+			g.Attr("x", fmt.Sprintf("%.1f", float64(i)*step)),
+			g.Attr("y", fmt.Sprintf("%.1f", height-h)),
+			g.Attr("width", fmt.Sprintf("%.1f", step*0.8)),
+			g.Attr("height", fmt.Sprintf("%.1f", h)),
+			g.Attr("fill", "currentColor"),
+			g.El("title", g.Text(fmt.Sprintf("%s: %d", days[i].Format("Jan 2"), n))),
+		))
+	}
+
+	return g.El("svg",
+		Class("w-full text-blue-500"),
+		g.Attr("viewBox", fmt.Sprintf("0 0 %.0f %.0f", width, height)),
+		g.Attr("preserveAspectRatio", "none"),
+		g.Attr("height", "60"),
+		g.Group(bars),
+	)
+}
+
+// sourceBreakdown renders the ad's event counts by traffic source
+func sourceBreakdown(sources map[analytics.Source]map[analytics.EventType]int) g.Node {
+	header := []g.Node{Div(Class("font-semibold"), g.Text("Source"))}
+	for _, t := range analytics.EventTypes {
+		header = append(header, Div(Class("font-semibold text-right"), g.Text(t.Label())))
+	}
+
+	rows := []g.Node{g.Group(header)}
+	for _, s := range analytics.Sources {
+		row := []g.Node{Div(g.Text(s.Label()))}
+		for _, t := range analytics.EventTypes {
+			row = append(row, Div(Class("text-right"), g.Text(fmt.Sprintf("%d", sources[s][t]))))
+		}
+		rows = append(rows, g.Group(row))
+	}
+
+	return Div(
+		Class("text-sm"),
+		GridContainer(len(analytics.EventTypes)+1, rows...),
+	)
+}
+
+// AdAnalyticsPage shows the daily events of an ad and where its traffic came from
+func AdAnalyticsPage(adObj ad.Ad, series analytics.Series, sources map[analytics.Source]map[analytics.EventType]int, currentUser *user.User, path string) g.Node {
+	charts := make([]g.Node, 0, len(analytics.EventTypes))
+	for _, t := range analytics.EventTypes {
+		charts = append(charts, Div(
+			Class("border rounded bg-white p-4"),
+			Div(
+				Class("flex justify-between mb-2"),
+				Span(Class("font-semibold"), g.Text(t.Label())),
+				Span(Class("text-gray-600"), g.Text(fmt.Sprintf("%d", series.Total(t)))),
+			),
+			eventChart(series.Days, series.Counts[t]),
+		))
+	}
+
+	var period string
+	if len(series.Days) > 0 {
+		period = fmt.Sprintf("%s – %s (UTC)", series.Days[0].Format("Jan 2"), series.Days[len(series.Days)-1].Format("Jan 2, 2006"))
+	}
+
+	return Page(
+		"Ad Analytics",
+		currentUser,
+		path,
+		[]g.Node{
+			pageHeader(adObj.Title),
+			Div(
+				Class("flex items-center justify-between mb-6"),
+				Span(Class("text-gray-600 text-sm"), g.Text(period)),
+				Div(
+					Class("flex items-center space-x-2"),
+					StyledLink("View ad", fmt.Sprintf("/ad/%d", adObj.ID), ButtonSecondary),
+					StyledLink("All ads", "/analytics", ButtonSecondary),
+				),
+			),
+			Div(Class("space-y-4 mb-8"), g.Group(charts)),
+			H2(Class("text-xl font-semibold mb-4"), g.Text("Where your traffic came from")),
+			sourceBreakdown(sources),
+		},
+	)
+}
@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	g "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/browse"
+	"github.com/parts-pile/site/user"
+)
+
+// browseChildHeadings heads the links one level below each level of the tree
+var browseChildHeadings = []string{"Makes", "Years", "Models", "Categories", "Subcategories"}
+
+// BrowsePage renders a crawlable browse tree page: breadcrumbs, links one
+// level down and a page of the ads below it
+func BrowsePage(currentUser *user.User, path string, names, children []string, ads []ad.Ad, page, totalPages int, loc *time.Location) g.Node {
+	heading := "Browse parts"
+	if len(names) > 0 {
+		heading = browse.Title(names) + " parts"
+	}
+	title := heading + " - Parts Pile"
+	if page > 1 {
+		title = fmt.Sprintf("%s (page %d) - Parts Pile", heading, page)
+	}
+
+	return PageWithMeta(
+		title,
+		currentUser,
+		path,
+		browseMeta(names, heading, page, totalPages),
+		[]g.Node{
+			browseBreadcrumbs(names),
+			pageHeader(heading),
+			browseChildren(names, children),
+			g.If(len(names) > 0, browseAdList(ads, loc)),
+			browsePagination(browse.Path(names...), page, totalPages),
+		},
+	)
+}
+
+// browsePageURL returns the URL of one page of a browse page's ads
+func browsePageURL(path string, page int) string {
+	if page <= 1 {
+		return path
+	}
+	return fmt.Sprintf("%s?page=%d", path, page)
+}
+
+func browseMeta(names []string, heading string, page, totalPages int) []g.Node {
+	path := browse.Path(names...)
+	description := "Used and new auto parts listed on Parts Pile."
+	if len(names) > 0 {
+		description = fmt.Sprintf("%s listed for sale on Parts Pile.", heading)
+	}
+	return []g.Node{
+		Meta(Name("description"), Content(description)),
+		Link(Rel("canonical"), Href(absoluteURL(browsePageURL(path, page)))),
+		g.If(page > 1, Link(Rel("prev"), Href(absoluteURL(browsePageURL(path, page-1))))),
+		g.If(page < totalPages, Link(Rel("next"), Href(absoluteURL(browsePageURL(path, page+1))))),
+		// Model pages and below offer the model's feed
+		g.Iff(len(names) >= 3, func() g.Node {
+			return Link(Rel("alternate"), Type("application/atom+xml"),
+				g.Attr("title", names[0]+" "+names[2]+" parts"),
+				Href(fmt.Sprintf("/feeds/parts/%s/%s.atom", browse.Slug(names[0]), browse.Slug(names[2]))))
+		}),
+	}
+}
+
+// browseBreadcrumbs links each level above the page, e.g. Parts › Ford › 2005
+func browseBreadcrumbs(names []string) g.Node {
+	crumbs := []g.Node{A(Href(browse.Root), Class("text-blue-600 hover:underline"), g.Text("Parts"))}
+	for i, name := range names {
+		crumbs = append(crumbs, Span(Class("mx-2 text-gray-400"), g.Text("›")))
+		if i == len(names)-1 {
+			crumbs = append(crumbs, Span(g.Attr("aria-current", "page"), g.Text(name)))
+		} else {
+			crumbs = append(crumbs, A(Href(browse.Path(names[:i+1]...)), Class("text-blue-600 hover:underline"), g.Text(name)))
+		}
+	}
+	return Nav(g.Attr("aria-label", "Breadcrumb"), Class("text-sm mb-4"), g.Group(crumbs))
+}
+
+// browseChildren links to the pages one level down
+func browseChildren(names, children []string) g.Node {
+	if len(children) == 0 {
+		return nil
+	}
+	links := make([]g.Node, len(children))
+	for i, child := range children {
+		links[i] = Li(A(Href(browse.Path(slices.Concat(names, []string{child})...)),
+			Class("text-blue-600 hover:underline"), g.Text(child)))
+	}
+	return Section(
+		Class("mb-8"),
+		H2(Class("text-xl font-semibold mb-2"), g.Text(browseChildHeadings[len(names)])),
+		Ul(Class("grid grid-cols-2 md:grid-cols-4 gap-2"), g.Group(links)),
+	)
+}
+
+func browseAdList(ads []ad.Ad, loc *time.Location) g.Node {
+	if len(ads) == 0 {
+		return P(Class("text-gray-600"), g.Text("No ads here right now."))
+	}
+	rows := make([]g.Node, len(ads))
+	for i, a := range ads {
+		rows[i] = browseAdRow(a, loc)
+	}
+	return Section(
+		H2(Class("text-xl font-semibold mb-2"), g.Text("Ads")),
+		Div(Class("border rounded bg-white divide-y"), g.Group(rows)),
+	)
+}
+
+// browseAdRow links to an ad with a plain link, so it can be followed
+// without JavaScript
+func browseAdRow(a ad.Ad, loc *time.Location) g.Node {
+	return A(
+		Href(fmt.Sprintf("/ad/%d", a.ID)),
+		Class("flex items-center py-2 px-3 hover:bg-gray-50"),
+		Div(Class("flex-1 text-blue-600"), titleNode(a)),
+		Div(Class("mr-4 flex gap-1"), pendingBadge(a), conditionBadge(a)),
+		Div(Class("mr-4 text-xs text-gray-500"), locationFlagNode(a)),
+		Div(Class("mr-4 text-xs text-gray-400"), ageNode(a, loc)),
+		Div(Class("text-green-600 font-semibold"), priceNode(a)),
+	)
+}
+
+func browsePagination(path string, page, totalPages int) g.Node {
+	if totalPages <= 1 {
+		return nil
+	}
+	prev := StyledLinkDisabled("Previous", ButtonSecondary)
+	if page > 1 {
+		prev = StyledLink("Previous", browsePageURL(path, page-1), ButtonSecondary, Rel("prev"))
+	}
+	next := StyledLinkDisabled("Next", ButtonSecondary)
+	if page < totalPages {
+		next = StyledLink("Next", browsePageURL(path, page+1), ButtonSecondary, Rel("next"))
+	}
+	return Nav(
+		g.Attr("aria-label", "Pagination"),
+		Class("flex items-center justify-between mt-6"),
+		prev,
+		Span(Class("text-sm text-gray-600"), g.Text(fmt.Sprintf("Page %d of %d", page, totalPages))),
+		next,
+	)
+}
@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/parts-pile/site/vehicle"
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+)
+
+// catalogForm posts an admin catalog change and swaps in the refreshed
+// section. The kind and name filter ride along so the same list comes back.
+func catalogForm(endpoint string, kind vehicle.Kind, filter string, children ...g.Node) g.Node {
+	return Form(
+		hx.Post(endpoint),
+		hx.Target("#admin-section-content"),
+		hx.Swap("innerHTML"),
+		Input(Type("hidden"), Name("kind"), Value(string(kind))),
+		Input(Type("hidden"), Name("q"), Value(filter)),
+		g.Group(children),
+	)
+}
+
+func catalogKindTabs(active vehicle.Kind) g.Node {
+	tabs := make([]g.Node, 0, len(vehicle.Kinds))
+	for _, k := range vehicle.Kinds {
+		colorClass := "bg-gray-200 text-gray-800 hover:bg-gray-300"
+		if k == active {
+			colorClass = "bg-blue-500 text-white"
+		}
+		tabs = append(tabs, Button(
+			Class("px-3 py-1 rounded text-sm "+colorClass),
+			hx.Get("/admin/catalog?kind="+string(k)),
+			hx.Target("#admin-section"),
+			hx.Swap("outerHTML"),
+			g.Text(k.Label()+"s"),
+		))
+	}
+	return Div(Class("flex gap-2 mb-4"), g.Group(tabs))
+}
+
+func catalogFilter(kind vehicle.Kind, filter string) g.Node {
+	return Form(
+		Class("flex gap-2 mb-4"),
+		hx.Get("/admin/catalog"),
+		hx.Target("#admin-section"),
+		hx.Swap("outerHTML"),
+		Input(Type("hidden"), Name("kind"), Value(string(kind))),
+		Input(Type("search"), Name("q"), Value(filter), Class("flex-1 p-2 border rounded"),
+			Placeholder("Filter "+kind.Label()+"s by name")),
+		styledButton("Filter", ButtonSecondary, Type("submit")),
+	)
+}
+
+func catalogAddForm(kind vehicle.Kind, filter string) g.Node {
+	return catalogForm("/api/admin/catalog/"+string(kind), kind, filter,
+		Class("bg-gray-100 p-4 rounded-lg mb-6 flex gap-2 items-center"),
+		H2(Class("text-lg font-semibold mr-2"), g.Text("Add "+kind.Label())),
+		Input(Type("text"), Name("name"), Class("flex-1 p-2 border rounded"), Required()),
+		styledButton("Add", buttonPrimary, Type("submit")),
+	)
+}
+
+// catalogAttachCarForm adds a year/model/engine combination to a make,
+// creating the year, model and engine if they're new
+func catalogAttachCarForm(makes []string, kind vehicle.Kind, filter string) g.Node {
+	options := make([]g.Node, 0, len(makes))
+	for _, m := range makes {
+		options = append(options, Option(Value(m), g.Text(m)))
+	}
+	return catalogForm("/api/admin/catalog/cars", kind, filter,
+		Class("bg-gray-100 p-4 rounded-lg mb-6 flex flex-col gap-2"),
+		H2(Class("text-lg font-semibold"), g.Text("Attach Car")),
+		Div(
+			Class("flex flex-wrap gap-2"),
+			Select(Name("make"), Class("p-2 border rounded"), Required(), g.Group(options)),
+			Input(Type("number"), Name("year"), Class("w-24 p-2 border rounded"), Placeholder("Year"), Required()),
+			Input(Type("text"), Name("model"), Class("flex-1 p-2 border rounded"), Placeholder("Model"), Required()),
+			Input(Type("text"), Name("engine"), Class("flex-1 p-2 border rounded"), Placeholder("Engine"), Required()),
+			styledButton("Attach", buttonPrimary, Type("submit")),
+		),
+	)
+}
+
+func catalogParentCompanySelect(e vehicle.Entry, companies []vehicle.ParentCompany, filter string) g.Node {
+	options := []g.Node{Option(Value(""), g.Text("None"))}
+	for _, pc := range companies {
+		options = append(options, Option(
+			Value(strconv.Itoa(pc.ID)),
+			g.If(e.ParentCompanyID != nil && *e.ParentCompanyID == pc.ID, Selected()),
+			g.Text(pc.Name),
+		))
+	}
+	return catalogForm(fmt.Sprintf("/api/admin/catalog/make/%d/parent-company", e.ID), vehicle.KindMake, filter,
+		hx.Trigger("change"),
+		Select(Name("parent_company_id"), Class("p-1 border rounded"), g.Group(options)),
+	)
+}
+
+func catalogEntryRow(kind vehicle.Kind, e vehicle.Entry, companies []vehicle.ParentCompany, filter string) g.Node {
+	base := fmt.Sprintf("/api/admin/catalog/%s/%d", kind, e.ID)
+	status := Span(Class("text-xs font-medium rounded px-1 text-green-800 bg-green-100"), g.Text("active"))
+	retireLabel, retireValue := "Retire", "1"
+	if e.Retired {
+		status = Span(Class("text-xs font-medium rounded px-1 text-gray-700 bg-gray-200"), g.Text("retired"))
+		retireLabel, retireValue = "Restore", "0"
+	}
+	return Tr(
+		Class("border-t"),
+		Td(Class("p-2"), g.Text(e.Name)),
+		Td(Class("p-2 text-right"), g.Text(strconv.Itoa(e.Cars))),
+		g.If(kind == vehicle.KindMake, Td(Class("p-2"), catalogParentCompanySelect(e, companies, filter))),
+		Td(Class("p-2"), status),
+		Td(Class("p-2"), catalogForm(base+"/rename", kind, filter,
+			Class("flex gap-1"),
+			Input(Type("text"), Name("name"), Value(e.Name), Class("w-40 p-1 border rounded"), Required()),
+			styledButton("Rename", ButtonSecondary, Type("submit")),
+		)),
+		Td(Class("p-2"), catalogForm(base+"/merge", kind, filter,
+			Class("flex gap-1"),
+			hx.Confirm(fmt.Sprintf("Merge %s into another %s? This can't be undone.", e.Name, kind)),
+			Input(Type("text"), Name("into"), Class("w-40 p-1 border rounded"), Placeholder("Merge into…"), Required()),
+			styledButton("Merge", ButtonDanger, Type("submit")),
+		)),
+		Td(Class("p-2 text-right"), catalogForm(base+"/retire", kind, filter,
+			Input(Type("hidden"), Name("retired"), Value(retireValue)),
+			Button(Type("submit"), Class("text-blue-600 hover:text-blue-800"), g.Text(retireLabel)),
+		)),
+	)
+}
+
+func catalogParentCompanyRow(pc vehicle.ParentCompany, kind vehicle.Kind, filter string) g.Node {
+	return Tr(
+		Class("border-t"),
+		Td(Class("p-2"), g.Text(pc.Name)),
+		Td(Class("p-2"), catalogForm(fmt.Sprintf("/api/admin/parent-companies/%d/country", pc.ID), kind, filter,
+			Class("flex gap-1"),
+			Input(Type("text"), Name("country"), Value(pc.Country), Class("w-40 p-1 border rounded")),
+			styledButton("Save", ButtonSecondary, Type("submit")),
+		)),
+	)
+}
+
+func catalogParentCompanies(companies []vehicle.ParentCompany, kind vehicle.Kind, filter string) g.Node {
+	rows := make([]g.Node, 0, len(companies))
+	for _, pc := range companies {
+		rows = append(rows, catalogParentCompanyRow(pc, kind, filter))
+	}
+	return Div(
+		Class("mt-8"),
+		H2(Class("text-lg font-semibold mb-2"), g.Text("Parent Companies")),
+		catalogForm("/api/admin/parent-companies", kind, filter,
+			Class("flex gap-2 mb-4"),
+			Input(Type("text"), Name("name"), Class("flex-1 p-2 border rounded"), Placeholder("Name"), Required()),
+			Input(Type("text"), Name("country"), Class("w-40 p-2 border rounded"), Placeholder("Country")),
+			styledButton("Add", buttonPrimary, Type("submit")),
+		),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Name")),
+				Th(Class("p-2 text-left"), g.Text("Country")),
+			)),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
+
+// AdminCatalogSection lets admins edit the vehicle catalog. Makes, models
+// and engines are listed one kind at a time, filtered by name; makes also
+// show their parent company.
+func AdminCatalogSection(kind vehicle.Kind, filter string, entries []vehicle.Entry, makes []string, companies []vehicle.ParentCompany, notice g.Node) g.Node {
+	rows := make([]g.Node, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, catalogEntryRow(kind, e, companies, filter))
+	}
+	return Div(
+		H1(g.Text("Vehicle Catalog")),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		catalogKindTabs(kind),
+		catalogAddForm(kind, filter),
+		catalogAttachCarForm(makes, kind, filter),
+		catalogFilter(kind, filter),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Textf("No %ss found.", kind))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text(kind.Label())),
+				Th(Class("p-2 text-right"), g.Text("Cars")),
+				g.If(kind == vehicle.KindMake, Th(Class("p-2 text-left"), g.Text("Parent Company"))),
+				Th(Class("p-2 text-left"), g.Text("Status")),
+				Th(), Th(), Th(),
+			)),
+			TBody(g.Group(rows)),
+		)),
+		catalogParentCompanies(companies, kind, filter),
+	)
+}
@@ -0,0 +1,171 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/user"
+)
+
+// draftAutosave renders the hidden draft fields and the status element that
+// autosaves the enclosing ad form. It must be placed inside the form so its
+// values, including draft_id, are sent with both autosave and submit.
+func draftAutosave(formID string, draft ad.Draft, images []ad.DraftImage) g.Node {
+	return g.Group([]g.Node{
+		draftIDInput(draft.ID, false),
+		Input(Type("hidden"), Name("draft_ad_id"), Value(fmt.Sprintf("%d", draft.AdID))),
+		DraftImageGallery(draft.ID, images, false),
+		Div(
+			ID("draft-status"),
+			Class("text-xs text-gray-500"),
+			hx.Post("/api/save-draft"),
+			hx.Trigger(fmt.Sprintf("change from:#%s delay:1s, input from:#%s delay:2s", formID, formID)),
+			hx.Encoding("multipart/form-data"),
+			hx.Target("this"),
+			hx.Swap("innerHTML"),
+			g.If(draft.ID != 0, draftSavedText(draft.UpdatedAt)),
+		),
+	})
+}
+
+func draftIDInput(draftID int, oob bool) g.Node {
+	return Input(
+		Type("hidden"),
+		ID("draft_id"),
+		Name("draft_id"),
+		Value(fmt.Sprintf("%d", draftID)),
+		g.If(oob, hx.SwapOOB("true")),
+	)
+}
+
+func draftSavedText(t time.Time) g.Node {
+	return g.Text(fmt.Sprintf("Draft saved %s", t.Local().Format("3:04 PM")))
+}
+
+// DraftSaved is the autosave response: the status text plus out-of-band
+// updates for the draft ID and the saved image gallery
+func DraftSaved(draft ad.Draft, images []ad.DraftImage) g.Node {
+	return g.Group([]g.Node{
+		draftSavedText(draft.UpdatedAt),
+		draftIDInput(draft.ID, true),
+		DraftImageGallery(draft.ID, images, true),
+	})
+}
+
+// DraftSaveFailed is the autosave response when the draft could not be stored
+func DraftSaveFailed() g.Node {
+	return Span(Class("text-red-600"), g.Text("Draft not saved"))
+}
+
+// DraftImageGallery shows the images already uploaded to a draft
+func DraftImageGallery(draftID int, images []ad.DraftImage, oob bool) g.Node {
+	imageNodes := []g.Node{}
+	for _, img := range images {
+		imageNodes = append(imageNodes,
+			Div(
+				Class("relative group"),
+				Img(
+					Src(fmt.Sprintf("/draft-image/%d/%d", draftID, img.ID)),
+					Alt(img.Filename),
+					Class("object-cover w-24 h-24 rounded border"),
+				),
+				Button(
+					Type("button"),
+					Class("absolute top-0 right-0 bg-white bg-opacity-80 rounded-full p-1 text-red-600 hover:text-red-800 z-10"),
+					hx.Delete(fmt.Sprintf("/api/drafts/%d/images/%d", draftID, img.ID)),
+					hx.Target("closest .group"),
+					hx.Swap("outerHTML"),
+					Img(Src("/images/trashcan.svg"), Alt("Delete"), Class("w-4 h-4")),
+				),
+			),
+		)
+	}
+	return Div(
+		ID("draft-images"),
+		Class("flex flex-row flex-wrap gap-2"),
+		g.If(oob, hx.SwapOOB("true")),
+		g.Group(imageNodes),
+	)
+}
+
+func draftTitle(draft ad.Draft) string {
+	if draft.Fields.Title != "" {
+		return draft.Fields.Title
+	}
+	return "Untitled draft"
+}
+
+func draftResumeURL(draft ad.Draft) string {
+	if draft.IsEdit() {
+		return fmt.Sprintf("/edit-ad/%d", draft.AdID)
+	}
+	return fmt.Sprintf("/new-ad?draft=%d", draft.ID)
+}
+
+// DraftListItem renders one row on the drafts page
+func DraftListItem(draft ad.Draft) g.Node {
+	kind := "New ad"
+	if draft.IsEdit() {
+		kind = fmt.Sprintf("Changes to ad %d", draft.AdID)
+	}
+	details := kind
+	if draft.Fields.Make != "" {
+		details += " · " + draft.Fields.Make
+	}
+	if draft.ImageCount > 0 {
+		details += fmt.Sprintf(" · %d images", draft.ImageCount)
+	}
+
+	return Div(
+		ID(fmt.Sprintf("draft-%d", draft.ID)),
+		Class("border p-4 mb-4 rounded bg-white flex items-center justify-between"),
+		Div(
+			Div(Class("font-semibold"), g.Text(draftTitle(draft))),
+			Div(Class("text-sm text-gray-600"), g.Text(details)),
+			Div(Class("text-xs text-gray-400"), draftSavedText(draft.UpdatedAt)),
+		),
+		Div(
+			Class("flex items-center space-x-2"),
+			StyledLink("Continue", draftResumeURL(draft), buttonPrimary),
+			styledButton("Discard", ButtonDanger,
+				Type("button"),
+				hx.Delete(fmt.Sprintf("/api/drafts/%d", draft.ID)),
+				hx.Confirm("Discard this draft?"),
+				hx.Target(fmt.Sprintf("#draft-%d", draft.ID)),
+				hx.Swap("outerHTML"),
+			),
+		),
+	)
+}
+
+func DraftsPage(drafts []ad.Draft, currentUser *user.User, path string) g.Node {
+	var content g.Node
+	if len(drafts) == 0 {
+		content = Div(Class("text-center py-12"),
+			Div(Class("text-gray-500 text-lg mb-4"), g.Text("No drafts.")),
+			Div(Class("text-gray-400 text-sm"), g.Text("Ads you start are saved here automatically until you publish them.")),
+		)
+	} else {
+		nodes := make([]g.Node, 0, len(drafts))
+		for _, d := range drafts {
+			nodes = append(nodes, DraftListItem(d))
+		}
+		content = Div(g.Group(nodes))
+	}
+
+	return Page(
+		"My Drafts",
+		currentUser,
+		path,
+		[]g.Node{
+			pageHeader("My Drafts"),
+			Div(Class("text-gray-600 text-sm mb-6"), g.Text("Unpublished ads and unsaved changes.")),
+			content,
+		},
+	)
+}
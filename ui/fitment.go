@@ -0,0 +1,238 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+)
+
+// FitmentGroupOptions holds the year/model/engine choices offered for one
+// fitment group, derived from the make/years/models selected in it
+type FitmentGroupOptions struct {
+	Years   []string
+	Models  []string
+	Engines []string
+}
+
+// primaryFitmentOptions returns the options of the first fitment group
+func primaryFitmentOptions(opts []FitmentGroupOptions) FitmentGroupOptions {
+	if len(opts) == 0 {
+		return FitmentGroupOptions{}
+	}
+	return opts[0]
+}
+
+// primaryFitment returns the first fitment group, or an empty one
+func primaryFitment(groups []ad.FitmentGroup) ad.FitmentGroup {
+	if len(groups) == 0 {
+		return ad.FitmentGroup{}
+	}
+	return groups[0]
+}
+
+// fitmentDivID returns the ID of a fitment group's container div. The first
+// group keeps the original IDs (yearsDiv, modelsDiv, enginesDiv).
+func fitmentDivID(base string, group int) string {
+	if group == 0 {
+		return base
+	}
+	return fmt.Sprintf("%s-%d", base, group)
+}
+
+// fitmentInclude builds the hx-include selector for a group's make select and
+// the given checkbox fields
+func fitmentInclude(group int, makeField string, checkboxFields ...string) string {
+	selectors := []string{fmt.Sprintf("[name='%s']", ad.FitmentField(makeField, group))}
+	for _, field := range checkboxFields {
+		selectors = append(selectors, fmt.Sprintf("[name='%s']:checked", ad.FitmentField(field, group)))
+	}
+	return strings.Join(selectors, ",")
+}
+
+// fitmentVals tells the vehicle option endpoints which group is asking
+func fitmentVals(group int) string {
+	return fmt.Sprintf(`{"group": "%d"}`, group)
+}
+
+// fitmentMakeSelect renders the make select of an additional fitment group
+func fitmentMakeSelect(group int, makes []string, selected string) g.Node {
+	name := ad.FitmentField("make", group)
+	options := []g.Node{Option(Value(""), g.Text("Select a make"))}
+	for _, makeName := range makes {
+		options = append(options, Option(Value(makeName), g.If(makeName == selected, Selected()), g.Text(makeName)))
+	}
+	return formGroup("Make", name,
+		Select(
+			ID(name),
+			Name(name),
+			Class("w-full p-2 border rounded"),
+			hx.Trigger("change"),
+			hx.Get("/api/years"),
+			hx.Target("#"+fitmentDivID("yearsDiv", group)),
+			hx.Include("this"),
+			hx.Vals(fitmentVals(group)),
+			g.Attr("onchange", fmt.Sprintf("document.getElementById('%s').innerHTML = ''; document.getElementById('%s').innerHTML = '';",
+				fitmentDivID("modelsDiv", group), fitmentDivID("enginesDiv", group))),
+			g.Group(options),
+		),
+	)
+}
+
+// fitmentOptionFields renders the years, models and engines containers of a
+// fitment group, which the make select and checkboxes refill as they change
+func fitmentOptionFields(group int, opts FitmentGroupOptions, fitment ad.FitmentGroup) g.Node {
+	return g.Group{
+		Div(
+			ID(fitmentDivID("yearsDiv", group)),
+			Class("space-y-2"),
+			g.If(len(opts.Years) > 0, FitmentYearsFormGroup(group, opts.Years, fitment)),
+		),
+		Div(
+			ID(fitmentDivID("modelsDiv", group)),
+			Class("space-y-2"),
+			g.If(len(opts.Models) > 0, FitmentModelsFormGroup(group, opts.Models, fitment)),
+		),
+		Div(
+			ID(fitmentDivID("enginesDiv", group)),
+			Class("space-y-2"),
+			g.If(len(opts.Engines) > 0, FitmentEnginesFormGroup(group, opts.Engines, fitment)),
+		),
+	}
+}
+
+// FitmentGroupFields renders an additional fitment group with its own make,
+// years, models and engines, and a button to remove it
+func FitmentGroupFields(group int, makes []string, fitment ad.FitmentGroup, opts FitmentGroupOptions) g.Node {
+	return Div(
+		ID(fitmentDivID("fitmentGroup", group)),
+		Class("border rounded p-4 space-y-4 bg-gray-50"),
+		g.Attr("data-fitment-group", fmt.Sprintf("%d", group)),
+		Div(
+			Class("flex justify-between items-center"),
+			Span(Class("font-semibold"), g.Text("Also fits")),
+			Button(
+				Type("button"),
+				Class("text-sm text-red-600 hover:text-red-800"),
+				g.Attr("onclick", "this.closest('[data-fitment-group]').remove()"),
+				g.Text("Remove"),
+			),
+		),
+		fitmentMakeSelect(group, makes, fitment.Make),
+		fitmentOptionFields(group, opts, fitment),
+	)
+}
+
+// extraFitmentGroups renders the fitment groups after the first one along
+// with the button that appends another group. groups and opts are indexed
+// from the first group, which the forms render separately.
+func extraFitmentGroups(makes []string, groups []ad.FitmentGroup, opts []FitmentGroupOptions) g.Node {
+	nodes := []g.Node{}
+	for i := 1; i < len(groups); i++ {
+		var o FitmentGroupOptions
+		if i < len(opts) {
+			o = opts[i]
+		}
+		nodes = append(nodes, FitmentGroupFields(i, makes, groups[i], o))
+	}
+	return Div(
+		Class("space-y-4"),
+		Div(ID("fitmentGroups"), Class("space-y-4"), g.Group(nodes)),
+		styledButton("Add another make", ButtonSecondary,
+			Type("button"),
+			hx.Get("/api/fitment-group"),
+			hx.Target("#fitmentGroups"),
+			hx.Swap("beforeend"),
+			hx.Vals(`js:{group: Math.max(0, ...Array.from(document.querySelectorAll('#fitmentGroups [data-fitment-group]'), el => +el.dataset.fitmentGroup)) + 1}`),
+		),
+	)
+}
+
+// FitmentFields renders the fitment of the new ad form: the first group's
+// make select and options, then the additional groups. It's swapped as a
+// whole when fitment is filled in from a part number.
+func FitmentFields(makes []string, groups []ad.FitmentGroup, opts []FitmentGroupOptions, attrs ...g.Node) g.Node {
+	first := primaryFitment(groups)
+	makeOptions := []g.Node{}
+	for _, makeName := range makes {
+		makeOptions = append(makeOptions, Option(Value(makeName), g.If(makeName == first.Make, Selected()), g.Text(makeName)))
+	}
+	return Div(
+		ID("fitmentFields"),
+		Class("space-y-6"),
+		g.Group(attrs),
+		formGroup("Make", "make",
+			Select(
+				ID("make"),
+				Name("make"),
+				Class("w-full p-2 border rounded"),
+				hx.Trigger("change"),
+				hx.Get("/api/years"),
+				hx.Target("#yearsDiv"),
+				hx.Include("this"),
+				g.Attr("onchange", "document.getElementById('modelsDiv').innerHTML = ''; document.getElementById('enginesDiv').innerHTML = '';"),
+				Option(Value(""), g.Text("Select a make")),
+				g.Group(makeOptions),
+			),
+		),
+		fitmentOptionFields(0, primaryFitmentOptions(opts), first),
+		extraFitmentGroups(makes, groups, opts),
+	)
+}
+
+// PartNumberFitment tells the seller which vehicles the part number they
+// entered fits, from the interchange. When filled is set the fitment fields
+// are replaced too; otherwise the seller is offered a button to do so.
+func PartNumberFitment(number string, vehicles int, makes []string, groups []ad.FitmentGroup, opts []FitmentGroupOptions, filled bool) g.Node {
+	names := make([]string, 0, len(groups))
+	for _, f := range groups {
+		names = append(names, f.Make+" "+strings.Join(f.Models, ", ")+" "+strings.Join(f.Engines, ", "))
+	}
+	noun := "vehicles"
+	if vehicles == 1 {
+		noun = "vehicle"
+	}
+	fits := fmt.Sprintf("%s fits %d %s: %s.", number, vehicles, noun, strings.Join(names, "; "))
+	if filled {
+		return g.Group{
+			Div(
+				Class("bg-blue-50 border border-blue-200 text-blue-800 px-4 py-3 rounded"),
+				g.Text(fits+" Fitment was filled in from the interchange; check it before posting."),
+			),
+			FitmentFields(makes, groups, opts, hx.SwapOOB("true")),
+		}
+	}
+	return Div(
+		Class("bg-blue-50 border border-blue-200 text-blue-800 px-4 py-3 rounded flex justify-between items-center gap-4"),
+		Span(g.Text(fits)),
+		styledButton("Use this fitment", ButtonSecondary,
+			Type("button"),
+			hx.Get("/api/part-number-fitment"),
+			hx.Target("#partNumberFitment"),
+			hx.Include("#"+ad.AttrPartNumber),
+			hx.Vals(`{"apply": "1"}`),
+		),
+	)
+}
+
+// FitmentNotice tells the seller about selected vehicle combinations that
+// don't exist and were skipped. It renders nothing when none were skipped.
+func FitmentNotice(report ad.FitmentReport) g.Node {
+	if report.Skipped == 0 {
+		return g.Group(nil)
+	}
+	return Div(
+		Class("bg-yellow-100 border border-yellow-400 text-yellow-800 px-4 py-3 rounded mb-4 flex justify-between items-start"),
+		Span(g.Text(report.Summary())),
+		Button(
+			Type("button"),
+			Class("ml-4 font-bold"),
+			g.Attr("onclick", "this.parentElement.remove()"),
+			g.Text("×"),
+		),
+	)
+}
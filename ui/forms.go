@@ -1,10 +1,15 @@
 package ui
 
 import (
+	"fmt"
+	"slices"
+	"strconv"
+
 	g "maragu.dev/gomponents"
 	hx "maragu.dev/gomponents-htmx"
 	. "maragu.dev/gomponents/html"
 
+	"github.com/parts-pile/site/ad"
 	"github.com/parts-pile/site/part"
 )
 
@@ -82,47 +87,110 @@ func passwordInput(id, name string) g.Node {
 	)
 }
 
-func YearsFormGroup(years []string) g.Node {
+func YearsFormGroup(years []string, checked ...string) g.Node {
+	return FitmentYearsFormGroup(0, years, ad.FitmentGroup{Years: checked})
+}
+
+func ModelsFormGroup(models []string, checked ...string) g.Node {
+	return FitmentModelsFormGroup(0, models, ad.FitmentGroup{Models: checked})
+}
+
+func EnginesFormGroup(engines []string, checked ...string) g.Node {
+	return FitmentEnginesFormGroup(0, engines, ad.FitmentGroup{Engines: checked})
+}
+
+// yearRangeSelect renders one end of a fitment group's year range. Picking a
+// range ticks the matching year checkboxes (see fitment.js).
+func yearRangeSelect(name, marker, placeholder string, years []string, selected int) g.Node {
+	options := []g.Node{Option(Value(""), g.Text(placeholder))}
+	for _, year := range years {
+		options = append(options, Option(Value(year), g.If(year == strconv.Itoa(selected), Selected()), g.Text(year)))
+	}
+	return Select(
+		Name(name),
+		Class("p-1 border rounded"),
+		g.Attr(marker, ""),
+		g.Group(options),
+	)
+}
+
+// FitmentYearsFormGroup renders the year checkboxes of a fitment group, with
+// a from/to range as a shortcut for long runs of years
+func FitmentYearsFormGroup(group int, years []string, sel ad.FitmentGroup) g.Node {
+	name := ad.FitmentField("years", group)
 	checkboxes := []g.Node{}
 	for _, year := range years {
 		checkboxes = append(checkboxes,
-			Checkbox("years", year, year, false, false,
+			Checkbox(name, year, year, slices.Contains(sel.Years, year), false,
 				hx.Trigger("change"),
 				hx.Get("/api/models"),
-				hx.Target("#modelsDiv"),
-				hx.Include("[name='make'],[name='years']:checked"),
+				hx.Target("#"+fitmentDivID("modelsDiv", group)),
+				hx.Include(fitmentInclude(group, "make", "years")),
+				hx.Vals(fitmentVals(group)),
 				hx.Swap("innerHTML"),
-				g.Attr("onclick", "document.getElementById('enginesDiv').innerHTML = ''"),
+				g.Attr("onclick", fmt.Sprintf("document.getElementById('%s').innerHTML = ''", fitmentDivID("enginesDiv", group))),
 			),
 		)
 	}
-	return formGroup("Years", "years", GridContainer(5, checkboxes...))
+	return formGroup("Years", name, Div(
+		Class("space-y-2"),
+		g.Attr("data-fitment-options", ""),
+		Div(
+			Class("flex items-center gap-2 text-sm"),
+			Span(g.Text("Range:")),
+			yearRangeSelect(ad.FitmentField("year_from", group), "data-year-from", "From", years, sel.YearFrom),
+			Span(g.Text("to")),
+			yearRangeSelect(ad.FitmentField("year_to", group), "data-year-to", "To", years, sel.YearTo),
+		),
+		GridContainer(5, checkboxes...),
+	))
+}
+
+// fitmentAllCheckbox renders a wildcard that matches every option, including
+// combinations not listed for the selected years
+func fitmentAllCheckbox(field string, group int, label string, checked bool) g.Node {
+	return Checkbox(ad.FitmentField(field, group), "1", label, checked, false, g.Attr("data-fitment-all", ""))
 }
 
-func ModelsFormGroup(models []string) g.Node {
+// FitmentModelsFormGroup renders the model checkboxes of a fitment group
+func FitmentModelsFormGroup(group int, models []string, sel ad.FitmentGroup) g.Node {
+	name := ad.FitmentField("models", group)
 	checkboxes := []g.Node{}
 	for _, model := range models {
 		checkboxes = append(checkboxes,
-			Checkbox("models", model, model, false, false,
+			Checkbox(name, model, model, sel.AllModels || slices.Contains(sel.Models, model), false,
 				hx.Trigger("change"),
 				hx.Get("/api/engines"),
-				hx.Target("#enginesDiv"),
-				hx.Include("[name='make'],[name='years']:checked,[name='models']:checked"),
+				hx.Target("#"+fitmentDivID("enginesDiv", group)),
+				hx.Include(fitmentInclude(group, "make", "years", "models")),
+				hx.Vals(fitmentVals(group)),
 				hx.Swap("innerHTML"),
 			),
 		)
 	}
-	return formGroup("Models", "models", GridContainer(5, checkboxes...))
+	return formGroup("Models", name, Div(
+		Class("space-y-2"),
+		g.Attr("data-fitment-options", ""),
+		fitmentAllCheckbox("all_models", group, "All models", sel.AllModels),
+		GridContainer(5, checkboxes...),
+	))
 }
 
-func EnginesFormGroup(engines []string) g.Node {
+// FitmentEnginesFormGroup renders the engine checkboxes of a fitment group
+func FitmentEnginesFormGroup(group int, engines []string, sel ad.FitmentGroup) g.Node {
+	name := ad.FitmentField("engines", group)
 	checkboxes := []g.Node{}
 	for _, engine := range engines {
 		checkboxes = append(checkboxes,
-			Checkbox("engines", engine, engine, false, false),
+			Checkbox(name, engine, engine, sel.AllEngines || slices.Contains(sel.Engines, engine), false),
 		)
 	}
-	return formGroup("Engines", "engines", GridContainer(5, checkboxes...))
+	return formGroup("Engines", name, Div(
+		Class("space-y-2"),
+		g.Attr("data-fitment-options", ""),
+		fitmentAllCheckbox("all_engines", group, "All engines", sel.AllEngines),
+		GridContainer(5, checkboxes...),
+	))
 }
 
 func CategoriesFormGroup(categories []string, selectedCategory string) g.Node {
@@ -172,11 +240,63 @@ func SubCategoriesFormGroup(subCategories []string, selectedSubCategory string)
 			Name("subcategory"),
 			Class("w-full p-2 border rounded"),
 			Required(),
+			hx.Trigger("change"),
+			hx.Get("/api/part-attributes"),
+			hx.Target("#partAttributesDiv"),
+			hx.Include("this,#partAttributesDiv"),
 			g.Group(options),
 		),
 	)
 }
 
+// CategorySearchFormGroup lets sellers type what they call the part, e.g.
+// "genny", and fills in the matching category and subcategory
+func CategorySearchFormGroup() g.Node {
+	return formGroup("Find a category", "categorySearch",
+		Input(
+			Type("search"),
+			ID("categorySearch"),
+			Name("category_search"),
+			Class("w-full p-2 border rounded"),
+			Placeholder("What do you call the part? e.g. alternator, genny"),
+			hx.Get("/api/category-match"),
+			hx.Trigger("input changed delay:400ms, search"),
+			hx.Target("#categoryFields"),
+			hx.Swap("outerHTML"),
+			hx.Include("this,#partAttributesDiv"),
+		),
+	)
+}
+
+// CategoryFields renders the category and subcategory selects, swapped as a
+// whole when a typed category is matched
+func CategoryFields(categories []string, selectedCategory string, subcategories []string, selectedSubCategory string) g.Node {
+	return Div(
+		ID("categoryFields"),
+		Class("space-y-6"),
+		CategoriesFormGroup(categories, selectedCategory),
+		Div(
+			ID("subcategoriesDiv"),
+			Class("space-y-2"),
+			g.If(len(subcategories) > 0, SubCategoriesFormGroup(subcategories, selectedSubCategory)),
+		),
+	)
+}
+
+// CategoryMatch replaces the category fields with a matched category and
+// subcategory, and the part attribute inputs with the subcategory's
+func CategoryMatch(a ad.Ad, categories []string, category string, subcategories []string, subCategory string) g.Node {
+	return g.Group([]g.Node{
+		CategoryFields(categories, category, subcategories, subCategory),
+		Div(
+			ID("partAttributesDiv"),
+			Class("space-y-2"),
+			hx.SwapOOB("true"),
+			PartAttributesFormGroup(a, part.GetAttributeSchema(subCategory)),
+		),
+	})
+}
+
 func SubCategoriesFormGroupFromStruct(subCategories []part.SubCategory, selectedSubCategory string) g.Node {
 	options := []g.Node{
 		Option(Value(""), g.Text("Select a subcategory")),
@@ -196,11 +316,116 @@ func SubCategoriesFormGroupFromStruct(subCategories []part.SubCategory, selected
 			Name("subcategory"),
 			Class("w-full p-2 border rounded"),
 			Required(),
+			hx.Trigger("change"),
+			hx.Get("/api/part-attributes"),
+			hx.Target("#partAttributesDiv"),
+			hx.Include("this,#partAttributesDiv"),
 			g.Group(options),
 		),
 	)
 }
 
+// PartAttributesFormGroup renders the structured part attribute inputs for a
+// subcategory, marking the ones its attribute schema requires
+func PartAttributesFormGroup(a ad.Ad, schema part.AttributeSchema) g.Node {
+	label := func(text, attr string) string {
+		if schema.IsRequired(attr) {
+			return text
+		}
+		return text + " (Optional)"
+	}
+
+	conditionOptions := []g.Node{Option(Value(""), g.Text("Select a condition"))}
+	for _, c := range ad.Conditions {
+		conditionOptions = append(conditionOptions,
+			Option(Value(c), g.Text(ad.ConditionLabel(c)), g.If(c == a.Condition, Selected())))
+	}
+
+	positionOptions := []g.Node{Option(Value(""), g.Text("Any / not applicable"))}
+	for _, p := range schema.AllowedPositions() {
+		positionOptions = append(positionOptions,
+			Option(Value(p), g.Text(p), g.If(p == a.Position, Selected())))
+	}
+
+	quantity := a.Quantity
+	if quantity < 1 {
+		quantity = 1
+	}
+
+	coreCharge := ""
+	if a.CoreCharge > 0 {
+		coreCharge = fmt.Sprintf("%.2f", a.CoreCharge)
+	}
+
+	return Div(
+		Class("grid grid-cols-1 md:grid-cols-2 gap-4"),
+		formGroup(label("Condition", ad.AttrCondition), ad.AttrCondition,
+			Select(
+				ID(ad.AttrCondition),
+				Name(ad.AttrCondition),
+				Class("w-full p-2 border rounded"),
+				g.If(schema.IsRequired(ad.AttrCondition), Required()),
+				g.Group(conditionOptions),
+			),
+		),
+		formGroup(label("OEM Part Number", ad.AttrPartNumber), ad.AttrPartNumber,
+			Input(
+				Type("text"),
+				ID(ad.AttrPartNumber),
+				Name(ad.AttrPartNumber),
+				Class("w-full p-2 border rounded"),
+				Placeholder("e.g. 3L3Z-10346-BA"),
+				g.If(schema.IsRequired(ad.AttrPartNumber), Required()),
+				Value(a.PartNumber),
+			),
+		),
+		formGroup("Quantity", ad.AttrQuantity,
+			Input(
+				Type("number"),
+				ID(ad.AttrQuantity),
+				Name(ad.AttrQuantity),
+				Class("w-full p-2 border rounded"),
+				Min("1"),
+				Step("1"),
+				Value(fmt.Sprintf("%d", quantity)),
+			),
+		),
+		formGroup(label("Side / Position", ad.AttrPosition), ad.AttrPosition,
+			Select(
+				ID(ad.AttrPosition),
+				Name(ad.AttrPosition),
+				Class("w-full p-2 border rounded"),
+				g.If(schema.IsRequired(ad.AttrPosition), Required()),
+				g.Group(positionOptions),
+			),
+		),
+		g.If(schema.CoreCharge || a.CoreCharge > 0 || schema.IsRequired(ad.AttrCoreCharge),
+			formGroup(label("Core Charge", ad.AttrCoreCharge), ad.AttrCoreCharge,
+				Input(
+					Type("number"),
+					ID(ad.AttrCoreCharge),
+					Name(ad.AttrCoreCharge),
+					Class("w-full p-2 border rounded"),
+					Step("0.01"),
+					Min("0"),
+					g.If(schema.IsRequired(ad.AttrCoreCharge), Required()),
+					Value(coreCharge),
+				),
+			),
+		),
+	)
+}
+
+// partAttributesDiv wraps the part attribute inputs so changing the subcategory
+// can swap in the inputs for its attribute schema
+func partAttributesDiv(a ad.Ad, subCategory string) g.Node {
+	return Div(
+		ID("partAttributesDiv"),
+		Class("space-y-2"),
+		PartAttributesFormGroup(a, part.GetAttributeSchema(subCategory)),
+	)
+}
+
 // notificationMethodRadioGroup creates radio buttons for selecting notification method
 func notificationMethodRadioGroup(selectedMethod string, emailAddress *string, phoneNumber string) g.Node {
 	radioButtons := []g.Node{
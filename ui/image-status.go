@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"fmt"
+
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/adimage"
+)
+
+// imageStatusLoader loads the processing status of the seller's uploaded
+// images after the detail renders. Other users never see it.
+func imageStatusLoader(ad ad.Ad, userID int) g.Node {
+	if userID == 0 || userID != ad.UserID {
+		return nil
+	}
+	return Div(
+		hx.Get(fmt.Sprintf("/ad/image-status/%d", ad.ID)),
+		hx.Trigger("load"),
+		hx.Swap("outerHTML"),
+	)
+}
+
+// AdImageStatus tells the seller which uploaded images are still processing
+// and which failed. It polls while images are processing; polled is set on
+// those follow-up requests so the seller learns when the images are ready.
+func AdImageStatus(adID int, jobs []adimage.Job, polled bool) g.Node {
+	var pending, failed []adimage.Job
+	for _, j := range jobs {
+		if j.Status == adimage.StatusFailed {
+			failed = append(failed, j)
+		} else {
+			pending = append(pending, j)
+		}
+	}
+
+	if len(pending) == 0 && len(failed) == 0 {
+		if !polled {
+			return EmptyResponse()
+		}
+		return Div(
+			Class("bg-green-100 border border-green-400 text-green-800 px-4 py-2 rounded text-sm"),
+			g.Text("Your new images are ready. "),
+			A(Href(fmt.Sprintf("/ad/%d", adID)), Class("underline"), g.Text("Reload to see them")),
+		)
+	}
+
+	return Div(
+		ID(fmt.Sprintf("image-status-%d", adID)),
+		Class("flex flex-col gap-2 text-sm"),
+		g.If(len(pending) > 0, g.Group{
+			hx.Get(fmt.Sprintf("/ad/image-status/%d?polled=1", adID)),
+			hx.Trigger("every 3s"),
+			hx.Swap("outerHTML"),
+		}),
+		g.If(len(pending) > 0, pendingImagesNode(pending)),
+		g.If(len(failed) > 0, failedImagesNode(adID, failed)),
+	)
+}
+
+func pendingImagesNode(pending []adimage.Job) g.Node {
+	retrying := 0
+	for _, j := range pending {
+		if j.Attempts > 0 && j.LastError != "" {
+			retrying++
+		}
+	}
+	msg := fmt.Sprintf("Processing %d image(s). They'll appear on the ad when ready.", len(pending))
+	if retrying > 0 {
+		msg += fmt.Sprintf(" %d will be retried shortly.", retrying)
+	}
+	return Div(
+		Class("bg-blue-50 border border-blue-300 text-blue-800 px-4 py-2 rounded"),
+		g.Text(msg),
+	)
+}
+
+func failedImagesNode(adID int, failed []adimage.Job) g.Node {
+	return Div(
+		Class("bg-red-50 border border-red-300 text-red-800 px-4 py-2 rounded"),
+		Div(Class("font-medium"), g.Text(fmt.Sprintf("%d image(s) couldn't be added:", len(failed)))),
+		Ul(
+			Class("list-disc ml-5"),
+			g.Map(failed, func(j adimage.Job) g.Node {
+				return Li(g.Textf("%s: %s", j.Filename, j.LastError))
+			}),
+		),
+		Button(
+			Type("button"),
+			Class("mt-1 underline"),
+			hx.Post(fmt.Sprintf("/api/ad-images/%d/dismiss", adID)),
+			hx.Target(fmt.Sprintf("#image-status-%d", adID)),
+			hx.Swap("outerHTML"),
+			g.Text("Dismiss"),
+		),
+	)
+}
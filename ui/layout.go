@@ -31,12 +31,19 @@ func seoMetaTags(title, currentPath string) []g.Node {
 }
 
 func Page(title string, currentUser *user.User, currentPath string, content []g.Node) g.Node {
+	return PageWithMeta(title, currentUser, currentPath, nil, content)
+}
+
+// PageWithMeta renders a page with extra tags in its head, such as the link
+// preview tags of a page meant to be shared
+func PageWithMeta(title string, currentUser *user.User, currentPath string, meta []g.Node, content []g.Node) g.Node {
 	return components.HTML5(components.HTML5Props{
 		Title:    title,
 		Language: "en",
 		Head: []g.Node{
 			// SEO Meta Tags (only on homepage)
 			g.If(currentPath == "/", g.Group(seoMetaTags(title, currentPath))),
+			g.Group(meta),
 
 			// Favicons
 			Link(Rel("icon"), Type("image/png"), Href("/images/favicon-32x32.png"), g.Attr("sizes", "32x32")),
@@ -78,6 +85,12 @@ func Page(title string, currentUser *user.User, currentPath string, content []g.
 				Src("/js/global-indicator.js"),
 				Defer(),
 			),
+			// Fitment range and wildcard helpers for the ad forms
+			Script(
+				Type("text/javascript"),
+				Src("/js/fitment.js"),
+				Defer(),
+			),
 			// Script(
 			// 	Type("text/javascript"),
 			// 	g.Raw("if(window.htmx){htmx.logAll()} else {document.addEventListener('htmx:load',function(){htmx.logAll()})}"),
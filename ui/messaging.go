@@ -28,7 +28,7 @@ func MessagesPage(currentUser *user.User, conversations []messaging.Conversation
 					),
 				),
 				g.If(len(conversations) > 0,
-					ConversationsList(conversations, currentUser.ID),
+					conversationUpdates(ConversationsList(conversations, currentUser.ID)),
 				),
 			),
 		},
@@ -71,13 +71,23 @@ func MessagesPageWithExpanded(currentUser *user.User, conversations []messaging.
 					),
 				),
 				g.If(len(conversations) > 0,
-					ConversationsListWithExpanded(conversations, currentUser, expandedConversation, expandedMessages),
+					conversationUpdates(ConversationsListWithExpanded(conversations, currentUser, expandedConversation, expandedMessages)),
 				),
 			),
 		},
 	)
 }
 
+// conversationUpdates connects the conversation list to the messaging SSE
+// stream so expanded conversations can react to updates
+func conversationUpdates(list g.Node) g.Node {
+	return Div(
+		g.Attr("hx-ext", "sse"),
+		g.Attr("sse-connect", "/messages/sse"),
+		list,
+	)
+}
+
 // ConversationsList renders the list of conversations
 func ConversationsList(conversations []messaging.Conversation, currentUserID int) g.Node {
 	var conversationNodes []g.Node
@@ -211,8 +221,16 @@ func ExpandedConversation(currentUser *user.User, conversation messaging.Convers
 			Div(
 				Class("bg-white rounded-lg border h-96 flex flex-col"),
 				MessagesList(messages, currentUser.ID),
+				OfferPanel(currentUser, conversation, messages),
 				MessageForm(conversation.ID),
 			),
+			// Reload the conversation when either side updates an offer
+			Div(
+				hx.Get(fmt.Sprintf("/messages/%d/expand", conversation.ID)),
+				hx.Trigger("sse:"+messaging.UpdateTypeOfferUpdated),
+				hx.Target(fmt.Sprintf("#conversation-%d", conversation.ID)),
+				hx.Swap("outerHTML"),
+			),
 		),
 	)
 }
@@ -238,6 +256,10 @@ func MessagesList(messages []messaging.Message, currentUserID int) g.Node {
 
 // MessageItem renders a single message
 func MessageItem(msg messaging.Message, currentUserID int) g.Node {
+	if msg.IsOffer() && msg.Offer != nil {
+		return OfferMessageItem(msg, currentUserID)
+	}
+
 	isOwnMessage := msg.SenderID == currentUserID
 
 	messageClass := "bg-blue-500 text-white"
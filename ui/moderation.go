@@ -0,0 +1,322 @@
+package ui
+
+import (
+	"fmt"
+
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/moderation"
+)
+
+// hiddenBadge tells the seller their ad is hidden by moderators, or returns nil
+func hiddenBadge(ad ad.Ad) g.Node {
+	if !ad.IsHidden() {
+		return nil
+	}
+	return Span(
+		Class("text-xs font-medium text-red-800 bg-red-100 rounded px-1"),
+		Title("Only you can see this ad until a moderator reviews it"),
+		g.Text("Hidden by moderators"),
+	)
+}
+
+// reportAdForm lets signed-in users other than the seller report an ad
+func reportAdForm(ad ad.Ad, userID int) g.Node {
+	if userID == 0 || userID == ad.UserID {
+		return nil
+	}
+	return Details(
+		ID(fmt.Sprintf("report-ad-%d", ad.ID)),
+		Class("text-sm text-gray-500 mt-2"),
+		Summary(Class("cursor-pointer hover:text-gray-700"), g.Text("Report this ad")),
+		Form(
+			Class("flex flex-col gap-2 mt-2"),
+			hx.Post(fmt.Sprintf("/api/report-ad/%d", ad.ID)),
+			hx.Target("this"),
+			hx.Swap("outerHTML"),
+			Textarea(
+				Name("details"),
+				Class("w-full p-2 border rounded"),
+				Rows("2"),
+				Placeholder("What's wrong with this ad?"),
+				Required(),
+			),
+			Div(styledButton("Send report", ButtonDanger, Type("submit"))),
+		),
+	)
+}
+
+// ReportAdResult replaces the report form once a report is sent
+func ReportAdResult(notice g.Node) g.Node {
+	return Div(Class("mt-2"), notice)
+}
+
+func moderationCaseNode(mc moderation.Case) g.Node {
+	reporter := ""
+	if mc.ReporterName != "" {
+		reporter = " by " + mc.ReporterName
+	}
+	return Li(
+		Class("text-sm"),
+		Span(Class("font-medium"), g.Text(mc.Reason.Label())),
+		g.Text(fmt.Sprintf("%s on %s", reporter, mc.CreatedAt.Format("2006-01-02 15:04"))),
+		g.If(mc.Details != "", Div(Class("text-gray-600 whitespace-pre-line"), g.Text(mc.Details))),
+	)
+}
+
+// moderationQueueItem renders a queued ad with its cases and the decision form
+func moderationQueueItem(item moderation.QueueItem) g.Node {
+	buttons := make([]g.Node, 0, len(moderation.Actions))
+	for _, action := range moderation.Actions {
+		variant := ButtonSecondary
+		switch action {
+		case moderation.ActionApprove:
+			variant = buttonPrimary
+		case moderation.ActionBanSeller:
+			variant = ButtonDanger
+		}
+		buttons = append(buttons, styledButton(action.Label(), variant,
+			Type("submit"), Name("action"), Value(string(action))))
+	}
+
+	cases := make([]g.Node, 0, len(item.Cases))
+	for _, mc := range item.Cases {
+		cases = append(cases, moderationCaseNode(mc))
+	}
+
+	return Div(
+		Class("border p-4 mb-4 rounded bg-white"),
+		Div(
+			Class("flex items-center gap-2 mb-2"),
+			A(Href(fmt.Sprintf("/ad/%d", item.AdID)), Class("font-semibold text-blue-600 hover:text-blue-800"), g.Text(item.AdTitle)),
+			g.If(item.Hidden, Span(Class("text-xs font-medium text-red-800 bg-red-100 rounded px-1"), g.Text("Hidden"))),
+			Span(Class("text-sm text-gray-500"), g.Text("by "+item.SellerName)),
+		),
+		Ul(Class("mb-3 space-y-1"), g.Group(cases)),
+		Form(
+			hx.Post(fmt.Sprintf("/api/admin/moderation/%d/decide", item.AdID)),
+			hx.Target("#admin-section-content"),
+			hx.Swap("innerHTML"),
+			Textarea(
+				Name("note"),
+				Class("w-full p-2 border rounded mb-2"),
+				Rows("2"),
+				Placeholder("Note to the seller (optional)"),
+			),
+			Div(Class("flex flex-wrap gap-2"), g.Group(buttons)),
+		),
+	)
+}
+
+// moderationMessageItem renders a flagged message with the decision form.
+// The decisions act on the message and its sender, never on the ad.
+func moderationMessageItem(mc moderation.MessageCase) g.Node {
+	buttons := make([]g.Node, 0, len(moderation.MessageActions))
+	for _, action := range moderation.MessageActions {
+		variant := ButtonSecondary
+		switch action {
+		case moderation.MessageActionDismiss:
+			variant = buttonPrimary
+		case moderation.MessageActionBanSender:
+			variant = ButtonDanger
+		}
+		buttons = append(buttons, styledButton(action.Label(), variant,
+			Type("submit"), Name("action"), Value(string(action))))
+	}
+
+	return Div(
+		Class("border p-4 mb-4 rounded bg-white"),
+		Div(
+			Class("flex items-center gap-2 mb-2"),
+			Span(Class("font-semibold"), g.Text("Message from "+mc.SenderName)),
+			g.If(mc.AdTitle != "", Span(Class("text-sm text-gray-500"),
+				g.Text("about "),
+				A(Href(fmt.Sprintf("/ad/%d", mc.AdID)), Class("text-blue-600 hover:text-blue-800"), g.Text(mc.AdTitle)),
+			)),
+			Span(Class("text-sm text-gray-500"), g.Text(mc.CreatedAt.Format("2006-01-02 15:04"))),
+		),
+		Div(Class("text-sm text-gray-600 whitespace-pre-line mb-3"), g.Text(mc.Details)),
+		Form(
+			hx.Post(fmt.Sprintf("/api/admin/moderation/messages/%d/decide", mc.ID)),
+			hx.Target("#admin-section-content"),
+			hx.Swap("innerHTML"),
+			Div(Class("flex flex-wrap gap-2"), g.Group(buttons)),
+		),
+	)
+}
+
+func moderationDecisionRow(d moderation.Decision) g.Node {
+	return Tr(
+		Class("border-t"),
+		Td(Class("p-2 text-gray-500"), g.Text(d.CreatedAt.Format("2006-01-02 15:04"))),
+		Td(Class("p-2"), A(Href(fmt.Sprintf("/ad/%d", d.AdID)), Class("text-blue-600 hover:text-blue-800"), g.Text(d.AdTitle))),
+		Td(Class("p-2"), g.Text(d.SellerName)),
+		Td(Class("p-2 font-medium"), g.Text(d.Action.Label())),
+		Td(Class("p-2"), g.Text(d.AdminName)),
+		Td(Class("p-2 text-gray-600"), g.Text(d.Note)),
+	)
+}
+
+// AdminModerationSection renders the ad and message queues and recent
+// decisions. notice, if set, reports the outcome of the last decision.
+func AdminModerationSection(queue []moderation.QueueItem, messages []moderation.MessageCase, decisions []moderation.Decision, notice g.Node) g.Node {
+	items := make([]g.Node, 0, len(queue))
+	for _, item := range queue {
+		items = append(items, moderationQueueItem(item))
+	}
+	if len(items) == 0 {
+		items = append(items, Div(Class("text-gray-500 mb-4"), g.Text("Nothing to review.")))
+	}
+
+	flagged := make([]g.Node, 0, len(messages))
+	for _, mc := range messages {
+		flagged = append(flagged, moderationMessageItem(mc))
+	}
+
+	rows := make([]g.Node, 0, len(decisions))
+	for _, d := range decisions {
+		rows = append(rows, moderationDecisionRow(d))
+	}
+
+	return Div(
+		H1(g.Text("Moderation Queue")),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		g.Group(items),
+		g.If(len(flagged) > 0, H2(Class("text-lg font-semibold mt-8 mb-2"), g.Text("Flagged Messages"))),
+		g.Group(flagged),
+		H2(Class("text-lg font-semibold mt-8 mb-2"), g.Text("Recent Decisions")),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Text("No decisions yet."))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("When")),
+				Th(Class("p-2 text-left"), g.Text("Ad")),
+				Th(Class("p-2 text-left"), g.Text("Seller")),
+				Th(Class("p-2 text-left"), g.Text("Decision")),
+				Th(Class("p-2 text-left"), g.Text("Admin")),
+				Th(Class("p-2 text-left"), g.Text("Note")),
+			)),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
+
+func moderationRuleRow(r moderation.Rule) g.Node {
+	outcomeClass := "text-yellow-800 bg-yellow-100"
+	if r.Outcome == moderation.OutcomeBlock {
+		outcomeClass = "text-red-800 bg-red-100"
+	}
+	return Tr(
+		Class("border-t"),
+		Td(Class("p-2 font-mono"), g.Text(r.Pattern)),
+		Td(Class("p-2"), g.Text(string(r.MatchType))),
+		Td(Class("p-2"), g.Text(r.Kind.Label())),
+		Td(Class("p-2"), Span(Class("text-xs font-medium rounded px-1 "+outcomeClass), g.Text(string(r.Outcome)))),
+		Td(Class("p-2 text-gray-600"), g.Text(r.Reason)),
+		Td(Class("p-2 text-right"),
+			Button(
+				Class("text-red-600 hover:text-red-800"),
+				hx.Post(fmt.Sprintf("/api/admin/moderation-rules/%d/delete", r.ID)),
+				hx.Target("#admin-section-content"),
+				hx.Swap("innerHTML"),
+				hx.Confirm("Delete this rule?"),
+				g.Text("Delete"),
+			),
+		),
+	)
+}
+
+func moderationKindOptions() g.Node {
+	options := []g.Node{Option(Value(""), g.Text(moderation.Kind("").Label()))}
+	for _, k := range moderation.Kinds {
+		options = append(options, Option(Value(string(k)), g.Text(k.Label())))
+	}
+	return Select(Name("kind"), Class("p-2 border rounded"), g.Group(options))
+}
+
+// moderationRuleForm adds one rule per line of the pattern box, so a word
+// list can be pasted in at once
+func moderationRuleForm() g.Node {
+	return Form(
+		Class("bg-gray-100 p-4 rounded-lg mb-6 flex flex-col gap-2"),
+		hx.Post("/api/admin/moderation-rules"),
+		hx.Target("#admin-section-content"),
+		hx.Swap("innerHTML"),
+		H2(Class("text-lg font-semibold"), g.Text("Add Rules")),
+		Textarea(
+			Name("patterns"),
+			Class("w-full p-2 border rounded font-mono"),
+			Rows("4"),
+			Placeholder("One word, phrase or regular expression per line"),
+			Required(),
+		),
+		Div(
+			Class("flex flex-wrap gap-2"),
+			Select(Name("match_type"), Class("p-2 border rounded"),
+				Option(Value(string(moderation.MatchWord)), g.Text("Word or phrase")),
+				Option(Value(string(moderation.MatchRegex)), g.Text("Regular expression")),
+			),
+			moderationKindOptions(),
+			Select(Name("outcome"), Class("p-2 border rounded"),
+				Option(Value(string(moderation.OutcomeFlag)), g.Text("Flag for review")),
+				Option(Value(string(moderation.OutcomeBlock)), g.Text("Block")),
+			),
+			Input(Type("text"), Name("reason"), Class("flex-1 p-2 border rounded"),
+				Placeholder("Reason shown to admins, or to users when blocked")),
+		),
+		Div(styledButton("Add", buttonPrimary, Type("submit"))),
+	)
+}
+
+// moderationRuleTester checks sample text against the saved rules
+func moderationRuleTester() g.Node {
+	return Form(
+		Class("bg-gray-100 p-4 rounded-lg mb-6 flex flex-col gap-2"),
+		hx.Post("/api/admin/moderation-rules/test"),
+		hx.Target("#moderation-rule-test-result"),
+		hx.Swap("innerHTML"),
+		H2(Class("text-lg font-semibold"), g.Text("Test Rules")),
+		Textarea(Name("text"), Class("w-full p-2 border rounded"), Rows("2"), Placeholder("Sample text")),
+		Div(Class("flex gap-2"), moderationKindOptions(), styledButton("Test", ButtonSecondary, Type("submit"))),
+		Div(ID("moderation-rule-test-result")),
+	)
+}
+
+// ModerationRuleTestResult shows the verdict for sample text
+func ModerationRuleTestResult(verdict moderation.Verdict) g.Node {
+	if verdict.Outcome == moderation.OutcomeAllow {
+		return Div(Class("text-green-700"), g.Text("Allowed"))
+	}
+	return Div(Class("text-red-700"), g.Textf("%s: %s", verdict.Outcome, verdict.Reason))
+}
+
+// AdminModerationRulesSection lists the screening rules with forms to add
+// and test them. notice, if set, reports the outcome of the last change.
+func AdminModerationRulesSection(rules []moderation.Rule, notice g.Node) g.Node {
+	rows := make([]g.Node, 0, len(rules))
+	for _, r := range rules {
+		rows = append(rows, moderationRuleRow(r))
+	}
+	return Div(
+		H1(g.Text("Moderation Rules")),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		moderationRuleForm(),
+		moderationRuleTester(),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Text("No rules yet."))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Pattern")),
+				Th(Class("p-2 text-left"), g.Text("Match")),
+				Th(Class("p-2 text-left"), g.Text("Applies to")),
+				Th(Class("p-2 text-left"), g.Text("Outcome")),
+				Th(Class("p-2 text-left"), g.Text("Reason")),
+				Th(),
+			)),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
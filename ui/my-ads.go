@@ -0,0 +1,163 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+	"github.com/parts-pile/site/user"
+)
+
+// Tabs of the My Ads page
+const (
+	MyAdsActive   = "active"
+	MyAdsArchived = "archived"
+	MyAdsDrafts   = "drafts"
+)
+
+var myAdsTabLabels = []struct{ tab, label string }{
+	{MyAdsActive, "Active"},
+	{MyAdsArchived, "Archived"},
+	{MyAdsDrafts, "Drafts"},
+}
+
+func myAdsTabs(current string) g.Node {
+	links := make([]g.Node, 0, len(myAdsTabLabels))
+	for _, t := range myAdsTabLabels {
+		class := "px-4 py-2 -mb-px border-b-2 border-transparent text-gray-600 hover:text-gray-800"
+		if t.tab == current {
+			class = "px-4 py-2 -mb-px border-b-2 border-blue-500 text-blue-600 font-semibold"
+		}
+		links = append(links, A(Href("/my-ads?tab="+t.tab), Class(class), g.Text(t.label)))
+	}
+	return Div(Class("flex border-b mb-6"), g.Group(links))
+}
+
+// myAdRow renders one of the seller's ads with its selection checkbox
+func myAdRow(adObj ad.Ad, loc *time.Location) g.Node {
+	title := Span(Class("font-semibold"), titleNode(adObj))
+	if !adObj.IsArchived() {
+		title = A(Href(fmt.Sprintf("/ad/%d", adObj.ID)), Class("font-semibold text-blue-600 hover:text-blue-800"), titleNode(adObj))
+	}
+	return Div(
+		Class("border p-4 mb-2 rounded bg-white flex items-center gap-4"),
+		Input(Type("checkbox"), Name("ad_ids"), Value(fmt.Sprintf("%d", adObj.ID)), g.Attr("data-my-ad", "")),
+		Div(
+			Class("flex-1"),
+			Div(Class("flex items-center gap-2"), title, pendingBadge(adObj), hiddenBadge(adObj)),
+			Div(Class("text-sm text-gray-600"),
+				g.Text(fmt.Sprintf("Listed %s ago", formatAdAge(adObj.CreatedAt.In(loc))))),
+		),
+		Span(Class("text-green-600"), priceNode(adObj)),
+		g.If(!adObj.IsArchived(), Div(
+			Class("flex items-center space-x-2 text-sm"),
+			A(Href(fmt.Sprintf("/edit-ad/%d", adObj.ID)), Class("text-blue-600 hover:text-blue-800"), g.Text("Edit")),
+			A(Href(fmt.Sprintf("/analytics/ad/%d", adObj.ID)), Class("text-blue-600 hover:text-blue-800"), g.Text("Analytics")),
+		)),
+	)
+}
+
+// bulkAction is a submit button applying an action to the selected ads
+func bulkAction(text, action string, variant ButtonVariant, attrs ...g.Node) g.Node {
+	return styledButton(text, variant, append([]g.Node{Type("submit"), Name("action"), Value(action)}, attrs...)...)
+}
+
+// myAdsBulkBar renders the actions available for the selected ads of a tab
+func myAdsBulkBar(tab string) g.Node {
+	selectAll := Label(
+		Class("flex items-center gap-2 text-sm"),
+		Input(Type("checkbox"), g.Attr("onchange",
+			"this.form.querySelectorAll('[data-my-ad]').forEach(function(box) { box.checked = this.checked }, this)")),
+		g.Text("Select all"),
+	)
+
+	if tab == MyAdsArchived {
+		return Div(
+			Class("flex flex-wrap items-center gap-4 mb-4"),
+			selectAll,
+			bulkAction("Restore", "restore", buttonPrimary),
+		)
+	}
+	return Div(
+		Class("flex flex-wrap items-center gap-4 mb-4"),
+		selectAll,
+		bulkAction("Renew", "renew", ButtonSecondary),
+		bulkAction("Archive", "archive", ButtonDanger),
+		Div(
+			Class("flex items-center gap-2"),
+			Select(
+				Name("price_mode"),
+				Class("p-2 border rounded"),
+				Option(Value("set"), g.Text("Set price to $")),
+				Option(Value("percent"), g.Text("Lower price by %")),
+			),
+			Input(Type("number"), Name("price"), Min("0"), Step("0.01"), Class("w-24 p-2 border rounded")),
+			bulkAction("Change price", "price", ButtonSecondary),
+		),
+	)
+}
+
+// MyAdsTab renders the contents of a My Ads tab. notice, if set, reports the
+// outcome of the last bulk action.
+func MyAdsTab(tab string, ads []ad.Ad, drafts []ad.Draft, loc *time.Location, notice g.Node) g.Node {
+	if tab == MyAdsDrafts {
+		nodes := make([]g.Node, 0, len(drafts))
+		for _, d := range drafts {
+			nodes = append(nodes, DraftListItem(d))
+		}
+		if len(nodes) == 0 {
+			nodes = append(nodes, myAdsEmpty("No drafts.", "Ads you start are saved here automatically until you publish them."))
+		}
+		return Div(ID("my-ads-tab"), g.Group(nodes))
+	}
+
+	if len(ads) == 0 {
+		if tab == MyAdsArchived {
+			return Div(ID("my-ads-tab"), notice, myAdsEmpty("No archived ads.", "Ads you archive are kept here so you can restore them."))
+		}
+		return Div(ID("my-ads-tab"), notice, myAdsEmpty("No active ads.", "Ads you post show up here."))
+	}
+
+	rows := make([]g.Node, 0, len(ads))
+	for _, a := range ads {
+		rows = append(rows, myAdRow(a, loc))
+	}
+	return Div(
+		ID("my-ads-tab"),
+		Form(
+			hx.Post("/api/my-ads/bulk"),
+			hx.Encoding("multipart/form-data"),
+			hx.Target("#my-ads-tab"),
+			hx.Swap("outerHTML"),
+			Input(Type("hidden"), Name("tab"), Value(tab)),
+			g.If(notice != nil, Div(Class("mb-4"), notice)),
+			myAdsBulkBar(tab),
+			g.Group(rows),
+		),
+	)
+}
+
+func myAdsEmpty(title, hint string) g.Node {
+	return Div(Class("text-center py-12"),
+		Div(Class("text-gray-500 text-lg mb-4"), g.Text(title)),
+		Div(Class("text-gray-400 text-sm"), g.Text(hint)),
+	)
+}
+
+// MyAdsPage lists the seller's ads by state with bulk actions
+func MyAdsPage(currentUser *user.User, path, tab string, ads []ad.Ad, drafts []ad.Draft, loc *time.Location) g.Node {
+	return Page(
+		"My Ads",
+		currentUser,
+		path,
+		[]g.Node{
+			pageHeader("My Ads"),
+			myAdsTabs(tab),
+			MyAdsTab(tab, ads, drafts, loc, nil),
+		},
+	)
+}
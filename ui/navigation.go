@@ -55,6 +55,7 @@ func navigation(currentUser *user.User, currentPath string) g.Node {
 	return Nav(
 		Class("mb-8 border-b pb-4 flex items-center space-x-4 w-full"),
 		A(Href("/"), Class("text-xl font-bold"), g.Text("Parts Pile")),
+		A(Href("/parts"), Class("text-blue-500 hover:underline"), g.Text("Browse")),
 		Span(Class("flex-grow")),
 		g.Iff(currentUser != nil, func() g.Node { return navLoggedIn(currentUser) }),
 		g.Iff(currentUser == nil, func() g.Node { return navLoggedOut(currentPath) }),
@@ -105,6 +106,24 @@ func UserMenuPopup(currentUser *user.User, currentPath string) g.Node {
 		),
 	)
 
+	menuItems = append(menuItems,
+		A(
+			Href("/my-ads"),
+			Class("block px-4 py-2 text-sm text-gray-700 hover:bg-gray-50 flex items-center"),
+			Span(Class("w-4 h-4 mr-2 text-center leading-4"), g.Text("📝")),
+			g.Text("My ads"),
+		),
+	)
+
+	menuItems = append(menuItems,
+		A(
+			Href("/analytics"),
+			Class("block px-4 py-2 text-sm text-gray-700 hover:bg-gray-50 flex items-center"),
+			Span(Class("w-4 h-4 mr-2 text-center leading-4"), g.Text("📈")),
+			g.Text("Ad analytics"),
+		),
+	)
+
 	menuItems = append(menuItems,
 		A(
 			Href("/messages"),
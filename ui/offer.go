@@ -0,0 +1,161 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/messaging"
+	"github.com/parts-pile/site/user"
+)
+
+// offerStatusBadge renders an offer's status as a colored label
+func offerStatusBadge(offer messaging.Offer) g.Node {
+	status := offer.CurrentStatus()
+	class := "bg-gray-100 text-gray-700"
+	switch status {
+	case messaging.OfferStatusPending:
+		class = "bg-yellow-100 text-yellow-800"
+	case messaging.OfferStatusAccepted:
+		class = "bg-green-100 text-green-800"
+	case messaging.OfferStatusDeclined, messaging.OfferStatusExpired:
+		class = "bg-red-100 text-red-700"
+	}
+	return Span(
+		Class("text-xs font-medium px-2 py-0.5 rounded-full "+class),
+		g.Text(status),
+	)
+}
+
+// offerExpiryText describes when an open offer expires
+func offerExpiryText(offer messaging.Offer) string {
+	remaining := time.Until(offer.ExpiresAt)
+	if remaining < time.Hour {
+		return fmt.Sprintf("expires in %dm", int(remaining.Minutes()))
+	}
+	return fmt.Sprintf("expires in %dh", int(remaining.Hours()))
+}
+
+// OfferMessageItem renders an offer, counter-offer or offer response inside a conversation
+func OfferMessageItem(msg messaging.Message, currentUserID int) g.Node {
+	isOwnMessage := msg.SenderID == currentUserID
+	containerClass := "flex justify-end"
+	if !isOwnMessage {
+		containerClass = "flex justify-start"
+	}
+
+	offer := *msg.Offer
+	title := "Offer"
+	if offer.IsCounter() {
+		title = "Counter-offer"
+	}
+
+	var body g.Node
+	if msg.Type == messaging.MessageTypeOfferResponse {
+		body = P(Class("text-sm text-gray-700"), g.Text(msg.Content))
+	} else {
+		body = Div(
+			Class("flex items-center justify-between gap-4"),
+			Div(
+				Div(Class("text-xs text-gray-500"), g.Text(title)),
+				Div(Class("text-lg font-semibold text-green-700"), g.Text(fmt.Sprintf("$%.2f", offer.Amount))),
+			),
+			Div(
+				Class("flex flex-col items-end gap-1"),
+				offerStatusBadge(offer),
+				g.If(offer.IsOpen(), Span(Class("text-xs text-gray-400"), g.Text(offerExpiryText(offer)))),
+			),
+		)
+	}
+
+	return Div(
+		Class(containerClass),
+		Div(
+			Class("max-w-xs lg:max-w-md px-4 py-2 rounded-lg border border-green-300 bg-green-50"),
+			body,
+			Div(Class("text-xs text-gray-400 mt-1"), g.Text(formatAdAge(msg.CreatedAt))),
+		),
+	)
+}
+
+// latestOffer returns the most recent offer in a conversation's messages
+func latestOffer(messages []messaging.Message) (messaging.Offer, bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Type == messaging.MessageTypeOffer && messages[i].Offer != nil {
+			return *messages[i].Offer, true
+		}
+	}
+	return messaging.Offer{}, false
+}
+
+// OfferPanel renders the offer actions available to the current user: make an
+// offer, answer the open offer, or mark the ad pending after an acceptance
+func OfferPanel(currentUser *user.User, conversation messaging.Conversation, messages []messaging.Message) g.Node {
+	offer, hasOffer := latestOffer(messages)
+	isSeller := currentUser.ID == conversation.AdUserID
+	inputClass := "w-28 p-2 border border-gray-300 rounded-lg"
+	target := fmt.Sprintf("#conversation-%d", conversation.ID)
+
+	var content g.Node
+	switch {
+	case hasOffer && offer.IsOpen() && offer.RecipientID == currentUser.ID:
+		respondURL := fmt.Sprintf("/messages/offers/%d/respond", offer.ID)
+		content = Div(
+			Class("flex flex-wrap items-center gap-2"),
+			Span(Class("text-sm text-gray-700"), g.Text(fmt.Sprintf("Respond to $%.2f:", offer.Amount))),
+			styledButton("Accept", buttonPrimary,
+				hx.Post(respondURL),
+				hx.Vals(`{"action": "accept"}`),
+				hx.Target(target),
+				hx.Swap("outerHTML"),
+			),
+			styledButton("Decline", ButtonDanger,
+				hx.Post(respondURL),
+				hx.Vals(`{"action": "decline"}`),
+				hx.Target(target),
+				hx.Swap("outerHTML"),
+			),
+			Form(
+				Class("flex items-center gap-2"),
+				hx.Post(respondURL),
+				hx.Vals(`{"action": "counter"}`),
+				hx.Target(target),
+				hx.Swap("outerHTML"),
+				Input(Type("number"), Name("amount"), Step("0.01"), Min("0.01"), Placeholder("Amount"), Class(inputClass), Required()),
+				styledButton("Counter", ButtonSecondary, Type("submit")),
+			),
+		)
+	case hasOffer && offer.IsOpen():
+		content = P(Class("text-sm text-gray-500"),
+			g.Text(fmt.Sprintf("Waiting for a response to your offer of $%.2f (%s).", offer.Amount, offerExpiryText(offer))))
+	case hasOffer && offer.Status == messaging.OfferStatusAccepted && isSeller:
+		content = Div(
+			Class("flex items-center gap-2"),
+			Span(Class("text-sm text-gray-700"), g.Text(fmt.Sprintf("Offer of $%.2f accepted.", offer.Amount))),
+			styledButton("Mark ad as pending", ButtonSecondary,
+				hx.Post(fmt.Sprintf("/messages/offers/%d/pending", offer.ID)),
+				hx.Target(fmt.Sprintf("#offer-result-%d", conversation.ID)),
+			),
+		)
+	case !isSeller:
+		content = Form(
+			Class("flex items-center gap-2"),
+			hx.Post(fmt.Sprintf("/messages/%d/offer", conversation.ID)),
+			hx.Target(target),
+			hx.Swap("outerHTML"),
+			Input(Type("number"), Name("amount"), Step("0.01"), Min("0.01"), Placeholder("Amount"), Class(inputClass), Required()),
+			styledButton("Make offer", ButtonSecondary, Type("submit")),
+		)
+	default:
+		return g.Text("")
+	}
+
+	return Div(
+		Class("px-4 py-2 bg-gray-50 border-t space-y-2"),
+		content,
+		Div(ID(fmt.Sprintf("offer-result-%d", conversation.ID))),
+	)
+}
@@ -0,0 +1,255 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/parts-pile/site/partnumber"
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+)
+
+// partNumberForm posts an admin part number change and swaps in the
+// refreshed section
+func partNumberForm(endpoint string, children ...g.Node) g.Node {
+	return Form(
+		hx.Post(endpoint),
+		hx.Target("#admin-section-content"),
+		hx.Swap("innerHTML"),
+		g.Group(children),
+	)
+}
+
+func partNumberKindSelect(selected partnumber.Kind) g.Node {
+	options := make([]g.Node, 0, len(partnumber.Kinds))
+	for _, k := range partnumber.Kinds {
+		options = append(options, Option(Value(string(k)), g.If(k == selected, Selected()), g.Text(k.Label())))
+	}
+	return Select(Name("kind"), Class("p-2 border rounded"), g.Group(options))
+}
+
+func partNumberImportForm() g.Node {
+	return Form(
+		Class("bg-gray-100 p-4 rounded-lg mb-6 flex flex-col gap-2"),
+		hx.Post("/api/admin/part-numbers/import"),
+		hx.Encoding("multipart/form-data"),
+		hx.Target("#admin-section-content"),
+		hx.Swap("innerHTML"),
+		H2(Class("text-lg font-semibold"), g.Text("Import CSV")),
+		P(Class("text-sm text-gray-600"),
+			g.Text("Columns: "+strings.Join(partnumber.ImportColumns, ", ")+". "),
+			g.Text("Only number is required. Year may be a range such as 2003-2007, and a blank engine means every engine. "),
+			g.Text("Separate interchanges and supersedes with semicolons. Importing adds and never removes, so a file can be imported again."),
+		),
+		Div(
+			Class("flex gap-2"),
+			Input(Type("file"), Name("file"), g.Attr("accept", ".csv,text/csv"), Class("flex-1 p-2 border rounded bg-white"), Required()),
+			styledButton("Import", buttonPrimary, Type("submit")),
+		),
+	)
+}
+
+func partNumberAddForm() g.Node {
+	return partNumberForm("/api/admin/part-numbers",
+		Class("bg-gray-100 p-4 rounded-lg mb-6 flex flex-wrap gap-2 items-center"),
+		H2(Class("text-lg font-semibold mr-2"), g.Text("Add Part Number")),
+		Input(Type("text"), Name("number"), Class("w-48 p-2 border rounded"), Placeholder("Number"), Required()),
+		Input(Type("text"), Name("brand"), Class("w-32 p-2 border rounded"), Placeholder("Brand")),
+		partNumberKindSelect(partnumber.KindOEM),
+		Input(Type("text"), Name("description"), Class("flex-1 p-2 border rounded"), Placeholder("Description")),
+		styledButton("Add", buttonPrimary, Type("submit")),
+	)
+}
+
+func partNumberFilter(filter string) g.Node {
+	return Form(
+		Class("flex gap-2 mb-4"),
+		hx.Get("/admin/part-numbers"),
+		hx.Target("#admin-section"),
+		hx.Swap("outerHTML"),
+		Input(Type("search"), Name("q"), Value(filter), Class("flex-1 p-2 border rounded"), Placeholder("Filter by part number")),
+		styledButton("Filter", ButtonSecondary, Type("submit")),
+	)
+}
+
+// partNumberLink opens a part number's detail in the admin section
+func partNumberLink(pn partnumber.PartNumber) g.Node {
+	return A(
+		Href(fmt.Sprintf("/admin/part-numbers?id=%d", pn.ID)),
+		Class("text-blue-600 hover:text-blue-800 font-mono"),
+		hx.Get(fmt.Sprintf("/admin/part-numbers?id=%d", pn.ID)),
+		hx.Target("#admin-section"),
+		hx.Swap("outerHTML"),
+		hx.PushURL("true"),
+		g.Text(pn.Number),
+	)
+}
+
+// AdminPartNumbersSection lists the part numbers in the interchange,
+// filtered by number, with forms to add one or import a CSV
+func AdminPartNumbersSection(filter string, numbers []partnumber.PartNumber, notice g.Node) g.Node {
+	rows := make([]g.Node, 0, len(numbers))
+	for _, pn := range numbers {
+		rows = append(rows, Tr(
+			Class("border-t"),
+			Td(Class("p-2"), partNumberLink(pn)),
+			Td(Class("p-2"), g.Text(pn.Brand)),
+			Td(Class("p-2"), g.Text(pn.Kind.Label())),
+			Td(Class("p-2 text-right"), g.Text(strconv.Itoa(pn.Cars))),
+			Td(Class("p-2"), g.Text(pn.Description)),
+		))
+	}
+	return Div(
+		H1(g.Text("Part Numbers")),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		partNumberImportForm(),
+		partNumberAddForm(),
+		partNumberFilter(filter),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Text("No part numbers found."))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Number")),
+				Th(Class("p-2 text-left"), g.Text("Brand")),
+				Th(Class("p-2 text-left"), g.Text("Kind")),
+				Th(Class("p-2 text-right"), g.Text("Cars")),
+				Th(Class("p-2 text-left"), g.Text("Description")),
+			)),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
+
+// PartNumberImportNotice reports a CSV import, listing the first warnings
+func PartNumberImportNotice(report partnumber.ImportReport, shown int) g.Node {
+	warnings := report.Warnings
+	if len(warnings) > shown {
+		warnings = warnings[:shown]
+	}
+	items := make([]g.Node, 0, len(warnings))
+	for _, w := range warnings {
+		items = append(items, Li(g.Text(w)))
+	}
+	return Div(
+		SuccessMessage(report.Summary(), ""),
+		g.If(len(items) > 0, Ul(Class("mt-2 text-sm text-yellow-800 list-disc pl-6"), g.Group(items))),
+		g.If(len(report.Warnings) > shown, P(Class("text-sm text-gray-600"),
+			g.Textf("… and %d more.", len(report.Warnings)-shown))),
+	)
+}
+
+func partNumberCarsTable(pn partnumber.PartNumber, cars []partnumber.Car) g.Node {
+	rows := make([]g.Node, 0, len(cars))
+	for _, c := range cars {
+		rows = append(rows, Tr(
+			Class("border-t"),
+			Td(Class("p-2"), g.Text(c.Make)),
+			Td(Class("p-2"), g.Text(strconv.Itoa(c.Year))),
+			Td(Class("p-2"), g.Text(c.Model)),
+			Td(Class("p-2"), g.Text(c.Engine)),
+			Td(Class("p-2 text-right"), partNumberForm(fmt.Sprintf("/api/admin/part-numbers/%d/cars/%d/delete", pn.ID, c.ID),
+				Button(Type("submit"), Class("text-red-600 hover:text-red-800"), g.Text("Remove")),
+			)),
+		))
+	}
+	return Div(
+		Class("mt-6"),
+		H2(Class("text-lg font-semibold mb-2"), g.Text("Fits")),
+		partNumberForm(fmt.Sprintf("/api/admin/part-numbers/%d/cars", pn.ID),
+			Class("flex flex-wrap gap-2 mb-4"),
+			Input(Type("text"), Name("make"), Class("w-32 p-2 border rounded"), Placeholder("Make"), Required()),
+			Input(Type("text"), Name("year"), Class("w-32 p-2 border rounded"), Placeholder("Year or 2003-2007"), Required()),
+			Input(Type("text"), Name("model"), Class("flex-1 p-2 border rounded"), Placeholder("Model"), Required()),
+			Input(Type("text"), Name("engine"), Class("flex-1 p-2 border rounded"), Placeholder("Engine (blank for all)")),
+			styledButton("Add", buttonPrimary, Type("submit")),
+		),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Text("No cars listed for this number."))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Make")),
+				Th(Class("p-2 text-left"), g.Text("Year")),
+				Th(Class("p-2 text-left"), g.Text("Model")),
+				Th(Class("p-2 text-left"), g.Text("Engine")),
+				Th(),
+			)),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
+
+func partNumberLinksTable(pn partnumber.PartNumber, links []partnumber.Link, interchangeable []partnumber.PartNumber) g.Node {
+	rows := make([]g.Node, 0, len(links))
+	for _, l := range links {
+		rows = append(rows, Tr(
+			Class("border-t"),
+			Td(Class("p-2"), partNumberLink(l.PartNumber)),
+			Td(Class("p-2"), g.Text(l.Brand)),
+			Td(Class("p-2"), g.Text(l.Relation+" this number")),
+			Td(Class("p-2 text-right"), partNumberForm(fmt.Sprintf("/api/admin/part-numbers/%d/links/%d/delete", pn.ID, l.ID),
+				Button(Type("submit"), Class("text-red-600 hover:text-red-800"), g.Text("Unlink")),
+			)),
+		))
+	}
+	var others []string
+	for _, other := range interchangeable {
+		if other.ID != pn.ID {
+			others = append(others, other.Number)
+		}
+	}
+	return Div(
+		Class("mt-6"),
+		H2(Class("text-lg font-semibold mb-2"), g.Text("Interchanges and Supersessions")),
+		partNumberForm(fmt.Sprintf("/api/admin/part-numbers/%d/links", pn.ID),
+			Class("flex flex-wrap gap-2 mb-4"),
+			Input(Type("text"), Name("other"), Class("w-48 p-2 border rounded"), Placeholder("Other number"), Required()),
+			Select(Name("kind"), Class("p-2 border rounded"),
+				Option(Value(string(partnumber.LinkInterchange)), g.Text("interchanges with")),
+				Option(Value(string(partnumber.LinkSupersedes)), g.Text("is superseded by this number")),
+			),
+			styledButton("Link", buttonPrimary, Type("submit")),
+		),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			TBody(g.Group(rows)),
+		)),
+		g.If(len(others) > 0, P(Class("text-sm text-gray-600 mt-2"),
+			g.Text("Searches for this number also find ads for: "+strings.Join(others, ", ")+"."))),
+	)
+}
+
+// AdminPartNumberDetail shows one part number with the cars it fits and the
+// numbers it interchanges with or supersedes
+func AdminPartNumberDetail(pn partnumber.PartNumber, cars []partnumber.Car, links []partnumber.Link, interchangeable []partnumber.PartNumber, notice g.Node) g.Node {
+	return Div(
+		A(
+			Href("/admin/part-numbers"),
+			Class("text-blue-600 hover:text-blue-800 text-sm"),
+			hx.Get("/admin/part-numbers"),
+			hx.Target("#admin-section"),
+			hx.Swap("outerHTML"),
+			hx.PushURL("true"),
+			g.Text("← All part numbers"),
+		),
+		H1(Class("font-mono"), g.Text(pn.Number)),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		partNumberForm(fmt.Sprintf("/api/admin/part-numbers/%d", pn.ID),
+			Class("bg-gray-100 p-4 rounded-lg flex flex-wrap gap-2 items-center"),
+			Input(Type("text"), Name("brand"), Value(pn.Brand), Class("w-32 p-2 border rounded"), Placeholder("Brand")),
+			partNumberKindSelect(pn.Kind),
+			Input(Type("text"), Name("description"), Value(pn.Description), Class("flex-1 p-2 border rounded"), Placeholder("Description")),
+			styledButton("Save", ButtonSecondary, Type("submit")),
+		),
+		partNumberCarsTable(pn, cars),
+		partNumberLinksTable(pn, links, interchangeable),
+		Div(
+			Class("mt-8"),
+			partNumberForm(fmt.Sprintf("/api/admin/part-numbers/%d/delete", pn.ID),
+				hx.Confirm(fmt.Sprintf("Delete %s with its fitment and links?", pn.Number)),
+				styledButton("Delete part number", ButtonDanger, Type("submit")),
+			),
+		),
+	)
+}
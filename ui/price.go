@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+
+	"github.com/parts-pile/site/ad"
+)
+
+// priceTrendLoader lazily loads the price trend of an ad into the detail view
+func priceTrendLoader(ad ad.Ad) g.Node {
+	return Div(
+		hx.Get(fmt.Sprintf("/ad/price-history/%d", ad.ID)),
+		hx.Trigger("load"),
+		hx.Swap("outerHTML"),
+	)
+}
+
+// PriceTrend renders a sparkline and the list of price changes of an ad.
+// Ads whose price never changed render nothing.
+func PriceTrend(history []ad.PricePoint, loc *time.Location) g.Node {
+	if len(history) < 2 {
+		return g.Text("")
+	}
+
+	first, last := history[0].Price, history[len(history)-1].Price
+	summaryClass := "text-gray-600"
+	summary := "Price unchanged"
+	switch {
+	case last < first:
+		summaryClass = "text-green-600"
+		summary = fmt.Sprintf("↓ $%.0f since listed", first-last)
+	case last > first:
+		summaryClass = "text-red-600"
+		summary = fmt.Sprintf("↑ $%.0f since listed", last-first)
+	}
+
+	changes := []g.Node{}
+	for i := len(history) - 1; i > 0; i-- {
+		changes = append(changes, Li(
+			g.Text(fmt.Sprintf("%s: $%.0f → $%.0f",
+				history[i].ChangedAt.In(loc).Format("Jan 2, 2006"), history[i-1].Price, history[i].Price)),
+		))
+	}
+
+	return Div(
+		Class("flex flex-col gap-1 text-sm"),
+		Div(
+			Class("flex flex-row items-center gap-2"),
+			Span(Class("text-gray-500"), g.Text("Price trend")),
+			priceSparkline(history),
+			Span(Class(summaryClass), g.Text(summary)),
+		),
+		Ul(Class("text-xs text-gray-500"), g.Group(changes)),
+	)
+}
+
+// priceSparkline draws the price history as a small step line
+func priceSparkline(history []ad.PricePoint) g.Node {
+	const width, height = 100.0, 20.0
+
+	lo, hi := history[0].Price, history[0].Price
+	for _, p := range history {
+		lo = min(lo, p.Price)
+		hi = max(hi, p.Price)
+	}
+	span := hi - lo
+	if span == 0 {
+		span = 1
+	}
+
+	points := make([]string, 0, len(history))
+	step := width / float64(len(history)-1)
+	for i, p := range history {
+		x := float64(i) * step
+		y := height - (p.Price-lo)/span*height
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+
+	return g.El("svg",
+		g.Attr("viewBox", fmt.Sprintf("-1 -1 %.0f %.0f", width+2, height+2)),
+		g.Attr("width", "100"),
+		g.Attr("height", "20"),
+		g.El("polyline",
+			g.Attr("fill", "none"),
+			g.Attr("stroke", "currentColor"),
+			g.Attr("stroke-width", "1.5"),
+			g.Attr("points", strings.Join(points, " ")),
+		),
+	)
+}
@@ -1,14 +1,19 @@
 package ui
 
 import (
+	"fmt"
+	"strings"
+
 	g "maragu.dev/gomponents"
 	hx "maragu.dev/gomponents-htmx"
 	. "maragu.dev/gomponents/html"
 
+	"github.com/parts-pile/site/apikey"
 	"github.com/parts-pile/site/user"
+	"github.com/parts-pile/site/webhook"
 )
 
-func SettingsPage(currentUser *user.User, currentPath string) g.Node {
+func SettingsPage(currentUser *user.User, currentPath string, priceDropAlerts bool, keys []apikey.Key, webhooks []webhook.Webhook, deliveries []webhook.Delivery) g.Node {
 	return Page(
 		"Settings",
 		currentUser,
@@ -28,6 +33,15 @@ func SettingsPage(currentUser *user.User, currentPath string) g.Node {
 					),
 				),
 				Div(ID("notificationPreferencesResults"), Class("mt-2")),
+				Div(Class("mt-6"),
+					Checkbox("priceDropAlerts", "on", "Notify me when an ad I bookmarked drops in price", priceDropAlerts, false,
+						hx.Post("/api/update-price-drop-alerts"),
+						hx.Trigger("change"),
+						hx.Include("this"),
+						hx.Target("#priceDropAlertsResults"),
+					),
+					Div(ID("priceDropAlertsResults"), Class("mt-2")),
+				),
 				Div(Class("mt-12"),
 					sectionHeader("Change Password", ""),
 					formContainer("changePasswordForm",
@@ -49,6 +63,14 @@ func SettingsPage(currentUser *user.User, currentPath string) g.Node {
 						),
 					),
 				),
+				Div(Class("mt-12"),
+					sectionHeader("API Keys", "Keys let your own tools and apps use your account through the /api/v1 JSON API."),
+					APIKeysSection(keys, nil),
+				),
+				Div(Class("mt-12"),
+					sectionHeader("Webhooks", "We POST signed JSON to your endpoints when something happens on your ads and conversations."),
+					WebhooksSection(webhooks, deliveries, nil),
+				),
 				Div(Class("mt-12"),
 					sectionHeader("Delete Account", "This will permanently delete your account and all associated data. This action cannot be undone."),
 					formContainer("deleteAccountForm",
@@ -70,3 +92,237 @@ func SettingsPage(currentUser *user.User, currentPath string) g.Node {
 		},
 	)
 }
+
+// apiKeyScopeLabels describes what each scope allows
+var apiKeyScopeLabels = map[string]string{
+	apikey.ScopeRead:     "Read ads, the catalog and your bookmarks",
+	apikey.ScopeWrite:    "Create, edit and delete your ads and bookmarks",
+	apikey.ScopeMessages: "Read and send your messages",
+}
+
+// APIKeysSection lists the user's API keys with a form to create another.
+// notice, if set, reports the outcome of the last change, such as the key
+// just created.
+func APIKeysSection(keys []apikey.Key, notice g.Node) g.Node {
+	rows := make([]g.Node, 0, len(keys))
+	for _, k := range keys {
+		rows = append(rows, apiKeyRow(k))
+	}
+	scopes := make([]g.Node, len(apikey.Scopes))
+	for i, scope := range apikey.Scopes {
+		scopes[i] = Checkbox("scopes", scope, apiKeyScopeLabels[scope], scope == apikey.ScopeRead, false)
+	}
+	return Div(
+		ID("api-keys"),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		Form(
+			Class("bg-gray-100 p-4 rounded-lg mb-4 flex flex-col gap-2"),
+			hx.Post("/api/api-keys"),
+			hx.Encoding("multipart/form-data"),
+			hx.Target("#api-keys"),
+			hx.Swap("outerHTML"),
+			formGroup("Key name", "apiKeyName",
+				Input(Type("text"), ID("apiKeyName"), Name("name"), Class("w-full p-2 border rounded"),
+					Placeholder("e.g. Inventory sync"), Required()),
+			),
+			g.Group(scopes),
+			Div(styledButton("Create Key", buttonPrimary, Type("submit"))),
+		),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Text("No API keys yet."))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Name")),
+				Th(Class("p-2 text-left"), g.Text("Key")),
+				Th(Class("p-2 text-left"), g.Text("Scopes")),
+				Th(Class("p-2 text-left"), g.Text("Created")),
+				Th(Class("p-2 text-left"), g.Text("Last used")),
+				Th(),
+			)),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
+
+func apiKeyRow(k apikey.Key) g.Node {
+	lastUsed := "Never"
+	if k.LastUsedAt != nil {
+		lastUsed = k.LastUsedAt.Format("Jan 2, 2006")
+	}
+	var action g.Node
+	if k.IsRevoked() {
+		action = Span(Class("text-gray-500"), g.Textf("Revoked %s", k.RevokedAt.Format("Jan 2, 2006")))
+	} else {
+		action = Button(
+			Type("button"),
+			Class("text-red-600 hover:underline"),
+			hx.Delete(fmt.Sprintf("/api/api-keys/%d", k.ID)),
+			hx.Target("#api-keys"),
+			hx.Swap("outerHTML"),
+			hx.Confirm("Revoke this key? Anything using it will stop working."),
+			g.Text("Revoke"),
+		)
+	}
+	return Tr(
+		Class("border-t"),
+		Td(Class("p-2"), g.Text(k.Name)),
+		Td(Class("p-2 font-mono"), g.Text(k.Prefix+"…")),
+		Td(Class("p-2"), g.Text(strings.Join(k.ScopeList(), ", "))),
+		Td(Class("p-2"), g.Text(k.CreatedAt.Format("Jan 2, 2006"))),
+		Td(Class("p-2"), g.Text(lastUsed)),
+		Td(Class("p-2 text-right"), action),
+	)
+}
+
+// NewAPIKeyNotice shows a newly created key, the only time it can be seen
+func NewAPIKeyNotice(token string) g.Node {
+	return Div(
+		Class("bg-green-100 border-green-500 text-green-700 px-4 py-3 rounded"),
+		P(g.Text("Your new API key is below. Copy it now: it won't be shown again.")),
+		Code(Class("block mt-2 p-2 bg-white border rounded font-mono break-all select-all"), g.Text(token)),
+	)
+}
+
+// webhookEventLabels describes when each event is sent
+var webhookEventLabels = map[string]string{
+	webhook.EventMessageCreated: "message.created - someone messages you",
+	webhook.EventAdRocked:       "ad.rocked - someone throws a rock at your ad",
+	webhook.EventAdBookmarked:   "ad.bookmarked - someone bookmarks your ad",
+	webhook.EventOfferUpdated:   "offer.updated - an offer is made, answered or expires",
+	webhook.EventAdExpired:      "ad.expired - your ad is archived for not being renewed",
+}
+
+// WebhooksSection lists the user's webhooks and their recent deliveries,
+// with a form to add another webhook. notice, if set, reports the outcome of
+// the last change.
+func WebhooksSection(webhooks []webhook.Webhook, deliveries []webhook.Delivery, notice g.Node) g.Node {
+	rows := make([]g.Node, 0, len(webhooks))
+	for _, w := range webhooks {
+		rows = append(rows, webhookRow(w))
+	}
+	events := make([]g.Node, len(webhook.Events))
+	for i, event := range webhook.Events {
+		events[i] = Checkbox("events", event, webhookEventLabels[event], false, false)
+	}
+	return Div(
+		ID("webhooks"),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		Form(
+			Class("bg-gray-100 p-4 rounded-lg mb-4 flex flex-col gap-2"),
+			hx.Post("/api/webhooks"),
+			hx.Encoding("multipart/form-data"),
+			hx.Target("#webhooks"),
+			hx.Swap("outerHTML"),
+			formGroup("Endpoint URL", "webhookURL",
+				Input(Type("url"), ID("webhookURL"), Name("url"), Class("w-full p-2 border rounded"),
+					Placeholder("https://example.com/partspile"), Required()),
+			),
+			g.Group(events),
+			Div(styledButton("Add Webhook", buttonPrimary, Type("submit"))),
+		),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Text("No webhooks yet."))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Endpoint")),
+				Th(Class("p-2 text-left"), g.Text("Events")),
+				Th(Class("p-2 text-left"), g.Text("Created")),
+				Th(),
+			)),
+			TBody(g.Group(rows)),
+		)),
+		g.If(len(deliveries) > 0, webhookDeliveries(deliveries)),
+	)
+}
+
+func webhookRow(w webhook.Webhook) g.Node {
+	return Tr(
+		Class("border-t align-top"),
+		Td(Class("p-2 break-all"),
+			g.Text(w.URL),
+			Details(Class("mt-1 text-gray-600"),
+				Summary(Class("cursor-pointer"), g.Text("Signing secret")),
+				Code(Class("block mt-1 p-1 bg-gray-50 border rounded font-mono break-all select-all"), g.Text(w.Secret)),
+			),
+		),
+		Td(Class("p-2"), g.Text(strings.Join(w.EventList(), ", "))),
+		Td(Class("p-2"), g.Text(w.CreatedAt.Format("Jan 2, 2006"))),
+		Td(Class("p-2 text-right"),
+			Button(
+				Type("button"),
+				Class("text-red-600 hover:underline"),
+				hx.Delete(fmt.Sprintf("/api/webhooks/%d", w.ID)),
+				hx.Target("#webhooks"),
+				hx.Swap("outerHTML"),
+				hx.Confirm("Delete this webhook? Its queued deliveries will be dropped."),
+				g.Text("Delete"),
+			),
+		),
+	)
+}
+
+// webhookDeliveries lists recent deliveries. Dead ones, which gave up after
+// their last attempt, can be resent.
+func webhookDeliveries(deliveries []webhook.Delivery) g.Node {
+	rows := make([]g.Node, len(deliveries))
+	for i, d := range deliveries {
+		rows[i] = webhookDeliveryRow(d)
+	}
+	return Div(Class("mt-6"),
+		H3(Class("font-semibold mb-2"), g.Text("Recent deliveries")),
+		Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Event")),
+				Th(Class("p-2 text-left"), g.Text("Endpoint")),
+				Th(Class("p-2 text-left"), g.Text("Status")),
+				Th(Class("p-2 text-left"), g.Text("Attempts")),
+				Th(Class("p-2 text-left"), g.Text("Queued")),
+				Th(),
+			)),
+			TBody(g.Group(rows)),
+		),
+	)
+}
+
+func webhookDeliveryRow(d webhook.Delivery) g.Node {
+	var status g.Node
+	switch d.Status {
+	case webhook.StatusDelivered:
+		status = Span(Class("text-green-700"), g.Text("Delivered"))
+	case webhook.StatusDead:
+		status = Span(Class("text-red-600 font-semibold"), g.Text("Failed"))
+	default:
+		status = Span(Class("text-gray-600"), g.Text("Retrying"))
+		if d.Attempts == 0 {
+			status = Span(Class("text-gray-600"), g.Text("Queued"))
+		}
+	}
+	detail := d.LastError
+	if d.ResponseStatus != nil {
+		detail = fmt.Sprintf("HTTP %d", *d.ResponseStatus)
+	}
+	if d.Status == webhook.StatusPending && d.Attempts > 0 {
+		detail = strings.TrimSpace(fmt.Sprintf("%s, next try %s", detail, d.NextAttemptAt.Format("Jan 2 15:04 MST")))
+	}
+	return Tr(
+		Class("border-t align-top"),
+		Td(Class("p-2 font-mono"), g.Text(d.Event)),
+		Td(Class("p-2 break-all"), g.Text(d.URL)),
+		Td(Class("p-2"), status,
+			g.If(detail != "" && d.Status != webhook.StatusDelivered, Div(Class("text-xs text-gray-500"), g.Text(detail))),
+		),
+		Td(Class("p-2"), g.Textf("%d", d.Attempts)),
+		Td(Class("p-2"), g.Text(d.CreatedAt.Format("Jan 2 15:04 MST"))),
+		Td(Class("p-2 text-right"),
+			g.If(d.CanResend(), Button(
+				Type("button"),
+				Class("text-blue-600 hover:underline"),
+				hx.Post(fmt.Sprintf("/api/webhook-deliveries/%d/resend", d.ID)),
+				hx.Target("#webhooks"),
+				hx.Swap("outerHTML"),
+				g.Text("Resend"),
+			)),
+		),
+	)
+}
@@ -0,0 +1,201 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/parts-pile/site/part"
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+)
+
+// taxonomyForm posts an admin taxonomy change and swaps in the refreshed
+// section
+func taxonomyForm(endpoint string, children ...g.Node) g.Node {
+	return Form(
+		hx.Post(endpoint),
+		hx.Target("#admin-section-content"),
+		hx.Swap("innerHTML"),
+		g.Group(children),
+	)
+}
+
+func taxonomyCategoryOptions(categories []part.TaxonomyCategory, selected int) []g.Node {
+	options := make([]g.Node, 0, len(categories))
+	for _, c := range categories {
+		options = append(options, Option(
+			Value(strconv.Itoa(c.ID)),
+			g.If(c.ID == selected, Selected()),
+			g.Text(c.Name),
+		))
+	}
+	return options
+}
+
+// taxonomyMergeOptions lists every subcategory but the one being merged
+func taxonomyMergeOptions(categories []part.TaxonomyCategory, skip int) []g.Node {
+	options := []g.Node{Option(Value(""), g.Text("Merge into…"))}
+	for _, c := range categories {
+		for _, s := range c.SubCategories {
+			if s.ID != skip {
+				options = append(options, Option(Value(strconv.Itoa(s.ID)), g.Text(c.Name+" / "+s.Name)))
+			}
+		}
+	}
+	return options
+}
+
+func taxonomyAliasForm(endpoint string) g.Node {
+	return taxonomyForm(endpoint,
+		Class("flex gap-1"),
+		Input(Type("text"), Name("alias"), Class("w-32 p-1 border rounded"), Placeholder("Alias"), Required()),
+		styledButton("Add", ButtonSecondary, Type("submit")),
+	)
+}
+
+func taxonomySubCategoryRow(s part.TaxonomySubCategory, categoryID int, categories []part.TaxonomyCategory) g.Node {
+	base := fmt.Sprintf("/api/admin/taxonomy/subcategories/%d", s.ID)
+	return Tr(
+		Class("border-t"),
+		Td(Class("p-2"), g.Text(s.Name)),
+		Td(Class("p-2 text-right"), g.Text(strconv.Itoa(s.Ads))),
+		Td(Class("p-2"), taxonomyForm(base+"/rename",
+			Class("flex gap-1"),
+			Input(Type("text"), Name("name"), Value(s.Name), Class("w-40 p-1 border rounded"), Required()),
+			styledButton("Rename", ButtonSecondary, Type("submit")),
+		)),
+		Td(Class("p-2"), taxonomyForm(base+"/move",
+			hx.Trigger("change"),
+			Select(Name("category_id"), Class("p-1 border rounded"), g.Group(taxonomyCategoryOptions(categories, categoryID))),
+		)),
+		Td(Class("p-2"), taxonomyForm(base+"/merge",
+			hx.Trigger("change"),
+			hx.Confirm(fmt.Sprintf("Merge %s into another subcategory? Its ads move over and its name becomes an alias. This can't be undone.", s.Name)),
+			Select(Name("into"), Class("w-48 p-1 border rounded"), g.Group(taxonomyMergeOptions(categories, s.ID))),
+		)),
+		Td(Class("p-2"), taxonomyAliasForm(base+"/aliases")),
+	)
+}
+
+func taxonomyCategoryCard(c part.TaxonomyCategory, categories []part.TaxonomyCategory) g.Node {
+	base := fmt.Sprintf("/api/admin/taxonomy/categories/%d", c.ID)
+	rows := make([]g.Node, 0, len(c.SubCategories))
+	for _, s := range c.SubCategories {
+		rows = append(rows, taxonomySubCategoryRow(s, c.ID, categories))
+	}
+	return Div(
+		Class("bg-white border rounded-lg p-4 mb-4"),
+		Div(
+			Class("flex flex-wrap gap-2 items-center mb-2"),
+			H2(Class("text-lg font-semibold mr-2"), g.Text(c.Name)),
+			taxonomyForm(base+"/rename",
+				Class("flex gap-1"),
+				Input(Type("text"), Name("name"), Value(c.Name), Class("w-48 p-1 border rounded"), Required()),
+				styledButton("Rename", ButtonSecondary, Type("submit")),
+			),
+			taxonomyAliasForm(base+"/aliases"),
+			g.If(len(c.SubCategories) == 0, taxonomyForm(base+"/delete",
+				hx.Confirm(fmt.Sprintf("Delete the %s category?", c.Name)),
+				styledButton("Delete", ButtonDanger, Type("submit")),
+			)),
+		),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Subcategory")),
+				Th(Class("p-2 text-right"), g.Text("Ads")),
+				Th(), Th(Class("p-2 text-left"), g.Text("Category")), Th(), Th(),
+			)),
+			TBody(g.Group(rows)),
+		)),
+		taxonomyForm(base+"/subcategories",
+			Class("flex gap-2 mt-2"),
+			Input(Type("text"), Name("name"), Class("flex-1 p-1 border rounded"), Placeholder("New subcategory"), Required()),
+			styledButton("Add", buttonPrimary, Type("submit")),
+		),
+	)
+}
+
+func taxonomyAliases(aliases []part.Alias) g.Node {
+	rows := make([]g.Node, 0, len(aliases))
+	for _, a := range aliases {
+		target := a.Category
+		if a.SubCategory != "" {
+			target += " / " + a.SubCategory
+		}
+		rows = append(rows, Tr(
+			Class("border-t"),
+			Td(Class("p-2"), g.Text(a.Alias)),
+			Td(Class("p-2"), g.Text(target)),
+			Td(Class("p-2 text-right"), taxonomyForm(fmt.Sprintf("/api/admin/taxonomy/aliases/%d/delete", a.ID),
+				Button(Type("submit"), Class("text-red-600 hover:text-red-800"), g.Text("Delete")),
+			)),
+		))
+	}
+	return Div(
+		Class("mt-8"),
+		H2(Class("text-lg font-semibold mb-2"), g.Text("Aliases")),
+		P(Class("text-sm text-gray-600 mb-2"), g.Text("Other names sellers and buyers use for a category or subcategory. Add them from the category list above.")),
+		g.If(len(rows) == 0, Div(Class("text-gray-500"), g.Text("No aliases yet."))),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			THead(Tr(
+				Th(Class("p-2 text-left"), g.Text("Alias")),
+				Th(Class("p-2 text-left"), g.Text("Stands for")),
+				Th(),
+			)),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
+
+func taxonomySynonyms(synonyms []part.Synonym) g.Node {
+	rows := make([]g.Node, 0, len(synonyms))
+	for _, s := range synonyms {
+		rows = append(rows, Tr(
+			Class("border-t"),
+			Td(Class("p-2"), g.Text(strings.Join(s.Terms, ", "))),
+			Td(Class("p-2 text-right"), taxonomyForm(fmt.Sprintf("/api/admin/taxonomy/synonyms/%d/delete", s.ID),
+				Button(Type("submit"), Class("text-red-600 hover:text-red-800"), g.Text("Delete")),
+			)),
+		))
+	}
+	return Div(
+		Class("mt-8"),
+		H2(Class("text-lg font-semibold mb-2"), g.Text("Synonyms")),
+		P(Class("text-sm text-gray-600 mb-2"), g.Text("Words that mean the same part. Searches for one also look for the others.")),
+		taxonomyForm("/api/admin/taxonomy/synonyms",
+			Class("flex gap-2 mb-4"),
+			Input(Type("text"), Name("terms"), Class("flex-1 p-2 border rounded"), Placeholder("rotor, disc, brake disc"), Required()),
+			styledButton("Add", buttonPrimary, Type("submit")),
+		),
+		g.If(len(rows) > 0, Table(
+			Class("w-full text-sm bg-white border rounded"),
+			TBody(g.Group(rows)),
+		)),
+	)
+}
+
+// AdminTaxonomySection lets admins edit the part categories and
+// subcategories, and the aliases and synonyms used to match what people type
+func AdminTaxonomySection(categories []part.TaxonomyCategory, aliases []part.Alias, synonyms []part.Synonym, notice g.Node) g.Node {
+	cards := make([]g.Node, 0, len(categories))
+	for _, c := range categories {
+		cards = append(cards, taxonomyCategoryCard(c, categories))
+	}
+	return Div(
+		H1(g.Text("Part Categories")),
+		g.If(notice != nil, Div(Class("mb-4"), notice)),
+		taxonomyForm("/api/admin/taxonomy/categories",
+			Class("bg-gray-100 p-4 rounded-lg mb-6 flex gap-2 items-center"),
+			H2(Class("text-lg font-semibold mr-2"), g.Text("Add Category")),
+			Input(Type("text"), Name("name"), Class("flex-1 p-2 border rounded"), Required()),
+			styledButton("Add", buttonPrimary, Type("submit")),
+		),
+		g.Group(cards),
+		taxonomyAliases(aliases),
+		taxonomySynonyms(synonyms),
+	)
+}
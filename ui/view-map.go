@@ -8,8 +8,6 @@ import (
 	. "maragu.dev/gomponents/html"
 
 	"github.com/parts-pile/site/ad"
-	"github.com/parts-pile/site/b2util"
-	"github.com/parts-pile/site/config"
 )
 
 func MapViewResults(ads []ad.Ad, userID int, loc *time.Location, bounds *GeoBounds) g.Node {
@@ -33,8 +31,8 @@ func createAdDataElements(ads []ad.Ad) []g.Node {
 		if ad.Latitude.Valid && ad.Longitude.Valid {
 			// Generate image URL only if images exist
 			var imageURL string
-			if ad.ImageCount > 0 {
-				imageURL = generateMapImageURL(ad.ID, 1)
+			if cover, ok := ad.Cover(); ok {
+				imageURL = generateMapImageURL(cover)
 			}
 
 			adDataElements = append(adDataElements,
@@ -53,18 +51,10 @@ func createAdDataElements(ads []ad.Ad) []g.Node {
 	return adDataElements
 }
 
-// generateMapImageURL generates a signed B2 image URL for map popup context
-func generateMapImageURL(adID int, idx int) string {
-	prefix := fmt.Sprintf("%d/", adID)
-	token, err := b2util.GetB2DownloadTokenForPrefixCached(prefix)
-	if err != nil || token == "" {
-		// Return empty string when B2 images aren't available - browser will show broken image
-		return ""
-	}
-
-	base := fmt.Sprintf("%s/%d/%d", config.B2FileServerURL, adID, idx)
+// generateMapImageURL generates a signed image URL for map popup context
+func generateMapImageURL(img ad.Image) string {
 	// Use 480w for map popups - good balance of quality and file size
-	return fmt.Sprintf("%s-480w.webp?Authorization=%s", base, token)
+	return adImageURL(img, "480w")
 }
 
 // MapDataOnly returns just the map data container for HTMX updates
@@ -253,6 +253,19 @@ func UpdateNotificationPreferences(userID int, method string, emailAddress *stri
 	return err
 }
 
+// GetPriceDropAlerts returns whether the user wants price-drop alerts for bookmarked ads
+func GetPriceDropAlerts(userID int) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(`SELECT price_drop_alerts FROM User WHERE id = ?`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// UpdatePriceDropAlerts opts the user in to or out of price-drop alerts
+func UpdatePriceDropAlerts(userID int, enabled bool) error {
+	_, err := db.Exec(`UPDATE User SET price_drop_alerts = ? WHERE id = ?`, enabled, userID)
+	return err
+}
+
 // ArchiveUser archives a user using soft delete
 func ArchiveUser(id int) error {
 	_, err := db.Exec("UPDATE User SET deleted_at = ? WHERE id = ?",
@@ -78,6 +78,10 @@ func SetupPayloadIndexes() error {
 		{"category", qdrant.FieldType_FieldTypeKeyword},
 		{"subcategory", qdrant.FieldType_FieldTypeKeyword},
 		{"price", qdrant.FieldType_FieldTypeFloat},
+		{"condition", qdrant.FieldType_FieldTypeKeyword},
+		{"part_number", qdrant.FieldType_FieldTypeKeyword},
+		{"position", qdrant.FieldType_FieldTypeKeyword},
+		{"core_charge", qdrant.FieldType_FieldTypeFloat},
 		{"location", qdrant.FieldType_FieldTypeGeo},
 	}
 
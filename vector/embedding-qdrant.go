@@ -551,6 +551,22 @@ func BuildGeoFilter(lat, lon float64, radiusMeters float64) *qdrant.Filter {
 	return nil
 }
 
+// BuildAdIDFilter restricts a search to the given ads, on top of filter
+// when it's set
+func BuildAdIDFilter(filter *qdrant.Filter, adIDs []int) *qdrant.Filter {
+	ids := make([]*qdrant.PointId, len(adIDs))
+	for i, adID := range adIDs {
+		ids[i] = qdrant.NewIDNum(uint64(adID))
+	}
+	restricted := &qdrant.Filter{Must: []*qdrant.Condition{qdrant.NewHasID(ids...)}}
+	if filter != nil {
+		restricted.Must = append(restricted.Must, filter.Must...)
+		restricted.Should = filter.Should
+		restricted.MustNot = filter.MustNot
+	}
+	return restricted
+}
+
 // BuildBoundingBoxGeoFilter creates a geo filter for bounding box search
 func BuildBoundingBoxGeoFilter(minLat, maxLat, minLon, maxLon float64) *qdrant.Filter {
 	log.Printf("[vector] Building bounding box filter: lat[%.6f,%.6f], lon[%.6f,%.6f]", minLat, maxLat, minLon, maxLon)
@@ -569,13 +569,15 @@ func BuildAdEmbeddings(ads []ad.Ad) error {
 
 // buildAdEmbeddingPrompt creates a prompt for generating embeddings
 func buildAdEmbeddingPrompt(adObj ad.Ad) string {
-	// Get parent company information for the make
-	var parentCompanyStr, parentCompanyCountry string
-	if adObj.Make != "" {
-		if pcInfo, err := vehicle.GetParentCompanyInfoForMake(adObj.Make); err == nil && pcInfo != nil {
-			parentCompanyStr = pcInfo.Name
-			parentCompanyCountry = pcInfo.Country
+	// Describe every fitment group, with the parent company of each make
+	var fitmentLines []string
+	for _, f := range adObj.FitmentGroups() {
+		line := fmt.Sprintf("Make: %s\nYears: %s\nModels: %s\nEngines: %s",
+			f.Make, joinStrings(f.Years), joinStrings(f.Models), joinStrings(f.Engines))
+		if pcInfo, err := vehicle.GetParentCompanyInfoForMake(f.Make); err == nil && pcInfo != nil {
+			line += fmt.Sprintf("\nParent Company: %s\nParent Company Country: %s", pcInfo.Name, pcInfo.Country)
 		}
+		fitmentLines = append(fitmentLines, line)
 	}
 
 	// Get rock count for this ad
@@ -594,16 +596,21 @@ func buildAdEmbeddingPrompt(adObj ad.Ad) string {
 		rockContext = fmt.Sprintf("This ad has %d reported issues (%d rocks thrown).", rockCount, rockCount)
 	}
 
-	return fmt.Sprintf(`Encode the following ad for semantic search. Focus on what the part is, what vehicles it fits, and any relevant details for a buyer. Return only the embedding vector.\n\nTitle: %s\nDescription: %s\nMake: %s\nParent Company: %s\nParent Company Country: %s\nYears: %s\nModels: %s\nEngines: %s\nCategory: %s\nLocation: %s, %s, %s\nQuality Indicator: %s`,
+	coreChargeStr := ""
+	if adObj.CoreCharge > 0 {
+		coreChargeStr = fmt.Sprintf("$%.2f refundable core charge", adObj.CoreCharge)
+	}
+
+	return fmt.Sprintf(`Encode the following ad for semantic search. Focus on what the part is, what vehicles it fits, and any relevant details for a buyer. Return only the embedding vector.\n\nTitle: %s\nDescription: %s\nFits:\n%s\nCategory: %s\nCondition: %s\nOEM Part Number: %s\nQuantity: %d\nPosition: %s\nCore Charge: %s\nLocation: %s, %s, %s\nQuality Indicator: %s`,
 		adObj.Title,
 		adObj.Description,
-		adObj.Make,
-		parentCompanyStr,
-		parentCompanyCountry,
-		joinStrings(adObj.Years),
-		joinStrings(adObj.Models),
-		joinStrings(adObj.Engines),
+		strings.Join(fitmentLines, "\n"),
 		adObj.Category.String,
+		adObj.ConditionLabel(),
+		adObj.PartNumber,
+		adObj.Quantity,
+		adObj.Position,
+		coreChargeStr,
 		adObj.City.String,
 		adObj.AdminArea.String,
 		adObj.Country.String,
@@ -620,15 +627,9 @@ func BuildAdEmbeddingMetadata(adObj ad.Ad) map[string]interface{} {
 		_, _, _, _, lat, lon, _ = ad.GetLocation(adObj.LocationID)
 	}
 
-	// Get tree path data for navigation filtering
-	var make string
-	var years, models, engines []string
-
-	// Use the vehicle data already populated in the ad object
-	make = adObj.Make
-	years = adObj.Years
-	models = adObj.Models
-	engines = adObj.Engines
+	// Get tree path data for navigation filtering. Ads fitting several makes
+	// carry the union of all their fitment groups.
+	makes, years, models, engines := adObj.FitmentSummary()
 
 	// Get category data for filtering
 	var category, subcategory string
@@ -649,7 +650,7 @@ func BuildAdEmbeddingMetadata(adObj ad.Ad) map[string]interface{} {
 
 	metadata := map[string]interface{}{
 		// Tree navigation (string values for filtering)
-		"make":        make,
+		"make":        makes,
 		"years":       years,
 		"models":      models,
 		"engines":     engines,
@@ -659,6 +660,13 @@ func BuildAdEmbeddingMetadata(adObj ad.Ad) map[string]interface{} {
 		// Price for filtering/sorting
 		"price": adObj.Price,
 
+		// Structured part attributes for filtering
+		ad.AttrCondition:  adObj.Condition,
+		ad.AttrPartNumber: adObj.PartNumber,
+		ad.AttrQuantity:   adObj.Quantity,
+		ad.AttrPosition:   adObj.Position,
+		ad.AttrCoreCharge: adObj.CoreCharge,
+
 		// Rock count for quality-based ranking
 		"rock_count": rockCount,
 	}
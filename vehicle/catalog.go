@@ -0,0 +1,449 @@
+package vehicle
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/parts-pile/site/db"
+)
+
+// Kind names one of the catalog tables admins can edit
+type Kind string
+
+const (
+	KindMake   Kind = "make"
+	KindModel  Kind = "model"
+	KindEngine Kind = "engine"
+)
+
+// Kinds lists the editable catalog tables in the order they're shown
+var Kinds = []Kind{KindMake, KindModel, KindEngine}
+
+var (
+	ErrNotFound = errors.New("catalog entry not found")
+	ErrRetired  = errors.New("catalog entry is retired")
+)
+
+func (k Kind) IsValid() bool {
+	return k == KindMake || k == KindModel || k == KindEngine
+}
+
+// Label is the singular name shown to admins
+func (k Kind) Label() string {
+	switch k {
+	case KindMake:
+		return "Make"
+	case KindModel:
+		return "Model"
+	case KindEngine:
+		return "Engine"
+	}
+	return string(k)
+}
+
+// table and column are only ever built from the constants above, never from
+// user input, so they are safe to splice into queries
+func (k Kind) table() string {
+	return k.Label()
+}
+
+func (k Kind) column() string {
+	return string(k) + "_id"
+}
+
+// Entry is a make, model or engine as listed for admins
+type Entry struct {
+	ID      int
+	Name    string
+	Cars    int
+	Retired bool
+	// Only set for makes
+	ParentCompanyID   *int
+	ParentCompanyName string
+}
+
+// GetEntries lists up to limit makes, models or engines whose names contain
+// filter, retired ones included, with the number of cars using each
+func GetEntries(kind Kind, filter string, limit int) ([]Entry, error) {
+	if !kind.IsValid() {
+		return nil, fmt.Errorf("unknown catalog kind %q", kind)
+	}
+	parentCols := "NULL, ''"
+	parentJoin := ""
+	if kind == KindMake {
+		parentCols = "t.parent_company_id, COALESCE(pc.name, '')"
+		parentJoin = " LEFT JOIN ParentCompany pc ON pc.id = t.parent_company_id"
+	}
+	rows, err := db.Query(`SELECT t.id, t.name, t.retired_at IS NOT NULL,
+		(SELECT COUNT(*) FROM Car c WHERE c.`+kind.column()+` = t.id), `+parentCols+`
+		FROM `+kind.table()+` t`+parentJoin+`
+		WHERE t.name LIKE ? ORDER BY t.name, t.id LIMIT ?`, "%"+strings.TrimSpace(filter)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		var parentID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Name, &e.Retired, &e.Cars, &parentID, &e.ParentCompanyName); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			e.ParentCompanyID = &id
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// FindEntry returns the ID of the make, model or engine with this name
+func FindEntry(kind Kind, name string) (int, error) {
+	if !kind.IsValid() {
+		return 0, fmt.Errorf("unknown catalog kind %q", kind)
+	}
+	id, err := findEntry(db.QueryRow, kind, strings.TrimSpace(name))
+	if err == nil && id == 0 {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+// findEntry returns the ID of the entry with this name, or 0 if there is none
+func findEntry(queryRow func(string, ...interface{}) *sql.Row, kind Kind, name string) (int, error) {
+	var id int
+	err := queryRow("SELECT id FROM "+kind.table()+" WHERE name = ? ORDER BY id LIMIT 1", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+func cleanName(kind Kind, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%s name is required", strings.ToLower(kind.Label()))
+	}
+	return name, nil
+}
+
+// AddEntry adds a make, model or engine. Models and engines are shared by
+// every make, so a name already in the catalog is refused.
+func AddEntry(kind Kind, name string) (int, error) {
+	if !kind.IsValid() {
+		return 0, fmt.Errorf("unknown catalog kind %q", kind)
+	}
+	name, err := cleanName(kind, name)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := findEntry(db.QueryRow, kind, name)
+	if err != nil {
+		return 0, err
+	}
+	if existing != 0 {
+		return 0, fmt.Errorf("%s %q already exists", strings.ToLower(kind.Label()), name)
+	}
+	res, err := db.Exec("INSERT INTO "+kind.table()+" (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	ClearVehicleCache()
+	return int(id), nil
+}
+
+// markAdsForReembedding flags the live ads fitted to cars using an entry, so
+// the background processor rebuilds their embeddings with the new names. It
+// returns how many ads were flagged.
+func markAdsForReembedding(tx *sql.Tx, kind Kind, id int) (int, error) {
+	res, err := tx.Exec(`UPDATE Ad SET has_vector = 0, updated_at = ?
+		WHERE deleted_at IS NULL AND id IN (
+			SELECT ac.ad_id FROM AdCar ac JOIN Car c ON c.id = ac.car_id WHERE c.`+kind.column()+` = ?)`,
+		time.Now().UTC().Format(time.RFC3339Nano), id)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// RenameEntry renames a make, model or engine. Ads fitted to it are flagged
+// for re-embedding; it returns how many. A name already used by another
+// entry is refused, since the two should be merged instead.
+func RenameEntry(kind Kind, id int, name string) (int, error) {
+	if !kind.IsValid() {
+		return 0, fmt.Errorf("unknown catalog kind %q", kind)
+	}
+	name, err := cleanName(kind, name)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	existing, err := findEntry(tx.QueryRow, kind, name)
+	if err != nil {
+		return 0, err
+	}
+	if existing != 0 && existing != id {
+		return 0, fmt.Errorf("%s %q already exists; merge into it instead", strings.ToLower(kind.Label()), name)
+	}
+	oldName, err := entryName(tx, kind, id)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE "+kind.table()+" SET name = ? WHERE id = ?", name, id); err != nil {
+		return 0, err
+	}
+	if oldName != name {
+		if err := recordReplacedName(tx, kind, oldName, id, id); err != nil {
+			return 0, err
+		}
+	}
+	ads, err := markAdsForReembedding(tx, kind, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	ClearVehicleCache()
+	return ads, nil
+}
+
+// MergeEntry folds one make, model or engine into another and deletes it.
+// Cars that would duplicate one the target already has are dropped, with
+// their ads moved onto the existing car; the rest are re-pointed. Ads fitted
+// to the merged entry are flagged for re-embedding; it returns how many.
+func MergeEntry(kind Kind, fromID, intoID int) (int, error) {
+	if !kind.IsValid() {
+		return 0, fmt.Errorf("unknown catalog kind %q", kind)
+	}
+	if fromID == intoID {
+		return 0, fmt.Errorf("can't merge a %s into itself", strings.ToLower(kind.Label()))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM "+kind.table()+" WHERE id IN (?, ?)", fromID, intoID).Scan(&found); err != nil {
+		return 0, err
+	}
+	if found != 2 {
+		return 0, ErrNotFound
+	}
+	fromName, err := entryName(tx, kind, fromID)
+	if err != nil {
+		return 0, err
+	}
+
+	ads, err := markAdsForReembedding(tx, kind, fromID)
+	if err != nil {
+		return 0, err
+	}
+
+	// A car on the merged entry whose twin already exists on the target
+	col := kind.column()
+	twin := `JOIN Car t ON t.` + col + ` = ?`
+	for _, c := range []string{"make_id", "year_id", "model_id", "engine_id"} {
+		if c != col {
+			twin += ` AND t.` + c + ` = c.` + c
+		}
+	}
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO AdCar (ad_id, car_id, fitment_group)
+		SELECT ac.ad_id, t.id, ac.fitment_group FROM AdCar ac
+		JOIN Car c ON c.id = ac.car_id `+twin+` WHERE c.`+col+` = ?`, intoID, fromID); err != nil {
+		return 0, err
+	}
+	duplicates := `SELECT c.id FROM Car c ` + twin + ` WHERE c.` + col + ` = ?`
+	if _, err := tx.Exec("DELETE FROM AdCar WHERE car_id IN ("+duplicates+")", intoID, fromID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM Car WHERE id IN ("+duplicates+")", intoID, fromID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE Car SET "+col+" = ? WHERE "+col+" = ?", intoID, fromID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM "+kind.table()+" WHERE id = ?", fromID); err != nil {
+		return 0, err
+	}
+	if err := recordReplacedName(tx, kind, fromName, fromID, intoID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	ClearVehicleCache()
+	return ads, nil
+}
+
+// entryName returns the current name of a make, model or engine
+func entryName(tx *sql.Tx, kind Kind, id int) (string, error) {
+	var name string
+	err := tx.QueryRow("SELECT name FROM "+kind.table()+" WHERE id = ?", id).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return name, err
+}
+
+// recordReplacedName remembers that an entry's old name now belongs to
+// another entry, or to the same one under a new name, so catalog imports
+// don't add it back. Names already replaced by the old entry follow it.
+func recordReplacedName(tx *sql.Tx, kind Kind, name string, fromID, intoID int) error {
+	if fromID != intoID {
+		if _, err := tx.Exec("UPDATE CatalogReplacedName SET entry_id = ? WHERE kind = ? AND entry_id = ?",
+			intoID, kind, fromID); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec("INSERT INTO CatalogReplacedName (kind, name, entry_id, created_at) VALUES (?, ?, ?, ?)",
+		kind, name, intoID, time.Now().UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// RetireEntry hides a make, model or engine from the vehicle pickers without
+// touching the ads already fitted to it, or brings it back
+func RetireEntry(kind Kind, id int, retired bool) error {
+	if !kind.IsValid() {
+		return fmt.Errorf("unknown catalog kind %q", kind)
+	}
+	var retiredAt interface{}
+	if retired {
+		retiredAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	res, err := db.Exec("UPDATE "+kind.table()+" SET retired_at = ? WHERE id = ?", retiredAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	ClearVehicleCache()
+	return nil
+}
+
+// AttachCar adds a make/year/model/engine combination to the catalog. The
+// make must exist; the year, model and engine are added if they're new. It
+// reports whether the car is new.
+func AttachCar(makeID, year int, modelName, engineName string) (bool, error) {
+	modelName, err := cleanName(KindModel, modelName)
+	if err != nil {
+		return false, err
+	}
+	engineName, err = cleanName(KindEngine, engineName)
+	if err != nil {
+		return false, err
+	}
+	if year < 1886 || year > time.Now().Year()+2 {
+		return false, fmt.Errorf("year %d is out of range", year)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var makeRetired bool
+	if err := tx.QueryRow("SELECT retired_at IS NOT NULL FROM Make WHERE id = ?", makeID).Scan(&makeRetired); err == sql.ErrNoRows {
+		return false, ErrNotFound
+	} else if err != nil {
+		return false, err
+	}
+	if makeRetired {
+		return false, ErrRetired
+	}
+
+	if _, err := tx.Exec("INSERT OR IGNORE INTO Year (year) VALUES (?)", year); err != nil {
+		return false, err
+	}
+	var yearID int
+	if err := tx.QueryRow("SELECT id FROM Year WHERE year = ?", year).Scan(&yearID); err != nil {
+		return false, err
+	}
+	modelID, err := getOrAddEntry(tx, KindModel, modelName)
+	if err != nil {
+		return false, err
+	}
+	engineID, err := getOrAddEntry(tx, KindEngine, engineName)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.Exec("INSERT OR IGNORE INTO Car (make_id, year_id, model_id, engine_id) VALUES (?, ?, ?, ?)",
+		makeID, yearID, modelID, engineID)
+	if err != nil {
+		return false, err
+	}
+	added, _ := res.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	if added > 0 {
+		ClearVehicleCache()
+	}
+	return added > 0, nil
+}
+
+// getOrAddEntry finds a model or engine by name, adding it if it's new.
+// Retired entries aren't reused.
+func getOrAddEntry(tx *sql.Tx, kind Kind, name string) (int, error) {
+	var id int
+	var retired bool
+	err := tx.QueryRow("SELECT id, retired_at IS NOT NULL FROM "+kind.table()+" WHERE name = ? ORDER BY id LIMIT 1", name).
+		Scan(&id, &retired)
+	if err == nil {
+		if retired {
+			return 0, fmt.Errorf("%s %q is retired", strings.ToLower(kind.Label()), name)
+		}
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	res, err := tx.Exec("INSERT INTO "+kind.table()+" (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := res.LastInsertId()
+	return int(newID), err
+}
+
+// GetParentCompanies lists every parent company
+func GetParentCompanies() ([]ParentCompany, error) {
+	var companies []ParentCompany
+	err := db.Select(&companies, "SELECT id, name, COALESCE(country, '') AS country FROM ParentCompany ORDER BY name")
+	return companies, err
+}
+
+// SetMakeParentCompany sets or, with nil, clears a make's parent company
+func SetMakeParentCompany(makeID int, parentCompanyID *int) error {
+	res, err := db.Exec("UPDATE Make SET parent_company_id = ? WHERE id = ?", parentCompanyID, makeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	ClearVehicleCache()
+	return nil
+}
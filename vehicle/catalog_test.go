@@ -0,0 +1,182 @@
+package vehicle
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/parts-pile/site/db/dbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKind(t *testing.T) {
+	assert.True(t, KindModel.IsValid())
+	assert.False(t, Kind("year").IsValid())
+	assert.Equal(t, "Engine", KindEngine.table())
+	assert.Equal(t, "engine_id", KindEngine.column())
+}
+
+func TestAddEntry_RefusesDuplicate(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectQuery("SELECT id FROM Model WHERE name = \\?").
+		WithArgs("Civic").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+	_, err := AddEntry(KindModel, "  Civic ")
+	assert.ErrorContains(t, err, "already exists")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddEntry_RequiresName(t *testing.T) {
+	_, err := AddEntry(KindMake, " ")
+	assert.ErrorContains(t, err, "make name is required")
+}
+
+func TestRenameEntry_FlagsAdsForReembedding(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM Make WHERE name = \\?").
+		WithArgs("Mercedes-Benz").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT name FROM Make WHERE id = \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Mercedes"))
+	mock.ExpectExec("UPDATE Make SET name = \\? WHERE id = \\?").
+		WithArgs("Mercedes-Benz", 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The old name is kept so catalog imports don't add it back
+	mock.ExpectExec("INSERT INTO CatalogReplacedName \\(kind, name, entry_id, created_at\\)").
+		WithArgs(KindMake, "Mercedes", 3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE Ad SET has_vector = 0, updated_at = \\?").
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	mock.ExpectCommit()
+
+	ads, err := RenameEntry(KindMake, 3, "Mercedes-Benz")
+	require.NoError(t, err)
+	assert.Equal(t, 12, ads)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRenameEntry_NameTaken(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM Engine WHERE name = \\?").
+		WithArgs("2.0L").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectRollback()
+
+	_, err := RenameEntry(KindEngine, 5, "2.0L")
+	assert.ErrorContains(t, err, "merge into it instead")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeEntry(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM Model WHERE id IN").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT name FROM Model WHERE id = \\?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Civic Hatchback"))
+	mock.ExpectExec("UPDATE Ad SET has_vector = 0").
+		WithArgs(sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec("INSERT OR IGNORE INTO AdCar .* JOIN Car t ON t.model_id = \\? AND t.make_id = c.make_id AND t.year_id = c.year_id AND t.engine_id = c.engine_id WHERE c.model_id = \\?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM AdCar WHERE car_id IN").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM Car WHERE id IN").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE Car SET model_id = \\? WHERE model_id = \\?").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec("DELETE FROM Model WHERE id = \\?").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE CatalogReplacedName SET entry_id = \\? WHERE kind = \\? AND entry_id = \\?").
+		WithArgs(1, KindModel, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO CatalogReplacedName").
+		WithArgs(KindModel, "Civic Hatchback", 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	ads, err := MergeEntry(KindModel, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, ads)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeEntry_Missing(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM Engine WHERE id IN").
+		WithArgs(2, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	_, err := MergeEntry(KindEngine, 2, 7)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetireEntry(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectExec("UPDATE Make SET retired_at = \\? WHERE id = \\?").
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE Make SET retired_at = \\? WHERE id = \\?").
+		WithArgs(nil, 4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, RetireEntry(KindMake, 3, true))
+	assert.ErrorIs(t, RetireEntry(KindMake, 4, false), ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAttachCar_RetiredMake(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT retired_at IS NOT NULL FROM Make WHERE id = \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"retired"}).AddRow(true))
+	mock.ExpectRollback()
+
+	_, err := AttachCar(3, 2020, "Civic", "1.5L")
+	assert.ErrorIs(t, err, ErrRetired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAttachCar_AddsNewModel(t *testing.T) {
+	mock := dbtest.Mock(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT retired_at IS NOT NULL FROM Make WHERE id = \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"retired"}).AddRow(false))
+	mock.ExpectExec("INSERT OR IGNORE INTO Year").WithArgs(2020).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id FROM Year WHERE year = \\?").
+		WithArgs(2020).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectQuery("SELECT id, retired_at IS NOT NULL FROM Model WHERE name = \\?").
+		WithArgs("Civic").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "retired"}))
+	mock.ExpectExec("INSERT INTO Model \\(name\\) VALUES").WithArgs("Civic").WillReturnResult(sqlmock.NewResult(21, 1))
+	mock.ExpectQuery("SELECT id, retired_at IS NOT NULL FROM Engine WHERE name = \\?").
+		WithArgs("1.5L").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "retired"}).AddRow(31, false))
+	mock.ExpectExec("INSERT OR IGNORE INTO Car").
+		WithArgs(3, 11, 21, 31).
+		WillReturnResult(sqlmock.NewResult(41, 1))
+	mock.ExpectCommit()
+
+	added, err := AttachCar(3, 2020, " Civic", "1.5L")
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -83,7 +83,7 @@ func GetMakes() []string {
 		return cached
 	}
 
-	query := "SELECT name FROM Make ORDER BY name"
+	query := "SELECT name FROM Make WHERE retired_at IS NULL ORDER BY name"
 	var makes []string
 	err := db.Select(&makes, query)
 	if err != nil {
@@ -104,7 +104,7 @@ func GetYears(makeName string) []string {
 	query := `SELECT DISTINCT Year.year FROM Car
 	JOIN Make ON Car.make_id = Make.id
 	JOIN Year ON Car.year_id = Year.id
-	WHERE Make.name = ? ORDER BY Year.year`
+	WHERE Make.name = ? AND Make.retired_at IS NULL ORDER BY Year.year`
 	var yearInts []int
 	err := db.Select(&yearInts, query, makeName)
 	if err != nil {
@@ -143,7 +143,8 @@ func GetModels(makeName string, years []string) []string {
 	JOIN Make ON Car.make_id = Make.id
 	JOIN Model ON Car.model_id = Model.id
 	JOIN Year ON Car.year_id = Year.id
-	WHERE Make.name = ? AND Year.year IN (` + strings.Join(yearPlaceholders, ",") + `) ORDER BY Model.name`
+	WHERE Make.name = ? AND Make.retired_at IS NULL AND Model.retired_at IS NULL
+	AND Year.year IN (` + strings.Join(yearPlaceholders, ",") + `) ORDER BY Model.name`
 
 	var models []string
 	err := db.Select(&models, query, args...)
@@ -185,7 +186,8 @@ func GetEngines(makeName string, years []string, models []string) []string {
 	JOIN Model ON Car.model_id = Model.id
 	JOIN Year ON Car.year_id = Year.id
 	JOIN Engine ON Car.engine_id = Engine.id
-	WHERE Make.name = ? AND Year.year IN (` + strings.Join(yearPlaceholders, ",") + `) AND Model.name IN (` + strings.Join(modelPlaceholders, ",") + `) ORDER BY Engine.name`
+	WHERE Make.name = ? AND Make.retired_at IS NULL AND Model.retired_at IS NULL AND Engine.retired_at IS NULL
+	AND Year.year IN (` + strings.Join(yearPlaceholders, ",") + `) AND Model.name IN (` + strings.Join(modelPlaceholders, ",") + `) ORDER BY Engine.name`
 
 	var engines []string
 	err := db.Select(&engines, query, args...)
@@ -523,13 +525,20 @@ func AddParentCompany(name, country string) (int, error) {
 		return 0, err
 	}
 	id, err := res.LastInsertId()
-	return int(id), err
+	if err != nil {
+		return 0, err
+	}
+	ClearVehicleCache()
+	return int(id), nil
 }
 
 // UpdateParentCompanyCountry updates the country for a parent company
 func UpdateParentCompanyCountry(id int, country string) error {
-	_, err := db.Exec("UPDATE ParentCompany SET country = ? WHERE id = ?", country, id)
-	return err
+	if _, err := db.Exec("UPDATE ParentCompany SET country = ? WHERE id = ?", country, id); err != nil {
+		return err
+	}
+	ClearVehicleCache()
+	return nil
 }
 
 // GetParentCompaniesForMake returns the parent company name for a given make
@@ -0,0 +1,479 @@
+// Package webhook tells users' own systems about events on their ads and
+// conversations. Deliveries are queued in the database and signed with the
+// endpoint's secret. Failed deliveries are retried with backoff, and the ones
+// that keep failing are kept as dead letters until the user resends them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/parts-pile/site/config"
+	"github.com/parts-pile/site/db"
+)
+
+// Event types users can subscribe to
+const (
+	// EventMessageCreated is sent to the recipient of a chat message
+	EventMessageCreated = "message.created"
+	// EventAdRocked is sent to the seller when someone throws a rock at
+	// their ad
+	EventAdRocked = "ad.rocked"
+	// EventAdBookmarked is sent to the seller when someone bookmarks their ad
+	EventAdBookmarked = "ad.bookmarked"
+	// EventOfferUpdated is sent to both sides of an offer when it's made,
+	// answered or expires
+	EventOfferUpdated = "offer.updated"
+	// EventAdExpired is sent to the seller when their ad is archived for
+	// reaching config.AdExpiry without being renewed
+	EventAdExpired = "ad.expired"
+)
+
+// Events lists every event type in the order they're offered
+var Events = []string{EventMessageCreated, EventAdRocked, EventAdBookmarked, EventOfferUpdated, EventAdExpired}
+
+// Headers sent with every delivery
+const (
+	HeaderEvent    = "X-PartsPile-Event"
+	HeaderDelivery = "X-PartsPile-Delivery"
+	// HeaderSignature holds "t=<unix seconds>,v1=<hex HMAC-SHA256>", the
+	// HMAC being of "<t>.<body>" keyed with the endpoint's secret
+	HeaderSignature = "X-PartsPile-Signature"
+)
+
+// secretPrefix starts every signing secret so they're easy to recognize
+const secretPrefix = "whsec_"
+
+// Status is where a delivery is in the queue
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSending   Status = "sending"
+	StatusDelivered Status = "delivered"
+	StatusDead      Status = "dead"
+)
+
+// ErrNotFound is returned for webhooks and deliveries the user doesn't have
+var ErrNotFound = errors.New("webhook not found")
+
+// Webhook is an endpoint a user registered for some event types
+type Webhook struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	URL       string    `db:"url"`
+	Secret    string    `db:"secret"`
+	Events    string    `db:"events"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// EventList returns the event types the webhook subscribes to
+func (w Webhook) EventList() []string {
+	return strings.Fields(w.Events)
+}
+
+// Subscribes returns true if the webhook wants the event type
+func (w Webhook) Subscribes(event string) bool {
+	return slices.Contains(w.EventList(), event)
+}
+
+// Delivery is one event queued for one webhook
+type Delivery struct {
+	ID             int        `db:"id"`
+	WebhookID      int        `db:"webhook_id"`
+	URL            string     `db:"url"`
+	Event          string     `db:"event"`
+	Status         Status     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	ResponseStatus *int       `db:"response_status"`
+	LastError      string     `db:"last_error"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+}
+
+// CanResend returns true if the delivery isn't already queued
+func (d Delivery) CanResend() bool {
+	return d.Status == StatusDelivered || d.Status == StatusDead
+}
+
+// payload is the body of every delivery
+type payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// normalizeEvents drops unknown and repeated event types, keeping them in
+// the usual order
+func normalizeEvents(events []string) []string {
+	var valid []string
+	for _, e := range Events {
+		if slices.Contains(events, e) {
+			valid = append(valid, e)
+		}
+	}
+	return valid
+}
+
+// ValidateURL checks an endpoint URL, which must be https
+func ValidateURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("Please enter a valid URL")
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("Webhook URLs must start with https://")
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("Webhook URLs can't contain a username or password")
+	}
+	return u.String(), nil
+}
+
+// Sign returns the signature header value for a body sent at the given time
+func Sign(secret string, at time.Time, body []byte) string {
+	t := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Create registers an endpoint for the user with a new signing secret
+func Create(userID int, rawURL string, events []string) (Webhook, error) {
+	endpoint, err := ValidateURL(rawURL)
+	if err != nil {
+		return Webhook{}, err
+	}
+	events = normalizeEvents(events)
+	if len(events) == 0 {
+		return Webhook{}, fmt.Errorf("Please choose at least one event")
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	w := Webhook{
+		UserID:    userID,
+		URL:       endpoint,
+		Secret:    secretPrefix + hex.EncodeToString(secret),
+		Events:    strings.Join(events, " "),
+		CreatedAt: time.Now().UTC(),
+	}
+	res, err := db.Exec(`INSERT INTO Webhook (user_id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)`,
+		w.UserID, w.URL, w.Secret, w.Events, w.CreatedAt.Format(time.RFC3339Nano))
+	if err != nil {
+		return Webhook{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Webhook{}, err
+	}
+	w.ID = int(id)
+	return w, nil
+}
+
+// GetWebhooksForUser returns the user's webhooks, newest first
+func GetWebhooksForUser(userID int) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := db.Select(&webhooks, `SELECT id, user_id, url, secret, events, created_at
+		FROM Webhook WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+	return webhooks, err
+}
+
+// CountWebhooks returns how many webhooks the user has
+func CountWebhooks(userID int) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM Webhook WHERE user_id = ?", userID).Scan(&n)
+	return n, err
+}
+
+// Delete removes one of the user's webhooks along with its deliveries
+func Delete(userID, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM Webhook WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM WebhookDelivery WHERE webhook_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Emit queues an event for every one of the user's webhooks that subscribes
+// to it. data is sent as the payload's data field.
+func Emit(userID int, event string, data any) error {
+	var webhooks []Webhook
+	err := db.Select(&webhooks, `SELECT w.id, w.events FROM Webhook w
+		JOIN User u ON u.id = w.user_id
+		WHERE w.user_id = ? AND u.deleted_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for _, w := range webhooks {
+		if w.Subscribes(event) {
+			ids = append(ids, w.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(payload{Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ts := now.Format(time.RFC3339Nano)
+	for _, id := range ids {
+		_, err := tx.Exec(`INSERT INTO WebhookDelivery (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, id, event, string(body), StatusPending, ts, ts, ts)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRecentDeliveries returns the user's latest deliveries across all their
+// webhooks, newest first
+func GetRecentDeliveries(userID, limit int) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := db.Select(&deliveries, `SELECT d.id, d.webhook_id, w.url, d.event, d.status, d.attempts,
+			d.response_status, d.last_error, d.next_attempt_at, d.created_at, d.delivered_at
+		FROM WebhookDelivery d JOIN Webhook w ON w.id = d.webhook_id
+		WHERE w.user_id = ? ORDER BY d.id DESC LIMIT ?`, userID, limit)
+	return deliveries, err
+}
+
+// Resend queues one of the user's delivered or dead deliveries again, with
+// a fresh set of attempts
+func Resend(userID, id int) error {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	res, err := db.Exec(`UPDATE WebhookDelivery SET status = ?, attempts = 0, last_error = '', next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND status IN (?, ?) AND webhook_id IN (SELECT id FROM Webhook WHERE user_id = ?)`,
+		StatusPending, now, now, id, StatusDelivered, StatusDead, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// dialPublic refuses connections to loopback, private and link-local
+// addresses, so webhooks can't be used to reach the site's own network
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("refusing to connect to %s", host)
+	}
+	return nil
+}
+
+// client sends deliveries. Redirects aren't followed: endpoints must answer
+// at the URL they registered.
+var client = &http.Client{
+	Timeout: config.WebhookTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: config.WebhookTimeout, Control: dialPublic}).DialContext,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// deliveryError is a failed attempt, with the endpoint's status code when
+// it answered
+type deliveryError struct {
+	status int
+	err    error
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+// send posts a delivery's payload to its endpoint
+func send(id int, event, endpoint, secret string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return &deliveryError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PartsPile-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(id))
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &deliveryError{err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &deliveryError{status: resp.StatusCode, err: fmt.Errorf("endpoint answered %s", resp.Status)}
+	}
+	return nil
+}
+
+// ProcessNext sends the oldest delivery that is due. It returns false when
+// there was nothing to do.
+func ProcessNext() (bool, error) {
+	now := time.Now().UTC()
+	var (
+		id, attempts                  int
+		event, body, endpoint, secret string
+	)
+	err := db.QueryRow(`SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM WebhookDelivery d JOIN Webhook w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.id LIMIT 1`,
+		StatusPending, now.Format(time.RFC3339Nano)).Scan(&id, &event, &body, &attempts, &endpoint, &secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	res, err := db.Exec("UPDATE WebhookDelivery SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND status = ?",
+		StatusSending, now.Format(time.RFC3339Nano), id, StatusPending)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Claimed by someone else in the meantime
+		return true, nil
+	}
+	attempts++
+
+	if err := send(id, event, endpoint, secret, []byte(body)); err != nil {
+		return true, fail(id, endpoint, attempts, err)
+	}
+	done := time.Now().UTC().Format(time.RFC3339Nano)
+	_, err = db.Exec(`UPDATE WebhookDelivery SET status = ?, response_status = NULL, last_error = '', delivered_at = ?, updated_at = ?
+		WHERE id = ?`, StatusDelivered, done, done, id)
+	return true, err
+}
+
+// fail schedules a retry with exponential backoff, or dead-letters the
+// delivery once it has used up its attempts
+func fail(id int, endpoint string, attempts int, err error) error {
+	log.Printf("[webhook] Delivery %d to %s failed (attempt %d): %v", id, endpoint, attempts, err)
+
+	var status sql.NullInt64
+	var derr *deliveryError
+	if errors.As(err, &derr) && derr.status != 0 {
+		status = sql.NullInt64{Int64: int64(derr.status), Valid: true}
+	}
+	msg := err.Error()
+	if len(msg) > 200 {
+		msg = msg[:200]
+	}
+	now := time.Now().UTC()
+
+	if attempts >= config.WebhookMaxAttempts {
+		_, err := db.Exec("UPDATE WebhookDelivery SET status = ?, response_status = ?, last_error = ?, updated_at = ? WHERE id = ?",
+			StatusDead, status, msg, now.Format(time.RFC3339Nano), id)
+		return err
+	}
+	next := now.Add(config.WebhookRetryDelay << (attempts - 1))
+	_, err = db.Exec(`UPDATE WebhookDelivery SET status = ?, response_status = ?, last_error = ?, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?`, StatusPending, status, msg, next.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano), id)
+	return err
+}
+
+// ProcessPending sends every delivery that is due, config.WebhookWorkers at
+// a time, and returns how many it sent or retried
+func ProcessPending() (int, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		n        int
+		firstErr error
+	)
+	for i := 0; i < config.WebhookWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				ok, err := ProcessNext()
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if err == nil && ok {
+					n++
+				}
+				mu.Unlock()
+				if err != nil || !ok {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return n, firstErr
+}
+
+// StartProcessor sends queued deliveries in the background. Deliveries left
+// sending by a previous run are sent again.
+func StartProcessor() {
+	if _, err := db.Exec("UPDATE WebhookDelivery SET status = ? WHERE status = ?", StatusPending, StatusSending); err != nil {
+		log.Printf("[webhook] Failed to resume interrupted deliveries: %v", err)
+	}
+	go func() {
+		log.Printf("[webhook] Webhook processor started")
+		ticker := time.NewTicker(config.WebhookPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := ProcessPending(); err != nil {
+				log.Printf("[webhook] Failed to send webhook deliveries: %v", err)
+			}
+		}
+	}()
+}